@@ -0,0 +1,101 @@
+// Package buzhash implements content-defined chunking with a Buzhash
+// rolling hash: a boundary is placed after a byte when the hash of the
+// window of bytes ending there has its low bits cleared.
+package buzhash
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/PlakarKorp/plakar/chunking"
+	chunkers "github.com/PlakarLabs/go-cdc-chunkers"
+)
+
+func init() {
+	chunking.Register("BUZHASH", New)
+}
+
+// windowSize is the number of bytes the rolling hash covers.
+const windowSize = 48
+
+var errMinSize = errors.New("MinSize is required and must be 64B <= MinSize <= 1GB && MinSize < NormalSize")
+var errNormalSize = errors.New("NormalSize is required and must be 64B <= NormalSize <= 1GB")
+var errMaxSize = errors.New("MaxSize is required and must be 64B <= MaxSize <= 1GB && MaxSize > NormalSize")
+
+// table maps each byte to a pseudo-random value. It is derived from a
+// fixed seed and must never change: chunk boundaries, and thus the
+// deduplication against existing snapshots, depend on it.
+var table [256]uint32
+
+func init() {
+	// splitmix64
+	state := uint64(0x706c616b6172) // "plakar"
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = uint32(z ^ (z >> 31))
+	}
+}
+
+type Buzhash struct {
+}
+
+func New() chunkers.ChunkerImplementation {
+	return &Buzhash{}
+}
+
+func (c *Buzhash) DefaultOptions() *chunkers.ChunkerOpts {
+	return &chunkers.ChunkerOpts{
+		MinSize:    2 * 1024,
+		MaxSize:    64 * 1024,
+		NormalSize: 8 * 1024,
+	}
+}
+
+func (c *Buzhash) Validate(options *chunkers.ChunkerOpts) error {
+	if options.NormalSize < 64 || options.NormalSize > 1024*1024*1024 {
+		return errNormalSize
+	}
+	if options.MinSize < 64 || options.MinSize > 1024*1024*1024 || options.MinSize >= options.NormalSize {
+		return errMinSize
+	}
+	if options.MaxSize < 64 || options.MaxSize > 1024*1024*1024 || options.MaxSize <= options.NormalSize {
+		return errMaxSize
+	}
+	return nil
+}
+
+// mask has as many bits as needed for chunks to average NormalSize: a
+// boundary is searched for past MinSize and found every 2^bits bytes.
+func mask(options *chunkers.ChunkerOpts) uint32 {
+	return uint32(1)<<(bits.Len(uint(options.NormalSize-options.MinSize))-1) - 1
+}
+
+func (c *Buzhash) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int) int {
+	switch {
+	case n <= options.MinSize:
+		return n
+	case n >= options.MaxSize:
+		n = options.MaxSize
+	}
+
+	m := mask(options)
+	var hash uint32
+	for _, b := range data[options.MinSize-windowSize : options.MinSize] {
+		hash = bits.RotateLeft32(hash, 1) ^ table[b]
+	}
+	if hash&m == 0 {
+		return options.MinSize
+	}
+	for i := options.MinSize; i < n; i++ {
+		hash = bits.RotateLeft32(hash, 1) ^
+			bits.RotateLeft32(table[data[i-windowSize]], windowSize%32) ^
+			table[data[i]]
+		if hash&m == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
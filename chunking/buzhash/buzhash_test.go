@@ -0,0 +1,74 @@
+package buzhash
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/chunking"
+	chunkers "github.com/PlakarLabs/go-cdc-chunkers"
+)
+
+// boundaries returns the offsets at which data is cut.
+func boundaries(t *testing.T, configuration *chunking.Configuration, data []byte) []int {
+	t.Helper()
+	chunker, err := chunking.NewChunker(configuration, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets []int
+	err = chunker.Split(func(offset, length uint, chunk []byte) error {
+		offsets = append(offsets, int(offset+length))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offsets
+}
+
+func TestBoundaries(t *testing.T) {
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	configuration := &chunking.Configuration{Algorithm: "BUZHASH", MinSize: 512, NormalSize: 2048, MaxSize: 8192}
+
+	// changing these breaks the deduplication against the chunks
+	// stored by previous versions
+	expected := []int{1890, 3553, 4658, 5716, 6231, 7820, 9085, 10665, 15191, 15721,
+		16513, 17336, 19852, 20863, 24956, 27196, 28403, 29255, 31184, 31812, 32769,
+		33673, 35669, 37681, 39226, 40113, 41097, 45206, 45861, 48831, 50559, 52788,
+		54160, 54768, 55333, 55951, 58531, 59995, 61753, 62849, 63469, 64467, 65536}
+
+	offsets := boundaries(t, configuration, data)
+	if len(offsets) != len(expected) {
+		t.Fatalf("expected %d chunks, got %d: %v", len(expected), len(offsets), offsets)
+	}
+	previous := 0
+	for i, offset := range offsets {
+		if offset != expected[i] {
+			t.Fatalf("chunk %d: expected a boundary at %d, got %d", i, expected[i], offset)
+		}
+		size := offset - previous
+		if size > int(configuration.MaxSize) || (size < int(configuration.MinSize) && offset != len(data)) {
+			t.Errorf("chunk %d: size %d out of bounds", i, size)
+		}
+		previous = offset
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		options chunkers.ChunkerOpts
+		valid   bool
+	}{
+		{chunkers.ChunkerOpts{MinSize: 64 * 1024, NormalSize: 1024 * 1024, MaxSize: 4 * 1024 * 1024}, true},
+		{*New().DefaultOptions(), true},
+		{chunkers.ChunkerOpts{MinSize: 32, NormalSize: 1024, MaxSize: 4096}, false},
+		{chunkers.ChunkerOpts{MinSize: 1024, NormalSize: 1024, MaxSize: 4096}, false},
+		{chunkers.ChunkerOpts{MinSize: 512, NormalSize: 4096, MaxSize: 4096}, false},
+	} {
+		if err := New().Validate(&test.options); (err == nil) != test.valid {
+			t.Errorf("%+v: expected valid to be %v, got %v", test.options, test.valid, err)
+		}
+	}
+}
@@ -1,5 +1,18 @@
 package chunking
 
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	chunkers "github.com/PlakarLabs/go-cdc-chunkers"
+	"github.com/PlakarLabs/go-cdc-chunkers/chunkers/fastcdc"
+	"github.com/PlakarLabs/go-cdc-chunkers/chunkers/ultracdc"
+)
+
 type Configuration struct {
 	Algorithm  string // Content-defined chunking algorithm (e.g., "rolling-hash", "fastcdc")
 	MinSize    uint32 // Minimum chunk size
@@ -7,6 +20,58 @@ type Configuration struct {
 	MaxSize    uint32 // Maximum chunk size
 }
 
+var muAlgorithms sync.Mutex
+var algorithms map[string]func() chunkers.ChunkerImplementation = make(map[string]func() chunkers.ChunkerImplementation)
+
+func init() {
+	// go-cdc-chunkers registers the algorithms it ships itself
+	algorithms["FASTCDC"] = func() chunkers.ChunkerImplementation { return &fastcdc.FastCDC{} }
+	algorithms["ULTRACDC"] = func() chunkers.ChunkerImplementation { return &ultracdc.UltraCDC{} }
+
+	Register("FIXED", newFixed)
+}
+
+// Register makes a content-defined chunking algorithm available under
+// name, which is what repositories record in their configuration.
+func Register(name string, implementation func() chunkers.ChunkerImplementation) {
+	muAlgorithms.Lock()
+	defer muAlgorithms.Unlock()
+
+	if _, ok := algorithms[name]; ok {
+		log.Fatalf("chunking algorithm '%s' registered twice", name)
+	}
+	algorithms[name] = implementation
+
+	// go-cdc-chunkers does the splitting and looks algorithms up by
+	// their lowercase name, it must not know another one by that name.
+	if err := chunkers.Register(strings.ToLower(name), implementation); err != nil {
+		log.Fatalf("chunking algorithm '%s': %s", name, err)
+	}
+}
+
+func Algorithms() []string {
+	muAlgorithms.Lock()
+	defer muAlgorithms.Unlock()
+
+	ret := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func lookup(algorithm string) (func() chunkers.ChunkerImplementation, error) {
+	muAlgorithms.Lock()
+	defer muAlgorithms.Unlock()
+
+	implementation, ok := algorithms[strings.ToUpper(algorithm)]
+	if !ok {
+		return nil, fmt.Errorf("unknown chunking algorithm: %s", algorithm)
+	}
+	return implementation, nil
+}
+
 func DefaultConfiguration() *Configuration {
 	return &Configuration{
 		Algorithm:  "FASTCDC",
@@ -15,3 +80,47 @@ func DefaultConfiguration() *Configuration {
 		MaxSize:    4 * 1024 * 1024,
 	}
 }
+
+// LookupDefaultConfiguration returns the default chunk sizes for the
+// given algorithm.
+func LookupDefaultConfiguration(algorithm string) (*Configuration, error) {
+	configuration := DefaultConfiguration()
+	configuration.Algorithm = strings.ToUpper(algorithm)
+	if err := configuration.Validate(); err != nil {
+		return nil, err
+	}
+	return configuration, nil
+}
+
+func (configuration *Configuration) options() *chunkers.ChunkerOpts {
+	return &chunkers.ChunkerOpts{
+		MinSize:    int(configuration.MinSize),
+		NormalSize: int(configuration.NormalSize),
+		MaxSize:    int(configuration.MaxSize),
+	}
+}
+
+// Validate checks that the algorithm is known and accepts the chunk
+// sizes of the configuration.
+func (configuration *Configuration) Validate() error {
+	implementation, err := lookup(configuration.Algorithm)
+	if err != nil {
+		return err
+	}
+	if configuration.MinSize > configuration.NormalSize || configuration.NormalSize > configuration.MaxSize {
+		return fmt.Errorf("chunk sizes must be ordered min <= normal <= max, got %d, %d and %d",
+			configuration.MinSize, configuration.NormalSize, configuration.MaxSize)
+	}
+	if err := implementation().Validate(configuration.options()); err != nil {
+		return fmt.Errorf("%s: %w", strings.ToLower(configuration.Algorithm), err)
+	}
+	return nil
+}
+
+// NewChunker returns a chunker splitting rd as the configuration says.
+func NewChunker(configuration *Configuration, rd io.Reader) (*chunkers.Chunker, error) {
+	if err := configuration.Validate(); err != nil {
+		return nil, err
+	}
+	return chunkers.NewChunker(strings.ToLower(configuration.Algorithm), rd, configuration.options())
+}
@@ -1,6 +1,9 @@
 package chunking
 
 import (
+	"bytes"
+	"math/rand"
+	"strings"
 	"testing"
 
 	chunkers "github.com/PlakarLabs/go-cdc-chunkers"
@@ -34,3 +37,112 @@ func TestDefaultConfiguration(t *testing.T) {
 		t.Errorf("DefaultConfiguration MaxSize failed: expected %v, got %v", expected.MaxSize, result.MaxSize)
 	}
 }
+
+func TestLookupDefaultConfiguration(t *testing.T) {
+	for _, algorithm := range Algorithms() {
+		configuration, err := LookupDefaultConfiguration(strings.ToLower(algorithm))
+		if err != nil {
+			t.Fatalf("%s: %s", algorithm, err)
+		}
+		if configuration.Algorithm != algorithm {
+			t.Errorf("expected algorithm %s, got %s", algorithm, configuration.Algorithm)
+		}
+	}
+	if _, err := LookupDefaultConfiguration("UNKNOWN"); err == nil {
+		t.Error("an unknown algorithm was accepted")
+	}
+
+	configuration := DefaultConfiguration()
+	configuration.MinSize = configuration.MaxSize
+	if _, err := NewChunker(configuration, bytes.NewReader(nil)); err == nil {
+		t.Error("invalid chunk sizes were accepted")
+	}
+}
+
+// split returns the chunks data is cut into.
+func split(t *testing.T, configuration *Configuration, data []byte) []string {
+	t.Helper()
+	chunker, err := NewChunker(configuration, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks []string
+	err = chunker.Split(func(offset, length uint, chunk []byte) error {
+		chunks = append(chunks, string(chunk))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chunks
+}
+
+func TestStableBoundaries(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+	shifted := append([]byte("some bytes inserted at the start"), data...)
+
+	for _, algorithm := range Algorithms() {
+		configuration := &Configuration{Algorithm: algorithm, MinSize: 2 * 1024, NormalSize: 8 * 1024, MaxSize: 64 * 1024}
+
+		chunks := split(t, configuration, data)
+		if strings.Join(chunks, "") != string(data) {
+			t.Fatalf("%s: the chunks don't add up to the input", algorithm)
+		}
+		if len(chunks) < 2 {
+			t.Fatalf("%s: expected the input to be split, got %d chunks", algorithm, len(chunks))
+		}
+		again := split(t, configuration, data)
+		if len(again) != len(chunks) {
+			t.Fatalf("%s: expected %d chunks, got %d", algorithm, len(chunks), len(again))
+		}
+		for i := range chunks {
+			if chunks[i] != again[i] {
+				t.Fatalf("%s: chunk %d differs between runs", algorithm, i)
+			}
+		}
+
+		// content-defined boundaries resynchronize after an insertion
+		if algorithm == "FIXED" {
+			continue
+		}
+		known := make(map[string]struct{})
+		for _, chunk := range chunks {
+			known[chunk] = struct{}{}
+		}
+		shared := 0
+		for _, chunk := range split(t, configuration, shifted) {
+			if _, ok := known[chunk]; ok {
+				shared++
+			}
+		}
+		if shared < len(chunks)*9/10 {
+			t.Errorf("%s: only %d of %d chunks survived an insertion", algorithm, shared, len(chunks))
+		}
+	}
+}
+
+func TestFixed(t *testing.T) {
+	data := make([]byte, 10*1024+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	configuration := &Configuration{Algorithm: "FIXED", MinSize: 64, NormalSize: 1024, MaxSize: 1024}
+
+	for run := 0; run < 3; run++ {
+		chunks := split(t, configuration, data)
+		if len(chunks) != 11 {
+			t.Fatalf("expected 11 chunks, got %d", len(chunks))
+		}
+		for i, chunk := range chunks {
+			expected := data[i*1024 : min((i+1)*1024, len(data))]
+			if chunk != string(expected) {
+				t.Fatalf("chunk %d: expected bytes %d to %d", i, i*1024, i*1024+len(expected))
+			}
+		}
+	}
+
+	// a last chunk smaller than MinSize is kept
+	data = data[:2*1024+10]
+	if chunks := split(t, configuration, data); len(chunks) != 3 || len(chunks[2]) != 10 {
+		t.Fatalf("unexpected chunks for %d bytes: %d", len(data), len(chunks))
+	}
+}
@@ -0,0 +1,46 @@
+package chunking
+
+import (
+	"errors"
+
+	chunkers "github.com/PlakarLabs/go-cdc-chunkers"
+)
+
+var errFixedNormalSize = errors.New("NormalSize is required and must be 64B <= NormalSize <= 1GB")
+var errFixedMaxSize = errors.New("MaxSize must be >= NormalSize")
+
+// Fixed cuts the input every NormalSize bytes regardless of its content.
+// Inserting data shifts every following boundary so it deduplicates
+// poorly, but the chunks are predictable which helps with structured
+// data and tests.
+type Fixed struct {
+}
+
+func newFixed() chunkers.ChunkerImplementation {
+	return &Fixed{}
+}
+
+func (c *Fixed) DefaultOptions() *chunkers.ChunkerOpts {
+	return &chunkers.ChunkerOpts{
+		MinSize:    64 * 1024,
+		NormalSize: 1024 * 1024,
+		MaxSize:    4 * 1024 * 1024,
+	}
+}
+
+func (c *Fixed) Validate(options *chunkers.ChunkerOpts) error {
+	if options.NormalSize < 64 || options.NormalSize > 1024*1024*1024 {
+		return errFixedNormalSize
+	}
+	if options.MaxSize < options.NormalSize {
+		return errFixedMaxSize
+	}
+	return nil
+}
+
+func (c *Fixed) Algorithm(options *chunkers.ChunkerOpts, data []byte, n int) int {
+	if n > options.NormalSize {
+		return options.NormalSize
+	}
+	return n
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -34,9 +35,13 @@ import (
 	_ "github.com/PlakarKorp/plakar/storage/backends/plakard"
 	_ "github.com/PlakarKorp/plakar/storage/backends/s3"
 
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/dump"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/ftp"
 	_ "github.com/PlakarKorp/plakar/snapshot/importer/s3"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/sftp"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/stdin"
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/tar"
 
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
 	_ "github.com/PlakarKorp/plakar/snapshot/exporter/s3"
@@ -94,11 +99,17 @@ func entryPoint() int {
 	var opt_time bool
 	var opt_trace string
 	var opt_quiet bool
+	var opt_logLevel string
+	var opt_logFormat string
 	var opt_profiling bool
 	var opt_keyfile string
 	var opt_keyring string
 	var opt_stats int
 	var opt_identity string
+	var opt_passphraseFd int
+	var opt_passphraseCommand string
+	var opt_packfileCache string
+	var opt_packfileCacheSize string
 
 	flag.StringVar(&opt_configfile, "config", opt_configDefault, "configuration file")
 	flag.IntVar(&opt_cpuCount, "cpu", opt_cpuDefault, "limit the number of usable cores")
@@ -107,13 +118,19 @@ func entryPoint() int {
 	flag.StringVar(&opt_cpuProfile, "profile-cpu", "", "profile CPU usage")
 	flag.StringVar(&opt_memProfile, "profile-mem", "", "profile MEM usage")
 	flag.BoolVar(&opt_time, "time", false, "display command execution time")
-	flag.StringVar(&opt_trace, "trace", "", "display trace logs")
+	flag.StringVar(&opt_trace, "trace", "", "display the trace logs of the comma-separated components, or all")
 	flag.BoolVar(&opt_quiet, "quiet", false, "no output except errors")
+	flag.StringVar(&opt_logLevel, "log-level", "", "log level: error, warn, info or debug")
+	flag.StringVar(&opt_logFormat, "log-format", "text", "log format: text or json")
 	flag.BoolVar(&opt_profiling, "profiling", false, "display profiling logs")
-	flag.StringVar(&opt_keyfile, "keyfile", "", "use passphrase from key file when prompted")
+	flag.StringVar(&opt_keyfile, "keyfile", "", "use passphrase, or private key of keypair repositories, from key file")
 	flag.StringVar(&opt_keyring, "keyring", "", "path to directory holding the keyring")
 	flag.StringVar(&opt_identity, "identity", "", "use identity from keyring")
 	flag.IntVar(&opt_stats, "stats", 0, "display statistics")
+	flag.IntVar(&opt_passphraseFd, "passphrase-fd", -1, "read the repository passphrase from the given file descriptor")
+	flag.StringVar(&opt_passphraseCommand, "passphrase-command", "", "use the output of the given command as repository passphrase")
+	flag.StringVar(&opt_packfileCache, "packfile-cache", "", "keep the packfiles read from the repository in the given directory")
+	flag.StringVar(&opt_packfileCacheSize, "packfile-cache-size", "1GB", "maximum size of the packfile cache")
 	flag.Parse()
 
 	ctx := context.NewContext()
@@ -121,7 +138,10 @@ func entryPoint() int {
 
 	ctx.SetCWD(cwd)
 
-	keyringDir := filepath.Join(opt_userDefault.HomeDir, ".plakar-keyring")
+	keyringDir := opt_keyring
+	if keyringDir == "" {
+		keyringDir = filepath.Join(opt_userDefault.HomeDir, ".plakar-keyring")
+	}
 	ctx.SetKeyringDir(keyringDir)
 
 	if opt_identity != "" {
@@ -181,7 +201,7 @@ func entryPoint() int {
 
 	var secretFromKeyfile string
 	if opt_keyfile != "" {
-		data, err := os.ReadFile(opt_keyfile)
+		data, err := encryption.ReadKeyfile(opt_keyfile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s: could not read key file: %s\n", flag.CommandLine.Name(), err)
 			return 1
@@ -212,7 +232,20 @@ func entryPoint() int {
 	}
 
 	// start logging
-	if !opt_quiet {
+	logFormat, err := logger.ParseFormat(opt_logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+		return 1
+	}
+	logger.SetFormat(logFormat)
+	if opt_logLevel != "" {
+		logLevel, err := logger.ParseLevel(opt_logLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+			return 1
+		}
+		logger.SetLevel(logLevel)
+	} else if !opt_quiet {
 		logger.EnableInfo()
 	}
 	if opt_trace != "" {
@@ -243,7 +276,7 @@ func entryPoint() int {
 	}
 
 	// these commands need to be ran before the repository is opened
-	if command == "create" || command == "version" || command == "stdio" || command == "help" || command == "identity" {
+	if command == "create" || command == "version" || command == "stdio" || command == "help" || command == "identity" || command == "keygen" || command == "passwd" {
 		retval, err := subcommands.Execute(ctx, nil, command, args)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
@@ -264,28 +297,88 @@ func entryPoint() int {
 		return 1
 	}
 
-	if store.Configuration().Version != storage.VERSION {
-		fmt.Fprintf(os.Stderr, "%s: incompatible repository version: %s != %s\n",
+	if opt_packfileCache != "" {
+		maxBytes, err := humanize.ParseBytes(opt_packfileCacheSize)
+		if err != nil || maxBytes == 0 {
+			fmt.Fprintf(os.Stderr, "%s: invalid packfile cache size: %s\n", flag.CommandLine.Name(), opt_packfileCacheSize)
+			return 1
+		}
+		cache, err := storage.OpenDiskCache(opt_packfileCache, maxBytes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+			return 1
+		}
+		store.SetDiskCache(cache)
+	}
+
+	// older repositories must be migrated first, newer ones can only be
+	// read as the store refuses to write to them
+	if cmp, err := storage.CompareVersions(store.Configuration().Version, storage.VERSION); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+		return 1
+	} else if cmp < 0 && command != "migrate" {
+		fmt.Fprintf(os.Stderr, "%s: repository version %s is older than %s, run \"plakar migrate\" to upgrade it\n",
 			flag.CommandLine.Name(), store.Configuration().Version, storage.VERSION)
 		return 1
 	}
 
+	// a passphrase passed on a file descriptor or by a command takes
+	// precedence over the environment, none is prompted for again on
+	// mismatch
+	presetPassphrase := os.Getenv("PLAKAR_PASSPHRASE")
+	if opt_passphraseFd != -1 && !skipPassphrase {
+		passphrase, err := utils.GetPassphraseFromFd(opt_passphraseFd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+			return 1
+		}
+		presetPassphrase = string(passphrase)
+	} else if opt_passphraseCommand != "" && !skipPassphrase && store.Configuration().Encryption != nil {
+		passphrase, err := utils.GetPassphraseFromCommand(opt_passphraseCommand, utils.PassphraseCommandTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flag.CommandLine.Name(), err)
+			return 1
+		}
+		presetPassphrase = string(passphrase)
+	}
+
 	var secret []byte
 	if !skipPassphrase {
-		if store.Configuration().Encryption != nil {
-			envPassphrase := os.Getenv("PLAKAR_PASSPHRASE")
+		if store.Configuration().Encryption != nil && store.Configuration().Encryption.PublicKey != "" {
+			// keypair repositories take the private key from the key file,
+			// either as plain PEM or sealed by keygen, and are opened
+			// write-only without it.
+			if ctx.GetKeyFromFile() != "" {
+				secret = []byte(ctx.GetKeyFromFile())
+			}
+			if encryption.IsKeyfile(secret) {
+				var passphrase []byte
+				if presetPassphrase != "" {
+					passphrase = []byte(presetPassphrase)
+				} else if passphrase, err = utils.GetPassphrase("key"); err != nil {
+					fmt.Fprintf(os.Stderr, "%s\n", err)
+					os.Exit(1)
+				}
+				keyfile, err := encryption.Keyload(secret, passphrase)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s\n", err)
+					os.Exit(1)
+				}
+				secret = keyfile.PrivateKeyPEM()
+			}
+		} else if store.Configuration().Encryption != nil {
 			if ctx.GetKeyFromFile() == "" {
 				attempts := 0
 				for {
 					var passphrase []byte
-					if envPassphrase == "" {
+					if presetPassphrase == "" {
 						passphrase, err = utils.GetPassphrase("repository")
 						if err != nil {
 							fmt.Fprintf(os.Stderr, "%s\n", err)
 							continue
 						}
 					} else {
-						passphrase = []byte(envPassphrase)
+						passphrase = []byte(presetPassphrase)
 					}
 
 					secret, err = encryption.DeriveSecret(passphrase, store.Configuration().Encryption.Key)
@@ -293,7 +386,8 @@ func entryPoint() int {
 						fmt.Fprintf(os.Stderr, "%s\n", err)
 						attempts++
 
-						if envPassphrase != "" {
+						// only a wrong passphrase is worth asking again
+						if presetPassphrase != "" || !errors.Is(err, encryption.ErrWrongPassphrase) {
 							os.Exit(1)
 						}
 						continue
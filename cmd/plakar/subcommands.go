@@ -8,21 +8,32 @@ import (
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/checksum"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/cleanup"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/clone"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/copy"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/create"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/diff"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/exec"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/find"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/fsck"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/gc"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/identity"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/info"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/keygen"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ls"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/man"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/migrate"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/mount"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/passwd"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/restore"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/restoreobject"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/rm"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/serve"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/server"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/stats"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/stdio"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/sync"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/tag"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/tags"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/ui"
+	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/untag"
 	_ "github.com/PlakarKorp/plakar/cmd/plakar/subcommands/version"
 )
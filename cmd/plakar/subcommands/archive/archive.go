@@ -32,6 +32,7 @@ import (
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
@@ -122,14 +123,32 @@ func cmd_archive(ctx *context.Context, repo *repository.Repository, args []strin
 	return 0
 }
 
+// pathnames returns the pathnames below root in a stable order so that
+// archiving a snapshot twice produces the same archive.
+func pathnames(fs *vfs.Filesystem, root string) ([]string, error) {
+	if root == "" {
+		root = "/"
+	}
+	ret := make([]string, 0)
+	err := fs.WalkSorted(root, func(pathname string, fileinfo *objects.FileInfo) error {
+		ret = append(ret, pathname)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
 func archiveTarball(snap *snapshot.Snapshot, out io.Writer, fs *vfs.Filesystem, path string, rebase bool) error {
 	tarWriter := tar.NewWriter(out)
 	defer tarWriter.Close()
 
-	for file := range fs.Pathnames() {
-		if path != "" && !utils.PathIsWithin(file, path) {
-			continue
-		}
+	files, err := pathnames(fs, path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
 
 		info, err := fs.Stat(file)
 		if err != nil {
@@ -195,51 +214,91 @@ func archiveZip(snap *snapshot.Snapshot, out io.Writer, fs *vfs.Filesystem, path
 	zipWriter := zip.NewWriter(out)
 	defer zipWriter.Close()
 
-	for file := range fs.Pathnames() {
+	files, err := pathnames(fs, path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
 
-		if path != "" {
-			if !utils.PathIsWithin(file, path) {
-				continue
-			}
+		info, err := fs.Stat(file)
+		if err != nil {
+			logger.Error("could not stat file %s: %s", file, err)
+			continue
 		}
-		info, _ := fs.Stat(file)
+
 		filepath := file
 		if rebase {
 			filepath = strings.TrimPrefix(filepath, path)
 		}
-
-		if _, isDir := info.(*vfs.DirEntry); isDir {
+		filepath = strings.TrimLeft(filepath, "/")
+		if filepath == "" {
 			continue
 		}
 
-		header, err := zip.FileInfoHeader(info.(*vfs.FileEntry).Stat())
-		if err != nil {
-			log.Printf("could not create header for file %s: %s", file, err)
-			continue
-		}
-		header.Name = strings.TrimLeft(filepath, "/")
-		header.Method = zip.Deflate
+		switch entry := info.(type) {
+		case *vfs.DirEntry:
+			header, err := zip.FileInfoHeader(entry.Stat())
+			if err != nil {
+				logger.Error("could not create header for directory %s: %s", file, err)
+				continue
+			}
+			header.Name = filepath + "/"
+			if _, err := zipWriter.CreateHeader(header); err != nil {
+				logger.Error("could not create zip entry for directory %s: %s", file, err)
+			}
 
-		rd, err := snap.NewReader(file)
-		if err != nil {
-			log.Printf("could not find file %s", file)
-			continue
-		}
+		case *vfs.FileEntry:
+			header, err := zip.FileInfoHeader(entry.Stat())
+			if err != nil {
+				logger.Error("could not create header for file %s: %s", file, err)
+				continue
+			}
+			header.Name = filepath
+
+			// symlinks follow the Info-ZIP convention: the unix mode is
+			// kept in the external attributes and the target is stored
+			// as the entry content.
+			if entry.Stat().Mode()&os.ModeSymlink != 0 {
+				header.Method = zip.Store
+				writer, err := zipWriter.CreateHeader(header)
+				if err != nil {
+					logger.Error("could not create zip entry for symlink %s: %s", file, err)
+					continue
+				}
+				if _, err := io.WriteString(writer, entry.SymlinkTarget); err != nil {
+					logger.Error("could not write symlink %s: %s", file, err)
+					return err
+				}
+				continue
+			}
 
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			log.Printf("could not create zip entry for file %s: %s", file, err)
-			rd.Close()
-			continue
-		}
+			if !entry.Stat().Mode().IsRegular() {
+				logger.Warn("skipping special file %s", file)
+				continue
+			}
+			header.Method = zip.Deflate
 
-		_, err = io.Copy(writer, rd)
-		if err != nil {
-			log.Printf("could not write file %s: %s", file, err)
+			rd, err := snap.NewReader(file)
+			if err != nil {
+				logger.Error("could not find file %s", file)
+				continue
+			}
+
+			writer, err := zipWriter.CreateHeader(header)
+			if err != nil {
+				logger.Error("could not create zip entry for file %s: %s", file, err)
+				rd.Close()
+				continue
+			}
+
+			_, err = io.Copy(writer, rd)
+			if err != nil {
+				logger.Error("could not write file %s: %s", file, err)
+				rd.Close()
+				return err
+			}
 			rd.Close()
-			continue
 		}
-		rd.Close()
 	}
 	return nil
 }
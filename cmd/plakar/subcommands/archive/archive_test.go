@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+	"github.com/PlakarKorp/plakar/storage"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestArchiveZipRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"hello.txt":        "hello, world\n",
+		"subdir/dummy.txt": "dummy content\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("hello.txt", filepath.Join(sourceDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := storage.NewConfiguration()
+	configuration.Compression = nil
+	configuration.Encryption = nil
+	snap := testutil.Backup(t, testutil.NewRepository(t, configuration), sourceDir)
+	fs, err := snap.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := archiveZip(snap, &buf, fs, sourceDir, true); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+
+	if dir, exists := entries["subdir/"]; !exists {
+		t.Errorf("missing directory entry subdir/")
+	} else if !dir.Mode().IsDir() {
+		t.Errorf("expected subdir/ to be a directory, got mode %s", dir.Mode())
+	}
+
+	for name, content := range files {
+		f, exists := entries[name]
+		if !exists {
+			t.Errorf("missing file entry %s", name)
+			continue
+		}
+		rd, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rd)
+		rd.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, data)
+		}
+	}
+
+	link, exists := entries["link"]
+	if !exists {
+		t.Fatalf("missing symlink entry")
+	}
+	if link.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected link to be a symlink, got mode %s", link.Mode())
+	}
+	rd, err := link.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ := io.ReadAll(rd)
+	rd.Close()
+	if string(target) != "hello.txt" {
+		t.Errorf("expected symlink target hello.txt, got %q", target)
+	}
+}
@@ -17,7 +17,6 @@
 package backup
 
 import (
-	"bufio"
 	"encoding/base64"
 	"flag"
 	"fmt"
@@ -56,49 +55,142 @@ func (e *excludeFlags) Set(value string) error {
 
 func cmd_backup(ctx *context.Context, repo *repository.Repository, args []string) int {
 	var opt_tags string
-	var opt_excludes string
+	var opt_excludeFrom string
 	var opt_exclude excludeFlags
+	var opt_include excludeFlags
 	var opt_concurrency uint64
 	var opt_quiet bool
+	var opt_resume bool
+	var opt_output string
+	var opt_ignoreErrors bool
+	var opt_dryRun bool
+	var opt_force bool
+	var opt_oneFileSystem bool
+	var opt_dereference bool
+	var opt_excludeCaches bool
+	var opt_excludeDevices bool
+	var opt_excludeSockets bool
+	var opt_excludeFifos bool
+	var opt_maxFileSize string
 
 	excludes := []glob.Glob{}
 	flags := flag.NewFlagSet("backup", flag.ExitOnError)
 	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.GetNumCPU())*8+1, "maximum number of parallel tasks")
 	flags.StringVar(&opt_tags, "tag", "", "tag to assign to this snapshot")
-	flags.StringVar(&opt_excludes, "excludes", "", "file containing a list of exclusions")
-	flags.Var(&opt_exclude, "exclude", "file containing a list of exclusions")
+	flags.StringVar(&opt_excludeFrom, "exclude-from", "", "file containing a list of exclusions")
+	flags.StringVar(&opt_excludeFrom, "excludes", "", "deprecated alias for -exclude-from")
+	flags.Var(&opt_exclude, "exclude", "pattern to exclude")
+	flags.Var(&opt_include, "include", "only back up files matching this pattern")
+	flags.BoolVar(&opt_excludeCaches, "exclude-caches", false, "don't back up directories tagged with a CACHEDIR.TAG file")
+	flags.BoolVar(&opt_excludeDevices, "exclude-devices", false, "don't back up block and character devices")
+	flags.BoolVar(&opt_excludeSockets, "exclude-sockets", false, "don't back up sockets")
+	flags.BoolVar(&opt_excludeFifos, "exclude-fifos", false, "don't back up named pipes")
+	flags.StringVar(&opt_maxFileSize, "max-file-size", "", "skip files larger than this size, e.g. 2GB")
 	flags.BoolVar(&opt_quiet, "quiet", false, "suppress output")
+	flags.BoolVar(&opt_resume, "resume", false, "resume an interrupted backup of the same directory")
+	flags.StringVar(&opt_output, "output", "text", "output format: text or json")
+	flags.BoolVar(&opt_dryRun, "dry-run", false, "show what would be backed up without creating a snapshot")
+	flags.BoolVar(&opt_ignoreErrors, "ignore-errors", false, "exit successfully even if some paths could not be backed up")
+	flags.BoolVar(&opt_force, "force", false, "break an expired repository lock")
+	flags.BoolVar(&opt_oneFileSystem, "one-file-system", false, "don't cross filesystem boundaries")
+	flags.BoolVar(&opt_dereference, "dereference", false, "back up the targets of symlinks instead of the links")
 	flags.Parse(args)
 
-	go eventsProcessorStdio(ctx, opt_quiet)
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "excludes" {
+			logger.Warn("%s: -excludes is deprecated, use -exclude-from instead", flags.Name())
+		}
+	})
+
+	var done chan struct{}
+	switch opt_output {
+	case "text":
+		done = eventsProcessorStdio(ctx, opt_quiet)
+	case "json":
+		done = eventsProcessorJSON(ctx)
+	default:
+		logger.Error("%s: unknown output format: %s", flags.Name(), opt_output)
+		return 1
+	}
+	// let the events processor output the last events before the
+	// process exits.
+	defer func() {
+		ctx.Events().Close()
+		<-done
+	}()
+
+	var maxFileSize uint64
+	if opt_maxFileSize != "" {
+		size, err := humanize.ParseBytes(opt_maxFileSize)
+		if err != nil || size == 0 {
+			logger.Error("%s: invalid maximum file size: %s", flags.Name(), opt_maxFileSize)
+			return 1
+		}
+		maxFileSize = size
+	}
 
 	for _, item := range opt_exclude {
-		excludes = append(excludes, glob.MustCompile(item))
+		pattern, err := glob.Compile(item)
+		if err != nil {
+			logger.Error("%s: invalid exclude pattern %s: %s", flags.Name(), item, err)
+			return 1
+		}
+		excludes = append(excludes, pattern)
 	}
 
-	if opt_excludes != "" {
-		fp, err := os.Open(opt_excludes)
+	var includes []glob.Glob
+	for _, item := range opt_include {
+		pattern, err := glob.Compile(item)
+		if err != nil {
+			logger.Error("%s: invalid include pattern %s: %s", flags.Name(), item, err)
+			return 1
+		}
+		includes = append(includes, pattern)
+	}
+
+	if opt_excludeFrom != "" {
+		patterns, err := loadExcludes(opt_excludeFrom, "")
 		if err != nil {
 			logger.Error("%s", err)
 			return 1
 		}
-		defer fp.Close()
+		excludes = append(excludes, patterns...)
+	}
 
-		scanner := bufio.NewScanner(fp)
-		for scanner.Scan() {
-			pattern, err := glob.Compile(scanner.Text())
+	var scanDir string
+	if flags.NArg() == 0 {
+		scanDir = ctx.GetCWD()
+	} else if flags.NArg() == 1 {
+		if !strings.HasPrefix(flags.Arg(0), "/") {
+			_, err := importer.NewImporter(flags.Arg(0))
 			if err != nil {
-				logger.Error("%s", err)
-				return 1
+				scanDir = path.Clean(ctx.GetCWD() + "/" + flags.Arg(0))
+			} else {
+				scanDir = flags.Arg(0)
 			}
-			excludes = append(excludes, pattern)
+		} else {
+			scanDir = path.Clean(flags.Arg(0))
 		}
-		if err := scanner.Err(); err != nil {
+	} else {
+		log.Fatal("only one directory pushable")
+	}
+
+	if !strings.Contains(scanDir, "://") {
+		patterns, err := discoverExcludes(scanDir)
+		if err != nil {
 			logger.Error("%s", err)
 			return 1
 		}
+		excludes = append(excludes, patterns...)
+	}
+
+	if !opt_dryRun {
+		if err := repo.Store().Lock(opt_force); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+			return 1
+		}
+		defer repo.Store().Unlock()
 	}
-	_ = excludes
 
 	snapshotUUID := uuid.Must(uuid.NewRandom())
 	snapshotID, err := snapshotUUID.MarshalBinary()
@@ -140,37 +232,52 @@ func cmd_backup(ctx *context.Context, repo *repository.Repository, args []string
 	opts := &snapshot.PushOptions{
 		MaxConcurrency: opt_concurrency,
 		Excludes:       excludes,
+		Includes:       includes,
+		Resume:         opt_resume,
+		OneFileSystem:  opt_oneFileSystem,
+		Dereference:    opt_dereference,
+		ExcludeCaches:  opt_excludeCaches,
+		ExcludeDevices: opt_excludeDevices,
+		ExcludeSockets: opt_excludeSockets,
+		ExcludeFifos:   opt_excludeFifos,
+		MaxFileSize:    maxFileSize,
 	}
 
-	if flags.NArg() == 0 {
-		err = snap.Backup(ctx.GetCWD(), opts)
-	} else if flags.NArg() == 1 {
-		var cleanPath string
-
-		if !strings.HasPrefix(flags.Arg(0), "/") {
-			_, err := importer.NewImporter(flags.Arg(0))
-			if err != nil {
-				cleanPath = path.Clean(ctx.GetCWD() + "/" + flags.Arg(0))
-			} else {
-				cleanPath = flags.Arg(0)
-			}
-		} else {
-			cleanPath = path.Clean(flags.Arg(0))
+	if opt_dryRun {
+		summary, err := snap.DryRun(scanDir, opts)
+		if err != nil {
+			logger.Error("failed to scan %s: %s", scanDir, err)
+			return 1
 		}
-		err = snap.Backup(cleanPath, opts)
-	} else {
-		log.Fatal("only one directory pushable")
+		if opt_output != "json" {
+			fmt.Printf("dry run: would back up %d files and %d directories, %s\n",
+				summary.Files, summary.Directories, humanize.Bytes(summary.Size))
+		}
+		return 0
 	}
 
-	if err != nil {
+	if err := snap.Backup(scanDir, opts); err != nil {
 		logger.Error("failed to create snapshot: %s", err)
 		return 1
 	}
 
-	logger.Info("created snapshot %x with root %s of size %s in %s",
-		snap.Header.GetIndexShortID(),
-		base64.RawStdEncoding.EncodeToString(snap.Header.Root[:]),
-		humanize.Bytes(snap.Header.Summary.Directory.Size+snap.Header.Summary.Below.Size),
-		snap.Header.CreationDuration)
+	// keep stdout made of JSON lines only
+	if opt_output != "json" {
+		logger.Info("created snapshot %x with root %s of size %s in %s",
+			snap.Header.GetIndexShortID(),
+			base64.RawStdEncoding.EncodeToString(snap.Header.Root[:]),
+			humanize.Bytes(snap.Header.Summary.Directory.Size+snap.Header.Summary.Below.Size),
+			snap.Header.CreationDuration)
+	}
+
+	return exitStatus(snap.Header.Summary.Directory.Errors+snap.Header.Summary.Below.Errors, opt_ignoreErrors)
+}
+
+// exitStatus reports a failure when some paths could not be backed up,
+// unless errors are to be ignored.
+func exitStatus(errors uint64, ignoreErrors bool) int {
+	if errors != 0 && !ignoreErrors {
+		return 1
+	}
 	return 0
 }
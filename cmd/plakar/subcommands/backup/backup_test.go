@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestExitStatus(t *testing.T) {
+	if status := exitStatus(0, false); status != 0 {
+		t.Errorf("expected 0 without errors, got %d", status)
+	}
+	if status := exitStatus(3, false); status != 1 {
+		t.Errorf("expected 1 with errors, got %d", status)
+	}
+	if status := exitStatus(3, true); status != 0 {
+		t.Errorf("expected 0 with ignored errors, got %d", status)
+	}
+}
+
+func TestBackupInvalidPattern(t *testing.T) {
+	repo := testutil.NewRepository(t, nil)
+	sourceDir := t.TempDir()
+
+	for _, args := range [][]string{
+		{"-quiet", "-exclude", "[", sourceDir},
+		{"-quiet", "-include", "[", sourceDir},
+	} {
+		if status := cmd_backup(repo.Context(), repo, args); status != 1 {
+			t.Errorf("%v: expected exit status 1, got %d", args, status)
+		}
+	}
+
+	snapshotIDs, err := repo.GetSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshotIDs) != 0 {
+		t.Fatalf("expected no snapshot to be created, got %d", len(snapshotIDs))
+	}
+}
+
+func TestBackupErrorsSummary(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(dir, 0); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(dir, 0755)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "readable.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := storage.NewConfiguration()
+	configuration.Compression = nil
+	configuration.Encryption = nil
+	repoDir := filepath.Join(tmpDir, "repo")
+	if _, err := storage.Create(context.NewContext(), repoDir, *configuration); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		args   []string
+		status int
+	}{
+		{args: []string{"-quiet", sourceDir}, status: 1},
+		{args: []string{"-quiet", "-ignore-errors", sourceDir}, status: 0},
+	} {
+		ctx := context.NewContext()
+		ctx.SetCacheDir(filepath.Join(tmpDir, "cache"))
+		store, err := storage.Open(ctx, repoDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo, err := repository.New(store, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		summaries := make(chan events.ErrorsSummary, 1)
+		listener := ctx.Events().Listen()
+		go func() {
+			defer close(summaries)
+			for event := range listener {
+				if event, ok := event.(events.ErrorsSummary); ok {
+					summaries <- event
+				}
+			}
+		}()
+
+		status := cmd_backup(ctx, repo, test.args)
+		ctx.Events().Close()
+
+		if status != test.status {
+			t.Errorf("%v: expected exit status %d, got %d", test.args, test.status, status)
+		}
+
+		summary, ok := <-summaries
+		if !ok {
+			t.Fatalf("%v: no errors summary", test.args)
+		}
+		if summary.Count != 2 {
+			t.Errorf("%v: expected 2 errors, got %d", test.args, summary.Count)
+		}
+		if summary.Classes["permission denied"] != 2 {
+			t.Errorf("%v: expected 2 permission errors, got %v", test.args, summary.Classes)
+		}
+		if len(summary.Paths) != 2 {
+			t.Errorf("%v: expected 2 paths, got %v", test.args, summary.Paths)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// ignoreFile is the name of the file holding exclusion patterns that is
+// looked up at the root of the backed up directory.
+const ignoreFile = ".plakarignore"
+
+// parseExcludes reads exclusion patterns, one per line.  Blank lines and
+// lines starting with a '#' are skipped.  If root is not empty, patterns
+// that are not absolute are anchored to it.
+func parseExcludes(rd io.Reader, root string) ([]glob.Glob, error) {
+	excludes := []glob.Glob{}
+
+	scanner := bufio.NewScanner(rd)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if root != "" && !strings.HasPrefix(line, "/") {
+			line = strings.TrimSuffix(root, "/") + "/" + line
+		}
+		pattern, err := glob.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+		excludes = append(excludes, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return excludes, nil
+}
+
+func loadExcludes(filename string, root string) ([]glob.Glob, error) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	excludes, err := parseExcludes(fp, root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return excludes, nil
+}
+
+// discoverExcludes loads the ignore file at the root of directory, if
+// there is one.
+func discoverExcludes(directory string) ([]glob.Glob, error) {
+	excludes, err := loadExcludes(filepath.Join(directory, ignoreFile), filepath.ToSlash(directory))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return excludes, err
+}
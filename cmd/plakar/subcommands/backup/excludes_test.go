@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseExcludes(t *testing.T) {
+	input := strings.Join([]string{
+		"# build artifacts",
+		"*.o",
+		"",
+		"   ",
+		"  # indented comment",
+		"/var/tmp/**",
+		"",
+	}, "\n")
+
+	excludes, err := parseExcludes(strings.NewReader(input), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(excludes) != 2 {
+		t.Fatalf("expected 2 patterns, got %d", len(excludes))
+	}
+	if !excludes[0].Match("/home/user/main.o") {
+		t.Error("expected *.o to match /home/user/main.o")
+	}
+	if !excludes[1].Match("/var/tmp/foo") {
+		t.Error("expected /var/tmp/** to match /var/tmp/foo")
+	}
+}
+
+func TestParseExcludesInvalidPattern(t *testing.T) {
+	if _, err := parseExcludes(strings.NewReader("ok\n[invalid\n"), ""); err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
+
+func TestDiscoverExcludes(t *testing.T) {
+	directory := t.TempDir()
+
+	excludes, err := discoverExcludes(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(excludes) != 0 {
+		t.Fatalf("expected no pattern without an ignore file, got %d", len(excludes))
+	}
+
+	content := "# local files\nbuild/**\n\n/etc/passwd\n"
+	if err := os.WriteFile(filepath.Join(directory, ignoreFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	excludes, err = discoverExcludes(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(excludes) != 2 {
+		t.Fatalf("expected 2 patterns, got %d", len(excludes))
+	}
+
+	root := filepath.ToSlash(directory)
+	if !excludes[0].Match(root + "/build/obj/main.o") {
+		t.Error("expected relative pattern to match below the root")
+	}
+	if excludes[0].Match("/elsewhere/build/obj/main.o") {
+		t.Error("expected relative pattern not to match outside of the root")
+	}
+	if !excludes[1].Match("/etc/passwd") {
+		t.Error("expected absolute pattern to be kept as is")
+	}
+}
@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/logger"
+)
+
+// jsonEvent is the representation of an event in the JSON lines output.
+type jsonEvent struct {
+	Type       string    `json:"type"`
+	Timestamp  time.Time `json:"timestamp"`
+	SnapshotID string    `json:"snapshot_id"`
+	Pathname   string    `json:"pathname,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Size       uint64    `json:"size,omitempty"`
+
+	Errors  uint64            `json:"errors,omitempty"`
+	Classes map[string]uint64 `json:"classes,omitempty"`
+	Paths   []string          `json:"paths,omitempty"`
+}
+
+func eventsProcessorJSON(ctx *context.Context) chan struct{} {
+	done := make(chan struct{})
+	listener := ctx.Events().Listen()
+	go func() {
+		defer close(done)
+
+		encoder := json.NewEncoder(os.Stdout)
+		for event := range listener {
+			var record jsonEvent
+			switch event := event.(type) {
+			case events.PathError:
+				record = jsonEvent{
+					Type:       "path_error",
+					Timestamp:  event.Timestamp(),
+					SnapshotID: hex.EncodeToString(event.SnapshotID[:]),
+					Pathname:   event.Pathname,
+					Message:    event.Message,
+				}
+			case events.DirectoryOK:
+				record = jsonEvent{
+					Type:       "directory_ok",
+					Timestamp:  event.Timestamp(),
+					SnapshotID: hex.EncodeToString(event.SnapshotID[:]),
+					Pathname:   event.Pathname,
+				}
+			case events.FileOK:
+				record = jsonEvent{
+					Type:       "file_ok",
+					Timestamp:  event.Timestamp(),
+					SnapshotID: hex.EncodeToString(event.SnapshotID[:]),
+					Pathname:   event.Pathname,
+				}
+			case events.FileSkipped:
+				record = jsonEvent{
+					Type:       "file_skipped",
+					Timestamp:  event.Timestamp(),
+					SnapshotID: hex.EncodeToString(event.SnapshotID[:]),
+					Pathname:   event.Pathname,
+					Size:       event.Size,
+				}
+			case events.ErrorsSummary:
+				record = jsonEvent{
+					Type:       "errors_summary",
+					Timestamp:  event.Timestamp(),
+					SnapshotID: hex.EncodeToString(event.SnapshotID[:]),
+					Errors:     event.Count,
+					Classes:    event.Classes,
+					Paths:      event.Paths,
+				}
+			default:
+				continue
+			}
+			if err := encoder.Encode(record); err != nil {
+				logger.Warn("could not output event: %s", err)
+			}
+		}
+	}()
+	return done
+}
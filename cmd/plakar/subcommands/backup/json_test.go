@@ -0,0 +1,75 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/events"
+)
+
+func TestEventsProcessorJSON(t *testing.T) {
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedStdout := os.Stdout
+	os.Stdout = wr
+	defer func() { os.Stdout = savedStdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(rd)
+		output <- data
+	}()
+
+	ctx := context.NewContext()
+	done := eventsProcessorJSON(ctx)
+
+	snapshotID := [32]byte{0x01, 0x02}
+	ctx.Events().Send(events.FileOKEvent(snapshotID, "/etc/passwd"))
+	ctx.Events().Send(events.DirectoryOKEvent(snapshotID, "/etc"))
+	ctx.Events().Send(events.StartEvent())
+	ctx.Events().Send(events.PathErrorEvent(snapshotID, "/etc/shadow", "permission denied"))
+	ctx.Events().Close()
+	<-done
+
+	wr.Close()
+	os.Stdout = savedStdout
+	data := <-output
+
+	expected := []jsonEvent{
+		{Type: "file_ok", Pathname: "/etc/passwd"},
+		{Type: "directory_ok", Pathname: "/etc"},
+		{Type: "path_error", Pathname: "/etc/shadow", Message: "permission denied"},
+	}
+
+	var records []jsonEvent
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var record jsonEvent
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %s", len(expected), len(records), data)
+	}
+	for i, record := range records {
+		if record.Type != expected[i].Type || record.Pathname != expected[i].Pathname || record.Message != expected[i].Message {
+			t.Errorf("record %d: expected %+v, got %+v", i, expected[i], record)
+		}
+		if record.SnapshotID != "0102000000000000000000000000000000000000000000000000000000000000" {
+			t.Errorf("record %d: unexpected snapshot id %s", i, record.SnapshotID)
+		}
+		if record.Timestamp.IsZero() {
+			t.Errorf("record %d: missing timestamp", i)
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package backup
 
 import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
 	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/events"
 	"github.com/PlakarKorp/plakar/logger"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/dustin/go-humanize"
+	"golang.org/x/term"
 )
 
 var (
@@ -12,21 +19,105 @@ var (
 	crossMark = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000")).SetString("✘")
 )
 
+// progressRefresh is the minimum delay between two redraws of the
+// progress line.
+const progressRefresh = 500 * time.Millisecond
+
+// estimateETA returns the transfer rate in bytes per second and the time
+// left to transfer bytesTotal bytes, given that bytes were transferred in
+// elapsed. The estimate is not meaningful until some data went through,
+// in which case ok is false.
+func estimateETA(elapsed time.Duration, bytes uint64, bytesTotal uint64) (rate float64, eta time.Duration, ok bool) {
+	if elapsed <= 0 || bytes == 0 {
+		return 0, 0, false
+	}
+	rate = float64(bytes) / elapsed.Seconds()
+	if bytes >= bytesTotal {
+		return rate, 0, true
+	}
+	eta = time.Duration(float64(bytesTotal-bytes) / rate * float64(time.Second))
+	return rate, eta.Round(time.Second), true
+}
+
+func progressLine(event events.Progress, elapsed time.Duration) string {
+	percent := 100.0
+	if event.BytesTotal != 0 {
+		percent = float64(event.Bytes) / float64(event.BytesTotal) * 100
+	}
+
+	line := fmt.Sprintf("%x: %5.1f%% %d/%d files, %s/%s", event.SnapshotID[:4], percent,
+		event.Done, event.Total, humanize.Bytes(event.Bytes), humanize.Bytes(event.BytesTotal))
+	if rate, eta, ok := estimateETA(elapsed, event.Bytes, event.BytesTotal); ok {
+		line += fmt.Sprintf(", %s/s, ETA %s", humanize.Bytes(uint64(rate)), eta)
+	}
+	return line
+}
+
 func eventsProcessorStdio(ctx *context.Context, quiet bool) chan struct{} {
 	done := make(chan struct{})
+	listener := ctx.Events().Listen()
 	go func() {
-		for event := range ctx.Events().Listen() {
+		showProgress := !quiet && term.IsTerminal(int(os.Stderr.Fd()))
+		progressShown := false
+		clearProgress := func() {
+			if progressShown {
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				progressShown = false
+			}
+		}
+
+		var start, lastRefresh time.Time
+		for event := range listener {
 			switch event := event.(type) {
+			case events.Start:
+				start = event.Timestamp()
+			case events.Progress:
+				if !showProgress || event.Timestamp().Sub(lastRefresh) < progressRefresh {
+					break
+				}
+				if start.IsZero() {
+					start = event.Timestamp()
+				}
+				lastRefresh = event.Timestamp()
+				fmt.Fprintf(os.Stderr, "\r\033[K%s", progressLine(event, event.Timestamp().Sub(start)))
+				progressShown = true
 			case events.PathError:
+				clearProgress()
 				logger.Warn("%x: KO %s %s: %s", event.SnapshotID[:4], crossMark, event.Pathname, event.Message)
 			case events.DirectoryOK:
 				if !quiet {
+					clearProgress()
 					logger.Info("%x: OK %s %s", event.SnapshotID[:4], checkMark, event.Pathname)
 				}
 			case events.FileOK:
 				if !quiet {
+					clearProgress()
 					logger.Info("%x: OK %s %s", event.SnapshotID[:4], checkMark, event.Pathname)
 				}
+			case events.FileSkipped:
+				clearProgress()
+				logger.Warn("%x: skipped %s: %s exceeds the maximum file size", event.SnapshotID[:4], event.Pathname, humanize.Bytes(event.Size))
+			case events.ErrorsSummary:
+				clearProgress()
+				logger.Warn("%x: %d paths could not be backed up", event.SnapshotID[:4], event.Count)
+				classes := make([]string, 0, len(event.Classes))
+				for class := range event.Classes {
+					classes = append(classes, class)
+				}
+				sort.Slice(classes, func(i, j int) bool {
+					return event.Classes[classes[i]] > event.Classes[classes[j]]
+				})
+				for _, class := range classes {
+					logger.Warn("%x:   %d: %s", event.SnapshotID[:4], event.Classes[class], class)
+				}
+				for _, pathname := range event.Paths {
+					logger.Warn("%x:   %s %s", event.SnapshotID[:4], crossMark, pathname)
+				}
+				if uint64(len(event.Paths)) < event.Count {
+					logger.Warn("%x:   and %d more", event.SnapshotID[:4], event.Count-uint64(len(event.Paths)))
+				}
+			case events.Done:
+				clearProgress()
 			default:
 				//logger.Warn("unknown event: %T", event)
 			}
@@ -0,0 +1,37 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateETA(t *testing.T) {
+	tests := []struct {
+		elapsed    time.Duration
+		bytes      uint64
+		bytesTotal uint64
+		rate       float64
+		eta        time.Duration
+		ok         bool
+	}{
+		{elapsed: 0, bytes: 0, bytesTotal: 1000, ok: false},
+		{elapsed: 10 * time.Second, bytes: 0, bytesTotal: 1000, ok: false},
+		{elapsed: 10 * time.Second, bytes: 100, bytesTotal: 1000, rate: 10, eta: 90 * time.Second, ok: true},
+		{elapsed: 2 * time.Second, bytes: 500, bytesTotal: 1000, rate: 250, eta: 2 * time.Second, ok: true},
+		{elapsed: 4 * time.Second, bytes: 1000, bytesTotal: 1000, rate: 250, eta: 0, ok: true},
+		// the total may lag behind while the importer is still scanning
+		{elapsed: 4 * time.Second, bytes: 2000, bytesTotal: 1000, rate: 500, eta: 0, ok: true},
+	}
+
+	for _, test := range tests {
+		rate, eta, ok := estimateETA(test.elapsed, test.bytes, test.bytesTotal)
+		if ok != test.ok {
+			t.Errorf("%v %d/%d: expected ok=%v, got %v", test.elapsed, test.bytes, test.bytesTotal, test.ok, ok)
+			continue
+		}
+		if rate != test.rate || eta != test.eta {
+			t.Errorf("%v %d/%d: expected rate %v and eta %v, got %v and %v",
+				test.elapsed, test.bytes, test.bytesTotal, test.rate, test.eta, rate, eta)
+		}
+	}
+}
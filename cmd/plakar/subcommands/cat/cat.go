@@ -28,6 +28,7 @@ import (
 	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/logger"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
 	"github.com/alecthomas/chroma/formatters"
 	"github.com/alecthomas/chroma/lexers"
 	"github.com/alecthomas/chroma/styles"
@@ -67,6 +68,24 @@ func cmd_cat(ctx *context.Context, repo *repository.Repository, args []string) i
 			continue
 		}
 
+		fs, err := snap.Filesystem()
+		if err != nil {
+			logger.Error("%s: %s: %s", flags.Name(), pathname, err)
+			errors++
+			continue
+		}
+		st, err := fs.Stat(pathname)
+		if err != nil {
+			logger.Error("%s: %s: no such file or directory", flags.Name(), pathname)
+			errors++
+			continue
+		}
+		if _, isDir := st.(*vfs.DirEntry); isDir {
+			logger.Error("%s: %s: is a directory", flags.Name(), pathname)
+			errors++
+			continue
+		}
+
 		rd, err := snap.NewReader(pathname)
 		if err != nil {
 			logger.Error("%s: %s: failed to open: %s", flags.Name(), pathname, err)
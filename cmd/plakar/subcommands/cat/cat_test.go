@@ -0,0 +1,83 @@
+package cat
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+// captureStdout returns what fn writes to stdout.
+func captureStdout(t *testing.T, fn func()) []byte {
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedStdout := os.Stdout
+	os.Stdout = wr
+	defer func() { os.Stdout = savedStdout }()
+
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(rd)
+		output <- data
+	}()
+
+	fn()
+	wr.Close()
+	return <-output
+}
+
+func TestCat(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// large enough to be split in several chunks
+	content := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	pathname := filepath.Join(sourceDir, "random.bin")
+	if err := os.WriteFile(pathname, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := testutil.NewRepository(t, nil)
+	snapshotID := testutil.Backup(t, repo, sourceDir).Header.SnapshotID
+
+	repo = testutil.OpenRepository(t, repo.Store())
+	ctx := repo.Context()
+	prefix := hex.EncodeToString(snapshotID[:])
+
+	var status int
+	output := captureStdout(t, func() {
+		status = cmd_cat(ctx, repo, []string{prefix + ":" + filepath.ToSlash(pathname)})
+	})
+	if status != 0 {
+		t.Fatalf("expected exit status 0, got %d", status)
+	}
+	if !bytes.Equal(output, content) {
+		t.Fatalf("output differs from the original file: got %d bytes, expected %d", len(output), len(content))
+	}
+
+	for _, name := range []string{"subdir", "missing.txt"} {
+		output := captureStdout(t, func() {
+			status = cmd_cat(ctx, repo, []string{prefix + ":" + filepath.ToSlash(filepath.Join(sourceDir, name))})
+		})
+		if status != 1 {
+			t.Errorf("%s: expected exit status 1, got %d", name, status)
+		}
+		if len(output) != 0 {
+			t.Errorf("%s: expected no output, got %d bytes", name, len(output))
+		}
+	}
+}
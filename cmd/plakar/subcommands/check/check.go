@@ -17,9 +17,12 @@
 package check
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
@@ -27,7 +30,6 @@ import (
 	"github.com/PlakarKorp/plakar/logger"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
-	"github.com/google/uuid"
 )
 
 func init() {
@@ -37,16 +39,35 @@ func init() {
 func cmd_check(ctx *context.Context, repo *repository.Repository, args []string) int {
 	var opt_concurrency uint64
 	var opt_fastCheck bool
+	var opt_key string
 	var opt_noVerify bool
 	var opt_quiet bool
+	var opt_signed bool
 
 	flags := flag.NewFlagSet("check", flag.ExitOnError)
 	flags.Uint64Var(&opt_concurrency, "concurrency", uint64(ctx.GetNumCPU())*8+1, "maximum number of parallel tasks")
 	flags.BoolVar(&opt_noVerify, "no-verify", false, "disable signature verification")
+	flags.BoolVar(&opt_signed, "signed", false, "fail on snapshots that are not signed")
+	flags.StringVar(&opt_key, "key", "", "base64 public key to verify signatures against")
 	flags.BoolVar(&opt_fastCheck, "fast", false, "enable fast checking (no checksum verification)")
 	flags.BoolVar(&opt_quiet, "quiet", false, "suppress output")
 	flags.Parse(args)
 
+	// without a trusted key, the signature is verified against the key
+	// recorded in the header it signs, which only proves that the header
+	// is self-consistent.
+	var trustedKey ed25519.PublicKey
+	if opt_key != "" {
+		key, err := base64.RawStdEncoding.DecodeString(opt_key)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			fmt.Fprintf(os.Stderr, "%s: invalid public key: %s\n", flags.Name(), opt_key)
+			return 1
+		}
+		trustedKey = key
+	} else if kp := ctx.GetKeypair(); kp != nil {
+		trustedKey = kp.PublicKey
+	}
+
 	go eventsProcessorStdio(ctx, opt_quiet)
 
 	var snapshots []string
@@ -71,14 +92,25 @@ func cmd_check(ctx *context.Context, repo *repository.Repository, args []string)
 			log.Fatal(err)
 		}
 
-		if !opt_noVerify && snap.Header.Identity.Identifier != uuid.Nil {
-			if ok, err := snap.Verify(); err != nil {
+		if !opt_noVerify {
+			publicKey := trustedKey
+			if publicKey == nil {
+				publicKey = snap.Header.Identity.PublicKey
+			}
+			switch err := snap.VerifyHeader(publicKey); err {
+			case nil:
+				logger.Info("snapshot %x signature verification succeeded", snap.Header.SnapshotID)
+			case snapshot.ErrNotSigned:
+				if opt_signed {
+					logger.Warn("snapshot %x is not signed", snap.Header.SnapshotID)
+					failures = true
+				}
+			case snapshot.ErrInvalidSignature:
+				logger.Warn("snapshot %x signature verification failed", snap.Header.SnapshotID)
+				failures = true
+			default:
 				logger.Warn("%s", err)
-			} else if !ok {
-				logger.Info("snapshot %x signature verification failed", snap.Header.SnapshotID)
 				failures = true
-			} else {
-				logger.Info("snapshot %x signature verification succeeded", snap.Header.SnapshotID)
 			}
 		}
 
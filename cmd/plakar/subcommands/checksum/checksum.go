@@ -20,12 +20,12 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"path/filepath"
 
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
@@ -76,26 +76,25 @@ func cmd_checksum(ctx *context.Context, repo *repository.Repository, args []stri
 }
 
 func displayChecksums(fs *vfs.Filesystem, repo *repository.Repository, snap *snapshot.Snapshot, pathname string, fastcheck bool) error {
+	return fs.WalkSorted(pathname, func(pathname string, fileinfo *objects.FileInfo) error {
+		if !fileinfo.Mode().IsRegular() {
+			return nil
+		}
+		return displayChecksum(fs, repo, snap, pathname, fastcheck)
+	})
+}
+
+func displayChecksum(fs *vfs.Filesystem, repo *repository.Repository, snap *snapshot.Snapshot, pathname string, fastcheck bool) error {
 	fsinfo, err := fs.Stat(pathname)
 	if err != nil {
 		return err
 	}
 
-	if dirEntry, isDir := fsinfo.(*vfs.DirEntry); isDir {
-		for _, entry := range dirEntry.Children {
-			if err := displayChecksums(fs, repo, snap, filepath.Join(pathname, entry.Stat().Name()), fastcheck); err != nil {
-				return err
-			}
-		}
-	}
-
-	if fsinfo, isRegular := fsinfo.(*vfs.FileEntry); !isRegular {
-		return err
-	} else if !fsinfo.Stat().Mode().IsRegular() {
-		return err
+	info, isRegular := fsinfo.(*vfs.FileEntry)
+	if !isRegular {
+		return nil
 	}
 
-	info := fsinfo.(*vfs.FileEntry)
 	object, err := snap.LookupObject(info.Object.Checksum)
 	if err != nil {
 		return err
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package copy
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+func init() {
+	subcommands.Register("copy", cmd_copy)
+}
+
+type snapshotFlags []string
+
+func (s *snapshotFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *snapshotFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func cmd_copy(ctx *context.Context, repo *repository.Repository, args []string) int {
+	var opt_snapshots snapshotFlags
+	var opt_force bool
+
+	flags := flag.NewFlagSet("copy", flag.ExitOnError)
+	flags.Var(&opt_snapshots, "snapshot", "only copy this snapshot, may be repeated")
+	flags.BoolVar(&opt_force, "force", false, "break an expired lock of the destination repository")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 || flags.Arg(0) != "to" {
+		logger.Error("usage: %s [-force] [-snapshot snapshotID ...] to repository", flags.Name())
+		return 1
+	}
+
+	snapshotIDs := make([]objects.Checksum, 0)
+	if len(opt_snapshots) != 0 {
+		snapshots, err := utils.GetSnapshots(repo, opt_snapshots)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+			return 1
+		}
+		for _, snap := range snapshots {
+			snapshotIDs = append(snapshotIDs, snap.Header.GetIndexID())
+		}
+	}
+
+	sourceConfiguration := repo.Store().Configuration()
+
+	// the destination is a replica: it keeps the repository ID, which the
+	// encryption binds the data to.
+	// only a missing destination is created, any other error could hide
+	// an existing repository that is temporarily unreachable.
+	dst, err := storage.Open(ctx, flags.Arg(1))
+	if errors.Is(err, fs.ErrNotExist) {
+		dst, err = storage.Create(ctx, flags.Arg(1), sourceConfiguration)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: could not create repository: %s\n", flags.Arg(1), err)
+			return 1
+		}
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flags.Name(), flags.Arg(1), err)
+		return 1
+	} else if dst.Configuration().RepositoryID != sourceConfiguration.RepositoryID {
+		fmt.Fprintf(os.Stderr, "%s: %s: not a copy of this repository\n", flags.Name(), flags.Arg(1))
+		return 1
+	}
+	defer dst.Close()
+
+	if err := dst.Lock(opt_force); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flags.Name(), flags.Arg(1), err)
+		return 1
+	}
+	defer dst.Unlock()
+
+	report, err := snapshot.Copy(repo, dst, snapshotIDs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+	logger.Info("copied %d packfiles and %d states to %s, %d already present",
+		report.Packfiles, report.States, flags.Arg(1), report.Skipped)
+	return 0
+}
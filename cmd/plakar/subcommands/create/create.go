@@ -19,10 +19,12 @@ package create
 import (
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/PlakarKorp/plakar/chunking"
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/compression"
@@ -31,26 +33,68 @@ import (
 	"github.com/PlakarKorp/plakar/hashing"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/storage"
+	"github.com/dustin/go-humanize"
 )
 
 func init() {
 	subcommands.Register("create", cmd_create)
 }
 
+// parseChunkSize parses a chunk size given in bytes or with a unit.
+func parseChunkSize(value string) (uint32, error) {
+	size, err := humanize.ParseBytes(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chunk size: %s", value)
+	}
+	if size == 0 || size > math.MaxUint32 {
+		return 0, fmt.Errorf("chunk size out of range: %s", value)
+	}
+	return uint32(size), nil
+}
+
 func cmd_create(ctx *context.Context, _ *repository.Repository, args []string) int {
 	var opt_noencryption bool
 	var opt_nocompression bool
 	var opt_hashing string
 	var opt_compression string
+	var opt_chunking string
+	var opt_chunkMin string
+	var opt_chunkNormal string
+	var opt_chunkMax string
+	var opt_verify bool
+	var opt_check bool
+	var opt_mode string
+	var opt_keyfile string
+	var opt_convergent bool
+	var opt_passphraseFd int
+	var opt_passphraseCommand string
 
 	flags := flag.NewFlagSet("create", flag.ExitOnError)
 	flags.BoolVar(&opt_noencryption, "no-encryption", false, "disable transparent encryption")
 	flags.BoolVar(&opt_nocompression, "no-compression", false, "disable transparent compression")
 	flags.StringVar(&opt_hashing, "hashing", "SHA256", "swap the hashing function")
 	flags.StringVar(&opt_compression, "compression", "LZ4", "swap the compression function")
+	flags.StringVar(&opt_chunking, "chunking", "FASTCDC", "swap the content-defined chunking algorithm")
+	flags.StringVar(&opt_chunkMin, "chunk-min", "", "minimum size of the chunks, e.g. 64KiB")
+	flags.StringVar(&opt_chunkNormal, "chunk-normal", "", "average size of the chunks, e.g. 1MiB")
+	flags.StringVar(&opt_chunkMax, "chunk-max", "", "maximum size of the chunks, e.g. 4MiB")
+	flags.BoolVar(&opt_verify, "verify-on-read", false, "verify the checksum of data fetched from the repository")
+	flags.BoolVar(&opt_check, "check-before-write", false, "skip the upload of packfiles already present in the repository")
+	flags.StringVar(&opt_mode, "mode", storage.ModeReadWrite, "repository mode: readwrite, appendonly or readonly")
+	flags.StringVar(&opt_keyfile, "keyfile", "", "encrypt to the ECDSA public key in the given PEM file")
+	flags.BoolVar(&opt_convergent, "convergent", false, "encrypt identical chunks to identical blobs")
+	flags.IntVar(&opt_passphraseFd, "passphrase-fd", -1, "read the passphrase from the given file descriptor")
+	flags.StringVar(&opt_passphraseCommand, "passphrase-command", "", "use the output of the given command as passphrase")
 	flags.Parse(args)
 
 	storageConfiguration := storage.NewConfiguration()
+	storageConfiguration.VerifyOnRead = opt_verify
+	storageConfiguration.CheckBeforeWrite = opt_check
+	if err := storage.ValidateMode(opt_mode); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+		return 1
+	}
+	storageConfiguration.Mode = opt_mode
 	if opt_nocompression {
 		storageConfiguration.Compression = nil
 	} else {
@@ -69,11 +113,69 @@ func cmd_create(ctx *context.Context, _ *repository.Repository, args []string) i
 	}
 	storageConfiguration.Hashing = *hashingConfiguration
 
-	if !opt_noencryption {
+	chunkingConfiguration, err := chunking.LookupDefaultConfiguration(strings.ToUpper(opt_chunking))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+		return 1
+	}
+	for _, size := range []struct {
+		value string
+		size  *uint32
+	}{
+		{opt_chunkMin, &chunkingConfiguration.MinSize},
+		{opt_chunkNormal, &chunkingConfiguration.NormalSize},
+		{opt_chunkMax, &chunkingConfiguration.MaxSize},
+	} {
+		if size.value == "" {
+			continue
+		}
+		if *size.size, err = parseChunkSize(size.value); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+			return 1
+		}
+	}
+	if err := chunkingConfiguration.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+		return 1
+	}
+	storageConfiguration.Chunking = *chunkingConfiguration
+
+	if opt_convergent && (opt_noencryption || opt_keyfile != "") {
+		fmt.Fprintf(os.Stderr, "%s: %s: -convergent requires a passphrase-encrypted repository\n", flag.CommandLine.Name(), flags.Name())
+		return 1
+	}
+
+	if !opt_noencryption && opt_keyfile != "" {
+		data, err := os.ReadFile(opt_keyfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+			return 1
+		}
+		if _, err := encryption.ParsePublicKey(data); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), opt_keyfile, err)
+			return 1
+		}
+		storageConfiguration.Encryption.Algorithm = encryption.DefaultConfiguration().Algorithm
+		storageConfiguration.Encryption.PublicKey = string(data)
+	} else if !opt_noencryption {
 		var passphrase []byte
 
 		envPassphrase := os.Getenv("PLAKAR_PASSPHRASE")
-		if ctx.GetKeyFromFile() == "" {
+		if opt_passphraseFd != -1 {
+			tmp, err := utils.GetPassphraseFromFd(opt_passphraseFd)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+				return 1
+			}
+			passphrase = tmp
+		} else if opt_passphraseCommand != "" {
+			tmp, err := utils.GetPassphraseFromCommand(opt_passphraseCommand, utils.PassphraseCommandTimeout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+				return 1
+			}
+			passphrase = tmp
+		} else if ctx.GetKeyFromFile() == "" {
 			if envPassphrase != "" {
 				passphrase = []byte(envPassphrase)
 			} else {
@@ -99,6 +201,7 @@ func cmd_create(ctx *context.Context, _ *repository.Repository, args []string) i
 
 		storageConfiguration.Encryption.Algorithm = encryption.DefaultConfiguration().Algorithm
 		storageConfiguration.Encryption.Key = encryptionKey
+		storageConfiguration.Encryption.Convergent = opt_convergent
 	} else {
 		storageConfiguration.Encryption = nil
 	}
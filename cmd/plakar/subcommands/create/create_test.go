@@ -0,0 +1,100 @@
+package create
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/chunking"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/storage"
+
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestCreateChunkSizes(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.NewContext()
+	ctx.SetCacheDir(filepath.Join(tmpDir, "cache"))
+
+	create := func(name string, args ...string) (*chunking.Configuration, int) {
+		t.Helper()
+		repoDir := filepath.Join(tmpDir, name)
+		status := cmd_create(ctx, nil, append(append([]string{"-no-encryption"}, args...), repoDir))
+		if status != 0 {
+			return nil, status
+		}
+		store, err := storage.Open(ctx, repoDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		configuration := store.Configuration().Chunking
+		return &configuration, status
+	}
+
+	configuration, status := create("default")
+	if status != 0 {
+		t.Fatalf("create failed with status %d", status)
+	}
+	if *configuration != *chunking.DefaultConfiguration() {
+		t.Errorf("expected the default configuration, got %+v", configuration)
+	}
+
+	configuration, status = create("sizes", "-chunk-min", "32KiB", "-chunk-normal", "512KiB", "-chunk-max", "2MiB")
+	if status != 0 {
+		t.Fatalf("create failed with status %d", status)
+	}
+	expected := chunking.Configuration{Algorithm: "FASTCDC", MinSize: 32 * 1024, NormalSize: 512 * 1024, MaxSize: 2 * 1024 * 1024}
+	if *configuration != expected {
+		t.Errorf("expected %+v, got %+v", expected, configuration)
+	}
+
+	// only the maximum is changed, the others keep their default
+	configuration, status = create("max", "-chunk-max", "8388608")
+	if status != 0 {
+		t.Fatalf("create failed with status %d", status)
+	}
+	if configuration.MaxSize != 8*1024*1024 || configuration.MinSize != chunking.DefaultConfiguration().MinSize {
+		t.Errorf("unexpected configuration %+v", configuration)
+	}
+
+	for _, args := range [][]string{
+		{"-chunk-min", "2MiB", "-chunk-normal", "1MiB"},
+		{"-chunk-normal", "8MiB"},
+		{"-chunk-max", "512KiB"},
+		{"-chunk-min", "nope"},
+		{"-chunk-max", "8GiB"},
+	} {
+		if _, status := create("invalid", args...); status == 0 {
+			t.Errorf("%v: expected create to fail", args)
+		}
+		if _, err := storage.Open(ctx, filepath.Join(tmpDir, "invalid")); err == nil {
+			t.Fatalf("%v: a repository was created", args)
+		}
+	}
+}
+
+func TestCreateConvergent(t *testing.T) {
+	tmpDir := t.TempDir()
+	ctx := context.NewContext()
+	ctx.SetCacheDir(filepath.Join(tmpDir, "cache"))
+	t.Setenv("PLAKAR_PASSPHRASE", "strong passphrase")
+
+	repoDir := filepath.Join(tmpDir, "convergent")
+	if status := cmd_create(ctx, nil, []string{"-convergent", repoDir}); status != 0 {
+		t.Fatalf("create failed with status %d", status)
+	}
+	store, err := storage.Open(ctx, repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if encryption := store.Configuration().Encryption; encryption == nil || !encryption.Convergent {
+		t.Fatalf("expected convergent encryption, got %+v", encryption)
+	}
+
+	repoDir = filepath.Join(tmpDir, "unencrypted")
+	if status := cmd_create(ctx, nil, []string{"-convergent", "-no-encryption", repoDir}); status == 0 {
+		t.Fatal("expected -convergent to require encryption")
+	}
+}
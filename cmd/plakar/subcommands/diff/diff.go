@@ -17,12 +17,16 @@
 package diff
 
 import (
+	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
@@ -40,17 +44,23 @@ func init() {
 
 func cmd_diff(ctx *context.Context, repo *repository.Repository, args []string) int {
 	var opt_highlight bool
+	var opt_stat bool
 	flags := flag.NewFlagSet("diff", flag.ExitOnError)
 	flags.BoolVar(&opt_highlight, "highlight", false, "highlight output")
+	flags.BoolVar(&opt_stat, "stat", false, "show which fields of the changed paths differ")
 	flags.Parse(args)
 
-	if flags.NArg() != 2 {
+	if flags.NArg() != 2 && flags.NArg() != 3 {
 		fmt.Println("args", flags.Args())
 		log.Fatalf("%s: needs two snapshot ID and/or snapshot files to diff", flag.CommandLine.Name())
 	}
 
 	snapshotPrefix1, pathname1 := utils.ParseSnapshotID(flags.Arg(0))
 	snapshotPrefix2, pathname2 := utils.ParseSnapshotID(flags.Arg(1))
+	if flags.NArg() == 3 {
+		_, pathname1 = utils.ParseSnapshotID(":" + flags.Arg(2))
+		pathname2 = pathname1
+	}
 
 	snap1, err := utils.OpenSnapshotByPrefix(repo, snapshotPrefix1)
 	if err != nil {
@@ -64,7 +74,7 @@ func cmd_diff(ctx *context.Context, repo *repository.Repository, args []string)
 
 	var diff string
 	if pathname1 == "" && pathname2 == "" {
-		diff, err = diff_filesystems(snap1, snap2)
+		diff, err = diff_filesystems(snap1, snap2, opt_stat)
 		if err != nil {
 			log.Fatalf("%s: could not diff snapshots: %s", flag.CommandLine.Name(), err)
 		}
@@ -75,7 +85,7 @@ func cmd_diff(ctx *context.Context, repo *repository.Repository, args []string)
 		if pathname2 == "" {
 			pathname2 = pathname1
 		}
-		diff, err = diff_pathnames(snap1, pathname1, snap2, pathname2)
+		diff, err = diff_pathnames(snap1, pathname1, snap2, pathname2, opt_stat)
 		if err != nil {
 			log.Fatalf("%s: could not diff pathnames: %s", flag.CommandLine.Name(), err)
 		}
@@ -92,7 +102,7 @@ func cmd_diff(ctx *context.Context, repo *repository.Repository, args []string)
 	return 0
 }
 
-func diff_filesystems(snap1 *snapshot.Snapshot, snap2 *snapshot.Snapshot) (string, error) {
+func diff_filesystems(snap1 *snapshot.Snapshot, snap2 *snapshot.Snapshot, stat bool) (string, error) {
 	vfs1, err := snap1.Filesystem()
 	if err != nil {
 		return "", err
@@ -103,15 +113,10 @@ func diff_filesystems(snap1 *snapshot.Snapshot, snap2 *snapshot.Snapshot) (strin
 		return "", err
 	}
 
-	stat1, err1 := vfs1.Stat("/")
-	stat2, err2 := vfs2.Stat("/")
-	if err1 != nil && err2 != nil {
-		return "", fmt.Errorf("root not found in both snapshots")
-	}
-	return diff_directories(stat1.(*vfs.DirEntry), stat2.(*vfs.DirEntry))
+	return diff_trees(vfs1, vfs2, "/", stat)
 }
 
-func diff_pathnames(snap1 *snapshot.Snapshot, pathname1 string, snap2 *snapshot.Snapshot, pathname2 string) (string, error) {
+func diff_pathnames(snap1 *snapshot.Snapshot, pathname1 string, snap2 *snapshot.Snapshot, pathname2 string, stat bool) (string, error) {
 	vfs1, err := snap1.Filesystem()
 	if err != nil {
 		return "", err
@@ -128,31 +133,82 @@ func diff_pathnames(snap1 *snapshot.Snapshot, pathname1 string, snap2 *snapshot.
 		return "", fmt.Errorf("file not found in both snapshots")
 	}
 
-	dirEntry1, isDir1 := stat1.(*vfs.DirEntry)
-	dirEntry2, isDir2 := stat2.(*vfs.DirEntry)
-	if isDir1 && isDir2 {
-		return diff_directories(dirEntry1, dirEntry2)
-	}
-
 	fileEntry1, isFile1 := stat1.(*vfs.FileEntry)
 	fileEntry2, isFile2 := stat2.(*vfs.FileEntry)
 	if isFile1 && isFile2 {
 		return diff_files(snap1, fileEntry1, snap2, fileEntry2)
 	}
 
-	return "", fmt.Errorf("not implemented yet")
+	if pathname1 != pathname2 {
+		return "", fmt.Errorf("directories can only be compared at the same path")
+	}
+	return diff_trees(vfs1, vfs2, pathname1, stat)
 }
 
-func diff_directories(dirEntry1 *vfs.DirEntry, dirEntry2 *vfs.DirEntry) (string, error) {
-	_ = dirEntry1
-	_ = dirEntry2
-	return "", fmt.Errorf("not implemented yet")
+// diff_trees lists the paths added, removed or changed below pathname,
+// one per line prefixed with '+', '-' or '~'.
+func diff_trees(vfs1 *vfs.Filesystem, vfs2 *vfs.Filesystem, pathname string, stat bool) (string, error) {
+	differences, err := vfs1.Diff(vfs2, pathname)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	for _, difference := range differences {
+		if stat && difference.Kind == vfs.DiffChanged {
+			fmt.Fprintf(&buf, "%s %s (%s)\n", difference.Kind, difference.Pathname, strings.Join(difference.Fields, ", "))
+		} else {
+			fmt.Fprintf(&buf, "%s %s\n", difference.Kind, difference.Pathname)
+		}
+	}
+	return buf.String(), nil
 }
 
-func diff_files(snap1 *snapshot.Snapshot, fileEntry1 *vfs.FileEntry, snap2 *snapshot.Snapshot, fileEntry2 *vfs.FileEntry) (string, error) {
-	_ = fileEntry1
-	_ = fileEntry2
+// binaryProbeSize is how much of a file is inspected to tell whether it
+// is text before computing a line diff.
+const binaryProbeSize = 8000
+
+// readLines reads the lines of a text file from a snapshot.  It stops
+// reading as soon as the content is found not to be UTF-8 text, in which
+// case isText is false.  A file missing from the snapshot has no lines.
+func readLines(snap *snapshot.Snapshot, filename string) (lines []string, isText bool, err error) {
+	rd, err := snap.NewReader(filename)
+	if err != nil {
+		return []string{}, true, nil
+	}
+
+	bufrd := bufio.NewReaderSize(rd, binaryProbeSize)
+	probe, err := bufrd.Peek(binaryProbeSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, false, err
+	}
+	if bytes.IndexByte(probe, 0) != -1 {
+		return nil, false, nil
+	}
+
+	lines = make([]string, 0)
+	for {
+		line, err := bufrd.ReadString('\n')
+		if len(line) != 0 {
+			if !utf8.ValidString(line) {
+				return nil, false, nil
+			}
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return lines, true, nil
+}
 
+func diff_files(snap1 *snapshot.Snapshot, fileEntry1 *vfs.FileEntry, snap2 *snapshot.Snapshot, fileEntry2 *vfs.FileEntry) (string, error) {
 	if fileEntry1.Object.Checksum == fileEntry2.Object.Checksum {
 		fmt.Printf("%s:%s and %s:%s are identical\n",
 			fmt.Sprintf("%x", snap1.Header.GetIndexShortID()), filepath.Join(fileEntry1.ParentPath, fileEntry1.Stat().Name()),
@@ -162,30 +218,30 @@ func diff_files(snap1 *snapshot.Snapshot, fileEntry1 *vfs.FileEntry, snap2 *snap
 
 	filename1 := filepath.Join(fileEntry1.ParentPath, fileEntry1.Stat().Name())
 	filename2 := filepath.Join(fileEntry2.ParentPath, fileEntry2.Stat().Name())
+	fromFile := fmt.Sprintf("%x", snap1.Header.GetIndexShortID()) + ":" + filename1
+	toFile := fmt.Sprintf("%x", snap2.Header.GetIndexShortID()) + ":" + filename2
 
-	buf1 := make([]byte, 0)
-	rd1, err := snap1.NewReader(filename1)
-	if err == nil {
-		buf1, err = io.ReadAll(rd1)
-		if err != nil {
-			return "", err
-		}
+	lines1, isText1, err := readLines(snap1, filename1)
+	if err != nil {
+		return "", err
 	}
-
-	buf2 := make([]byte, 0)
-	rd2, err := snap2.NewReader(filename2)
-	if err == nil {
-		buf2, err = io.ReadAll(rd2)
+	var lines2 []string
+	isText2 := false
+	if isText1 {
+		lines2, isText2, err = readLines(snap2, filename2)
 		if err != nil {
 			return "", err
 		}
 	}
+	if !isText1 || !isText2 {
+		return fmt.Sprintf("Binary files %s and %s differ\n", fromFile, toFile), nil
+	}
 
 	diff := difflib.UnifiedDiff{
-		A:        difflib.SplitLines(string(buf1)),
-		B:        difflib.SplitLines(string(buf2)),
-		FromFile: fmt.Sprintf("%x", snap1.Header.GetIndexShortID()) + ":" + filename1,
-		ToFile:   fmt.Sprintf("%x", snap2.Header.GetIndexShortID()) + ":" + filename2,
+		A:        lines1,
+		B:        lines2,
+		FromFile: fromFile,
+		ToFile:   toFile,
 		Context:  3,
 	}
 	text, err := difflib.GetUnifiedDiffString(diff)
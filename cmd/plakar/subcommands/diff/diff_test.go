@@ -0,0 +1,184 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/PlakarKorp/plakar/storage"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		pathname := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pathname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// backupSnapshots backs up sourceDir before and after calling modify and
+// returns both snapshots.
+func backupSnapshots(t *testing.T, sourceDir string, modify func()) (*snapshot.Snapshot, *snapshot.Snapshot) {
+	configuration := storage.NewConfiguration()
+	configuration.Compression = nil
+	configuration.Encryption = nil
+	repo := testutil.NewRepository(t, configuration)
+
+	snap1 := testutil.Backup(t, repo, sourceDir)
+	modify()
+	snap2 := testutil.Backup(t, repo, sourceDir)
+	return snap1, snap2
+}
+
+func filesystems(t *testing.T, snap1, snap2 *snapshot.Snapshot) (*vfs.Filesystem, *vfs.Filesystem) {
+	vfs1, err := snap1.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vfs2, err := snap2.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vfs1, vfs2
+}
+
+func TestDiffFilesystems(t *testing.T) {
+	sourceDir := filepath.ToSlash(filepath.Join(t.TempDir(), "source"))
+	writeFiles(t, sourceDir, map[string]string{
+		"keep.txt":       "unchanged",
+		"change.txt":     "before",
+		"remove.txt":     "removed",
+		"dir/old.txt":    "old",
+		"gone/inner.txt": "inner",
+	})
+
+	snap1, snap2 := backupSnapshots(t, sourceDir, func() {
+		writeFiles(t, sourceDir, map[string]string{
+			"change.txt":       "after the change",
+			"new.txt":          "added",
+			"newdir/inner.txt": "added too",
+		})
+		for _, name := range []string{"remove.txt", "gone"} {
+			if err := os.RemoveAll(filepath.Join(sourceDir, name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	vfs1, vfs2 := filesystems(t, snap1, snap2)
+
+	differences, err := vfs1.Diff(vfs2, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]vfs.Difference)
+	for _, difference := range differences {
+		if strings.HasPrefix(difference.Pathname, sourceDir+"/") {
+			got[strings.TrimPrefix(difference.Pathname, sourceDir+"/")] = difference
+		}
+	}
+
+	expected := map[string]vfs.DiffKind{
+		"change.txt":       vfs.DiffChanged,
+		"gone":             vfs.DiffRemoved,
+		"gone/inner.txt":   vfs.DiffRemoved,
+		"new.txt":          vfs.DiffAdded,
+		"newdir":           vfs.DiffAdded,
+		"newdir/inner.txt": vfs.DiffAdded,
+		"remove.txt":       vfs.DiffRemoved,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %d differences, got %d: %v", len(expected), len(got), differences)
+	}
+	for name, kind := range expected {
+		difference, exists := got[name]
+		if !exists {
+			t.Errorf("%s: missing difference", name)
+			continue
+		}
+		if difference.Kind != kind {
+			t.Errorf("%s: expected %s, got %s", name, kind, difference.Kind)
+		}
+	}
+
+	fields := strings.Join(got["change.txt"].Fields, ",")
+	if !strings.Contains(fields, "size") || !strings.Contains(fields, "content") {
+		t.Errorf("expected size and content to differ for change.txt, got %s", fields)
+	}
+
+	// restricting the comparison to an unchanged directory
+	differences, err = vfs1.Diff(vfs2, sourceDir+"/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(differences) != 0 {
+		t.Errorf("expected no difference in dir, got %v", differences)
+	}
+
+	output, err := diff_trees(vfs1, vfs2, sourceDir+"/newdir", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "+ " + sourceDir + "/newdir\n+ " + sourceDir + "/newdir/inner.txt\n"; output != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+
+	output, err = diff_trees(vfs1, vfs2, sourceDir+"/change.txt", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(output, "~ "+sourceDir+"/change.txt (size") {
+		t.Errorf("unexpected stat output %q", output)
+	}
+}
+
+func TestDiffFileContents(t *testing.T) {
+	sourceDir := filepath.ToSlash(filepath.Join(t.TempDir(), "source"))
+	writeFiles(t, sourceDir, map[string]string{
+		"text.txt":   "one\ntwo\nthree\n",
+		"binary.bin": "\x00\x01\x02\x03",
+		"latin1.txt": "caf\xe9\n",
+	})
+
+	snap1, snap2 := backupSnapshots(t, sourceDir, func() {
+		writeFiles(t, sourceDir, map[string]string{
+			"text.txt":   "one\n2\nthree\nfour",
+			"binary.bin": "\x00\x01\x02\x04",
+			"latin1.txt": "caf\xe8\n",
+		})
+	})
+
+	output, err := diff_pathnames(snap1, sourceDir+"/text.txt", snap2, sourceDir+"/text.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{" one\n", "-two\n", "+2\n", " three\n", "+four\n"} {
+		if !strings.Contains(output, "\n"+line) {
+			t.Errorf("expected %q in the diff, got:\n%s", line, output)
+		}
+	}
+	if !strings.HasPrefix(output, "--- ") {
+		t.Errorf("expected a unified diff, got:\n%s", output)
+	}
+
+	for _, name := range []string{"binary.bin", "latin1.txt"} {
+		output, err := diff_pathnames(snap1, sourceDir+"/"+name, snap2, sourceDir+"/"+name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(output, "Binary files ") || !strings.HasSuffix(output, " differ\n") {
+			t.Errorf("%s: expected binary files to differ, got %q", name, output)
+		}
+	}
+}
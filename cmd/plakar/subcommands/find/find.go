@@ -19,8 +19,9 @@ package find
 import (
 	"flag"
 	"fmt"
-	"log"
-	"path/filepath"
+	"io"
+	"os"
+	"path"
 	"sort"
 	"strings"
 	"time"
@@ -28,8 +29,10 @@ import (
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
 )
 
 func init() {
@@ -41,75 +44,98 @@ func cmd_find(ctx *context.Context, repo *repository.Repository, args []string)
 	flags.Parse(args)
 
 	if flags.NArg() < 1 {
-		log.Fatalf("%s: need at least a chunk prefix to search", flag.CommandLine.Name())
+		logger.Error("usage: %s pattern ...", flags.Name())
+		return 1
 	}
 
-	result := make(map[*snapshot.Snapshot]map[string]bool)
-	snapshotsList, err := utils.GetSnapshotsList(repo)
+	snapshots, err := utils.GetSnapshots(repo, nil)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
 	}
-	for _, snapshotUuid := range snapshotsList {
-		snap, err := snapshot.Load(repo, snapshotUuid)
-		if err != nil {
-			log.Fatal(err)
-			return 1
-		}
 
+	if err := find(os.Stdout, snapshots, flags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+	return 0
+}
+
+// find writes, for each snapshot in turn, the size and modification time
+// of the pathnames matching the patterns, so that the history of a file
+// can be followed across snapshots.
+func find(w io.Writer, snapshots []*snapshot.Snapshot, patterns []string) error {
+	for _, snap := range snapshots {
 		fs, err := snap.Filesystem()
 		if err != nil {
-			log.Fatal(err)
-			return 1
+			return err
+		}
+		pathnames, err := findPathnames(fs, patterns)
+		if err != nil {
+			return err
 		}
 
-		result[snap] = make(map[string]bool)
-
-		for _, arg := range flags.Args() {
-			// try finding a pathname to a directory of file
-			if strings.Contains(arg, "/") {
-				for pathname := range fs.Pathnames() {
-					if pathname == arg {
-						if exists := result[snap][pathname]; !exists {
-							result[snap][pathname] = true
-						}
-					}
-				}
+		for _, pathname := range pathnames {
+			entry, err := fs.Stat(pathname)
+			if err != nil {
+				return err
 			}
-
-			// try finding a directory or file
-			for name := range fs.Pathnames() {
-				if filepath.Base(name) == arg {
-					if exists := result[snap][arg]; !exists {
-						result[snap][name] = true
-					}
-				}
+			var size int64
+			var mtime time.Time
+			switch entry := entry.(type) {
+			case *vfs.FileEntry:
+				size, mtime = entry.Stat().Size(), entry.Stat().ModTime()
+			case *vfs.DirEntry:
+				size, mtime = entry.Stat().Size(), entry.Stat().ModTime()
 			}
-
+			fmt.Fprintf(w, "%s  %x %12d %s %s\n",
+				snap.Header.CreationTime.UTC().Format(time.RFC3339),
+				snap.Header.GetIndexShortID(),
+				size,
+				mtime.UTC().Format(time.RFC3339),
+				pathname)
 		}
 	}
+	return nil
+}
 
-	snapshots := make([]*snapshot.Snapshot, 0)
-	for snap := range result {
-		snapshots = append(snapshots, snap)
-	}
-	sort.Slice(snapshots, func(i, j int) bool {
-		return snapshots[i].Header.CreationTime.Before(snapshots[j].Header.CreationTime)
-	})
-
-	for _, snap := range snapshots {
-		files := make([]string, 0)
-		for file := range result[snap] {
-			files = append(files, file)
+// findPathnames returns the sorted pathnames of the filesystem matching
+// the patterns. A pattern containing a slash is matched against whole
+// pathnames, any other against the names of files and directories.
+func findPathnames(fs *vfs.Filesystem, patterns []string) ([]string, error) {
+	found := make(map[string]struct{})
+	var names []string
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "/") {
+			pathnames, err := fs.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", pattern, err)
+			}
+			for _, pathname := range pathnames {
+				found[pathname] = struct{}{}
+			}
+		} else {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%s: %w", pattern, err)
+			}
+			names = append(names, pattern)
 		}
+	}
 
-		sort.Slice(files, func(i, j int) bool {
-			return files[i] < files[j]
-		})
-
-		for _, pathname := range files {
-			fmt.Printf("%s  %x %s\n", snap.Header.CreationTime.UTC().Format(time.RFC3339), snap.Header.GetIndexShortID(), pathname)
+	if len(names) != 0 {
+		for pathname := range fs.Pathnames() {
+			for _, name := range names {
+				if matched, _ := path.Match(name, path.Base(pathname)); matched {
+					found[pathname] = struct{}{}
+				}
+			}
 		}
 	}
 
-	return 0
+	ret := make([]string, 0, len(found))
+	for pathname := range found {
+		ret = append(ret, pathname)
+	}
+	sort.Strings(ret)
+	return ret, nil
 }
@@ -0,0 +1,108 @@
+package find
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestFind(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	passwd := filepath.Join(sourceDir, "etc", "passwd")
+	group := filepath.Join(sourceDir, "etc", "group")
+
+	store := testutil.NewStore(t, nil)
+	backup := func() {
+		testutil.Backup(t, testutil.OpenRepository(t, store), sourceDir)
+	}
+	write := func(pathname, content string, mtime time.Time) {
+		if err := os.WriteFile(pathname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(pathname, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// passwd is created, removed, then restored with another content
+	first := time.Date(2024, 11, 1, 10, 0, 0, 0, time.UTC)
+	second := time.Date(2024, 11, 12, 10, 0, 0, 0, time.UTC)
+	write(passwd, "root", first)
+	write(group, "wheel", first)
+	backup()
+	if err := os.Remove(passwd); err != nil {
+		t.Fatal(err)
+	}
+	backup()
+	write(passwd, "root\nuser", second)
+	backup()
+
+	snapshots, err := utils.GetSnapshots(testutil.OpenRepository(t, store), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 3 {
+		t.Fatalf("expected 3 snapshots, got %d", len(snapshots))
+	}
+
+	lines := func(patterns ...string) []string {
+		var buf strings.Builder
+		if err := find(&buf, snapshots, patterns); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	}
+	line := func(i int, size int, mtime time.Time, pathname string) string {
+		hdr := snapshots[i].Header
+		return fmt.Sprintf("%s  %x %12d %s %s", hdr.CreationTime.UTC().Format(time.RFC3339),
+			hdr.GetIndexShortID(), size, mtime.Format(time.RFC3339), filepath.ToSlash(pathname))
+	}
+
+	expected := []string{
+		line(0, 4, first, passwd),
+		line(2, 9, second, passwd),
+	}
+	for _, patterns := range [][]string{
+		{filepath.ToSlash(passwd)},
+		{"passwd"},
+		{"pass*"},
+		{filepath.ToSlash(filepath.Join(sourceDir, "*", "pass?d"))},
+	} {
+		if got := lines(patterns...); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%v: expected\n%s\ngot\n%s", patterns, strings.Join(expected, "\n"), strings.Join(got, "\n"))
+		}
+	}
+
+	// a pathname is listed once even if several patterns match it
+	got := lines(filepath.ToSlash(filepath.Join(sourceDir, "etc", "*")), "passwd")
+	expected = []string{
+		line(0, 5, first, group),
+		line(0, 4, first, passwd),
+		line(1, 5, first, group),
+		line(2, 5, first, group),
+		line(2, 9, second, passwd),
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	if got := lines("shadow"); len(got) != 1 || got[0] != "" {
+		t.Errorf("expected no match, got %q", got)
+	}
+	if err := find(&strings.Builder{}, snapshots, []string{"/etc/["}); err == nil {
+		t.Error("expected an invalid pattern to be reported")
+	}
+}
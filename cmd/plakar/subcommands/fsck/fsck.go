@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package fsck
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+func init() {
+	subcommands.Register("fsck", cmd_fsck)
+}
+
+func cmd_fsck(ctx *context.Context, repo *repository.Repository, args []string) int {
+	var opt_repair bool
+	var opt_force bool
+
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	flags.BoolVar(&opt_repair, "repair", false, "delete the packfiles not referenced by any snapshot")
+	flags.BoolVar(&opt_force, "force", false, "break an expired repository lock, or proceed without one")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		logger.Error("usage: %s [-repair [-force]]", flags.Name())
+		return 1
+	}
+
+	if opt_repair {
+		if !repo.Store().CanLock() && !opt_force {
+			fmt.Fprintf(os.Stderr, "%s: repository can't be locked, use -force to proceed anyway\n", flags.Name())
+			return 1
+		}
+		if err := repo.Store().Lock(opt_force); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+			return 1
+		}
+		defer repo.Store().Unlock()
+	}
+
+	report, err := snapshot.Fsck(repo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+
+	for _, dangling := range report.Dangling {
+		if dangling.Packfile == (objects.Checksum{}) {
+			fmt.Printf("%x: dangling reference to %s: unknown to the state\n",
+				dangling.SnapshotID[:4], dangling.Reference)
+		} else {
+			fmt.Printf("%x: dangling reference to %s: packfile %x is missing\n",
+				dangling.SnapshotID[:4], dangling.Reference, dangling.Packfile)
+		}
+	}
+	for _, orphan := range report.Orphans {
+		fmt.Printf("orphaned packfile %x\n", orphan)
+	}
+
+	if opt_repair && len(report.Dangling) != 0 && len(report.Orphans) != 0 {
+		// the snapshots with dangling references were not fully walked,
+		// the packfiles they still use may be among the orphans.
+		fmt.Fprintf(os.Stderr, "%s: refusing to delete packfiles while references are dangling\n", flags.Name())
+		return 1
+	}
+
+	if opt_repair && len(report.Orphans) != 0 {
+		if err := repo.DeletePackfiles(report.Orphans); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: could not delete orphaned packfiles: %s\n", flags.Name(), err)
+			return 1
+		}
+		logger.Info("deleted %d orphaned packfiles", len(report.Orphans))
+		report.Orphans = nil
+	}
+
+	logger.Info("%d snapshots checked: %d dangling references, %d orphaned packfiles",
+		report.Snapshots, len(report.Dangling), len(report.Orphans))
+
+	if len(report.Dangling) != 0 || len(report.Orphans) != 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package gc
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+func init() {
+	subcommands.Register("gc", cmd_gc)
+}
+
+func cmd_gc(ctx *context.Context, repo *repository.Repository, args []string) int {
+	var opt_dryRun bool
+	var opt_force bool
+
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	flags.BoolVar(&opt_dryRun, "dry-run", false, "list the packfiles to delete without deleting them")
+	flags.BoolVar(&opt_force, "force", false, "break an expired repository lock, or proceed without one")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		logger.Error("usage: %s [-dry-run] [-force]", flags.Name())
+		return 1
+	}
+
+	if !opt_dryRun {
+		if !repo.Store().CanLock() && !opt_force {
+			fmt.Fprintf(os.Stderr, "%s: repository can't be locked, use -force to proceed anyway\n", flags.Name())
+			return 1
+		}
+		if err := repo.Store().Lock(opt_force); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+			return 1
+		}
+		defer repo.Store().Unlock()
+	}
+
+	unreferenced, err := snapshot.UnreferencedPackfiles(repo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+
+	if opt_dryRun {
+		for _, checksum := range unreferenced {
+			fmt.Printf("would delete packfile %x\n", checksum)
+		}
+		return 0
+	}
+
+	if err := repo.DeletePackfiles(unreferenced); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+	logger.Info("deleted %d unreferenced packfiles", len(unreferenced))
+	return 0
+}
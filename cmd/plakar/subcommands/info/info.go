@@ -22,10 +22,12 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -39,6 +41,7 @@ import (
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/repository/state"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/PlakarKorp/plakar/storage"
 	"github.com/dustin/go-humanize"
 	"github.com/google/uuid"
 )
@@ -48,15 +51,20 @@ func init() {
 }
 
 func cmd_info(ctx *context.Context, repo *repository.Repository, args []string) int {
-	if len(args) == 0 {
-		return info_repository(repo)
-	}
+	var opt_json bool
 
 	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	flags.BoolVar(&opt_json, "json", false, "output the repository information as JSON")
 	flags.Parse(args)
 
 	// Determine which concept to show information for based on flags.Args()[0]
 	switch flags.Arg(0) {
+	case "", "repository":
+		if err := info_repository(os.Stdout, repo, opt_json); err != nil {
+			logger.Error("error: %s", err)
+			return 1
+		}
+
 	case "snapshot":
 		if len(flags.Args()) < 2 {
 			logger.Error("usage: %s snapshot snapshotID", flags.Name())
@@ -100,62 +108,110 @@ func cmd_info(ctx *context.Context, repo *repository.Repository, args []string)
 		}
 
 	default:
-		fmt.Println("Invalid parameter. usage: info [snapshot|object|chunk|state|packfile|vfs]")
+		fmt.Println("Invalid parameter. usage: info [repository|snapshot|object|chunk|state|packfile|vfs]")
 		return 1
 	}
 
 	return 0
 }
 
-func info_repository(repo *repository.Repository) int {
+// redacted replaces the key material in the information printed.
+const redacted = "<redacted>"
+
+// repositoryInfo is the configuration of a repository as stored in its
+// CONFIG, with the key material redacted, along with a summary of its
+// snapshots.
+type repositoryInfo struct {
+	storage.Configuration
+	Snapshots int
+	Size      uint64
+}
+
+func collectRepositoryInfo(repo *repository.Repository) (*repositoryInfo, error) {
 	metadatas, err := utils.GetHeaders(repo, nil)
 	if err != nil {
-		logger.Warn("%s", err)
-		return 1
+		return nil, err
 	}
 
-	fmt.Println("Version:", repo.Configuration().Version)
-	fmt.Println("CreationTime:", repo.Configuration().CreationTime)
-	fmt.Println("RepositoryID:", repo.Configuration().RepositoryID)
-
-	fmt.Println("Packfile:")
-	fmt.Printf(" - MaxSize: %s (%d bytes)\n",
-		humanize.Bytes(uint64(repo.Configuration().Packfile.MaxSize)),
-		repo.Configuration().Packfile.MaxSize)
-
-	fmt.Println("Chunking:")
-	fmt.Println(" - Algorithm:", repo.Configuration().Chunking.Algorithm)
-	fmt.Printf(" - MinSize: %s (%d bytes)\n",
-		humanize.Bytes(uint64(repo.Configuration().Chunking.MinSize)), repo.Configuration().Chunking.MinSize)
-	fmt.Printf(" - NormalSize: %s (%d bytes)\n",
-		humanize.Bytes(uint64(repo.Configuration().Chunking.NormalSize)), repo.Configuration().Chunking.NormalSize)
-	fmt.Printf(" - MaxSize: %s (%d bytes)\n",
-		humanize.Bytes(uint64(repo.Configuration().Chunking.MaxSize)), repo.Configuration().Chunking.MaxSize)
-
-	fmt.Println("Hashing:")
-	fmt.Println(" - Algorithm:", repo.Configuration().Hashing.Algorithm)
-	fmt.Println(" - Bits:", repo.Configuration().Hashing.Bits)
-
-	if repo.Configuration().Compression != nil {
-		fmt.Println("Compression:")
-		fmt.Println(" - Algorithm:", repo.Configuration().Compression.Algorithm)
-		fmt.Println(" - Level:", repo.Configuration().Compression.Level)
+	info := &repositoryInfo{
+		Configuration: repo.Configuration(),
+		Snapshots:     len(metadatas),
+	}
+	if info.Mode == "" {
+		info.Mode = storage.ModeReadWrite
+	}
+	if info.Encryption != nil {
+		encryption := *info.Encryption
+		if encryption.Key != "" {
+			encryption.Key = redacted
+		}
+		info.Encryption = &encryption
 	}
+	for _, metadata := range metadatas {
+		info.Size += metadata.Summary.Directory.Size + metadata.Summary.Below.Size
+	}
+	return info, nil
+}
 
-	if repo.Configuration().Encryption != nil {
-		fmt.Println("Encryption:")
-		fmt.Println(" - Algorithm:", repo.Configuration().Encryption.Algorithm)
-		fmt.Println(" - Key:", repo.Configuration().Encryption.Key)
+func info_repository(w io.Writer, repo *repository.Repository, opt_json bool) error {
+	info, err := collectRepositoryInfo(repo)
+	if err != nil {
+		return err
 	}
 
-	fmt.Println("Snapshots:", len(metadatas))
-	totalSize := uint64(0)
-	for _, metadata := range metadatas {
-		totalSize += metadata.Summary.Directory.Size + metadata.Summary.Below.Size
+	if opt_json {
+		return json.NewEncoder(w).Encode(info)
 	}
-	fmt.Printf("Size: %s (%d bytes)\n", humanize.Bytes(totalSize), totalSize)
 
-	return 0
+	fmt.Fprintln(w, "Version:", info.Version)
+	fmt.Fprintln(w, "CreationTime:", info.CreationTime)
+	fmt.Fprintln(w, "RepositoryID:", info.RepositoryID)
+
+	fmt.Fprintln(w, "Packfile:")
+	fmt.Fprintf(w, " - MaxSize: %s (%d bytes)\n",
+		humanize.Bytes(uint64(info.Packfile.MaxSize)), info.Packfile.MaxSize)
+
+	fmt.Fprintln(w, "Chunking:")
+	fmt.Fprintln(w, " - Algorithm:", info.Chunking.Algorithm)
+	fmt.Fprintf(w, " - MinSize: %s (%d bytes)\n",
+		humanize.Bytes(uint64(info.Chunking.MinSize)), info.Chunking.MinSize)
+	fmt.Fprintf(w, " - NormalSize: %s (%d bytes)\n",
+		humanize.Bytes(uint64(info.Chunking.NormalSize)), info.Chunking.NormalSize)
+	fmt.Fprintf(w, " - MaxSize: %s (%d bytes)\n",
+		humanize.Bytes(uint64(info.Chunking.MaxSize)), info.Chunking.MaxSize)
+
+	fmt.Fprintln(w, "Hashing:")
+	fmt.Fprintln(w, " - Algorithm:", info.Hashing.Algorithm)
+	fmt.Fprintln(w, " - Bits:", info.Hashing.Bits)
+
+	if info.Compression != nil {
+		fmt.Fprintln(w, "Compression:")
+		fmt.Fprintln(w, " - Algorithm:", info.Compression.Algorithm)
+		fmt.Fprintln(w, " - Level:", info.Compression.Level)
+	}
+
+	if info.Encryption != nil {
+		fmt.Fprintln(w, "Encryption:")
+		fmt.Fprintln(w, " - Algorithm:", info.Encryption.Algorithm)
+		if info.Encryption.Key != "" {
+			fmt.Fprintln(w, " - Key:", info.Encryption.Key)
+		}
+		if info.Encryption.PublicKey != "" {
+			fmt.Fprintln(w, " - Keyfile: yes")
+		}
+		if info.Encryption.Convergent {
+			fmt.Fprintln(w, " - Convergent: yes")
+		}
+	}
+
+	fmt.Fprintln(w, "VerifyOnRead:", info.VerifyOnRead)
+	fmt.Fprintln(w, "CheckBeforeWrite:", info.CheckBeforeWrite)
+	fmt.Fprintln(w, "Mode:", info.Mode)
+
+	fmt.Fprintln(w, "Snapshots:", info.Snapshots)
+	fmt.Fprintf(w, "Size: %s (%d bytes)\n", humanize.Bytes(info.Size), info.Size)
+
+	return nil
 }
 
 func info_snapshot(repo *repository.Repository, snapshotID string) error {
@@ -206,6 +262,10 @@ func info_snapshot(repo *repository.Repository, snapshotID string) error {
 	fmt.Printf(" - ProcessID: %s\n", header.GetContext("ProcessID"))
 	fmt.Printf(" - Client: %s\n", header.GetContext("Client"))
 	fmt.Printf(" - CommandLine: %s\n", header.GetContext("CommandLine"))
+	if database := header.GetContext("DatabaseName"); database != "" {
+		fmt.Printf(" - DatabaseName: %s\n", database)
+		fmt.Printf(" - DumpTimestamp: %s\n", header.GetContext("DumpTimestamp"))
+	}
 
 	fmt.Println("Summary:")
 	fmt.Printf(" - Directories: %d\n", header.Summary.Directory.Directories+header.Summary.Below.Directories)
@@ -494,6 +554,9 @@ func info_vfs(repo *repository.Repository, snapshotPath string) error {
 		fmt.Printf("Size: %s (%d bytes)\n", humanize.Bytes(uint64(dirEntry.Stat().Size())), dirEntry.Stat().Size())
 		fmt.Printf("Permissions: %s\n", dirEntry.Stat().Mode())
 		fmt.Printf("ModTime: %s\n", dirEntry.Stat().ModTime())
+		if !dirEntry.Stat().BirthTime().IsZero() {
+			fmt.Printf("BirthTime: %s\n", dirEntry.Stat().BirthTime())
+		}
 		fmt.Printf("DeviceID: %d\n", dirEntry.Stat().Dev())
 		fmt.Printf("InodeID: %d\n", dirEntry.Stat().Ino())
 		fmt.Printf("UserID: %d\n", dirEntry.Stat().Uid())
@@ -582,6 +645,9 @@ func info_vfs(repo *repository.Repository, snapshotPath string) error {
 		fmt.Printf("Size: %s (%d bytes)\n", humanize.Bytes(uint64(fileEntry.Stat().Size())), fileEntry.Stat().Size())
 		fmt.Printf("Permissions: %s\n", fileEntry.Stat().Mode())
 		fmt.Printf("ModTime: %s\n", fileEntry.Stat().ModTime())
+		if !fileEntry.Stat().BirthTime().IsZero() {
+			fmt.Printf("BirthTime: %s\n", fileEntry.Stat().BirthTime())
+		}
 		fmt.Printf("DeviceID: %d\n", fileEntry.Stat().Dev())
 		fmt.Printf("InodeID: %d\n", fileEntry.Stat().Ino())
 		fmt.Printf("UserID: %d\n", fileEntry.Stat().Uid())
@@ -0,0 +1,86 @@
+package info
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/storage"
+
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestInfoRepository(t *testing.T) {
+	configuration := storage.NewConfiguration()
+	configuration.Encryption.Key = "c2VjcmV0IGtleSBtYXRlcmlhbA=="
+	repo := testutil.NewRepository(t, configuration)
+
+	var buf bytes.Buffer
+	if err := info_repository(&buf, repo, true); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), configuration.Encryption.Key) {
+		t.Fatalf("the key leaked in the JSON output: %s", buf.String())
+	}
+
+	var info repositoryInfo
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.RepositoryID != configuration.RepositoryID {
+		t.Errorf("expected repository ID %s, got %s", configuration.RepositoryID, info.RepositoryID)
+	}
+	if !info.CreationTime.Equal(configuration.CreationTime) {
+		t.Errorf("expected creation time %s, got %s", configuration.CreationTime, info.CreationTime)
+	}
+	if info.Version != configuration.Version {
+		t.Errorf("expected version %s, got %s", configuration.Version, info.Version)
+	}
+	if info.Hashing != configuration.Hashing {
+		t.Errorf("expected hashing %+v, got %+v", configuration.Hashing, info.Hashing)
+	}
+	if info.Chunking != configuration.Chunking {
+		t.Errorf("expected chunking %+v, got %+v", configuration.Chunking, info.Chunking)
+	}
+	if info.Packfile != configuration.Packfile {
+		t.Errorf("expected packfile %+v, got %+v", configuration.Packfile, info.Packfile)
+	}
+	if info.Compression == nil || *info.Compression != *configuration.Compression {
+		t.Errorf("expected compression %+v, got %+v", configuration.Compression, info.Compression)
+	}
+	expected := encryption.Configuration{
+		Algorithm:     configuration.Encryption.Algorithm,
+		Key:           redacted,
+		Authenticated: configuration.Encryption.Authenticated,
+	}
+	if info.Encryption == nil || *info.Encryption != expected {
+		t.Errorf("expected encryption %+v, got %+v", expected, info.Encryption)
+	}
+	if info.Snapshots != 0 || info.Size != 0 {
+		t.Errorf("expected an empty repository, got %d snapshots of %d bytes", info.Snapshots, info.Size)
+	}
+
+	buf.Reset()
+	if err := info_repository(&buf, repo, false); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	if strings.Contains(output, configuration.Encryption.Key) {
+		t.Fatalf("the key leaked in the output: %s", output)
+	}
+	for _, line := range []string{
+		"RepositoryID: " + configuration.RepositoryID.String(),
+		" - Algorithm: " + configuration.Hashing.Algorithm,
+		" - Algorithm: " + configuration.Chunking.Algorithm,
+		" - Algorithm: " + configuration.Compression.Algorithm,
+		" - Algorithm: " + configuration.Encryption.Algorithm,
+		" - Key: " + redacted,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("expected %q in the output:\n%s", line, output)
+		}
+	}
+}
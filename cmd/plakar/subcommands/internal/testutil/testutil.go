@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package testutil provides the repositories and snapshots the tests of
+// the subcommands operate on.
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/google/uuid"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+// NewStore creates a repository in a temporary directory, with its cache
+// next to it. A nil configuration is the default one, without
+// encryption.
+func NewStore(tb testing.TB, configuration *storage.Configuration) *storage.Store {
+	tb.Helper()
+	if configuration == nil {
+		configuration = storage.NewConfiguration()
+		configuration.Encryption = nil
+	}
+	tmpDir := tb.TempDir()
+	ctx := context.NewContext()
+	ctx.SetCacheDir(filepath.Join(tmpDir, "cache"))
+	store, err := storage.Create(ctx, filepath.Join(tmpDir, "repo"), *configuration)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return store
+}
+
+// NewRepository is NewStore with the repository opened.
+func NewRepository(tb testing.TB, configuration *storage.Configuration) *repository.Repository {
+	tb.Helper()
+	return OpenRepository(tb, NewStore(tb, configuration))
+}
+
+// OpenRepository opens store, loading its current state.
+func OpenRepository(tb testing.TB, store *storage.Store) *repository.Repository {
+	tb.Helper()
+	repo, err := repository.New(store, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return repo
+}
+
+// Backup backs sourceDir up to repo and loads the snapshot.
+func Backup(tb testing.TB, repo *repository.Repository, sourceDir string) *snapshot.Snapshot {
+	tb.Helper()
+	snapshotID := repo.Checksum([]byte(uuid.NewString()))
+	snap, err := snapshot.New(repo, snapshotID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := snap.Backup(sourceDir, &snapshot.PushOptions{MaxConcurrency: 1}); err != nil {
+		tb.Fatal(err)
+	}
+	snap, err = snapshot.Load(repo, snapshotID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return snap
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package keygen
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+func init() {
+	subcommands.Register("keygen", cmd_keygen)
+}
+
+func cmd_keygen(ctx *context.Context, _ *repository.Repository, args []string) int {
+	var opt_output string
+
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	flags.StringVar(&opt_output, "output", filepath.Join(ctx.GetKeyringDir(), "plakar.key"), "path of the generated key file")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "%s: %s: too many parameters\n", flag.CommandLine.Name(), flags.Name())
+		return 1
+	}
+
+	if _, err := os.Stat(opt_output); err == nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s: file exists\n", flag.CommandLine.Name(), flags.Name(), opt_output)
+		return 1
+	}
+
+	var passphrase []byte
+	if envPassphrase := os.Getenv("PLAKAR_PASSPHRASE"); envPassphrase != "" {
+		passphrase = []byte(envPassphrase)
+	} else {
+		for {
+			tmp, err := utils.GetPassphraseConfirm("key")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				continue
+			}
+			passphrase = tmp
+			break
+		}
+	}
+
+	keyfile, err := encryption.Keygen()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+		return 1
+	}
+
+	if err := writeKeyfile(keyfile, passphrase, opt_output); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+		return 1
+	}
+
+	fmt.Println(keyfile.Identifier)
+	return 0
+}
+
+// writeKeyfile stores the sealed key file at output and its public key,
+// to be passed to `plakar create -keyfile`, next to it.
+func writeKeyfile(keyfile *encryption.Keyfile, passphrase []byte, output string) error {
+	sealed, err := keyfile.Seal(passphrase)
+	if err != nil {
+		return err
+	}
+	publicKey, err := keyfile.PublicKeyPEM()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0700); err != nil {
+		return err
+	}
+	if err := encryption.WriteKeyfile(output, sealed); err != nil {
+		return err
+	}
+	return os.WriteFile(output+".pub", publicKey, 0644)
+}
@@ -20,15 +20,22 @@ import (
 	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/user"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
 	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot/header"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
 	"github.com/dustin/go-humanize"
 )
@@ -39,30 +46,72 @@ func init() {
 
 func cmd_ls(ctx *context.Context, repo *repository.Repository, args []string) int {
 	var opt_recursive bool
+	var opt_long bool
 	var opt_tag string
 	var opt_uuid bool
+	var opt_context string
+	var opt_olderThan string
+	var opt_newerThan string
 
 	flags := flag.NewFlagSet("ls", flag.ExitOnError)
 	flags.BoolVar(&opt_uuid, "uuid", false, "display uuid instead of short ID")
 	flags.StringVar(&opt_tag, "tag", "", "filter by tag")
+	flags.StringVar(&opt_context, "context", "", "filter by context key=value, or key for any value")
+	flags.StringVar(&opt_olderThan, "older-than", "", "only list snapshots older than this duration (e.g. 720h, 30d)")
+	flags.StringVar(&opt_newerThan, "newer-than", "", "only list snapshots newer than this duration (e.g. 12h, 1w)")
 	flags.BoolVar(&opt_recursive, "recursive", false, "recursive listing")
+	flags.BoolVar(&opt_recursive, "R", false, "recursive listing")
+	flags.BoolVar(&opt_long, "l", false, "long listing with mode, owner, size and modification time")
 	flags.Parse(args)
 
+	var olderThan, newerThan time.Duration
+	if opt_olderThan != "" {
+		duration, err := utils.HumanToDuration(opt_olderThan)
+		if err != nil {
+			logger.Error("%s: -older-than: %s", flags.Name(), err)
+			return 1
+		}
+		olderThan = duration
+	}
+	if opt_newerThan != "" {
+		duration, err := utils.HumanToDuration(opt_newerThan)
+		if err != nil {
+			logger.Error("%s: -newer-than: %s", flags.Name(), err)
+			return 1
+		}
+		newerThan = duration
+	}
+
 	if flags.NArg() == 0 {
-		list_snapshots(repo, opt_uuid, opt_tag)
+		list_snapshots(repo, opt_uuid, opt_tag, opt_context, olderThan, newerThan)
 		return 0
 	}
 
-	list_snapshot(repo, flags.Arg(0), opt_recursive)
+	if err := list_snapshot(repo, flags.Arg(0), opt_long, opt_recursive); err != nil {
+		logger.Error("%s: %s: %s", flags.Name(), flags.Arg(0), err)
+		return 1
+	}
 	return 0
 }
 
-func list_snapshots(repo *repository.Repository, useUuid bool, tag string) {
-	metadatas, err := utils.GetHeaders(repo, nil)
+func list_snapshots(repo *repository.Repository, useUuid bool, tag string, contextFilter string, olderThan, newerThan time.Duration) {
+	headers, err := utils.GetHeaders(repo, nil)
 	if err != nil {
 		log.Fatalf("%s: could not fetch snapshots list", flag.CommandLine.Name())
 	}
 
+	metadatas := make([]header.Header, 0, len(headers))
+	for _, hdr := range headers {
+		metadatas = append(metadatas, *hdr)
+	}
+	if contextFilter != "" {
+		key, value, _ := strings.Cut(contextFilter, "=")
+		metadatas = header.FilterByContext(metadatas, key, value)
+	}
+	if olderThan != 0 || newerThan != 0 {
+		metadatas = header.FilterByAge(metadatas, olderThan, newerThan)
+	}
+
 	for _, metadata := range metadatas {
 		if tag != "" {
 			found := false
@@ -95,77 +144,81 @@ func list_snapshots(repo *repository.Repository, useUuid bool, tag string) {
 	}
 }
 
-func _list_snapshot(pvfs *vfs.Filesystem, pathname string, recursive bool) error {
+func formatEntry(fi objects.FileInfo, long bool) string {
+	if !long {
+		return fi.Name()
+	}
+
+	pwUserLookup, err := user.LookupId(fmt.Sprintf("%d", fi.Uid()))
+	username := fmt.Sprintf("%d", fi.Uid())
+	if err == nil {
+		username = pwUserLookup.Username
+	}
+
+	grGroupLookup, err := user.LookupGroupId(fmt.Sprintf("%d", fi.Gid()))
+	groupname := fmt.Sprintf("%d", fi.Gid())
+	if err == nil {
+		groupname = grGroupLookup.Name
+	}
+	return fmt.Sprintf("%s %s % 8s % 8s % 8s %s",
+		fi.ModTime().UTC().Format(time.RFC3339),
+		fi.Mode(),
+		username,
+		groupname,
+		humanize.Bytes(uint64(fi.Size())),
+		fi.Name())
+}
+
+func _list_snapshot(w io.Writer, pvfs *vfs.Filesystem, pathname string, long bool, recursive bool) error {
 	entry, err := pvfs.Stat(pathname)
 	if err != nil {
-		log.Fatalf("%s: could not fetch vfs list: %s", flag.CommandLine.Name(), err)
+		return err
 	}
 
 	switch entry := entry.(type) {
 	case *vfs.DirEntry:
-		for _, child := range entry.Children {
-			fi := child.Stat()
-			pwUserLookup, err := user.LookupId(fmt.Sprintf("%d", fi.Uid()))
-			username := fmt.Sprintf("%d", fi.Uid())
-			if err == nil {
-				username = pwUserLookup.Username
-			}
+		children := make([]vfs.ChildEntry, len(entry.Children))
+		copy(children, entry.Children)
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Stat().Name() < children[j].Stat().Name()
+		})
+
+		if recursive {
+			fmt.Fprintf(w, "%s:\n", pathname)
+		}
+		for _, child := range children {
+			fmt.Fprintln(w, formatEntry(child.Stat(), long))
+		}
 
-			grGroupLookup, err := user.LookupGroupId(fmt.Sprintf("%d", fi.Gid()))
-			groupname := fmt.Sprintf("%d", fi.Gid())
-			if err == nil {
-				groupname = grGroupLookup.Name
-			}
-			fmt.Fprintf(os.Stdout, "%s %s % 8s % 8s % 8s %s\n",
-				fi.ModTime().UTC().Format(time.RFC3339),
-				fi.Mode(),
-				username,
-				groupname,
-				humanize.Bytes(uint64(fi.Size())),
-				fi.Name())
-			if recursive {
-				err := _list_snapshot(pvfs, pathname+"/"+fi.Name(), recursive)
-				if err != nil {
-					log.Println(err)
+		if recursive {
+			for _, child := range children {
+				if !child.Stat().IsDir() {
+					continue
+				}
+				fmt.Fprintln(w)
+				if err := _list_snapshot(w, pvfs, path.Join(pathname, child.Stat().Name()), long, recursive); err != nil {
+					return err
 				}
 			}
 		}
 
 	case *vfs.FileEntry:
-		fi := entry.Stat()
-		pwUserLookup, err := user.LookupId(fmt.Sprintf("%d", fi.Uid()))
-		username := fmt.Sprintf("%d", fi.Uid())
-		if err == nil {
-			username = pwUserLookup.Username
-		}
-
-		grGroupLookup, err := user.LookupGroupId(fmt.Sprintf("%d", fi.Gid()))
-		groupname := fmt.Sprintf("%d", fi.Gid())
-		if err == nil {
-			groupname = grGroupLookup.Name
-		}
-		fmt.Fprintf(os.Stdout, "%s %s % 8s % 8s % 8s %s\n",
-			fi.ModTime().UTC().Format(time.RFC3339),
-			fi.Mode(),
-			username,
-			groupname,
-			humanize.Bytes(uint64(fi.Size())),
-			fi.Name())
+		fmt.Fprintln(w, formatEntry(*entry.Stat(), long))
 	}
 	return nil
 }
 
-func list_snapshot(repo *repository.Repository, snapshotPath string, recursive bool) error {
+func list_snapshot(repo *repository.Repository, snapshotPath string, long bool, recursive bool) error {
 	prefix, pathname := utils.ParseSnapshotID(snapshotPath)
 
 	snap, err := utils.OpenSnapshotByPrefix(repo, prefix)
 	if err != nil {
-		log.Fatalf("%s: could not fetch snapshot: %s", flag.CommandLine.Name(), err)
+		return err
 	}
 
 	pvfs, err := snap.Filesystem()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	return _list_snapshot(pvfs, pathname, recursive)
+	return _list_snapshot(os.Stdout, pvfs, pathname, long, recursive)
 }
@@ -0,0 +1,106 @@
+package ls
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestListSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "nested", "deeper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 11, 12, 10, 0, 0, 0, time.UTC)
+	files := map[string]string{
+		"nested/b.txt":          "bb",
+		"nested/a.txt":          "a",
+		"nested/deeper/c.txt":   "ccc",
+		"nested/deeper/z.txt":   "z",
+		"outside-of-nested.txt": "",
+	}
+	for name, content := range files {
+		pathname := filepath.Join(sourceDir, name)
+		if err := os.WriteFile(pathname, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(pathname, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pvfs, err := testutil.Backup(t, testutil.NewRepository(t, nil), sourceDir).Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.ToSlash(filepath.Join(sourceDir, "nested"))
+
+	var buf strings.Builder
+	if err := _list_snapshot(&buf, pvfs, nested, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a.txt\nb.txt\ndeeper\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := _list_snapshot(&buf, pvfs, nested, false, true); err != nil {
+		t.Fatal(err)
+	}
+	expected := nested + ":\na.txt\nb.txt\ndeeper\n\n" + nested + "/deeper:\nc.txt\nz.txt\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := _list_snapshot(&buf, pvfs, nested+"/deeper", true, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+
+	username := fmt.Sprintf("%d", os.Getuid())
+	if u, err := user.LookupId(username); err == nil {
+		username = u.Username
+	}
+	groupname := fmt.Sprintf("%d", os.Getgid())
+	if g, err := user.LookupGroupId(groupname); err == nil {
+		groupname = g.Name
+	}
+
+	columns := strings.Fields(lines[0])
+	if len(columns) != 7 {
+		t.Fatalf("expected 7 columns, got %q", lines[0])
+	}
+	if columns[0] != "2024-11-12T10:00:00Z" {
+		t.Errorf("unexpected mtime %q", columns[0])
+	}
+	if columns[1] != "-rw-r-----" {
+		t.Errorf("unexpected mode %q", columns[1])
+	}
+	if columns[2] != username || columns[3] != groupname {
+		t.Errorf("unexpected owner %s:%s", columns[2], columns[3])
+	}
+	if columns[4] != "3" || columns[5] != "B" {
+		t.Errorf("unexpected size %s %s", columns[4], columns[5])
+	}
+	if columns[6] != "c.txt" {
+		t.Errorf("unexpected name %q", columns[6])
+	}
+
+	if err := _list_snapshot(&buf, pvfs, nested+"/missing", false, false); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package migrate
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+func init() {
+	subcommands.Register("migrate", cmd_migrate)
+}
+
+func cmd_migrate(ctx *context.Context, repo *repository.Repository, args []string) int {
+	var opt_force bool
+
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.BoolVar(&opt_force, "force", false, "break an expired repository lock")
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		logger.Error("usage: %s [-force]", flags.Name())
+		return 1
+	}
+
+	if err := migrate(repo.Store(), opt_force); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+	return 0
+}
+
+func migrate(store *storage.Store, force bool) error {
+	if err := store.Lock(force); err != nil {
+		return err
+	}
+	defer store.Unlock()
+
+	migrations, err := store.Migrate()
+	for _, migration := range migrations {
+		logger.Info("migrated repository from version %s to %s", migration.From, migration.To)
+	}
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		logger.Info("repository is up to date, version %s", store.Configuration().Version)
+	}
+	return nil
+}
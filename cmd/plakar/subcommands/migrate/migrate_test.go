@@ -0,0 +1,60 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/google/uuid"
+
+	_ "github.com/PlakarKorp/plakar/storage/backends/memory"
+)
+
+func TestMigrateUpToDate(t *testing.T) {
+	ctx := context.NewContext()
+	location := "memory://migrate-" + uuid.NewString()
+	configuration := storage.NewConfiguration()
+	if _, err := storage.Create(ctx, location, *configuration); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := storage.Open(ctx, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(store, false); err != nil {
+		t.Fatal(err)
+	}
+	if store.Configuration() != *configuration {
+		t.Fatalf("expected the configuration to be left untouched")
+	}
+}
+
+func TestMigrateTooNew(t *testing.T) {
+	ctx := context.NewContext()
+	location := "memory://migrate-" + uuid.NewString()
+	configuration := storage.NewConfiguration()
+	configuration.Version = "99.0.0"
+	if _, err := storage.Create(ctx, location, *configuration); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := storage.Open(ctx, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(store, false); !errors.Is(err, storage.ErrVersionTooNew) {
+		t.Fatalf("expected ErrVersionTooNew, got %v", err)
+	}
+
+	data := []byte("some content")
+	checksum := [32]byte{0x01}
+	if err := store.PutState(checksum, bytes.NewReader(data), uint64(len(data))); !errors.Is(err, storage.ErrVersionTooNew) {
+		t.Fatalf("expected writes to be refused, got %v", err)
+	}
+	if states, err := store.GetStates(); err != nil || len(states) != 0 {
+		t.Fatalf("expected the repository to be readable and empty, got %v, %v", states, err)
+	}
+}
@@ -22,7 +22,9 @@ package mount
 import (
 	goctx "context"
 	"flag"
-	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
 	"github.com/PlakarKorp/plakar/context"
@@ -50,7 +52,8 @@ func cmd_mount(ctx *context.Context, repo *repository.Repository, args []string)
 	// Create an appropriate file system.
 	server, err := plakarfs.NewPlakarFS(repo, mountpoint)
 	if err != nil {
-		log.Fatalf("makeFS: %v", err)
+		logger.Error("%s: could not create filesystem: %s", flags.Name(), err)
+		return 1
 	}
 
 	cfg := &fuse.MountConfig{
@@ -59,12 +62,29 @@ func cmd_mount(ctx *context.Context, repo *repository.Repository, args []string)
 
 	mfs, err := fuse.Mount(mountpoint, server, cfg)
 	if err != nil {
-		log.Fatalf("Mount: %v", err)
+		logger.Error("%s: could not mount %s: %s", flags.Name(), mountpoint, err)
+		return 1
 	}
 
+	// unmount on interrupt so we don't leave a stale mountpoint behind,
+	// Join() returns once the kernel has released the filesystem.
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+	go func() {
+		for range sigc {
+			if err := fuse.Unmount(mountpoint); err != nil {
+				logger.Warn("%s: could not unmount %s: %s", flags.Name(), mountpoint, err)
+				continue
+			}
+			return
+		}
+	}()
+
 	// Wait for it to be unmounted.
 	if err = mfs.Join(goctx.Background()); err != nil {
-		log.Fatalf("Join: %v", err)
+		logger.Error("%s: %s", flags.Name(), err)
+		return 1
 	}
 
 	return 0
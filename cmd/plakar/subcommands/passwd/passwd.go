@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package passwd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+func init() {
+	subcommands.Register("passwd", cmd_passwd)
+}
+
+func cmd_passwd(ctx *context.Context, _ *repository.Repository, args []string) int {
+	flags := flag.NewFlagSet("passwd", flag.ExitOnError)
+	flags.Parse(args)
+
+	var path string
+	switch flags.NArg() {
+	case 0:
+		path = filepath.Join(ctx.GetKeyringDir(), "plakar.key")
+	case 1:
+		path = flags.Arg(0)
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %s: too many parameters\n", flag.CommandLine.Name(), flags.Name())
+		return 1
+	}
+
+	oldPassphrase, err := utils.GetPassphrase("current key")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+		return 1
+	}
+
+	// check the current passphrase before asking for a new one
+	keyfile, err := loadKeyfile(path, oldPassphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), path, err)
+		return 1
+	}
+
+	newPassphrase, err := utils.GetPassphraseConfirm("new key")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+		return 1
+	}
+
+	if err := storeKeyfile(path, keyfile, newPassphrase); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), path, err)
+		return 1
+	}
+	return 0
+}
+
+func loadKeyfile(path string, passphrase []byte) (*encryption.Keyfile, error) {
+	data, err := encryption.ReadKeyfile(path)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.Keyload(data, passphrase)
+}
+
+func storeKeyfile(path string, keyfile *encryption.Keyfile, passphrase []byte) error {
+	sealed, err := keyfile.Seal(passphrase)
+	if err != nil {
+		return err
+	}
+	return encryption.WriteKeyfile(path, sealed)
+}
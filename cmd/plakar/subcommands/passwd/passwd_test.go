@@ -0,0 +1,44 @@
+package passwd
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/encryption"
+)
+
+func TestChangePassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plakar.key")
+
+	keyfile, err := encryption.Keygen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeKeyfile(path, keyfile, []byte("old passphrase")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadKeyfile(path, []byte("not the old one")); !errors.Is(err, encryption.ErrWrongPassphrase) {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+
+	loaded, err := loadKeyfile(path, []byte("old passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeKeyfile(path, loaded, []byte("new passphrase")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadKeyfile(path, []byte("old passphrase")); !errors.Is(err, encryption.ErrWrongPassphrase) {
+		t.Fatalf("expected the old passphrase to be rejected, got %v", err)
+	}
+	reloaded, err := loadKeyfile(path, []byte("new passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Identifier != keyfile.Identifier || string(reloaded.PrivateKey) != string(keyfile.PrivateKey) {
+		t.Fatal("key changed along with the passphrase")
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package restoreobject
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+)
+
+func init() {
+	subcommands.Register("restore-object", cmd_restore_object)
+}
+
+func cmd_restore_object(ctx *context.Context, repo *repository.Repository, args []string) int {
+	var opt_output string
+
+	flags := flag.NewFlagSet("restore-object", flag.ExitOnError)
+	flags.StringVar(&opt_output, "o", "", "write the object to this file instead of the standard output")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		logger.Error("usage: %s [-o file] checksum", flags.Name())
+		return 1
+	}
+
+	checksum, err := parseChecksum(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+
+	if opt_output == "" {
+		if _, err := snapshot.RestoreObject(repo, checksum, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := restoreToFile(repo, checksum, opt_output); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+	return 0
+}
+
+func parseChecksum(arg string) (objects.Checksum, error) {
+	var checksum objects.Checksum
+	decoded, err := hex.DecodeString(arg)
+	if err != nil || len(decoded) != len(checksum) {
+		return checksum, fmt.Errorf("invalid checksum: %s", arg)
+	}
+	copy(checksum[:], decoded)
+	return checksum, nil
+}
+
+// restoreToFile only creates the file once the content matched its
+// checksum, so that a corrupted object doesn't end up in place of it.
+func restoreToFile(repo *repository.Repository, checksum objects.Checksum, pathname string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(pathname), "."+filepath.Base(pathname)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := snapshot.RestoreObject(repo, checksum, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), pathname)
+}
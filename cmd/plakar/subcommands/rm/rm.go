@@ -18,7 +18,9 @@ package rm
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -41,11 +43,19 @@ func init() {
 func cmd_rm(ctx *context.Context, repo *repository.Repository, args []string) int {
 	var opt_older string
 	var opt_tag string
+	var opt_force bool
 	flags := flag.NewFlagSet("rm", flag.ExitOnError)
 	flags.StringVar(&opt_tag, "tag", "", "filter by tag")
 	flags.StringVar(&opt_older, "older", "", "remove snapshots older than this date")
+	flags.BoolVar(&opt_force, "force", false, "break an expired repository lock")
 	flags.Parse(args)
 
+	if err := repo.Store().Lock(opt_force); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+	defer repo.Store().Unlock()
+
 	var beforeDate time.Time
 	if opt_older != "" {
 		now := time.Now()
@@ -159,6 +169,8 @@ func cmd_rm(ctx *context.Context, repo *repository.Repository, args []string) in
 			if err != nil {
 				logger.Error("%s", err)
 				errors++
+				wg.Done()
+				return
 			}
 			wg.Done()
 			logger.Info("removed snapshot %x of size %s in %s",
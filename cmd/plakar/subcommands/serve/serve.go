@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package serve
+
+import (
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	subcommands.Register("serve", cmd_serve)
+}
+
+func cmd_serve(ctx *context.Context, repo *repository.Repository, args []string) int {
+	var opt_addr string
+	var opt_token string
+	var opt_webdav bool
+
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.StringVar(&opt_addr, "addr", "localhost:9877", "address to listen on")
+	flags.BoolVar(&opt_webdav, "webdav", false, "serve over WebDAV, to mount the snapshot as a network drive")
+	flags.StringVar(&opt_token, "token", "", "token required from http clients")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		logger.Error("%s: a snapshot is required", flags.Name())
+		return 1
+	}
+
+	prefix, pathname := utils.ParseSnapshotID(flags.Arg(0))
+	snap, err := utils.OpenSnapshotByPrefix(repo, prefix)
+	if err != nil {
+		logger.Error("%s: could not open snapshot: %s", flags.Name(), prefix)
+		return 1
+	}
+
+	handler, err := newHandler(snap, pathname, opt_token, opt_webdav)
+	if err != nil {
+		logger.Error("%s: %s: %s", flags.Name(), pathname, err)
+		return 1
+	}
+
+	logger.Printf("serving snapshot %x on http://%s/", snap.Header.GetIndexShortID(), opt_addr)
+	if err := http.ListenAndServe(opt_addr, handler); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flag.CommandLine.Name(), flags.Name(), err)
+		return 1
+	}
+	return 0
+}
+
+type handler struct {
+	fsys   fs.FS
+	token  string
+	webdav http.Handler
+}
+
+// newHandler returns an http.Handler serving the snapshot, or the
+// directory root in it, read-only, to browsers or WebDAV clients.
+func newHandler(snap *snapshot.Snapshot, root string, token string, webdav bool) (http.Handler, error) {
+	fsys := snap.AsFS()
+	if root = strings.Trim(path.Clean("/"+root), "/"); root != "" {
+		info, err := fs.Stat(fsys, root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("not a directory")
+		}
+		fsys, err = fs.Sub(fsys, root)
+		if err != nil {
+			return nil, err
+		}
+	}
+	h := &handler{fsys: fsys, token: token}
+	if webdav {
+		h.webdav = newWebdavHandler(fsys)
+	}
+	return h, nil
+}
+
+// authenticated accepts the token as a bearer token, for scripts, or as
+// the password of a basic authentication, which browsers prompt for.
+func (h *handler) authenticated(r *http.Request) bool {
+	if h.token == "" {
+		return true
+	}
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		provided = password
+	}
+	return subtle.ConstantTimeCompare([]byte(h.token), []byte(provided)) == 1
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="plakar"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if h.webdav != nil {
+		h.webdav.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.Trim(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+
+	file, err := h.fsys.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if dir, isDir := file.(fs.ReadDirFile); isDir && info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+			return
+		}
+		h.serveDirectory(w, r, dir)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		http.Error(w, "not a regular file", http.StatusForbidden)
+		return
+	}
+	h.serveFile(w, r, file, info)
+}
+
+var listing = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Path}}</title></head>
+<body>
+<h1>{{.Path}}</h1>
+<table>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}</a></td><td>{{.Size}}</td><td>{{.ModTime}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type listingEntry struct {
+	Name    string
+	Href    string
+	Size    string
+	ModTime string
+}
+
+func (h *handler) serveDirectory(w http.ResponseWriter, r *http.Request, dir fs.ReadDirFile) {
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Path    string
+		Entries []listingEntry
+	}{Path: path.Clean("/" + r.URL.Path)}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		listed := listingEntry{
+			Name:    entry.Name(),
+			Href:    url.PathEscape(entry.Name()),
+			Size:    humanize.Bytes(uint64(info.Size())),
+			ModTime: info.ModTime().UTC().Format(time.RFC3339),
+		}
+		if entry.IsDir() {
+			listed.Name += "/"
+			listed.Href += "/"
+			listed.Size = ""
+		}
+		data.Entries = append(data.Entries, listed)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := listing.Execute(w, data); err != nil {
+		logger.Error("serve: %s: %s", r.URL.Path, err)
+	}
+}
+
+// serveFile leaves the headers and range requests to http.ServeContent:
+// seeking in a file only fetches the chunks from the new offset on.
+func (h *handler) serveFile(w http.ResponseWriter, r *http.Request, file fs.File, info fs.FileInfo) {
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "file is not seekable", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), content)
+}
@@ -0,0 +1,209 @@
+package serve
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestServe(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "sub dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "sub dir", "file.txt"), []byte("served content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := testutil.Backup(t, testutil.NewRepository(t, nil), sourceDir)
+
+	handler, err := newHandler(snap, filepath.ToSlash(sourceDir), "secret", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(pathname string, authenticate func(*http.Request)) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+pathname, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authenticate != nil {
+			authenticate(req)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, string(body)
+	}
+	bearer := func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer secret")
+	}
+
+	if status, _ := get("/sub%20dir/file.txt", nil); status != http.StatusUnauthorized {
+		t.Fatalf("expected status %d without a token, got %d", http.StatusUnauthorized, status)
+	}
+	if status, _ := get("/sub%20dir/file.txt", func(req *http.Request) { req.SetBasicAuth("", "wrong") }); status != http.StatusUnauthorized {
+		t.Fatalf("expected status %d with a wrong token, got %d", http.StatusUnauthorized, status)
+	}
+
+	status, body := get("/sub%20dir/file.txt", bearer)
+	if status != http.StatusOK || body != "served content" {
+		t.Fatalf("unexpected response %d %q", status, body)
+	}
+	status, body = get("/sub%20dir/file.txt", func(req *http.Request) { req.SetBasicAuth("user", "secret") })
+	if status != http.StatusOK || body != "served content" {
+		t.Fatalf("unexpected response %d %q", status, body)
+	}
+
+	status, body = get("/", bearer)
+	if status != http.StatusOK || !strings.Contains(body, `<a href="sub%20dir/">sub dir/</a>`) {
+		t.Fatalf("unexpected listing %d %q", status, body)
+	}
+	// the client follows the redirection to the trailing slash
+	status, body = get("/sub%20dir", bearer)
+	if status != http.StatusOK || !strings.Contains(body, `<a href="file.txt">file.txt</a>`) {
+		t.Fatalf("unexpected listing %d %q", status, body)
+	}
+
+	if status, _ := get("/missing", bearer); status != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, status)
+	}
+	if status, _ := get("/../../etc/passwd", bearer); status != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, status)
+	}
+}
+
+func TestServeRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// large enough to be split in several chunks
+	content := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	if err := os.WriteFile(filepath.Join(sourceDir, "random.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newHandler(testutil.Backup(t, testutil.NewRepository(t, nil), sourceDir), filepath.ToSlash(sourceDir), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, bounds := range [][2]int{{100, 199}, {3<<20 - 10, 3<<20 + 10}, {len(content) - 50, len(content) - 1}} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/random.bin", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", bounds[0], bounds[1]))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != http.StatusPartialContent {
+			t.Fatalf("%v: expected status %d, got %d", bounds, http.StatusPartialContent, res.StatusCode)
+		}
+		expected := fmt.Sprintf("bytes %d-%d/%d", bounds[0], bounds[1], len(content))
+		if contentRange := res.Header.Get("Content-Range"); contentRange != expected {
+			t.Fatalf("%v: expected Content-Range %q, got %q", bounds, expected, contentRange)
+		}
+		if !bytes.Equal(body, content[bounds[0]:bounds[1]+1]) {
+			t.Fatalf("%v: unexpected content", bounds)
+		}
+	}
+}
+
+func TestServeWebdav(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "subdir", "file.txt"), []byte("served content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newHandler(testutil.Backup(t, testutil.NewRepository(t, nil), sourceDir), filepath.ToSlash(sourceDir), "secret", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	do := func(method string, pathname string, header map[string]string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+pathname, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("", "secret")
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, string(body)
+	}
+
+	status, body := do("PROPFIND", "/subdir/", map[string]string{"Depth": "1"})
+	if status != http.StatusMultiStatus {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusMultiStatus, status, body)
+	}
+	for _, expected := range []string{"<D:href>/subdir/</D:href>", "<D:href>/subdir/file.txt</D:href>", "<D:getcontentlength>14</D:getcontentlength>"} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected %s in %s", expected, body)
+		}
+	}
+
+	status, body = do(http.MethodGet, "/subdir/file.txt", nil)
+	if status != http.StatusOK || body != "served content" {
+		t.Fatalf("unexpected response %d %q", status, body)
+	}
+
+	// the snapshot is read-only
+	if status, _ := do(http.MethodPut, "/subdir/new.txt", nil); status < 400 {
+		t.Fatalf("expected PUT to fail, got status %d", status)
+	}
+	if status, _ := do(http.MethodDelete, "/subdir/file.txt", nil); status < 400 {
+		t.Fatalf("expected DELETE to fail, got status %d", status)
+	}
+}
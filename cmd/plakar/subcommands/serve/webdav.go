@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package serve
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/logger"
+	"golang.org/x/net/webdav"
+)
+
+func newWebdavHandler(fsys fs.FS) http.Handler {
+	return &webdav.Handler{
+		FileSystem: &webdavFS{fsys: fsys},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				logger.Error("serve: %s %s: %s", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+}
+
+// webdavFS is a read-only webdav.FileSystem over the io/fs view of a
+// snapshot: every modification fails with os.ErrPermission.
+type webdavFS struct {
+	fsys fs.FS
+}
+
+func webdavName(name string) string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (wfs *webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (wfs *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+	file, err := wfs.fsys.Open(webdavName(name))
+	if err != nil {
+		return nil, err
+	}
+	return &webdavFile{File: file}, nil
+}
+
+func (wfs *webdavFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (wfs *webdavFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (wfs *webdavFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return fs.Stat(wfs.fsys, webdavName(name))
+}
+
+type webdavFile struct {
+	fs.File
+}
+
+func (file *webdavFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := file.File.(io.Seeker)
+	if !ok {
+		return 0, errors.New("file is not seekable")
+	}
+	return seeker.Seek(offset, whence)
+}
+
+func (file *webdavFile) Readdir(count int) ([]fs.FileInfo, error) {
+	dir, ok := file.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, errors.New("not a directory")
+	}
+	entries, err := dir.ReadDir(count)
+	ret := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, info)
+	}
+	return ret, err
+}
+
+func (file *webdavFile) Write([]byte) (int, error) {
+	return 0, os.ErrPermission
+}
@@ -34,10 +34,12 @@ func init() {
 func cmd_server(ctx *context.Context, repo *repository.Repository, args []string) int {
 	var opt_protocol string
 	var opt_allowdelete bool
+	var opt_token string
 
 	flags := flag.NewFlagSet("server", flag.ExitOnError)
 	flags.StringVar(&opt_protocol, "protocol", "plakar", "protocol to use (http or plakar)")
 	flags.BoolVar(&opt_allowdelete, "allow-delete", false, "disable delete operations")
+	flags.StringVar(&opt_token, "token", "", "bearer token required from http clients")
 	flags.Parse(args)
 
 	addr := ":9876"
@@ -52,7 +54,7 @@ func cmd_server(ctx *context.Context, repo *repository.Repository, args []string
 
 	switch opt_protocol {
 	case "http":
-		httpd.Server(repo, addr, noDelete)
+		httpd.Server(repo, addr, noDelete, opt_token)
 	case "plakar":
 		options := &plakard.ServerOptions{
 			NoOpen:   true,
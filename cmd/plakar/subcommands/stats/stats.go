@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package stats
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/profiler"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/dustin/go-humanize"
+)
+
+func init() {
+	subcommands.Register("stats", cmd_stats)
+}
+
+type repositoryStats struct {
+	Snapshots    int     `json:"snapshots"`
+	LogicalSize  uint64  `json:"logical_size"`
+	Packfiles    int     `json:"packfiles"`
+	PhysicalSize uint64  `json:"physical_size"`
+	Chunks       int     `json:"chunks"`
+	DedupRatio   float64 `json:"dedup_ratio"`
+}
+
+func cmd_stats(ctx *context.Context, repo *repository.Repository, args []string) int {
+	var opt_json bool
+
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	flags.BoolVar(&opt_json, "json", false, "output the statistics as JSON")
+	flags.Parse(args)
+
+	if flags.NArg() == 2 {
+		return footprint(repo, flags.Name(), flags.Arg(0), flags.Arg(1), opt_json)
+	} else if flags.NArg() != 0 {
+		logger.Error("%s: expects either no parameter or a snapshot and its base", flags.Name())
+		return 1
+	}
+
+	st, err := collectStats(repo)
+	if err != nil {
+		logger.Error("%s: %s", flags.Name(), err)
+		return 1
+	}
+
+	if opt_json {
+		if err := json.NewEncoder(os.Stdout).Encode(st); err != nil {
+			logger.Error("%s: %s", flags.Name(), err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Printf("%-15s %d\n", "Snapshots:", st.Snapshots)
+	fmt.Printf("%-15s %s (%d bytes)\n", "Logical size:", humanize.Bytes(st.LogicalSize), st.LogicalSize)
+	fmt.Printf("%-15s %d\n", "Packfiles:", st.Packfiles)
+	fmt.Printf("%-15s %d\n", "Chunks:", st.Chunks)
+	fmt.Printf("%-15s %s (%d bytes)\n", "Physical size:", humanize.Bytes(st.PhysicalSize), st.PhysicalSize)
+	fmt.Printf("%-15s %.2f\n", "Dedup ratio:", st.DedupRatio)
+	return 0
+}
+
+// collectStats compares the size of the data referenced by the snapshots
+// to the size of the packfiles actually stored by the backend.
+func collectStats(repo *repository.Repository) (*repositoryStats, error) {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("stats.collect", time.Since(t0))
+		logger.Trace("stats", "collect(): %s", time.Since(t0))
+	}()
+
+	st := &repositoryStats{}
+
+	headers, err := utils.GetHeaders(repo, nil)
+	if err != nil {
+		return nil, err
+	}
+	st.Snapshots = len(headers)
+	for _, header := range headers {
+		st.LogicalSize += header.Summary.Directory.Size + header.Summary.Below.Size
+	}
+
+	packfiles, err := repo.GetPackfiles()
+	if err != nil {
+		return nil, err
+	}
+	st.Packfiles = len(packfiles)
+	for _, checksum := range packfiles {
+		stat, err := repo.Store().StatPackfile(checksum)
+		if err != nil {
+			return nil, err
+		}
+		st.PhysicalSize += stat.Size
+	}
+
+	for range repo.ListChunks() {
+		st.Chunks++
+	}
+
+	if st.PhysicalSize != 0 {
+		st.DedupRatio = float64(st.LogicalSize) / float64(st.PhysicalSize)
+	}
+	return st, nil
+}
+
+// footprint reports the chunks that a snapshot adds on top of its base and
+// the storage they take in the repository.
+func footprint(repo *repository.Repository, name, snapshotPrefix, basePrefix string, opt_json bool) int {
+	snap, err := utils.OpenSnapshotByPrefix(repo, snapshotPrefix)
+	if err != nil {
+		logger.Error("%s: %s: %s", name, snapshotPrefix, err)
+		return 1
+	}
+	base, err := utils.OpenSnapshotByPrefix(repo, basePrefix)
+	if err != nil {
+		logger.Error("%s: %s: %s", name, basePrefix, err)
+		return 1
+	}
+
+	fp, err := snap.Footprint(base)
+	if err != nil {
+		logger.Error("%s: %s", name, err)
+		return 1
+	}
+
+	if opt_json {
+		if err := json.NewEncoder(os.Stdout).Encode(fp); err != nil {
+			logger.Error("%s: %s", name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Printf("%-15s %d\n", "Chunks added:", fp.Chunks)
+	fmt.Printf("%-15s %s (%d bytes)\n", "Stored size:", humanize.Bytes(fp.StoredSize), fp.StoredSize)
+	return 0
+}
@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+	"github.com/PlakarKorp/plakar/storage"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestCollectStats(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// two identical files, so the second one is deduplicated
+	content := strings.Repeat("plakar", 1000)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configuration := storage.NewConfiguration()
+	configuration.Compression = nil
+	configuration.Encryption = nil
+	repo := testutil.NewRepository(t, configuration)
+
+	// back up the same directory twice
+	for i := 0; i < 2; i++ {
+		testutil.Backup(t, repo, sourceDir)
+	}
+
+	repo = testutil.OpenRepository(t, repo.Store())
+	st, err := collectStats(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Snapshots != 2 {
+		t.Errorf("expected 2 snapshots, got %d", st.Snapshots)
+	}
+	if expected := uint64(2 * 2 * len(content)); st.LogicalSize != expected {
+		t.Errorf("expected a logical size of %d, got %d", expected, st.LogicalSize)
+	}
+
+	physicalSize := uint64(0)
+	packfiles := 0
+	err = filepath.Walk(filepath.Join(repo.Store().Location(), "packfiles"), func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			physicalSize += uint64(info.Size())
+			packfiles++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Packfiles != packfiles || st.PhysicalSize != physicalSize {
+		t.Errorf("expected %d packfiles for %d bytes, got %d for %d bytes", packfiles, physicalSize, st.Packfiles, st.PhysicalSize)
+	}
+	if st.Chunks == 0 {
+		t.Errorf("expected chunks to be counted")
+	}
+	if st.DedupRatio != float64(st.LogicalSize)/float64(st.PhysicalSize) {
+		t.Errorf("unexpected dedup ratio %f", st.DedupRatio)
+	}
+}
@@ -18,6 +18,7 @@ package sync
 
 import (
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -31,6 +32,7 @@ import (
 	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot"
 	"github.com/PlakarKorp/plakar/storage"
+	"github.com/dustin/go-humanize"
 )
 
 func init() {
@@ -38,7 +40,12 @@ func init() {
 }
 
 func cmd_sync(ctx *context.Context, repo *repository.Repository, args []string) int {
+	var opt_prune bool
+	var opt_force bool
+
 	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	flags.BoolVar(&opt_prune, "prune", false, "delete from the copy what the repository no longer holds")
+	flags.BoolVar(&opt_force, "force", false, "break an expired repository lock")
 	flags.Parse(args)
 
 	syncSnapshotID := ""
@@ -55,7 +62,7 @@ func cmd_sync(ctx *context.Context, repo *repository.Repository, args []string)
 		peerRepositoryPath = flags.Arg(2)
 
 	default:
-		logger.Error("usage: %s [snapshotID] to|from repository", flags.Name())
+		logger.Error("usage: %s [-force] [-prune] [snapshotID] to|from|with repository", flags.Name())
 		return 1
 	}
 
@@ -77,6 +84,9 @@ func cmd_sync(ctx *context.Context, repo *repository.Repository, args []string)
 			secret, err := encryption.DeriveSecret(passphrase, peerStore.Configuration().Encryption.Key)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "%s\n", err)
+				if !errors.Is(err, encryption.ErrWrongPassphrase) {
+					return 1
+				}
 				continue
 			}
 			peerSecret = secret
@@ -106,6 +116,41 @@ func cmd_sync(ctx *context.Context, repo *repository.Repository, args []string)
 		return 1
 	}
 
+	replica := peerStore.Configuration().RepositoryID == repo.Configuration().RepositoryID
+	if opt_prune && (!replica || direction == "with" || syncSnapshotID != "") {
+		fmt.Fprintf(os.Stderr, "%s: -prune requires a copy of the repository, a direction of to or from and no snapshotID\n", flags.Name())
+		return 1
+	}
+
+	if err := dstRepository.Store().Lock(opt_force); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flags.Name(), dstRepository.Location(), err)
+		return 1
+	}
+	defer dstRepository.Store().Unlock()
+	if direction == "with" {
+		if err := srcRepository.Store().Lock(opt_force); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", flags.Name(), srcRepository.Location(), err)
+			return 1
+		}
+		defer srcRepository.Store().Unlock()
+	}
+
+	// copies of a repository share its packfiles and states, pushing those
+	// missing on the destination is enough to synchronize them.
+	if replica {
+		if err := syncReplica(srcRepository, dstRepository, syncSnapshotID, opt_prune); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+			return 1
+		}
+		if direction == "with" {
+			if err := syncReplica(dstRepository, srcRepository, syncSnapshotID, false); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+				return 1
+			}
+		}
+		return 0
+	}
+
 	srcSnapshots, err := srcRepository.GetSnapshots()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: could not get snapshots from repository: %s\n", srcRepository.Location(), err)
@@ -178,6 +223,36 @@ func cmd_sync(ctx *context.Context, repo *repository.Repository, args []string)
 	return 0
 }
 
+func syncReplica(srcRepository *repository.Repository, dstRepository *repository.Repository, syncSnapshotID string, prune bool) error {
+	var report *snapshot.SyncReport
+	if syncSnapshotID == "" {
+		var err error
+		report, err = snapshot.Sync(srcRepository, dstRepository.Store(), prune)
+		if err != nil {
+			return err
+		}
+	} else {
+		srcSnapshots, err := srcRepository.GetSnapshots()
+		if err != nil {
+			return err
+		}
+		snapshotIDs := utils.MatchSnapshotPrefix(srcSnapshots, syncSnapshotID)
+		if len(snapshotIDs) == 0 {
+			return fmt.Errorf("%s: no snapshot matches %s", srcRepository.Location(), syncSnapshotID)
+		}
+		copied, err := snapshot.Copy(srcRepository, dstRepository.Store(), snapshotIDs)
+		if err != nil {
+			return err
+		}
+		report = &snapshot.SyncReport{CopyReport: *copied}
+	}
+
+	logger.Info("%s: pushed %d packfiles and %d states (%s), skipped %d, pruned %d",
+		dstRepository.Location(), report.Packfiles, report.States,
+		humanize.Bytes(report.Bytes), report.Skipped, report.Pruned)
+	return nil
+}
+
 func synchronize(srcRepository *repository.Repository, dstRepository *repository.Repository, snapshotID [32]byte) error {
 	srcSnapshot, err := snapshot.Load(srcRepository, snapshotID)
 	if err != nil {
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tag
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands"
+	"github.com/PlakarKorp/plakar/cmd/plakar/utils"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+func init() {
+	subcommands.Register("tag", cmd_tag)
+}
+
+func cmd_tag(ctx *context.Context, repo *repository.Repository, args []string) int {
+	var opt_force bool
+
+	flags := flag.NewFlagSet("tag", flag.ExitOnError)
+	flags.BoolVar(&opt_force, "force", false, "break an expired repository lock")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		logger.Error("usage: %s [-force] tag[,tag...] snapshotID ...", flags.Name())
+		return 1
+	}
+
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(flags.Arg(0), ",") {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		logger.Error("%s: no tag given", flags.Name())
+		return 1
+	}
+
+	if err := repo.Store().Lock(opt_force); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+	defer repo.Store().Unlock()
+
+	snapshots, err := utils.GetSnapshots(repo, flags.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Name(), err)
+		return 1
+	}
+
+	errors := 0
+	for _, snap := range snapshots {
+		if !snap.Header.AddTags(tags...) {
+			continue
+		}
+		if err := snap.UpdateHeader(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %x: %s\n", flags.Name(), snap.Header.GetIndexShortID(), err)
+			errors++
+			continue
+		}
+		logger.Info("tagged snapshot %x", snap.Header.GetIndexShortID())
+	}
+
+	if errors != 0 {
+		return 1
+	}
+	return 0
+}
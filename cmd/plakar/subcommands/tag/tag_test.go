@@ -0,0 +1,85 @@
+package tag
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestTag(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := testutil.NewStore(t, nil)
+	ctx := store.Context()
+
+	snapshotIDs := make([]objects.Checksum, 0)
+	// tagging again must leave the repository untouched
+	var previousStates []objects.Checksum
+	for i := 0; i < 2; i++ {
+		snap := testutil.Backup(t, testutil.OpenRepository(t, store), sourceDir)
+		snapshotIDs = append(snapshotIDs, snap.Header.SnapshotID)
+	}
+
+	tags := func(repo *repository.Repository, snapshotID objects.Checksum) []string {
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snap.Header.Tags
+	}
+
+	args := []string{"weekly,daily"}
+	for _, snapshotID := range snapshotIDs {
+		args = append(args, hex.EncodeToString(snapshotID[:4]))
+	}
+
+	for i := 0; i < 2; i++ {
+		if status := cmd_tag(ctx, testutil.OpenRepository(t, store), args); status != 0 {
+			t.Fatalf("expected exit status 0, got %d", status)
+		}
+
+		repo := testutil.OpenRepository(t, store)
+		for _, snapshotID := range snapshotIDs {
+			if got := tags(repo, snapshotID); !reflect.DeepEqual(got, []string{"daily", "weekly"}) {
+				t.Fatalf("%x: unexpected tags %v", snapshotID[:4], got)
+			}
+		}
+		states, err := repo.GetStates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(states) != 1 {
+			t.Fatalf("expected the states to be replaced by a single one, got %d", len(states))
+		}
+		if previousStates != nil && !reflect.DeepEqual(states, previousStates) {
+			t.Fatal("tagging again should not write to the repository")
+		}
+		previousStates = states
+
+		// the content is still reachable through the new header
+		snap, err := snapshot.Load(repo, snapshotIDs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := snap.Check("/", &snapshot.CheckOptions{MaxConcurrency: 1}); err != nil || !ok {
+			t.Fatalf("snapshot failed its check: %v", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package untag
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/cmd/plakar/subcommands/internal/testutil"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/google/uuid"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestUntag(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := testutil.NewStore(t, nil)
+	ctx := store.Context()
+	repo := testutil.OpenRepository(t, store)
+
+	snapshotID := repo.Checksum([]byte(uuid.NewString()))
+	snap, err := snapshot.New(repo, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap.Header.Tags = []string{"daily", "weekly"}
+	if err := snap.Backup(sourceDir, &snapshot.PushOptions{MaxConcurrency: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := hex.EncodeToString(snapshotID[:4])
+	untag := func(tags string) (*repository.Repository, []objects.Checksum) {
+		if status := cmd_untag(ctx, testutil.OpenRepository(t, store), []string{tags, prefix}); status != 0 {
+			t.Fatalf("expected exit status 0, got %d", status)
+		}
+		repo := testutil.OpenRepository(t, store)
+		states, err := repo.GetStates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo, states
+	}
+	tags := func(repo *repository.Repository) []string {
+		snap, err := snapshot.Load(repo, snapshotID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snap.Header.Tags
+	}
+
+	statesBefore, err := repo.GetStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, states := untag("monthly")
+	if got := tags(repo); !reflect.DeepEqual(got, []string{"daily", "weekly"}) {
+		t.Fatalf("unexpected tags %v", got)
+	}
+	if !reflect.DeepEqual(states, statesBefore) {
+		t.Fatal("untagging a missing tag should not write to the repository")
+	}
+
+	repo, _ = untag("weekly,monthly")
+	if got := tags(repo); !reflect.DeepEqual(got, []string{"daily"}) {
+		t.Fatalf("unexpected tags %v", got)
+	}
+}
@@ -0,0 +1,82 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// pipeFd returns a file descriptor reading what was written to the pipe,
+// owned by the caller.
+func pipeFd(t *testing.T, content string) int {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := w.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	fd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+func TestGetPassphraseFromFd(t *testing.T) {
+	for content, expected := range map[string]string{
+		"secret\n":       "secret",
+		"secret":         "secret",
+		"secret\n\n":     "secret\n",
+		"with spaces \n": "with spaces ",
+		"multi\nline\n":  "multi\nline",
+	} {
+		passphrase, err := GetPassphraseFromFd(pipeFd(t, content))
+		if err != nil {
+			t.Fatalf("%q: %v", content, err)
+		}
+		if string(passphrase) != expected {
+			t.Errorf("%q: expected %q, got %q", content, expected, passphrase)
+		}
+	}
+
+	if _, err := GetPassphraseFromFd(pipeFd(t, "\n")); err == nil {
+		t.Error("expected an empty passphrase to be rejected")
+	}
+	if _, err := GetPassphraseFromFd(1 << 20); err == nil {
+		t.Error("expected an invalid descriptor to fail")
+	}
+}
+
+func TestGetPassphraseFromCommand(t *testing.T) {
+	passphrase, err := GetPassphraseFromCommand("echo 'from a secret manager'", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(passphrase) != "from a secret manager" {
+		t.Errorf("unexpected passphrase %q", passphrase)
+	}
+
+	if _, err := GetPassphraseFromCommand("echo secret; exit 3", time.Second); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("expected the exit status to be reported, got %v", err)
+	}
+	if _, err := GetPassphraseFromCommand("true", time.Second); err == nil {
+		t.Error("expected an empty output to be rejected")
+	}
+
+	t0 := time.Now()
+	if _, err := GetPassphraseFromCommand("exec sleep 10", 100*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(t0); elapsed > 5*time.Second {
+		t.Errorf("timeout not honored, command ran for %s", elapsed)
+	}
+}
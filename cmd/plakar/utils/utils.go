@@ -17,17 +17,20 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/xml"
 	"errors"
-	"flag"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -58,29 +61,47 @@ func ParseSnapshotID(id string) (string, string) {
 	return prefix, pattern
 }
 
-func LookupSnapshotByPrefix(repo *repository.Repository, prefix string) []objects.Checksum {
-	ret := make([]objects.Checksum, 0)
-	for snapshotID := range repo.ListSnapshots() {
+var ErrNotFound = errors.New("no snapshot has prefix")
+var ErrAmbiguous = errors.New("snapshot ID is ambiguous")
+
+// ResolveSnapshotPrefix returns the snapshot whose hexadecimal ID starts
+// with prefix, which may be the full ID. It fails with ErrNotFound if no
+// snapshot matches and with ErrAmbiguous if several do.
+func ResolveSnapshotPrefix(repo *repository.Repository, prefix string) (objects.Checksum, error) {
+	snapshotIDs, err := repo.GetSnapshots()
+	if err != nil {
+		return objects.Checksum{}, err
+	}
+	return resolveSnapshotPrefix(snapshotIDs, prefix)
+}
+
+// MatchSnapshotPrefix returns the snapshots among snapshotIDs whose
+// hexadecimal ID starts with prefix, regardless of its case.
+func MatchSnapshotPrefix(snapshotIDs []objects.Checksum, prefix string) []objects.Checksum {
+	prefix = strings.ToLower(prefix)
+
+	matches := make([]objects.Checksum, 0)
+	for _, snapshotID := range snapshotIDs {
 		if strings.HasPrefix(hex.EncodeToString(snapshotID[:]), prefix) {
-			ret = append(ret, snapshotID)
+			matches = append(matches, snapshotID)
 		}
 	}
-	return ret
+	return matches
 }
 
-func LocateSnapshotByPrefix(repo *repository.Repository, prefix string) (objects.Checksum, error) {
-	snapshots := LookupSnapshotByPrefix(repo, prefix)
-	if len(snapshots) == 0 {
-		return objects.Checksum{}, fmt.Errorf("no snapshot has prefix: %s", prefix)
+func resolveSnapshotPrefix(snapshotIDs []objects.Checksum, prefix string) (objects.Checksum, error) {
+	matches := MatchSnapshotPrefix(snapshotIDs, prefix)
+	if len(matches) == 0 {
+		return objects.Checksum{}, fmt.Errorf("%w: %s", ErrNotFound, prefix)
 	}
-	if len(snapshots) > 1 {
-		return objects.Checksum{}, fmt.Errorf("snapshot ID is ambiguous: %s (matches %d snapshots)", prefix, len(snapshots))
+	if len(matches) > 1 {
+		return objects.Checksum{}, fmt.Errorf("%w: %s (matches %d snapshots)", ErrAmbiguous, prefix, len(matches))
 	}
-	return snapshots[0], nil
+	return matches[0], nil
 }
 
 func OpenSnapshotByPrefix(repo *repository.Repository, prefix string) (*snapshot.Snapshot, error) {
-	snapshotID, err := LocateSnapshotByPrefix(repo, prefix)
+	snapshotID, err := ResolveSnapshotPrefix(repo, prefix)
 	if err != nil {
 		return nil, err
 	}
@@ -128,52 +149,16 @@ func GetHeaders(repo *repository.Repository, prefixes []string) ([]*header.Heade
 		return result, nil
 	}
 
-	tags := make(map[string]objects.Checksum)
-	tagsTimestamp := make(map[string]time.Time)
-
-	for _, snapshotID := range snapshotsList {
+	snapshotIDs, err := resolveSnapshotIDs(repo, snapshotsList, prefixes)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshotID := range snapshotIDs {
 		hdr, _, err := snapshot.GetSnapshot(repo, snapshotID)
 		if err != nil {
 			return nil, err
 		}
-		for _, tag := range hdr.Tags {
-			if recordTime, exists := tagsTimestamp[tag]; !exists {
-				tags[tag] = snapshotID
-				tagsTimestamp[tag] = hdr.CreationTime
-			} else if recordTime.Before(hdr.CreationTime) {
-				tags[tag] = snapshotID
-				tagsTimestamp[tag] = hdr.CreationTime
-			}
-		}
-	}
-
-	// prefixes, preprocess snapshots to only fetch necessary ones
-	for _, prefix := range prefixes {
-		parsedUuidPrefix, _ := ParseSnapshotID(prefix)
-
-		matches := 0
-		for _, snapshotID := range snapshotsList {
-			if strings.HasPrefix(hex.EncodeToString(snapshotID[:]), parsedUuidPrefix) {
-				matches++
-			}
-		}
-		if matches == 0 {
-			if _, exists := tags[parsedUuidPrefix]; !exists {
-				log.Fatalf("%s: no snapshot has prefix: %s", flag.CommandLine.Name(), parsedUuidPrefix)
-			}
-		} else if matches > 1 {
-			log.Fatalf("%s: snapshot ID is ambiguous: %s (matches %d snapshots)", flag.CommandLine.Name(), prefix, matches)
-		}
-
-		for _, snapshotID := range snapshotsList {
-			if strings.HasPrefix(hex.EncodeToString(snapshotID[:]), parsedUuidPrefix) || snapshotID == tags[parsedUuidPrefix] {
-				metadata, _, err := snapshot.GetSnapshot(repo, snapshotID)
-				if err != nil {
-					return nil, err
-				}
-				result = append(result, metadata)
-			}
-		}
+		result = append(result, hdr)
 	}
 	return result, nil
 }
@@ -207,54 +192,69 @@ func GetSnapshots(repo *repository.Repository, prefixes []string) ([]*snapshot.S
 		return sortSnapshotsByDate(result), nil
 	}
 
-	tags := make(map[string]objects.Checksum)
-	tagsTimestamp := make(map[string]time.Time)
-
-	for _, snapshotID := range snapshotsList {
-		metadata, _, err := snapshot.GetSnapshot(repo, snapshotID)
+	snapshotIDs, err := resolveSnapshotIDs(repo, snapshotsList, prefixes)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshotID := range snapshotIDs {
+		snapshotInstance, err := snapshot.Load(repo, snapshotID)
 		if err != nil {
 			return nil, err
 		}
-		for _, tag := range metadata.Tags {
-			if recordTime, exists := tagsTimestamp[tag]; !exists {
-				tags[tag] = snapshotID
-				tagsTimestamp[tag] = metadata.CreationTime
-			} else if recordTime.Before(metadata.CreationTime) {
-				tags[tag] = snapshotID
-				tagsTimestamp[tag] = metadata.CreationTime
-			}
-		}
+		result = append(result, snapshotInstance)
 	}
+	return result, nil
+}
+
+// resolveSnapshotIDs resolves each prefix with resolveSnapshotPrefix, or
+// as a tag designating the latest snapshot with that tag if no snapshot
+// ID has that prefix.
+func resolveSnapshotIDs(repo *repository.Repository, snapshotsList []objects.Checksum, prefixes []string) ([]objects.Checksum, error) {
+	var tags map[string]objects.Checksum
 
-	// prefixes, preprocess snapshots to only fetch necessary ones
+	ret := make([]objects.Checksum, 0, len(prefixes))
 	for _, prefix := range prefixes {
-		parsedUuidPrefix, _ := ParseSnapshotID(prefix)
+		parsedPrefix, _ := ParseSnapshotID(prefix)
 
-		matches := 0
-		for _, snapshotID := range snapshotsList {
-			if strings.HasPrefix(hex.EncodeToString(snapshotID[:]), parsedUuidPrefix) {
-				matches++
+		snapshotID, err := resolveSnapshotPrefix(snapshotsList, parsedPrefix)
+		if errors.Is(err, ErrNotFound) {
+			if tags == nil {
+				tags, err = latestTags(repo, snapshotsList)
+				if err != nil {
+					return nil, err
+				}
 			}
-		}
-		if matches == 0 {
-			if _, exists := tags[parsedUuidPrefix]; !exists {
-				log.Fatalf("%s: no snapshot has prefix: %s", flag.CommandLine.Name(), parsedUuidPrefix)
+			tagged, exists := tags[parsedPrefix]
+			if !exists {
+				return nil, fmt.Errorf("%w: %s", ErrNotFound, parsedPrefix)
 			}
-		} else if matches > 1 {
-			log.Fatalf("%s: snapshot ID is ambiguous: %s (matches %d snapshots)", flag.CommandLine.Name(), prefix, matches)
+			snapshotID = tagged
+		} else if err != nil {
+			return nil, err
 		}
+		ret = append(ret, snapshotID)
+	}
+	return ret, nil
+}
 
-		for _, snapshotID := range snapshotsList {
-			if strings.HasPrefix(hex.EncodeToString(snapshotID[:]), parsedUuidPrefix) || snapshotID == tags[parsedUuidPrefix] {
-				snapshotInstance, err := snapshot.Load(repo, snapshotID)
-				if err != nil {
-					return nil, err
-				}
-				result = append(result, snapshotInstance)
+// latestTags maps each tag to the latest snapshot having it.
+func latestTags(repo *repository.Repository, snapshotsList []objects.Checksum) (map[string]objects.Checksum, error) {
+	tags := make(map[string]objects.Checksum)
+	tagsTimestamp := make(map[string]time.Time)
+
+	for _, snapshotID := range snapshotsList {
+		hdr, _, err := snapshot.GetSnapshot(repo, snapshotID)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range hdr.Tags {
+			if recordTime, exists := tagsTimestamp[tag]; !exists || recordTime.Before(hdr.CreationTime) {
+				tags[tag] = snapshotID
+				tagsTimestamp[tag] = hdr.CreationTime
 			}
 		}
 	}
-	return result, nil
+	return tags, nil
 }
 
 func sortSnapshotsByDate(snapshots []*snapshot.Snapshot) []*snapshot.Snapshot {
@@ -267,8 +267,8 @@ func sortSnapshotsByDate(snapshots []*snapshot.Snapshot) []*snapshot.Snapshot {
 func HumanToDuration(human string) (time.Duration, error) {
 	// support either one of the following:
 	// - time.Duration string
-	// - human readable string (e.g. 1h, 1d, 1w, 1m, 1y)
-	// - human readable string with time.Duration suffix (e.g. 1h30m, 1d12h, 1w3d, 1m2w, 1y1m)
+	// - human readable string (e.g. 1h, 1d, 1w, 1y)
+	// - human readable string with time.Duration suffix (e.g. 1h30m, 1d12h, 1w3d, 1y2w)
 
 	// first we check if it's a time.Duration string
 	duration, err := time.ParseDuration(human)
@@ -276,9 +276,48 @@ func HumanToDuration(human string) (time.Duration, error) {
 		return duration, nil
 	}
 
-	// TODO-handle iteratively constructed human readable strings
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+
+	if human == "" {
+		return 0, fmt.Errorf("invalid duration: %s", human)
+	}
+
+	total := time.Duration(0)
+	rest := human
+	for rest != "" {
+		digits := 0
+		for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 {
+			return 0, fmt.Errorf("invalid duration: %s", human)
+		}
+		value, err := strconv.ParseInt(rest[:digits], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", human)
+		}
+		rest = rest[digits:]
+
+		unitLen := 0
+		for unitLen < len(rest) && (rest[unitLen] < '0' || rest[unitLen] > '9') {
+			unitLen++
+		}
+		unit := rest[:unitLen]
+		rest = rest[unitLen:]
 
-	return 0, fmt.Errorf("invalid duration: %s", human)
+		if multiplier, exists := units[unit]; exists {
+			total += time.Duration(value) * multiplier
+		} else if duration, err := time.ParseDuration(fmt.Sprintf("%d%s", value, unit)); err == nil {
+			total += duration
+		} else {
+			return 0, fmt.Errorf("invalid duration: %s", human)
+		}
+	}
+	return total, nil
 }
 
 type ReleaseUpdateSummary struct {
@@ -389,6 +428,63 @@ func GetPassphraseConfirm(prefix string) ([]byte, error) {
 	return passphrase1, nil
 }
 
+// GetPassphraseFromFd reads a passphrase from a file descriptor inherited
+// from the parent process, up to the end of file. A single trailing
+// newline is removed.
+func GetPassphraseFromFd(fd int) ([]byte, error) {
+	fp := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	if fp == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer fp.Close()
+
+	passphrase, err := io.ReadAll(fp)
+	if err != nil {
+		return nil, fmt.Errorf("could not read passphrase from fd %d: %w", fd, err)
+	}
+	passphrase = bytes.TrimSuffix(passphrase, []byte("\n"))
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("empty passphrase read from fd %d", fd)
+	}
+	return passphrase, nil
+}
+
+// PassphraseCommandTimeout bounds the time given to -passphrase-command,
+// leaving room for a secret manager to ask for a PIN or a touch.
+const PassphraseCommandTimeout = time.Minute
+
+// GetPassphraseFromCommand runs command through the shell and uses its
+// standard output as passphrase, a single trailing newline is removed.
+// The command shares the terminal so that it can prompt the user.
+func GetPassphraseFromCommand(command string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	// don't wait forever on children that inherited the output pipe
+	cmd.WaitDelay = time.Second
+
+	passphrase, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("passphrase command timed out after %s", timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("passphrase command failed: %w", err)
+	}
+	passphrase = bytes.TrimSuffix(passphrase, []byte("\n"))
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase command returned an empty passphrase")
+	}
+	return passphrase, nil
+}
+
 func GetCacheDir(appName string) (string, error) {
 	var cacheDir string
 
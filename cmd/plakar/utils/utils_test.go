@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+func TestHumanToDuration(t *testing.T) {
+	day := 24 * time.Hour
+	valid := map[string]time.Duration{
+		"720h":   720 * time.Hour,
+		"1h30m":  90 * time.Minute,
+		"30d":    30 * day,
+		"1w":     7 * day,
+		"1y":     365 * day,
+		"1d12h":  36 * time.Hour,
+		"1w3d":   10 * day,
+		"1y2w":   379 * day,
+		"2d30m":  2*day + 30*time.Minute,
+		"100ms":  100 * time.Millisecond,
+		"10d10d": 20 * day,
+	}
+	for human, expected := range valid {
+		duration, err := HumanToDuration(human)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", human, err)
+		} else if duration != expected {
+			t.Errorf("%s: expected %s, got %s", human, expected, duration)
+		}
+	}
+
+	for _, human := range []string{"", "d", "3", "1x", "1d-2h", "-1d"} {
+		if _, err := HumanToDuration(human); err == nil {
+			t.Errorf("%q: expected an error", human)
+		}
+	}
+}
+
+func TestResolveSnapshotPrefix(t *testing.T) {
+	snapshotIDs := []objects.Checksum{
+		{0xab, 0xcd, 0x01},
+		{0xab, 0xcd, 0x02},
+		{0xef, 0x01},
+	}
+	full := "ef01" + strings.Repeat("00", 30)
+
+	for prefix, expected := range map[string]objects.Checksum{
+		full:     snapshotIDs[2],
+		"ef":     snapshotIDs[2],
+		"abcd01": snapshotIDs[0],
+		"ABCD02": snapshotIDs[1],
+	} {
+		snapshotID, err := resolveSnapshotPrefix(snapshotIDs, prefix)
+		if err != nil {
+			t.Errorf("%s: %v", prefix, err)
+		} else if snapshotID != expected {
+			t.Errorf("%s: expected %x, got %x", prefix, expected, snapshotID)
+		}
+	}
+
+	for _, prefix := range []string{"ab", "abcd0", ""} {
+		if _, err := resolveSnapshotPrefix(snapshotIDs, prefix); !errors.Is(err, ErrAmbiguous) {
+			t.Errorf("%s: expected ErrAmbiguous, got %v", prefix, err)
+		}
+	}
+
+	for _, prefix := range []string{"12", "abcd03", full + "00", "not hex"} {
+		if _, err := resolveSnapshotPrefix(snapshotIDs, prefix); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got %v", prefix, err)
+		}
+	}
+}
+
+func TestMatchSnapshotPrefix(t *testing.T) {
+	snapshotIDs := []objects.Checksum{
+		{0xab, 0xcd, 0x01},
+		{0xab, 0xcd, 0x02},
+		{0xef, 0x01},
+	}
+
+	for prefix, expected := range map[string]int{
+		"ab":     2,
+		"ABCD":   2,
+		"abCD02": 1,
+		"":       3,
+		"12":     0,
+	} {
+		if matches := MatchSnapshotPrefix(snapshotIDs, prefix); len(matches) != expected {
+			t.Errorf("%s: expected %d matches, got %d", prefix, expected, len(matches))
+		}
+	}
+}
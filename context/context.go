@@ -1,12 +1,17 @@
 package context
 
 import (
+	goctx "context"
+
 	"github.com/PlakarKorp/plakar/encryption/keypair"
 	"github.com/PlakarKorp/plakar/events"
 	"github.com/google/uuid"
 )
 
 type Context struct {
+	goctx.Context
+	cancel goctx.CancelFunc
+
 	events *events.Receiver
 
 	numCPU      int
@@ -30,12 +35,18 @@ type Context struct {
 }
 
 func NewContext() *Context {
+	ctx, cancel := goctx.WithCancel(goctx.Background())
 	return &Context{
-		events: events.New(),
+		Context: ctx,
+		cancel:  cancel,
+		events:  events.New(),
 	}
 }
 
+// Close aborts the operations still running with this context, in-flight
+// network requests included.
 func (c *Context) Close() {
+	c.cancel()
 	c.events.Close()
 }
 
@@ -0,0 +1,224 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const wrapInfo = "plakar master key wrap"
+
+var ErrNoPrivateKey = errors.New("private key required to decrypt")
+
+// ParsePublicKey parses a PEM-encoded ECDSA public key in PKIX form, as
+// produced by `openssl ec -pubout`.
+func ParsePublicKey(data []byte) (*ecdh.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ECDSA public key")
+	}
+	return ecdsaKey.ECDH()
+}
+
+// ParsePrivateKey parses a PEM-encoded ECDSA private key, either in SEC 1
+// ("EC PRIVATE KEY") or PKCS #8 ("PRIVATE KEY") form.
+func ParsePrivateKey(data []byte) (*ecdh.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	var ecdsaKey *ecdsa.PrivateKey
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ecdsaKey = key
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if ecdsaKey, ok = key.(*ecdsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("not an ECDSA private key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	return ecdsaKey.ECDH()
+}
+
+// wrapCipher derives the AES-GCM instance protecting a wrapped key from
+// the ECDH shared secret and both public keys.
+func wrapCipher(shared []byte, ephemeral []byte, recipient []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	kek := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(wrapInfo)), kek); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// WrapKey encrypts key to the public key using an ephemeral ECDH exchange.
+// The result holds the ephemeral public key, the nonce and the sealed key.
+func WrapKey(publicKey *ecdh.PublicKey, key []byte) ([]byte, error) {
+	ephemeral, err := publicKey.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralBytes := ephemeral.PublicKey().Bytes()
+	gcm, err := wrapCipher(shared, ephemeralBytes, publicKey.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	wrapped := append(ephemeralBytes, nonce...)
+	return gcm.Seal(wrapped, nonce, key, nil), nil
+}
+
+// wrappedKeySize returns the size of a 32-byte key wrapped to privateKey.
+func wrappedKeySize(privateKey *ecdh.PrivateKey) int {
+	// ephemeral point, GCM nonce, key and GCM tag
+	return len(privateKey.PublicKey().Bytes()) + 12 + 32 + 16
+}
+
+// UnwrapKey recovers a key wrapped with WrapKey to the public half of
+// privateKey.
+func UnwrapKey(privateKey *ecdh.PrivateKey, wrapped []byte) ([]byte, error) {
+	pointSize := len(privateKey.PublicKey().Bytes())
+	if len(wrapped) < pointSize {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+
+	ephemeral, err := privateKey.Curve().NewPublicKey(wrapped[:pointSize])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := wrapCipher(shared, wrapped[:pointSize], privateKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped = wrapped[pointSize:]
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	return gcm.Open(nil, wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():], nil)
+}
+
+// Sealer encrypts streams to a public key, without access to the private
+// key. A random master key is generated and wrapped once per Sealer, each
+// stream carries the wrapped master key ahead of the symmetric stream.
+type Sealer struct {
+	masterKey []byte
+	wrapped   []byte
+}
+
+func NewSealer(publicKey *ecdh.PublicKey) (*Sealer, error) {
+	masterKey := make([]byte, 32)
+	if _, err := rand.Read(masterKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := WrapKey(publicKey, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{
+		masterKey: masterKey,
+		wrapped:   wrapped,
+	}, nil
+}
+
+func (sealer *Sealer) EncryptStream(aad []byte, r io.Reader) (io.Reader, error) {
+	rd, err := EncryptStream(sealer.masterKey, aad, r)
+	if err != nil {
+		return nil, err
+	}
+	return io.MultiReader(bytes.NewReader(sealer.wrapped), rd), nil
+}
+
+// Opener decrypts streams produced by a Sealer. Unwrapped master keys are
+// kept so that the ECDH exchange runs once per writing session rather than
+// once per stream.
+type Opener struct {
+	privateKey *ecdh.PrivateKey
+
+	mu         sync.Mutex
+	masterKeys map[string][]byte
+}
+
+func NewOpener(privateKey *ecdh.PrivateKey) *Opener {
+	return &Opener{
+		privateKey: privateKey,
+		masterKeys: make(map[string][]byte),
+	}
+}
+
+func (opener *Opener) masterKey(wrapped []byte) ([]byte, error) {
+	opener.mu.Lock()
+	defer opener.mu.Unlock()
+
+	if masterKey, exists := opener.masterKeys[string(wrapped)]; exists {
+		return masterKey, nil
+	}
+	masterKey, err := UnwrapKey(opener.privateKey, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	opener.masterKeys[string(wrapped)] = masterKey
+	return masterKey, nil
+}
+
+func (opener *Opener) DecryptStream(aad []byte, r io.Reader) (io.Reader, error) {
+	wrapped := make([]byte, wrappedKeySize(opener.privateKey))
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, err
+	}
+	masterKey, err := opener.masterKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptStream(masterKey, aad, r)
+}
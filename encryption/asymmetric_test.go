@@ -0,0 +1,127 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"testing"
+)
+
+func generateKeyPEM(t *testing.T, curve elliptic.Curve) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: private}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})
+}
+
+func TestWrapUnwrapKey(t *testing.T) {
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384()} {
+		privatePEM, publicPEM := generateKeyPEM(t, curve)
+		publicKey, err := ParsePublicKey(publicPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privateKey, err := ParsePrivateKey(privatePEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		masterKey := make([]byte, 32)
+		rand.Read(masterKey)
+
+		wrapped, err := WrapKey(publicKey, masterKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(wrapped) != wrappedKeySize(privateKey) {
+			t.Fatalf("%s: expected a wrapped key of %d bytes, got %d", curve.Params().Name, wrappedKeySize(privateKey), len(wrapped))
+		}
+		unwrapped, err := UnwrapKey(privateKey, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, masterKey) {
+			t.Fatalf("%s: unwrapped key differs from the master key", curve.Params().Name)
+		}
+
+		otherPEM, _ := generateKeyPEM(t, curve)
+		otherKey, err := ParsePrivateKey(otherPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := UnwrapKey(otherKey, wrapped); err == nil {
+			t.Fatalf("%s: expected unwrapping with another private key to fail", curve.Params().Name)
+		}
+	}
+}
+
+func TestSealerOpener(t *testing.T) {
+	privatePEM, publicPEM := generateKeyPEM(t, elliptic.P256())
+	publicKey, err := ParsePublicKey(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := ParsePrivateKey(privatePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealer, err := NewSealer(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opener := NewOpener(privateKey)
+
+	for _, data := range [][]byte{[]byte("write-only backups"), {}, bytes.Repeat([]byte("x"), 3*chunkSize)} {
+		rd, err := sealer.EncryptStream(nil, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rd, err = opener.DecryptStream(nil, bytes.NewReader(encrypted))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, data) {
+			t.Fatalf("decrypted data does not match, got %d bytes, want %d", len(decrypted), len(data))
+		}
+	}
+	if len(opener.masterKeys) != 1 {
+		t.Fatalf("expected the master key to be unwrapped once, got %d entries", len(opener.masterKeys))
+	}
+}
+
+func TestParseKeyErrors(t *testing.T) {
+	privatePEM, publicPEM := generateKeyPEM(t, elliptic.P256())
+	if _, err := ParsePublicKey(privatePEM); err == nil {
+		t.Fatal("expected a private key to be rejected as public key")
+	}
+	if _, err := ParsePrivateKey(publicPEM); err == nil {
+		t.Fatal("expected a public key to be rejected as private key")
+	}
+	if _, err := ParsePublicKey([]byte("not a key")); err == nil {
+		t.Fatal("expected garbage to be rejected")
+	}
+}
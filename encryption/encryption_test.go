@@ -1,10 +1,18 @@
 package encryption
 
 import (
+	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
+
+	"github.com/PlakarKorp/plakar/compression"
+	"github.com/PlakarKorp/plakar/encryption/keypair"
 )
 
 func TestEncryptDecryptStream(t *testing.T) {
@@ -23,13 +31,13 @@ func TestEncryptDecryptStream(t *testing.T) {
 	r := strings.NewReader(originalData)
 
 	// Encrypt the data
-	encryptedReader, err := EncryptStream(derivedKey, r)
+	encryptedReader, err := EncryptStream(derivedKey, nil, r)
 	if err != nil {
 		t.Fatalf("Failed to encrypt data: %v", err)
 	}
 
 	// Decrypt the data
-	decryptedReader, err := DecryptStream(derivedKey, encryptedReader)
+	decryptedReader, err := DecryptStream(derivedKey, nil, encryptedReader)
 	if err != nil {
 		t.Fatalf("Failed to decrypt data: %v", err)
 	}
@@ -62,13 +70,13 @@ func TestEncryptDecryptEmptyStream(t *testing.T) {
 	r := strings.NewReader(originalData)
 
 	// Encrypt the data
-	encryptedReader, err := EncryptStream(derivedKey, r)
+	encryptedReader, err := EncryptStream(derivedKey, nil, r)
 	if err != nil {
 		t.Fatalf("Failed to encrypt data: %v", err)
 	}
 
 	// Decrypt the data
-	decryptedReader, err := DecryptStream(derivedKey, encryptedReader)
+	decryptedReader, err := DecryptStream(derivedKey, nil, encryptedReader)
 	if err != nil {
 		t.Fatalf("Failed to decrypt data: %v", err)
 	}
@@ -101,7 +109,7 @@ func TestEncryptDecryptStreamWithIncorrectKey(t *testing.T) {
 	r := strings.NewReader(originalData)
 
 	// Encrypt the data
-	encryptedReader, err := EncryptStream(derivedKey, r)
+	encryptedReader, err := EncryptStream(derivedKey, nil, r)
 	if err != nil {
 		t.Fatalf("Failed to encrypt data: %v", err)
 	}
@@ -113,7 +121,7 @@ func TestEncryptDecryptStreamWithIncorrectKey(t *testing.T) {
 	}
 
 	// Attempt to decrypt the data with the incorrect key
-	decryptedReader, err := DecryptStream(incorrectKey, encryptedReader)
+	decryptedReader, err := DecryptStream(incorrectKey, nil, encryptedReader)
 	if err == nil {
 		// Attempt to read the (likely) invalid decrypted data to trigger an error
 		if _, readErr := io.ReadAll(decryptedReader); readErr == nil {
@@ -148,3 +156,247 @@ func TestBuildSecretFromPassphraseAndDeriveSecret(t *testing.T) {
 		t.Fatal("Expected error for incorrect passphrase, but got none")
 	}
 }
+
+func TestEncryptDecryptCompressedKeypair(t *testing.T) {
+	kp, err := keypair.Generate()
+	if err != nil {
+		t.Fatalf("Failed to generate keypair: %v", err)
+	}
+	serialized, err := kp.ToBytes()
+	if err != nil {
+		t.Fatalf("Failed to serialize keypair: %v", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	for _, algorithm := range []string{"LZ4", "GZIP"} {
+		// Compress then encrypt, as the repository does when encoding
+		deflated, err := compression.DeflateStream(algorithm, bytes.NewReader(serialized))
+		if err != nil {
+			t.Fatalf("%s: Failed to compress keypair: %v", algorithm, err)
+		}
+		encryptedReader, err := EncryptStream(key, nil, deflated)
+		if err != nil {
+			t.Fatalf("%s: Failed to encrypt keypair: %v", algorithm, err)
+		}
+
+		decryptedReader, err := DecryptStream(key, nil, encryptedReader)
+		if err != nil {
+			t.Fatalf("%s: Failed to decrypt keypair: %v", algorithm, err)
+		}
+		inflated, err := compression.InflateStream(algorithm, decryptedReader)
+		if err != nil {
+			t.Fatalf("%s: Failed to decompress keypair: %v", algorithm, err)
+		}
+		data, err := io.ReadAll(inflated)
+		if err != nil {
+			t.Fatalf("%s: Failed to read keypair: %v", algorithm, err)
+		}
+
+		decoded, err := keypair.FromBytes(data)
+		if err != nil {
+			t.Fatalf("%s: Failed to deserialize keypair: %v", algorithm, err)
+		}
+		if !bytes.Equal(decoded.PrivateKey, kp.PrivateKey) || !bytes.Equal(decoded.PublicKey, kp.PublicKey) {
+			t.Errorf("%s: Keypair does not match original", algorithm)
+		}
+	}
+}
+
+func TestDecryptStreamWithDifferentAAD(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	originalData := "Data bound to its context"
+	encryptedReader, err := EncryptStream(key, []byte("repository A"), strings.NewReader(originalData))
+	if err != nil {
+		t.Fatalf("Failed to encrypt data: %v", err)
+	}
+	encrypted, err := io.ReadAll(encryptedReader)
+	if err != nil {
+		t.Fatalf("Failed to read encrypted data: %v", err)
+	}
+
+	// The same additional data decrypts
+	decryptedReader, err := DecryptStream(key, []byte("repository A"), bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatalf("Failed to decrypt data: %v", err)
+	}
+	decryptedData, err := io.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatalf("Failed to read decrypted data: %v", err)
+	}
+	if string(decryptedData) != originalData {
+		t.Errorf("Decrypted data does not match original. Got: %q, want: %q", string(decryptedData), originalData)
+	}
+
+	// Different or missing additional data must not
+	for _, aad := range [][]byte{[]byte("repository B"), nil} {
+		decryptedReader, err := DecryptStream(key, aad, bytes.NewReader(encrypted))
+		if err == nil {
+			_, err = io.ReadAll(decryptedReader)
+		}
+		if err == nil {
+			t.Errorf("Expected decryption with AAD %q to fail", aad)
+		}
+	}
+}
+
+func TestDecryptStreamWithTamperedSubkey(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	encryptedReader, err := EncryptStream(key, nil, strings.NewReader("Protected by a wrapped subkey"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt data: %v", err)
+	}
+	encrypted, err := io.ReadAll(encryptedReader)
+	if err != nil {
+		t.Fatalf("Failed to read encrypted data: %v", err)
+	}
+
+	// The subkey is sealed with AES-GCM right after its 12-byte nonce,
+	// flipping any bit of it must be detected before data is decrypted
+	encrypted[12] ^= 0x01
+	if _, err := DecryptStream(key, nil, bytes.NewReader(encrypted)); err == nil {
+		t.Fatal("Expected error for tampered subkey, but got none")
+	}
+}
+
+func TestDeriveSecretErrors(t *testing.T) {
+	secret, err := BuildSecretFromPassphrase([]byte("right passphrase"))
+	if err != nil {
+		t.Fatalf("Failed to build secret from passphrase: %v", err)
+	}
+
+	if _, err := DeriveSecret([]byte("wrong passphrase"), secret); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected ErrWrongPassphrase for wrong passphrase, got %v", err)
+	}
+
+	for _, corrupt := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		_, err := DeriveSecret([]byte("right passphrase"), corrupt)
+		if !errors.Is(err, ErrInvalidSecret) {
+			t.Errorf("Expected ErrInvalidSecret for %q, got %v", corrupt, err)
+		}
+	}
+}
+
+func TestEncryptDecryptStreamWithMalformedKey(t *testing.T) {
+	for _, key := range [][]byte{nil, make([]byte, 5), make([]byte, 33)} {
+		if _, err := EncryptStream(key, nil, strings.NewReader("data")); err == nil {
+			t.Errorf("Expected error encrypting with a %d-byte key, but got none", len(key))
+		}
+		if _, err := DecryptStream(key, nil, strings.NewReader(strings.Repeat("x", 128))); err == nil {
+			t.Errorf("Expected error decrypting with a %d-byte key, but got none", len(key))
+		}
+	}
+}
+
+func TestEncryptDecryptStreamShortReads(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	// Spans several chunks, read back one byte at a time and with data
+	// returned along with io.EOF
+	originalData := strings.Repeat("short reads must not split chunks ", 100)
+	encryptedReader, err := EncryptStream(key, nil, iotest.DataErrReader(iotest.OneByteReader(strings.NewReader(originalData))))
+	if err != nil {
+		t.Fatalf("Failed to encrypt data: %v", err)
+	}
+	decryptedReader, err := DecryptStream(key, nil, iotest.OneByteReader(encryptedReader))
+	if err != nil {
+		t.Fatalf("Failed to decrypt data: %v", err)
+	}
+	decryptedData, err := io.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatalf("Failed to read decrypted data: %v", err)
+	}
+	if string(decryptedData) != originalData {
+		t.Errorf("Decrypted data does not match original, got %d bytes, want %d", len(decryptedData), len(originalData))
+	}
+}
+
+func TestDecryptStreamTruncated(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	encryptedReader, err := EncryptStream(key, nil, strings.NewReader(strings.Repeat("x", 3*chunkSize)))
+	if err != nil {
+		t.Fatalf("Failed to encrypt data: %v", err)
+	}
+	encrypted, err := io.ReadAll(encryptedReader)
+	if err != nil {
+		t.Fatalf("Failed to read encrypted data: %v", err)
+	}
+
+	// Truncated within the header, then within the last chunk
+	for _, size := range []int{20, len(encrypted) - 1} {
+		decryptedReader, err := DecryptStream(key, nil, bytes.NewReader(encrypted[:size]))
+		if err == nil {
+			_, err = io.ReadAll(decryptedReader)
+		}
+		if err == nil {
+			t.Errorf("Expected error for stream truncated to %d bytes, but got none", size)
+		}
+	}
+}
+
+func TestEncryptStreamConvergent(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	aad := []byte("repository")
+	data := bytes.Repeat([]byte("identical chunk "), 200)
+	checksum := sha256.Sum256(data)
+
+	encrypt := func(convergent bool, checksum []byte) []byte {
+		var rd io.Reader
+		var err error
+		if convergent {
+			rd, err = EncryptStreamConvergent(key, aad, checksum, bytes.NewReader(data))
+		} else {
+			rd, err = EncryptStream(key, aad, bytes.NewReader(data))
+		}
+		if err != nil {
+			t.Fatalf("Failed to encrypt data: %v", err)
+		}
+		encrypted, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatalf("Failed to read encrypted data: %v", err)
+		}
+		return encrypted
+	}
+
+	first := encrypt(true, checksum[:])
+	if second := encrypt(true, checksum[:]); !bytes.Equal(first, second) {
+		t.Errorf("Expected identical chunks to encrypt identically in convergent mode")
+	}
+	if bytes.Equal(encrypt(false, nil), encrypt(false, nil)) {
+		t.Errorf("Expected identical chunks to encrypt differently outside convergent mode")
+	}
+	other := sha256.Sum256([]byte("another chunk"))
+	if bytes.Equal(first, encrypt(true, other[:])) {
+		t.Errorf("Expected another checksum to give another ciphertext")
+	}
+
+	decryptedReader, err := DecryptStream(key, aad, bytes.NewReader(first))
+	if err != nil {
+		t.Fatalf("Failed to decrypt data: %v", err)
+	}
+	decrypted, err := io.ReadAll(decryptedReader)
+	if err != nil {
+		t.Fatalf("Failed to read decrypted data: %v", err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Errorf("Decrypted data does not match original")
+	}
+}
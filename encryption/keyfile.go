@@ -0,0 +1,237 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrKeyfilePermissions is returned when reading a private key that is
+// accessible to users other than its owner.
+var ErrKeyfilePermissions = errors.New("key file permissions are too open")
+
+// KeyfileBlockType is the PEM block type of passphrase-protected key files.
+const KeyfileBlockType = "PLAKAR ENCRYPTED KEY"
+
+// Keyfile holds the private key of a keypair repository along with an
+// identifier, it is stored sealed with a passphrase.
+type Keyfile struct {
+	Identifier uuid.UUID
+	Timestamp  time.Time
+	PrivateKey []byte // PKCS #8, DER-encoded
+}
+
+// Keygen generates a new ECDSA P-256 private key.
+func Keygen() (*Keyfile, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	identifier, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	return &Keyfile{
+		Identifier: identifier,
+		Timestamp:  time.Now(),
+		PrivateKey: der,
+	}, nil
+}
+
+// PrivateKeyPEM returns the private key in the PEM form expected by
+// ParsePrivateKey.
+func (k *Keyfile) PrivateKeyPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: k.PrivateKey})
+}
+
+// PublicKeyPEM returns the public key in the PEM form expected by
+// ParsePublicKey, to be passed to `plakar create -keyfile`.
+func (k *Keyfile) PublicKeyPEM() ([]byte, error) {
+	key, err := x509.ParsePKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ECDSA private key")
+	}
+	der, err := x509.MarshalPKIXPublicKey(&ecdsaKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// Seal encrypts the key file with a key derived from the passphrase and
+// returns it PEM-encoded.
+func (k *Keyfile) Seal(passphrase []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	dk, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	serialized, err := msgpack.Marshal(k)
+	if err != nil {
+		return nil, err
+	}
+
+	rd, err := EncryptStream(dk, nil, bytes.NewReader(serialized))
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  KeyfileBlockType,
+		Bytes: append(salt, sealed...),
+	}), nil
+}
+
+// IsKeyfile returns true if data holds a sealed key file rather than a
+// plain PEM private key.
+func IsKeyfile(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && block.Type == KeyfileBlockType
+}
+
+// Keyload decrypts a key file sealed with Seal.
+func Keyload(data []byte, passphrase []byte) (*Keyfile, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != KeyfileBlockType {
+		return nil, fmt.Errorf("not a plakar key file")
+	}
+	if len(block.Bytes) < saltSize {
+		return nil, fmt.Errorf("key file too short")
+	}
+
+	salt := block.Bytes[:saltSize]
+	dk, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	rd, err := DecryptStream(dk, nil, bytes.NewReader(block.Bytes[saltSize:]))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	serialized, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	var k Keyfile
+	if err := msgpack.Unmarshal(serialized, &k); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// isPrivateKey returns true if data holds a private key, sealed or not.
+func isPrivateKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	return block.Type == KeyfileBlockType || block.Type == "PRIVATE KEY" || block.Type == "EC PRIVATE KEY"
+}
+
+// ReadKeyfile reads the content of the file passed to -keyfile. Like ssh,
+// it refuses private keys that group or others can access, passphrase
+// files are returned as is.
+func ReadKeyfile(path string) ([]byte, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	data, err := io.ReadAll(fp)
+	if err != nil {
+		return nil, err
+	}
+	if !isPrivateKey(data) || runtime.GOOS == "windows" {
+		return data, nil
+	}
+
+	// stat the open file rather than the path, so the check applies to
+	// what was read
+	info, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return nil, fmt.Errorf("%w: %s is %04o, expected 0600", ErrKeyfilePermissions, path, perm)
+	}
+	return data, nil
+}
+
+// WriteKeyfile writes a key file readable by its owner only. The key file
+// may be the only copy of the key, so it is written to a temporary file
+// renamed over path once synced: path holds either the previous or the
+// new content, never a truncated one.
+func WriteKeyfile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes the rename of a file within dir durable.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	fp, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return fp.Sync()
+}
@@ -0,0 +1,168 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestKeygenKeyload(t *testing.T) {
+	keyfile, err := Keygen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := keyfile.Seal([]byte("key passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsKeyfile(sealed) {
+		t.Fatal("expected the sealed key to be recognized as a key file")
+	}
+
+	loaded, err := Keyload(sealed, []byte("key passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Identifier != keyfile.Identifier {
+		t.Fatalf("identifier did not round-trip: got %s, want %s", loaded.Identifier, keyfile.Identifier)
+	}
+
+	// the loaded key must decrypt what is sealed to the public key
+	publicPEM, err := keyfile.PublicKeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ParsePublicKey(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := ParsePrivateKey(loaded.PrivateKeyPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !privateKey.PublicKey().Equal(publicKey) {
+		t.Fatal("loaded private key does not match the public key")
+	}
+
+	if _, err := Keyload(sealed, []byte("wrong passphrase")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+	if IsKeyfile(publicPEM) {
+		t.Fatal("a public key is not a key file")
+	}
+}
+
+func TestReadKeyfilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not checked on windows")
+	}
+
+	keyfile, err := Keygen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := keyfile.Seal([]byte("key passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "plakar.key")
+	if err := WriteKeyfile(path, sealed); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected key file to be written 0600, got %04o", info.Mode().Perm())
+	}
+	if _, err := ReadKeyfile(path); err != nil {
+		t.Fatalf("ReadKeyfile: %v", err)
+	}
+
+	for _, perm := range []os.FileMode{0640, 0604, 0644} {
+		if err := os.Chmod(path, perm); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadKeyfile(path); !errors.Is(err, ErrKeyfilePermissions) {
+			t.Errorf("%04o: expected ErrKeyfilePermissions, got %v", perm, err)
+		}
+	}
+
+	// passphrase files are not subject to the check
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(passphraseFile, []byte("passphrase\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadKeyfile(passphraseFile); err != nil {
+		t.Fatalf("ReadKeyfile on a passphrase file: %v", err)
+	}
+}
+
+func TestWriteKeyfileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plakar.key")
+
+	oldContent := bytes.Repeat([]byte("o"), 64*1024)
+	newContent := bytes.Repeat([]byte("n"), 128*1024)
+	if err := WriteKeyfile(path, oldContent); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if !bytes.Equal(data, oldContent) && !bytes.Equal(data, newContent) {
+				errc <- fmt.Errorf("read a partial key file of %d bytes", len(data))
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		content := newContent
+		if i%2 == 1 {
+			content = oldContent
+		}
+		if err := WriteKeyfile(path, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected temporary files to be cleaned up, found %d entries", len(entries))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected key file to be 0600, got %04o", info.Mode().Perm())
+	}
+}
@@ -1,11 +1,14 @@
 package encryption
 
 import (
-	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 
@@ -15,16 +18,37 @@ import (
 type Configuration struct {
 	Algorithm string
 	Key       string
+
+	// Authenticated makes streams authenticate the repository ID as
+	// additional data, it is unset for repositories that predate it.
+	Authenticated bool
+
+	// PublicKey holds the PEM-encoded ECDSA public key of repositories
+	// created with a keyfile, Key is unused for those.
+	PublicKey string
+
+	// Convergent makes chunks encrypt with keys and nonces derived from
+	// their checksum, so that identical chunks give identical blobs.  Who
+	// can read the store learns which chunks are the same, and who holds
+	// the key can confirm that a known content is stored.
+	Convergent bool
 }
 
+var (
+	ErrWrongPassphrase = errors.New("passphrase does not match")
+	ErrInvalidSecret   = errors.New("invalid repository secret")
+)
+
 const (
 	saltSize  = 16
+	nonceSize = 12   // Standard nonce size of AES-GCM
 	chunkSize = 1024 // Size of each chunk for encryption/decryption
 )
 
 func DefaultConfiguration() *Configuration {
 	return &Configuration{
-		Algorithm: "AES256-GCM",
+		Algorithm:     "AES256-GCM",
+		Authenticated: true,
 	}
 }
 
@@ -50,7 +74,10 @@ func BuildSecretFromPassphrase(passphrase []byte) (string, error) {
 func DeriveSecret(passphrase []byte, secret string) ([]byte, error) {
 	decodedSecret, err := base64.StdEncoding.DecodeString(secret)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSecret, err)
+	}
+	if len(decodedSecret) != saltSize+32 {
+		return nil, ErrInvalidSecret
 	}
 
 	salt := decodedSecret[:saltSize]
@@ -62,20 +89,56 @@ func DeriveSecret(passphrase []byte, secret string) ([]byte, error) {
 		return nil, err
 	}
 
-	if !bytes.Equal(dk, expectedKey) {
-		return nil, fmt.Errorf("passphrase does not match")
+	if subtle.ConstantTimeCompare(dk, expectedKey) != 1 {
+		return nil, ErrWrongPassphrase
 	}
 	return dk, nil
 }
 
-// EncryptStream encrypts a stream using AES-GCM with a random session-specific subkey
-func EncryptStream(key []byte, r io.Reader) (io.Reader, error) {
+// EncryptStream encrypts a stream using AES-GCM with a random session-specific subkey,
+// aad is authenticated along with the subkey and each chunk but not encrypted
+func EncryptStream(key []byte, aad []byte, r io.Reader) (io.Reader, error) {
 	// Generate a random subkey for data encryption
 	subkey := make([]byte, 32)
 	if _, err := rand.Read(subkey); err != nil {
 		return nil, err
 	}
 
+	// Generate the nonces for subkey and data encryption
+	subkeyNonce := make([]byte, nonceSize)
+	if _, err := rand.Read(subkeyNonce); err != nil {
+		return nil, err
+	}
+	dataNonce := make([]byte, nonceSize)
+	if _, err := rand.Read(dataNonce); err != nil {
+		return nil, err
+	}
+
+	return encryptStream(key, aad, subkey, subkeyNonce, dataNonce, r)
+}
+
+// EncryptStreamConvergent encrypts a stream like EncryptStream, but derives
+// the subkey and the nonces from the key and checksum, the checksum of the
+// plaintext: the same data always gives the same ciphertext.  The output
+// is decrypted by DecryptStream.
+func EncryptStreamConvergent(key []byte, aad []byte, checksum []byte, r io.Reader) (io.Reader, error) {
+	derive := func(label string, size int) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(label))
+		mac.Write(checksum)
+		return mac.Sum(nil)[:size]
+	}
+
+	return encryptStream(key, aad,
+		derive("plakar convergent subkey", 32),
+		derive("plakar convergent subkey nonce", nonceSize),
+		derive("plakar convergent data nonce", nonceSize),
+		r)
+}
+
+// encryptStream seals subkey with key and the data with subkey, both nonces
+// are nonceSize bytes long.
+func encryptStream(key []byte, aad []byte, subkey []byte, subkeyNonce []byte, dataNonce []byte, r io.Reader) (io.Reader, error) {
 	// Encrypt the subkey with the main key using AES-GCM
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -86,14 +149,8 @@ func EncryptStream(key []byte, r io.Reader) (io.Reader, error) {
 		return nil, err
 	}
 
-	// Generate a nonce for subkey encryption
-	subkeyNonce := make([]byte, gcm.NonceSize())
-	if _, err := rand.Read(subkeyNonce); err != nil {
-		return nil, err
-	}
-
 	// Encrypt the subkey
-	encSubkey := gcm.Seal(nil, subkeyNonce, subkey, nil)
+	encSubkey := gcm.Seal(nil, subkeyNonce, subkey, aad)
 
 	// Set up AES-GCM for data encryption using the subkey
 	dataBlock, err := aes.NewCipher(subkey)
@@ -105,12 +162,6 @@ func EncryptStream(key []byte, r io.Reader) (io.Reader, error) {
 		return nil, err
 	}
 
-	// Generate a nonce for data encryption
-	dataNonce := make([]byte, dataGCM.NonceSize())
-	if _, err := rand.Read(dataNonce); err != nil {
-		return nil, err
-	}
-
 	// Set up the pipe for streaming encryption
 	pr, pw := io.Pipe()
 
@@ -118,25 +169,32 @@ func EncryptStream(key []byte, r io.Reader) (io.Reader, error) {
 	go func() {
 		defer pw.Close()
 		// Write the encrypted subkey and both nonces to the output stream
-		pw.Write(subkeyNonce)
-		pw.Write(encSubkey)
-		pw.Write(dataNonce)
+		for _, header := range [][]byte{subkeyNonce, encSubkey, dataNonce} {
+			if _, err := pw.Write(header); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
 
-		// Encrypt and write the actual data in chunks
+		// Encrypt and write the actual data in chunks, a short read may
+		// still carry data along with io.EOF or an error
 		buf := make([]byte, chunkSize)
 		for {
-			n, err := r.Read(buf)
-			if err != nil {
-				if err != io.EOF {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				// Encrypt each chunk and write it to the pipe
+				encryptedChunk := dataGCM.Seal(nil, dataNonce, buf[:n], aad)
+				if _, err := pw.Write(encryptedChunk); err != nil {
 					pw.CloseWithError(err)
+					return
 				}
-				break
 			}
-			// Encrypt each chunk and write it to the pipe
-			encryptedChunk := dataGCM.Seal(nil, dataNonce, buf[:n], nil)
-			if _, err := pw.Write(encryptedChunk); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return
+			}
+			if err != nil {
 				pw.CloseWithError(err)
-				break
+				return
 			}
 		}
 	}()
@@ -144,8 +202,9 @@ func EncryptStream(key []byte, r io.Reader) (io.Reader, error) {
 	return pr, nil
 }
 
-// DecryptStream decrypts a stream using AES-GCM with a random session-specific subkey
-func DecryptStream(key []byte, r io.Reader) (io.Reader, error) {
+// DecryptStream decrypts a stream using AES-GCM with a random session-specific subkey,
+// it fails unless aad matches the one passed to EncryptStream
+func DecryptStream(key []byte, aad []byte, r io.Reader) (io.Reader, error) {
 	// Set up to decrypt the subkey from the input
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -167,7 +226,7 @@ func DecryptStream(key []byte, r io.Reader) (io.Reader, error) {
 		return nil, err
 	}
 
-	subkey, err := gcm.Open(nil, subkeyNonce, encSubkey, nil)
+	subkey, err := gcm.Open(nil, subkeyNonce, encSubkey, aad)
 	if err != nil {
 		return nil, err
 	}
@@ -194,25 +253,29 @@ func DecryptStream(key []byte, r io.Reader) (io.Reader, error) {
 	go func() {
 		defer pw.Close()
 
-		// Decrypt the data in chunks and write it to the pipe
+		// Decrypt the data in chunks and write it to the pipe, reading
+		// whole chunks so that short reads don't split a sealed chunk
 		buf := make([]byte, chunkSize+dataGCM.Overhead())
 		for {
-			n, err := r.Read(buf)
-			if err != nil {
-				if err != io.EOF {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				// Decrypt each chunk and write it to the pipe
+				decryptedChunk, err := dataGCM.Open(nil, dataNonce, buf[:n], aad)
+				if err != nil {
 					pw.CloseWithError(err)
+					return
+				}
+				if _, err := pw.Write(decryptedChunk); err != nil {
+					pw.CloseWithError(err)
+					return
 				}
-				break
 			}
-			// Decrypt each chunk and write it to the pipe
-			decryptedChunk, err := dataGCM.Open(nil, dataNonce, buf[:n], nil)
-			if err != nil {
-				pw.CloseWithError(err)
-				break
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return
 			}
-			if _, err := pw.Write(decryptedChunk); err != nil {
+			if err != nil {
 				pw.CloseWithError(err)
-				break
+				return
 			}
 		}
 	}()
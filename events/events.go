@@ -275,6 +275,22 @@ func (e FileCorrupted) Timestamp() time.Time {
 	return e.ts
 }
 
+/**/
+type FileSkipped struct {
+	ts time.Time
+
+	SnapshotID [32]byte
+	Pathname   string
+	Size       uint64
+}
+
+func FileSkippedEvent(snapshotID [32]byte, pathname string, size uint64) FileSkipped {
+	return FileSkipped{ts: time.Now(), SnapshotID: snapshotID, Pathname: pathname, Size: size}
+}
+func (e FileSkipped) Timestamp() time.Time {
+	return e.ts
+}
+
 /**/
 type ObjectOK struct {
 	ts time.Time
@@ -364,3 +380,38 @@ func ChunkCorruptedEvent(snapshotID [32]byte, checksum [32]byte) ChunkCorrupted
 func (e ChunkCorrupted) Timestamp() time.Time {
 	return e.ts
 }
+
+/**/
+type Progress struct {
+	ts time.Time
+
+	SnapshotID [32]byte
+	Done       uint64
+	Total      uint64
+	Bytes      uint64
+	BytesTotal uint64
+}
+
+func ProgressEvent(snapshotID [32]byte, done uint64, total uint64, bytes uint64, bytesTotal uint64) Progress {
+	return Progress{ts: time.Now(), SnapshotID: snapshotID, Done: done, Total: total, Bytes: bytes, BytesTotal: bytesTotal}
+}
+func (e Progress) Timestamp() time.Time {
+	return e.ts
+}
+
+/**/
+type ErrorsSummary struct {
+	ts time.Time
+
+	SnapshotID [32]byte
+	Count      uint64
+	Classes    map[string]uint64
+	Paths      []string
+}
+
+func ErrorsSummaryEvent(snapshotID [32]byte, count uint64, classes map[string]uint64, paths []string) ErrorsSummary {
+	return ErrorsSummary{ts: time.Now(), SnapshotID: snapshotID, Count: count, Classes: classes, Paths: paths}
+}
+func (e ErrorsSummary) Timestamp() time.Time {
+	return e.ts
+}
@@ -89,7 +89,7 @@ func Unseal(data []byte, passphrase []byte) (*Identity, error) {
 		return nil, err
 	}
 
-	rd, err := encryption.DecryptStream(dk, bytes.NewReader(data[32:]))
+	rd, err := encryption.DecryptStream(dk, nil, bytes.NewReader(data[32:]))
 	if err != nil {
 		return nil, err
 	}
@@ -116,7 +116,7 @@ func (i *Identity) Seal(passphrase []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	rd, err := encryption.EncryptStream(dk, bytes.NewReader(serialized))
+	rd, err := encryption.EncryptStream(dk, nil, bytes.NewReader(serialized))
 	if err != nil {
 		return nil, err
 	}
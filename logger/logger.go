@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/charmbracelet/log"
 )
@@ -15,7 +16,37 @@ var debugChannel chan string
 var traceChannel chan string
 var profileChannel chan string
 
-var enableInfo = false
+// Level selects the messages that are logged: those of the level and
+// the more severe ones. Errors are always logged.
+type Level int
+
+const (
+	ErrorLevel Level = iota
+	WarnLevel
+	InfoLevel
+	DebugLevel
+)
+
+var levels = map[string]Level{
+	"error": ErrorLevel,
+	"warn":  WarnLevel,
+	"info":  InfoLevel,
+	"debug": DebugLevel,
+}
+
+// Format is how log lines are written.
+type Format int
+
+const (
+	// TextFormat is meant to be read by humans and is the default.
+	TextFormat Format = iota
+	// JSONFormat writes a JSON object per line, with a timestamp and
+	// the trace component as fields, meant to be ingested.
+	JSONFormat
+)
+
+var logLevel = WarnLevel
+var logFormat = TextFormat
 var enableTracing = false
 var enableProfiling = false
 
@@ -48,19 +79,64 @@ func init() {
 	})
 }
 
+func loggers() []*log.Logger {
+	return []*log.Logger{infoLogger, warnLogger, stderrLogger, debugLogger, traceLogger, profileLogger}
+}
+
+// ParseLevel returns the level named name: error, warn, info or debug.
+func ParseLevel(name string) (Level, error) {
+	level, exists := levels[strings.ToLower(name)]
+	if !exists {
+		return ErrorLevel, fmt.Errorf("unknown log level: %s", name)
+	}
+	return level, nil
+}
+
+func SetLevel(level Level) {
+	logLevel = level
+}
+
+// ParseFormat returns the format named name: text or json.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "text":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	}
+	return TextFormat, fmt.Errorf("unknown log format: %s", name)
+}
+
+func SetFormat(format Format) {
+	logFormat = format
+	for _, logger := range loggers() {
+		if format == JSONFormat {
+			logger.SetFormatter(log.JSONFormatter)
+			logger.SetReportTimestamp(true)
+			logger.SetTimeFormat(time.RFC3339Nano)
+		} else {
+			logger.SetFormatter(log.TextFormatter)
+			logger.SetReportTimestamp(false)
+			logger.SetTimeFormat(log.DefaultTimeFormat)
+		}
+	}
+}
+
 func Printf(format string, args ...interface{}) {
 	infoLogger.Print(fmt.Sprintf(format, args...))
 	// infoChannel <- fmt.Sprintf(format, args...)
 }
 
 func Info(format string, args ...interface{}) {
-	if enableInfo {
+	if logLevel >= InfoLevel {
 		infoLogger.Print(fmt.Sprintf(format, args...))
 	}
 }
 
 func Warn(format string, args ...interface{}) {
-	warnLogger.Print(fmt.Sprintf(format, args...))
+	if logLevel >= WarnLevel {
+		warnLogger.Print(fmt.Sprintf(format, args...))
+	}
 }
 
 func Error(format string, args ...interface{}) {
@@ -68,7 +144,9 @@ func Error(format string, args ...interface{}) {
 }
 
 func Debug(format string, args ...interface{}) {
-	debugLogger.Print(fmt.Sprintf(format, args...))
+	if logLevel >= DebugLevel {
+		debugLogger.Print(fmt.Sprintf(format, args...))
+	}
 }
 
 func Trace(subsystem string, format string, args ...interface{}) {
@@ -79,7 +157,12 @@ func Trace(subsystem string, format string, args ...interface{}) {
 			_, exists = traceSubsystems["all"]
 		}
 		mutraceSubsystems.Unlock()
-		if exists {
+		if !exists {
+			return
+		}
+		if logFormat == JSONFormat {
+			traceLogger.Print(fmt.Sprintf(format, args...), "component", subsystem)
+		} else {
 			traceLogger.Print(fmt.Sprintf(subsystem+": "+format, args...))
 		}
 	}
@@ -92,13 +175,23 @@ func Profile(format string, args ...interface{}) {
 }
 
 func EnableInfo() {
-	enableInfo = true
+	if logLevel < InfoLevel {
+		logLevel = InfoLevel
+	}
 }
+
+// EnableTrace enables the traces of the comma-separated subsystems in
+// traces, or of all of them if it lists "all".
 func EnableTrace(traces string) {
+	mutraceSubsystems.Lock()
+	defer mutraceSubsystems.Unlock()
+
 	enableTracing = true
 	traceSubsystems = make(map[string]bool)
 	for _, subsystem := range strings.Split(traces, ",") {
-		traceSubsystems[subsystem] = true
+		if subsystem = strings.TrimSpace(subsystem); subsystem != "" {
+			traceSubsystems[subsystem] = true
+		}
 	}
 }
 
@@ -0,0 +1,135 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// capture redirects the loggers to a buffer until the test ends and
+// restores the default settings.
+func capture(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	for _, logger := range loggers() {
+		logger.SetOutput(&buf)
+	}
+	t.Cleanup(func() {
+		for _, logger := range loggers() {
+			logger.SetOutput(os.Stdout)
+		}
+		warnLogger.SetOutput(os.Stderr)
+		stderrLogger.SetOutput(os.Stderr)
+		SetFormat(TextFormat)
+		SetLevel(WarnLevel)
+		enableTracing = false
+	})
+	return &buf
+}
+
+func TestLevels(t *testing.T) {
+	buf := capture(t)
+
+	for _, name := range []string{"error", "warn", "info", "debug"} {
+		level, err := ParseLevel(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		SetLevel(level)
+		buf.Reset()
+		Error("error message")
+		Warn("warn message")
+		Info("info message")
+		Debug("debug message")
+
+		for _, message := range []string{"error", "warn", "info", "debug"} {
+			expected, _ := ParseLevel(message)
+			if logged := strings.Contains(buf.String(), message+" message"); logged != (expected <= level) {
+				t.Errorf("level %s: %s message logged: %v", name, message, logged)
+			}
+		}
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestFormats(t *testing.T) {
+	buf := capture(t)
+	SetLevel(InfoLevel)
+	EnableTrace("vfs")
+
+	Info("hello %s", "world")
+	Trace("vfs", "Stat(%s): %s", "/etc", "1ms")
+	if expected := "info: hello world\ntrace: vfs: Stat(/etc): 1ms\n"; buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+
+	format, err := ParseFormat("json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetFormat(format)
+	buf.Reset()
+	Info("hello %s", "world")
+	Trace("vfs", "Stat(%s): %s", "/etc", "1ms")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	expected := []map[string]string{
+		{"prefix": "info", "msg": "hello world"},
+		{"prefix": "trace", "msg": "Stat(/etc): 1ms", "component": "vfs"},
+	}
+	for i, line := range lines {
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, fields["time"]); err != nil {
+			t.Errorf("%q: bad timestamp: %v", line, err)
+		}
+		for key, value := range expected[i] {
+			if fields[key] != value {
+				t.Errorf("%q: expected %s to be %q, got %q", line, key, value, fields[key])
+			}
+		}
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestTrace(t *testing.T) {
+	buf := capture(t)
+
+	trace := func() string {
+		buf.Reset()
+		Trace("vfs", "vfs event")
+		Trace("header", "header event")
+		Trace("repository", "repository event")
+		return buf.String()
+	}
+
+	if output := trace(); output != "" {
+		t.Fatalf("expected no trace before enabling them, got %q", output)
+	}
+
+	EnableTrace("vfs, repository")
+	output := trace()
+	for component, enabled := range map[string]bool{"vfs": true, "header": false, "repository": true} {
+		if logged := strings.Contains(output, component+": "+component+" event"); logged != enabled {
+			t.Errorf("%s: expected traced to be %v, got %q", component, enabled, output)
+		}
+	}
+
+	EnableTrace("all")
+	if output := trace(); strings.Count(output, "\n") != 3 {
+		t.Errorf("expected every component to be traced, got %q", output)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package lru implements the least recently used eviction shared by the
+// caches of the repository.
+package lru
+
+import (
+	"container/list"
+)
+
+// Cache maps keys to values up to a maximum size, dropping the least
+// recently used entries to make room for new ones.  The size of an entry
+// is given by the sizeOf function passed to New, or is 1 if it is nil so
+// that the maximum size is a number of entries.  A Cache is not safe for
+// concurrent use, callers hold their own lock.
+type Cache[K comparable, V any] struct {
+	maxSize uint64
+	size    uint64
+	sizeOf  func(V) uint64
+	onEvict func(K, V)
+	entries map[K]*list.Element
+	lru     *list.List // most recently used first
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+	size  uint64
+}
+
+// New returns a cache of at most maxSize.  onEvict, if not nil, is called
+// for every entry leaving the cache other than by being replaced by Put.
+func New[K comparable, V any](maxSize uint64, sizeOf func(V) uint64, onEvict func(K, V)) *Cache[K, V] {
+	return &Cache[K, V]{
+		maxSize: maxSize,
+		sizeOf:  sizeOf,
+		onEvict: onEvict,
+		entries: make(map[K]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the value cached for key and marks it as the most recently
+// used.
+func (cache *Cache[K, V]) Get(key K) (V, bool) {
+	element, ok := cache.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	cache.lru.MoveToFront(element)
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Put caches value for key, replacing the value cached before if any,
+// and evicts the least recently used entries until it fits.  A value
+// larger than the cache is not kept and Put returns false.
+func (cache *Cache[K, V]) Put(key K, value V) bool {
+	size := uint64(1)
+	if cache.sizeOf != nil {
+		size = cache.sizeOf(value)
+	}
+	if size > cache.maxSize {
+		return false
+	}
+
+	if element, ok := cache.entries[key]; ok {
+		cache.lru.Remove(element)
+		delete(cache.entries, key)
+		cache.size -= element.Value.(*entry[K, V]).size
+	}
+	for cache.size+size > cache.maxSize {
+		cache.remove(cache.lru.Back())
+	}
+	cache.entries[key] = cache.lru.PushFront(&entry[K, V]{key: key, value: value, size: size})
+	cache.size += size
+	return true
+}
+
+// Remove drops the entry cached for key, if any.
+func (cache *Cache[K, V]) Remove(key K) {
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+}
+
+// RemoveFunc drops the entries for which fn returns true.
+func (cache *Cache[K, V]) RemoveFunc(fn func(K, V) bool) {
+	for element := cache.lru.Front(); element != nil; {
+		next := element.Next()
+		if entry := element.Value.(*entry[K, V]); fn(entry.key, entry.value) {
+			cache.remove(element)
+		}
+		element = next
+	}
+}
+
+// Len returns the number of cached entries.
+func (cache *Cache[K, V]) Len() int {
+	return cache.lru.Len()
+}
+
+// MaxSize returns the size the cache holds at most.
+func (cache *Cache[K, V]) MaxSize() uint64 {
+	return cache.maxSize
+}
+
+// Size returns the total size of the cached entries.
+func (cache *Cache[K, V]) Size() uint64 {
+	return cache.size
+}
+
+func (cache *Cache[K, V]) remove(element *list.Element) {
+	entry := cache.lru.Remove(element).(*entry[K, V])
+	delete(cache.entries, entry.key)
+	cache.size -= entry.size
+	if cache.onEvict != nil {
+		cache.onEvict(entry.key, entry.value)
+	}
+}
@@ -0,0 +1,74 @@
+package lru
+
+import (
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	var evicted []string
+	cache := New(2, nil, func(key string, _ int) {
+		evicted = append(evicted, key)
+	})
+
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	if value, ok := cache.Get("a"); !ok || value != 1 {
+		t.Fatalf("expected a hit, got %d, %v", value, ok)
+	}
+
+	// evicts b, a was read since it was cached
+	cache.Put("c", 3)
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("the least recently used entry was kept")
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("expected b to be evicted, got %v", evicted)
+	}
+
+	// replacing an entry doesn't evict it
+	cache.Put("a", 4)
+	if value, ok := cache.Get("a"); !ok || value != 4 {
+		t.Fatalf("expected the new value, got %d, %v", value, ok)
+	}
+	if len(evicted) != 1 || cache.Len() != 2 {
+		t.Fatalf("unexpected evictions %v with %d entries", evicted, cache.Len())
+	}
+
+	cache.Remove("c")
+	if _, ok := cache.Get("c"); ok || cache.Len() != 1 {
+		t.Fatal("a removed entry was kept")
+	}
+	if len(evicted) != 2 || evicted[1] != "c" {
+		t.Fatalf("expected c to be evicted, got %v", evicted)
+	}
+}
+
+func TestCacheSize(t *testing.T) {
+	cache := New[string](10, func(value []byte) uint64 {
+		return uint64(len(value))
+	}, nil)
+
+	cache.Put("a", []byte("aaaa"))
+	cache.Put("b", []byte("bbbb"))
+	cache.Put("c", []byte("cccc"))
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("the least recently used entry was kept")
+	}
+	if cache.Size() != 8 || cache.Len() != 2 {
+		t.Fatalf("unexpected size %d with %d entries", cache.Size(), cache.Len())
+	}
+
+	if cache.Put("d", []byte("ddddddddddd")) {
+		t.Fatal("an entry larger than the cache was kept")
+	}
+	if cache.Size() != 8 {
+		t.Fatalf("entries were evicted for an entry larger than the cache")
+	}
+
+	cache.RemoveFunc(func(key string, _ []byte) bool {
+		return key == "b"
+	})
+	if _, ok := cache.Get("b"); ok || cache.Size() != 4 {
+		t.Fatalf("unexpected size %d after removal", cache.Size())
+	}
+}
@@ -0,0 +1,16 @@
+//go:build darwin || freebsd || netbsd
+
+package objects
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func birthTime(stat fs.FileInfo) time.Time {
+	if st, ok := stat.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Birthtimespec.Unix())
+	}
+	return time.Time{}
+}
@@ -0,0 +1,27 @@
+//go:build darwin || freebsd || netbsd
+
+package objects
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileInfoFromStatBirthTime(t *testing.T) {
+	before := time.Now().Add(-time.Second)
+	pathname := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(pathname, []byte("born"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	birthTime := FileInfoFromStat(info).BirthTime()
+	if birthTime.Before(before) || birthTime.After(time.Now()) {
+		t.Fatalf("unexpected birth time %v", birthTime)
+	}
+}
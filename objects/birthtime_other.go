@@ -0,0 +1,14 @@
+//go:build !darwin && !freebsd && !netbsd
+
+package objects
+
+import (
+	"io/fs"
+	"time"
+)
+
+// birthTime isn't part of struct stat on other platforms, on Linux it is
+// only available through statx(2), which needs the pathname.
+func birthTime(stat fs.FileInfo) time.Time {
+	return time.Time{}
+}
@@ -13,6 +13,12 @@ import (
 	"github.com/dustin/go-humanize"
 )
 
+// Extent is a range of bytes within a file.
+type Extent struct {
+	Offset int64 `json:"Offset" msgpack:"offset"`
+	Length int64 `json:"Length" msgpack:"length"`
+}
+
 type FileInfo struct {
 	Lname      string      `json:"Name" msgpack:"name"`
 	Lsize      int64       `json:"Size" msgpack:"size"`
@@ -25,6 +31,8 @@ type FileInfo struct {
 	Lnlink     uint16      `json:"Nlink" msgpack:"nlink"`
 	Lusername  string      `json:"Username" msgpack:"username"`
 	Lgroupname string      `json:"Groupname" msgpack:"groupname"`
+	LbirthTime time.Time   `json:"BirthTime" msgpack:"birthTime,omitempty"`
+	Lholes     []Extent    `json:"Holes,omitempty" msgpack:"holes,omitempty"`
 }
 
 func (f FileInfo) Name() string {
@@ -79,6 +87,18 @@ func (f FileInfo) Groupname() string {
 	return f.Lgroupname
 }
 
+// BirthTime returns the creation time of the file, or the zero time when
+// the platform or the importer doesn't provide it.
+func (f FileInfo) BirthTime() time.Time {
+	return f.LbirthTime
+}
+
+// Holes returns the ranges of a sparse file that had no storage allocated
+// at backup time, in increasing order.
+func (f FileInfo) Holes() []Extent {
+	return f.Lholes
+}
+
 func FileInfoFromStat(stat fs.FileInfo) FileInfo {
 	Ldev := uint64(0)
 	Lino := uint64(0)
@@ -95,15 +115,16 @@ func FileInfoFromStat(stat fs.FileInfo) FileInfo {
 	}
 
 	return FileInfo{
-		Lname:    stat.Name(),
-		Lsize:    stat.Size(),
-		Lmode:    stat.Mode(),
-		LmodTime: stat.ModTime(),
-		Ldev:     Ldev,
-		Lino:     Lino,
-		Luid:     Luid,
-		Lgid:     Lgid,
-		Lnlink:   Lnlink,
+		Lname:      stat.Name(),
+		Lsize:      stat.Size(),
+		Lmode:      stat.Mode(),
+		LmodTime:   stat.ModTime(),
+		Ldev:       Ldev,
+		Lino:       Lino,
+		Luid:       Luid,
+		Lgid:       Lgid,
+		Lnlink:     Lnlink,
+		LbirthTime: birthTime(stat),
 	}
 }
 
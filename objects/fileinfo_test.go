@@ -0,0 +1,37 @@
+package objects
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestFileInfoBirthTime(t *testing.T) {
+	fileinfo := NewFileInfo("file", 42, 0644, time.Unix(1700000000, 0), 1, 2, 3, 4, 1)
+	if !fileinfo.BirthTime().IsZero() {
+		t.Fatalf("expected an unknown birth time, got %v", fileinfo.BirthTime())
+	}
+
+	withoutBirthTime, err := msgpack.Marshal(fileinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(withoutBirthTime, []byte("birthTime")) {
+		t.Fatal("an unknown birth time should not be serialized")
+	}
+
+	fileinfo.LbirthTime = time.Unix(1600000000, 123)
+	serialized, err := msgpack.Marshal(fileinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded FileInfo
+	if err := msgpack.Unmarshal(serialized, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.BirthTime().Equal(fileinfo.BirthTime()) {
+		t.Fatalf("expected birth time %v, got %v", fileinfo.BirthTime(), decoded.BirthTime())
+	}
+}
@@ -1,6 +1,7 @@
 package objects
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
@@ -13,6 +14,22 @@ func (m Checksum) MarshalJSON() ([]byte, error) {
 	return json.Marshal(fmt.Sprintf("%0x", m[:]))
 }
 
+func (m *Checksum) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != len(m) {
+		return fmt.Errorf("invalid checksum length: %d", len(decoded))
+	}
+	copy(m[:], decoded)
+	return nil
+}
+
 type CustomMetadata struct {
 	Key   string `msgpack:"key"`
 	Value []byte `msgpack:"value"`
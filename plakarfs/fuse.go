@@ -1,9 +1,13 @@
+//go:build linux || darwin
+// +build linux darwin
+
 package plakarfs
 
 import (
 	"context"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 
@@ -359,24 +363,33 @@ func (fs *plakarFS) ReadFile(
 		return fuse.ENOENT
 	}
 
-	rd, err := snap.NewReader(inode.path[37:])
-	if err != nil {
+	fileEntry, isFile := info.(*vfs.FileEntry)
+	if !isFile {
 		return fuse.EIO
 	}
 
-	if op.Offset > info.(*vfs.FileEntry).Stat().Size() {
+	if op.Offset >= fileEntry.Stat().Size() {
 		return nil
 	}
 
-	_, err = rd.Seek(op.Offset, os.SEEK_SET)
+	rd, err := snap.NewReader(inode.path[37:])
 	if err != nil {
-		return err
+		return fuse.EIO
 	}
+	defer rd.Close()
 
-	buf := make([]byte, 16384)
-	rd.Read(buf)
-	b := copy(op.Dst, buf)
-	op.BytesRead += b
+	_, err = rd.Seek(op.Offset, io.SeekStart)
+	if err != nil {
+		return fuse.EIO
+	}
+
+	// the kernel expects the buffer to be filled unless EOF is reached,
+	// a short read would be interpreted as end of file.
+	n, err := io.ReadFull(rd, op.Dst)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fuse.EIO
+	}
+	op.BytesRead += n
 
 	return nil
 
@@ -525,13 +538,14 @@ func (fs *plakarFS) ReadDir(
 			return fuse.EIO
 		}
 
-		children, err := filesystem.Children(lookupPath)
+		children, err := filesystem.ChildrenInfo(lookupPath)
 		if err != nil {
 			return fuse.EIO
 		}
 
 		i := 0
-		for child := range children {
+		for _, childinfo := range children {
+			child := childinfo.Name()
 			var inodeLookupPath string
 			if inode.parentID == fuseops.RootInodeID {
 				inodeLookupPath = "/" + child
@@ -539,13 +553,8 @@ func (fs *plakarFS) ReadDir(
 				inodeLookupPath = lookupPath + "/" + child
 			}
 
-			stat, err := filesystem.Stat(inodeLookupPath)
-			if err != nil {
-				return fuse.EIO
-			}
-
 			dtype := fuseutil.DT_Directory
-			if stat.(os.FileInfo).Mode().IsRegular() {
+			if childinfo.Mode().IsRegular() {
 				dtype = fuseutil.DT_Char
 			}
 
@@ -1,6 +1,7 @@
 package profiler
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -52,16 +53,52 @@ func RecordEvent(event string, duration time.Duration) {
 	profilerSingleton.eventCounts[event] += 1
 }
 
-func Display() {
+// Stats aggregates the durations recorded for an event.
+type Stats struct {
+	Count uint64
+	Total time.Duration
+	Min   time.Duration
+	Max   time.Duration
+	Avg   time.Duration
+}
+
+// Dump returns the aggregated durations recorded so far, per event.
+func Dump() map[string]Stats {
 	profilerSingleton.muProfiler.Lock()
 	defer profilerSingleton.muProfiler.Unlock()
 
+	ret := make(map[string]Stats, len(profilerSingleton.events))
 	for event := range profilerSingleton.events {
 		count := profilerSingleton.eventCounts[event]
-		duration := profilerSingleton.eventDurations[event]
-		durationMin := profilerSingleton.eventDurationsMin[event]
-		durationMax := profilerSingleton.eventDurationsMax[event]
-		durationAvg := time.Duration(uint64(profilerSingleton.eventDurations[event]) / profilerSingleton.eventCounts[event])
-		logger.Profile("%s: calls=%d, min=%s, avg=%s, max=%s, total=%s", event, count, durationMin, durationAvg, durationMax, duration)
+		ret[event] = Stats{
+			Count: count,
+			Total: profilerSingleton.eventDurations[event],
+			Min:   profilerSingleton.eventDurationsMin[event],
+			Max:   profilerSingleton.eventDurationsMax[event],
+			Avg:   time.Duration(uint64(profilerSingleton.eventDurations[event]) / count),
+		}
+	}
+	return ret
+}
+
+// Display logs the aggregated durations, the events taking the most time
+// overall first.
+func Display() {
+	stats := Dump()
+
+	events := make([]string, 0, len(stats))
+	for event := range stats {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if stats[events[i]].Total != stats[events[j]].Total {
+			return stats[events[i]].Total > stats[events[j]].Total
+		}
+		return events[i] < events[j]
+	})
+
+	for _, event := range events {
+		st := stats[event]
+		logger.Profile("%s: calls=%d, min=%s, avg=%s, max=%s, total=%s", event, st.Count, st.Min, st.Avg, st.Max, st.Total)
 	}
 }
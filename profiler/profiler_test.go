@@ -128,3 +128,39 @@ func TestRecordEvent(t *testing.T) {
 		t.Errorf("Expected event2 max duration to be 300ms, got %v", maxDuration2)
 	}
 }
+
+func TestDump(t *testing.T) {
+	resetProfiler()
+
+	for _, duration := range []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond} {
+		RecordEvent("event1", duration)
+	}
+	RecordEvent("event2", 5*time.Millisecond)
+
+	stats := Dump()
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(stats))
+	}
+
+	expected := Stats{
+		Count: 3,
+		Total: 60 * time.Millisecond,
+		Min:   10 * time.Millisecond,
+		Max:   30 * time.Millisecond,
+		Avg:   20 * time.Millisecond,
+	}
+	if stats["event1"] != expected {
+		t.Errorf("Expected event1 stats to be %+v, got %+v", expected, stats["event1"])
+	}
+
+	expected = Stats{Count: 1, Total: 5 * time.Millisecond, Min: 5 * time.Millisecond, Max: 5 * time.Millisecond, Avg: 5 * time.Millisecond}
+	if stats["event2"] != expected {
+		t.Errorf("Expected event2 stats to be %+v, got %+v", expected, stats["event2"])
+	}
+
+	// the dump is a copy
+	RecordEvent("event2", 5*time.Millisecond)
+	if stats["event2"].Count != 1 {
+		t.Errorf("Expected the dump to be unaffected by new events")
+	}
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/PlakarKorp/plakar/lru"
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+// filesystemCacheSize is the number of filesystems kept by a repository,
+// so that opening the same snapshot again within a process doesn't
+// reload its root.
+const filesystemCacheSize = 16
+
+// filesystemCache keeps the filesystems of the snapshots most recently
+// opened.  They are built by the vfs package, which can't be imported
+// here, hence values of type any.
+type filesystemCache struct {
+	mu  sync.Mutex
+	lru *lru.Cache[objects.Checksum, any]
+}
+
+// GetFilesystem returns the filesystem cached by PutFilesystem for the
+// root directory root.
+func (r *Repository) GetFilesystem(root objects.Checksum) (any, bool) {
+	r.filesystems.mu.Lock()
+	defer r.filesystems.mu.Unlock()
+
+	if r.filesystems.lru == nil {
+		return nil, false
+	}
+	return r.filesystems.lru.Get(root)
+}
+
+// PutFilesystem caches the filesystem whose root directory is root.  It
+// is shared by all callers of GetFilesystem and must not be modified.
+func (r *Repository) PutFilesystem(root objects.Checksum, filesystem any) {
+	r.filesystems.mu.Lock()
+	defer r.filesystems.mu.Unlock()
+
+	if r.filesystems.lru == nil {
+		r.filesystems.lru = lru.New[objects.Checksum, any](filesystemCacheSize, nil, nil)
+	}
+	r.filesystems.lru.Put(root, filesystem)
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/encryption"
+)
+
+func TestKeypairWriteOnly(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: private})
+
+	writer := &Repository{}
+	writer.configuration.Encryption = encryption.DefaultConfiguration()
+	writer.configuration.Encryption.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	if err := writer.setupKeypair(); err != nil {
+		t.Fatal(err)
+	}
+	if !writer.WriteOnly() {
+		t.Fatal("expected a repository opened without private key to be write-only")
+	}
+
+	data := []byte("backed up without the private key")
+	encoded, err := writer.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Decode(encoded); !errors.Is(err, encryption.ErrNoPrivateKey) {
+		t.Fatalf("expected ErrNoPrivateKey, got %v", err)
+	}
+
+	reader := &Repository{configuration: writer.configuration, secret: privatePEM}
+	if err := reader.setupKeypair(); err != nil {
+		t.Fatal(err)
+	}
+	if reader.WriteOnly() {
+		t.Fatal("expected a repository opened with the private key to be readable")
+	}
+	decoded, err := reader.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Fatalf("unexpected decoded data %q", decoded)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPrivate, err := x509.MarshalECPrivateKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatch := &Repository{configuration: writer.configuration,
+		secret: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: otherPrivate})}
+	if err := mismatch.setupKeypair(); err == nil {
+		t.Fatal("expected a private key not matching the public key to be rejected")
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/lru"
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+// PackfileCache keeps whole packfiles in memory for the duration of an
+// operation reading many blobs, such as a restore, so that the chunks of
+// small files stored together are served from a single read rather than
+// a request each.  A packfile is fetched whole from the second blob read
+// in it, the first one is a ranged read like any other.  At most max
+// packfiles are kept, the least recently used one is dropped to make
+// room for the next.
+type PackfileCache struct {
+	repo *Repository
+	mu   sync.Mutex
+	lru  *lru.Cache[objects.Checksum, *packfileEntry]
+}
+
+type packfileEntry struct {
+	reads int
+
+	// closed once data and err are set, nil until a read loads the
+	// packfile
+	loaded chan struct{}
+	data   []byte
+	err    error
+}
+
+func (r *Repository) NewPackfileCache(max int) *PackfileCache {
+	return &PackfileCache{
+		repo: r,
+		lru:  lru.New[objects.Checksum, *packfileEntry](uint64(max), nil, nil),
+	}
+}
+
+// GetChunks is Repository.GetChunks reading through the cache.
+func (cache *PackfileCache) GetChunks(checksums []objects.Checksum) (map[objects.Checksum][]byte, error) {
+	return cache.repo.getChunks(cache, checksums)
+}
+
+// get returns the raw blob at offset in the packfile, or false if it is
+// to be read from the store.
+func (cache *PackfileCache) get(checksum objects.Checksum, offset uint32, length uint32) ([]byte, bool, error) {
+	cache.mu.Lock()
+	entry, ok := cache.lru.Get(checksum)
+	if !ok {
+		entry = &packfileEntry{}
+		cache.lru.Put(checksum, entry)
+	}
+	entry.reads++
+	load := false
+	if entry.loaded == nil && entry.reads > 1 {
+		entry.loaded = make(chan struct{})
+		load = true
+	}
+	loaded := entry.loaded
+	cache.mu.Unlock()
+
+	if loaded == nil {
+		return nil, false, nil
+	}
+	if load {
+		entry.data, entry.err = cache.repo.readPackfile(checksum)
+		close(loaded)
+	}
+	<-loaded
+
+	if entry.err != nil {
+		return nil, false, entry.err
+	}
+	if uint64(offset)+uint64(length) > uint64(len(entry.data)) {
+		return nil, false, fmt.Errorf("packfile %x: blob at %d is out of bounds", checksum, offset)
+	}
+	return entry.data[offset : offset+length], true, nil
+}
+
+func (r *Repository) readPackfile(checksum objects.Checksum) ([]byte, error) {
+	rd, _, err := r.store.GetPackfile(checksum)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := rd.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return io.ReadAll(rd)
+}
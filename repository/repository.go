@@ -2,28 +2,40 @@ package repository
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
 	"path/filepath"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/PlakarKorp/plakar/chunking"
 	"github.com/PlakarKorp/plakar/compression"
 	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/encryption"
 	"github.com/PlakarKorp/plakar/hashing"
 	"github.com/PlakarKorp/plakar/logger"
 	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
 	"github.com/PlakarKorp/plakar/profiler"
 	"github.com/PlakarKorp/plakar/repository/cache"
 	"github.com/PlakarKorp/plakar/repository/state"
 	"github.com/PlakarKorp/plakar/storage"
 	chunkers "github.com/PlakarLabs/go-cdc-chunkers"
-	_ "github.com/PlakarLabs/go-cdc-chunkers/chunkers/fastcdc"
-	_ "github.com/PlakarLabs/go-cdc-chunkers/chunkers/ultracdc"
+
+	_ "github.com/PlakarKorp/plakar/chunking/buzhash"
 )
 
+// ErrConcurrentUpdate is returned when the repository was modified by
+// another process since it was opened.
+var ErrConcurrentUpdate = errors.New("repository was modified concurrently")
+
+// chunkFetchConcurrency bounds the number of in-flight requests issued by
+// GetChunks, fetching is network-bound so it is not tied to the CPU count.
+const chunkFetchConcurrency = 16
+
 type Repository struct {
 	store         *storage.Store
 	cache         *cache.Cache
@@ -31,6 +43,13 @@ type Repository struct {
 	configuration storage.Configuration
 
 	secret []byte
+
+	// repositories created with a public key encrypt through sealer and
+	// can only decrypt when opened with the matching private key.
+	sealer *encryption.Sealer
+	opener *encryption.Opener
+
+	filesystems filesystemCache
 }
 
 func New(store *storage.Store, secret []byte) (*Repository, error) {
@@ -52,12 +71,51 @@ func New(store *storage.Store, secret []byte) (*Repository, error) {
 		configuration: store.Configuration(),
 		secret:        secret,
 	}
+	if err := r.setupKeypair(); err != nil {
+		return nil, err
+	}
 	if err := r.rebuildState(); err != nil {
 		return nil, err
 	}
 	return r, nil
 }
 
+// setupKeypair prepares the encryption of repositories created with a
+// public key, in which case the secret is the PEM-encoded private key.
+func (r *Repository) setupKeypair() error {
+	if r.configuration.Encryption == nil || r.configuration.Encryption.PublicKey == "" {
+		return nil
+	}
+
+	publicKey, err := encryption.ParsePublicKey([]byte(r.configuration.Encryption.PublicKey))
+	if err != nil {
+		return err
+	}
+	r.sealer, err = encryption.NewSealer(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if r.secret != nil {
+		privateKey, err := encryption.ParsePrivateKey(r.secret)
+		if err != nil {
+			return err
+		}
+		if !privateKey.PublicKey().Equal(publicKey) {
+			return fmt.Errorf("private key does not match the repository public key")
+		}
+		r.opener = encryption.NewOpener(privateKey)
+		r.secret = nil
+	}
+	return nil
+}
+
+// WriteOnly returns true if the repository can store new data but lacks
+// the private key needed to read it back.
+func (r *Repository) WriteOnly() bool {
+	return r.sealer != nil && r.opener == nil
+}
+
 func (r *Repository) rebuildState() error {
 	t0 := time.Now()
 	defer func() {
@@ -105,6 +163,12 @@ func (r *Repository) rebuildState() error {
 		for _, stateID := range missingStates {
 			remoteState, _, err := r.GetState(stateID)
 			if err != nil {
+				// states written by others can't be read back without
+				// the private key, deduplication is only done against
+				// the ones in the local cache.
+				if r.WriteOnly() && errors.Is(err, encryption.ErrNoPrivateKey) {
+					continue
+				}
 				return err
 			}
 			if r.cache != nil {
@@ -161,6 +225,15 @@ func (r *Repository) Close() error {
 	return nil
 }
 
+// authenticatedData binds encrypted data to the repository, so that it
+// can't be swapped for data encrypted with the same key elsewhere.
+func (r *Repository) authenticatedData() []byte {
+	if r.configuration.Encryption == nil || !r.configuration.Encryption.Authenticated {
+		return nil
+	}
+	return r.configuration.RepositoryID[:]
+}
+
 func (r *Repository) Decode(buffer []byte) ([]byte, error) {
 	t0 := time.Now()
 	defer func() {
@@ -168,8 +241,20 @@ func (r *Repository) Decode(buffer []byte) ([]byte, error) {
 		logger.Trace("repository", "Decode(%d bytes): %s", len(buffer), time.Since(t0))
 	}()
 
-	if r.secret != nil {
-		tmp, err := encryption.DecryptStream(r.secret, bytes.NewReader(buffer))
+	if r.sealer != nil {
+		if r.opener == nil {
+			return nil, encryption.ErrNoPrivateKey
+		}
+		tmp, err := r.opener.DecryptStream(r.authenticatedData(), bytes.NewReader(buffer))
+		if err != nil {
+			return nil, err
+		}
+		buffer, err = io.ReadAll(tmp)
+		if err != nil {
+			return nil, err
+		}
+	} else if r.secret != nil {
+		tmp, err := encryption.DecryptStream(r.secret, r.authenticatedData(), bytes.NewReader(buffer))
 		if err != nil {
 			return nil, err
 		}
@@ -180,6 +265,9 @@ func (r *Repository) Decode(buffer []byte) ([]byte, error) {
 	}
 
 	if r.configuration.Compression != nil {
+		if bytes.HasPrefix(buffer, uncompressedMarker) {
+			return buffer[len(uncompressedMarker):], nil
+		}
 		tmp, err := compression.InflateStream(r.configuration.Compression.Algorithm, bytes.NewReader(buffer))
 		if err != nil {
 			return nil, err
@@ -192,14 +280,43 @@ func (r *Repository) Decode(buffer []byte) ([]byte, error) {
 	return buffer, nil
 }
 
+// uncompressedMarker prefixes the blobs stored uncompressed in a repository
+// that compresses, see EncodeUncompressed.  Compressed streams start with
+// the magic number of their algorithm and never with a NUL byte, so the
+// blobs written before the marker existed are still inflated.
+var uncompressedMarker = []byte{0x00, 'r', 'a', 'w'}
+
 func (r *Repository) Encode(buffer []byte) ([]byte, error) {
+	return r.encode(buffer, true, nil)
+}
+
+// EncodeUncompressed encodes a blob without compressing it, for data that
+// would not shrink such as the chunks of already compressed files.  Decode
+// tells these blobs apart on its own.
+func (r *Repository) EncodeUncompressed(buffer []byte) ([]byte, error) {
+	return r.encode(buffer, false, nil)
+}
+
+// EncodeChunk encodes the chunk of the given checksum, compressed or not.
+// In repositories with convergent encryption the same chunk always
+// encodes to the same blob.
+func (r *Repository) EncodeChunk(checksum objects.Checksum, buffer []byte, compress bool) ([]byte, error) {
+	if r.configuration.Encryption != nil && r.configuration.Encryption.Convergent {
+		return r.encode(buffer, compress, checksum[:])
+	}
+	return r.encode(buffer, compress, nil)
+}
+
+// encode compresses and encrypts buffer, convergently if checksum is set
+// and the repository is encrypted with a secret.
+func (r *Repository) encode(buffer []byte, compress bool, checksum []byte) ([]byte, error) {
 	t0 := time.Now()
 	defer func() {
 		profiler.RecordEvent("repository.Encode", time.Since(t0))
 		logger.Trace("repository", "Encode(%d): %s", len(buffer), time.Since(t0))
 	}()
 
-	if r.configuration.Compression != nil {
+	if r.configuration.Compression != nil && (compress || len(buffer) == 0) {
 		tmp, err := compression.DeflateStream(r.configuration.Compression.Algorithm, bytes.NewReader(buffer))
 		if err != nil {
 			return nil, err
@@ -208,10 +325,27 @@ func (r *Repository) Encode(buffer []byte) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
+	} else if r.configuration.Compression != nil {
+		buffer = append(append(make([]byte, 0, len(uncompressedMarker)+len(buffer)), uncompressedMarker...), buffer...)
 	}
 
-	if r.secret != nil {
-		tmp, err := encryption.EncryptStream(r.secret, bytes.NewReader(buffer))
+	if r.sealer != nil {
+		tmp, err := r.sealer.EncryptStream(r.authenticatedData(), bytes.NewReader(buffer))
+		if err != nil {
+			return nil, err
+		}
+		buffer, err = io.ReadAll(tmp)
+		if err != nil {
+			return nil, err
+		}
+	} else if r.secret != nil {
+		var tmp io.Reader
+		var err error
+		if checksum != nil {
+			tmp, err = encryption.EncryptStreamConvergent(r.secret, r.authenticatedData(), checksum, bytes.NewReader(buffer))
+		} else {
+			tmp, err = encryption.EncryptStream(r.secret, r.authenticatedData(), bytes.NewReader(buffer))
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -244,16 +378,7 @@ func (r *Repository) Checksum(data []byte) objects.Checksum {
 }
 
 func (r *Repository) Chunker(rd io.ReadCloser) (*chunkers.Chunker, error) {
-	chunkingAlgorithm := r.configuration.Chunking.Algorithm
-	chunkingMinSize := r.configuration.Chunking.MinSize
-	chunkingNormalSize := r.configuration.Chunking.NormalSize
-	chunkingMaxSize := r.configuration.Chunking.MaxSize
-
-	return chunkers.NewChunker(strings.ToLower(chunkingAlgorithm), rd, &chunkers.ChunkerOpts{
-		MinSize:    int(chunkingMinSize),
-		NormalSize: int(chunkingNormalSize),
-		MaxSize:    int(chunkingMaxSize),
-	})
+	return chunking.NewChunker(&r.configuration.Chunking, rd)
 }
 
 func (r *Repository) NewStateDelta() *state.State {
@@ -289,6 +414,11 @@ func (r *Repository) DeleteSnapshot(snapshotID objects.Checksum) error {
 		logger.Trace("repository", "DeleteSnapshot(%x): %s", snapshotID, time.Since(t0))
 	}()
 
+	// the deletion is a state write, which the backend can't tell apart
+	if err := r.store.CheckDelete(); err != nil {
+		return err
+	}
+
 	ret := r.state.DeleteSnapshot(snapshotID)
 	if ret != nil {
 		return ret
@@ -303,6 +433,7 @@ func (r *Repository) DeleteSnapshot(snapshotID objects.Checksum) error {
 	if _, err := r.PutState(checksum, bytes.NewBuffer(buffer), int64(len(buffer))); err != nil {
 		return err
 	}
+	r.state.Extends(checksum)
 	return nil
 }
 
@@ -334,6 +465,9 @@ func (r *Repository) GetState(checksum objects.Checksum) ([]byte, int64, error)
 	if err != nil {
 		return nil, 0, err
 	}
+	if closer, ok := rd.(io.Closer); ok {
+		defer closer.Close()
+	}
 
 	buffer, err := io.ReadAll(rd)
 	if err != nil {
@@ -411,14 +545,28 @@ func (r *Repository) GetPackfileBlob(checksum objects.Checksum, offset uint32, l
 		logger.Trace("repository", "GetPackfileBlob(%x, %d, %d): %s", checksum, offset, length, time.Since(t0))
 	}()
 
-	rd, _, err := r.store.GetPackfileBlob(checksum, offset, length)
-	if err != nil {
-		return nil, 0, err
-	}
+	return r.getPackfileBlob(nil, checksum, offset, length)
+}
 
-	data, err := io.ReadAll(rd)
-	if err != nil {
-		return nil, 0, err
+// getPackfileBlob is GetPackfileBlob reading through cache, if not nil.
+func (r *Repository) getPackfileBlob(cache *PackfileCache, checksum objects.Checksum, offset uint32, length uint32) (io.Reader, int64, error) {
+	var data []byte
+	cached := false
+	if cache != nil {
+		var err error
+		if data, cached, err = cache.get(checksum, offset, length); err != nil {
+			return nil, 0, err
+		}
+	}
+	if !cached {
+		rd, _, err := r.store.GetPackfileBlob(checksum, offset, length)
+		if err != nil {
+			return nil, 0, err
+		}
+		data, err = io.ReadAll(rd)
+		if err != nil {
+			return nil, 0, err
+		}
 	}
 
 	decoded, err := r.Decode(data)
@@ -449,6 +597,145 @@ func (r *Repository) DeletePackfile(checksum objects.Checksum) error {
 	return r.store.DeletePackfile(checksum)
 }
 
+// DeletePackfiles removes packfiles and forgets the blobs they hold. A new
+// state without them replaces all existing states before the packfiles are
+// removed, so that no blob is ever deduplicated against a deleted packfile.
+// It fails with ErrConcurrentUpdate if states were committed since the
+// repository was opened.
+func (r *Repository) DeletePackfiles(checksums []objects.Checksum) error {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("repository.DeletePackfiles", time.Since(t0))
+		logger.Trace("repository", "DeletePackfiles(%d): %s", len(checksums), time.Since(t0))
+	}()
+
+	if len(checksums) == 0 {
+		return nil
+	}
+
+	if err := r.store.CheckDelete(); err != nil {
+		return err
+	}
+	if _, err := r.checkConcurrentUpdate(); err != nil {
+		return err
+	}
+	for _, checksum := range checksums {
+		r.state.DeletePackfile(checksum)
+	}
+	if err := r.ReplaceStates(); err != nil {
+		return err
+	}
+
+	for _, checksum := range checksums {
+		if err := r.DeletePackfile(checksum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConcurrentUpdate returns the states of the repository, or fails
+// with ErrConcurrentUpdate if one was written since the aggregate state was
+// built.
+func (r *Repository) checkConcurrentUpdate() ([]objects.Checksum, error) {
+	states, err := r.GetStates()
+	if err != nil {
+		return nil, err
+	}
+	knownStates := make(map[objects.Checksum]struct{}, len(r.state.Metadata.Extends))
+	for _, stateID := range r.state.Metadata.Extends {
+		knownStates[stateID] = struct{}{}
+	}
+	for _, stateID := range states {
+		if _, known := knownStates[stateID]; !known {
+			return nil, ErrConcurrentUpdate
+		}
+	}
+	return states, nil
+}
+
+// ReplaceStates writes the aggregate state as the only state of the
+// repository and deletes the states it was built from. It is needed when
+// the aggregate state no longer matches the merge of these states, as
+// when blobs were forgotten or moved to another packfile. It fails with
+// ErrConcurrentUpdate if a state was written since the aggregate state
+// was built.
+func (r *Repository) ReplaceStates() error {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("repository.ReplaceStates", time.Since(t0))
+		logger.Trace("repository", "ReplaceStates(): %s", time.Since(t0))
+	}()
+
+	if err := r.store.CheckDelete(); err != nil {
+		return err
+	}
+	previousStates, err := r.checkConcurrentUpdate()
+	if err != nil {
+		return err
+	}
+	extends := r.state.Metadata.Extends
+	r.state.Metadata.Extends = []objects.Checksum{}
+
+	buffer, err := r.state.Serialize()
+	if err != nil {
+		r.state.Metadata.Extends = extends
+		return err
+	}
+	stateID := r.Checksum(buffer)
+	if _, err := r.PutState(stateID, bytes.NewReader(buffer), int64(len(buffer))); err != nil {
+		r.state.Metadata.Extends = extends
+		return err
+	}
+	r.state.Extends(stateID)
+	r.state.ResetDirty()
+
+	for _, previousID := range previousStates {
+		if previousID == stateID {
+			continue
+		}
+		if err := r.DeleteState(previousID); err != nil {
+			return err
+		}
+		if r.cache != nil {
+			r.cache.Delete(previousID)
+		}
+	}
+	return nil
+}
+
+// GetPackfileForBlob returns the packfile holding the blob of the given
+// packfile.TYPE_* type, as recorded in the state.
+func (r *Repository) GetPackfileForBlob(blobType uint8, checksum objects.Checksum) (objects.Checksum, bool) {
+	var packfileChecksum objects.Checksum
+	var exists bool
+
+	switch blobType {
+	case packfile.TYPE_SNAPSHOT:
+		packfileChecksum, _, _, exists = r.state.GetSubpartForSnapshot(checksum)
+	case packfile.TYPE_CHUNK:
+		packfileChecksum, exists = r.state.GetPackfileForChunk(checksum)
+	case packfile.TYPE_OBJECT:
+		packfileChecksum, exists = r.state.GetPackfileForObject(checksum)
+	case packfile.TYPE_FILE:
+		packfileChecksum, exists = r.state.GetPackfileForFile(checksum)
+	case packfile.TYPE_DIRECTORY:
+		packfileChecksum, exists = r.state.GetPackfileForDirectory(checksum)
+	case packfile.TYPE_DATA:
+		packfileChecksum, exists = r.state.GetPackfileForData(checksum)
+	case packfile.TYPE_SIGNATURE:
+		packfileChecksum, exists = r.state.GetPackfileForSignature(checksum)
+	}
+	return packfileChecksum, exists
+}
+
+// GetChunkLength returns the length of the chunk as stored in its
+// packfile, that is once compressed and encrypted.
+func (r *Repository) GetChunkLength(checksum objects.Checksum) (uint32, bool) {
+	_, _, length, exists := r.state.GetSubpartForChunk(checksum)
+	return length, exists
+}
+
 func (r *Repository) GetChunk(checksum objects.Checksum) (io.Reader, uint64, error) {
 	t0 := time.Now()
 	defer func() {
@@ -456,19 +743,120 @@ func (r *Repository) GetChunk(checksum objects.Checksum) (io.Reader, uint64, err
 		logger.Trace("repository", "GetChunk(%x): %s", checksum, time.Since(t0))
 	}()
 
+	return r.getChunk(nil, checksum)
+}
+
+func (r *Repository) getChunk(cache *PackfileCache, checksum objects.Checksum) (io.Reader, uint64, error) {
 	packfileChecksum, offset, length, exists := r.state.GetSubpartForChunk(checksum)
 	if !exists {
 		return nil, 0, fmt.Errorf("packfile not found")
 	}
 
-	rd, len, err := r.GetPackfileBlob(packfileChecksum, offset, length)
+	rd, len, err := r.getPackfileBlob(cache, packfileChecksum, offset, length)
 	if err != nil {
 		return nil, 0, err
 	}
 
+	if r.configuration.VerifyOnRead {
+		data, err := io.ReadAll(rd)
+		if err != nil {
+			return nil, 0, err
+		}
+		if r.Checksum(data) != checksum {
+			return nil, 0, fmt.Errorf("chunk %x: %w", checksum, storage.ErrChecksumMismatch)
+		}
+		rd = bytes.NewReader(data)
+	}
+
 	return rd, uint64(len), nil
 }
 
+// ChunkErrors maps the checksum of each chunk that GetChunks failed to
+// fetch to the error that was returned for it.
+type ChunkErrors map[objects.Checksum]error
+
+func (errs ChunkErrors) Error() string {
+	checksums := make([]objects.Checksum, 0, len(errs))
+	for checksum := range errs {
+		checksums = append(checksums, checksum)
+	}
+	sort.Slice(checksums, func(i, j int) bool {
+		return bytes.Compare(checksums[i][:], checksums[j][:]) < 0
+	})
+
+	if len(checksums) == 1 {
+		return fmt.Sprintf("chunk %x: %s", checksums[0], errs[checksums[0]])
+	}
+	return fmt.Sprintf("%d chunks failed to fetch, first %x: %s", len(checksums), checksums[0], errs[checksums[0]])
+}
+
+// GetChunks fetches a batch of chunks using a bounded pool of workers, which
+// hides most of the per-request latency of remote stores. Chunks that were
+// fetched are always returned, even when some others failed, in which case
+// the error is a ChunkErrors describing each failure.
+func (r *Repository) GetChunks(checksums []objects.Checksum) (map[objects.Checksum][]byte, error) {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("repository.GetChunks", time.Since(t0))
+		logger.Trace("repository", "GetChunks(%d chunks): %s", len(checksums), time.Since(t0))
+	}()
+
+	return r.getChunks(nil, checksums)
+}
+
+func (r *Repository) getChunks(cache *PackfileCache, checksums []objects.Checksum) (map[objects.Checksum][]byte, error) {
+	pending := make(map[objects.Checksum]struct{}, len(checksums))
+	for _, checksum := range checksums {
+		pending[checksum] = struct{}{}
+	}
+
+	workers := chunkFetchConcurrency
+	if len(pending) < workers {
+		workers = len(pending)
+	}
+
+	var mu sync.Mutex
+	chunks := make(map[objects.Checksum][]byte, len(pending))
+	errs := make(ChunkErrors)
+
+	queue := make(chan objects.Checksum)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for checksum := range queue {
+				data, err := r.getChunkBytes(cache, checksum)
+				mu.Lock()
+				if err != nil {
+					errs[checksum] = err
+				} else {
+					chunks[checksum] = data
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for checksum := range pending {
+		queue <- checksum
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(errs) != 0 {
+		return chunks, errs
+	}
+	return chunks, nil
+}
+
+func (r *Repository) getChunkBytes(cache *PackfileCache, checksum objects.Checksum) ([]byte, error) {
+	rd, _, err := r.getChunk(cache, checksum)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(rd)
+}
+
 func (r *Repository) GetObject(checksum objects.Checksum) (io.Reader, uint64, error) {
 	t0 := time.Now()
 	defer func() {
@@ -639,6 +1027,16 @@ func (r *Repository) DataExists(checksum objects.Checksum) bool {
 	return r.state.DataExists(checksum)
 }
 
+func (r *Repository) SignatureExists(checksum objects.Checksum) bool {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("repository.SignatureExists", time.Since(t0))
+		logger.Trace("repository", "SignatureExists(%x): %s", checksum, time.Since(t0))
+	}()
+
+	return r.state.SignatureExists(checksum)
+}
+
 func (r *Repository) ListSnapshots() <-chan objects.Checksum {
 	t0 := time.Now()
 	defer func() {
@@ -648,6 +1046,38 @@ func (r *Repository) ListSnapshots() <-chan objects.Checksum {
 	return r.state.ListSnapshots()
 }
 
+// ListPackfiles returns the packfiles known to the state, which may differ
+// from the ones in the store.
+func (r *Repository) ListPackfiles() <-chan objects.Checksum {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("repository.ListPackfiles", time.Since(t0))
+		logger.Trace("repository", "ListPackfiles(): %s", time.Since(t0))
+	}()
+	return r.state.ListPackfiles()
+}
+
+func (r *Repository) ListChunks() <-chan objects.Checksum {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("repository.ListChunks", time.Since(t0))
+		logger.Trace("repository", "ListChunks(): %s", time.Since(t0))
+	}()
+	return r.state.ListChunks()
+}
+
+// MergeState makes the locations recorded in st known to the repository,
+// without them being part of a committed state yet.
+// StateSubset returns the part of the state locating the blobs stored in
+// the given packfiles.
+func (r *Repository) StateSubset(packfiles map[objects.Checksum]struct{}) *state.State {
+	return r.state.Subset(packfiles)
+}
+
+func (r *Repository) MergeState(st *state.State) {
+	r.state.Merge(objects.Checksum{}, st)
+}
+
 func (r *Repository) SetPackfileForChunk(packfileChecksum objects.Checksum, chunkChecksum objects.Checksum, offset uint32, length uint32) {
 	t0 := time.Now()
 	defer func() {
@@ -708,6 +1138,16 @@ func (r *Repository) SetPackfileForSignature(packfileChecksum objects.Checksum,
 	r.state.SetPackfileForSignature(packfileChecksum, signatureChecksum, offset, length)
 }
 
+func (r *Repository) ForgetSnapshot(snapshotID objects.Checksum) {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("repository.ForgetSnapshot", time.Since(t0))
+		logger.Trace("repository", "ForgetSnapshot(%x): %s", snapshotID, time.Since(t0))
+	}()
+
+	r.state.ForgetSnapshot(snapshotID)
+}
+
 func (r *Repository) SetPackfileForSnapshot(packfileChecksum objects.Checksum, snapshotID objects.Checksum, offset uint32, length uint32) {
 	t0 := time.Now()
 	defer func() {
@@ -0,0 +1,402 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/compression"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/encryption"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/google/uuid"
+
+	_ "github.com/PlakarKorp/plakar/storage/backends/memory"
+)
+
+// latencyBackend serves packfile blobs from memory after a fixed delay,
+// standing in for a remote store.
+type latencyBackend struct {
+	latency   time.Duration
+	packfiles map[[32]byte][]byte
+
+	packfileReads atomic.Int64
+	blobReads     atomic.Int64
+}
+
+func (backend *latencyBackend) Create(repository string, configuration storage.Configuration) error {
+	return nil
+}
+func (backend *latencyBackend) Open(repository string) error { return nil }
+func (backend *latencyBackend) Configuration() storage.Configuration {
+	return storage.Configuration{}
+}
+
+func (backend *latencyBackend) GetStates() ([][32]byte, error) { return nil, nil }
+func (backend *latencyBackend) PutState(checksum [32]byte, rd io.Reader, size uint64) error {
+	return nil
+}
+func (backend *latencyBackend) GetState(checksum [32]byte) (io.Reader, uint64, error) {
+	return nil, 0, errors.New("not implemented")
+}
+func (backend *latencyBackend) DeleteState(checksum [32]byte) error { return nil }
+
+func (backend *latencyBackend) GetPackfiles() ([][32]byte, error) { return nil, nil }
+func (backend *latencyBackend) PutPackfile(checksum [32]byte, rd io.Reader, size uint64) error {
+	return nil
+}
+func (backend *latencyBackend) GetPackfile(checksum [32]byte) (io.Reader, uint64, error) {
+	time.Sleep(backend.latency)
+	backend.packfileReads.Add(1)
+	data, exists := backend.packfiles[checksum]
+	if !exists {
+		return nil, 0, fmt.Errorf("packfile %x not found", checksum)
+	}
+	return bytes.NewReader(data), uint64(len(data)), nil
+}
+func (backend *latencyBackend) GetPackfileBlob(checksum [32]byte, offset uint32, length uint32) (io.Reader, uint32, error) {
+	time.Sleep(backend.latency)
+	backend.blobReads.Add(1)
+	data, exists := backend.packfiles[checksum]
+	if !exists {
+		return nil, 0, fmt.Errorf("packfile %x not found", checksum)
+	}
+	return bytes.NewReader(data[offset : offset+length]), length, nil
+}
+func (backend *latencyBackend) DeletePackfile(checksum [32]byte) error { return nil }
+func (backend *latencyBackend) Close() error                           { return nil }
+
+var latencyBackendInstance = &latencyBackend{
+	latency:   time.Millisecond,
+	packfiles: make(map[[32]byte][]byte),
+}
+
+func init() {
+	storage.Register("latency", func(*context.Context) storage.Backend {
+		return latencyBackendInstance
+	})
+}
+
+// newLatencyRepository returns a repository holding nchunks chunks of
+// 1KB, all stored in a single packfile of the latency backend.
+func newLatencyRepository(t testing.TB, nchunks int) (*Repository, []objects.Checksum) {
+	store, err := storage.NewStore(context.NewContext(), "latency", "latency://")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packfileChecksum := objects.Checksum{0xff, byte(nchunks)}
+	packfile := make([]byte, 0, nchunks*1024)
+	st := state.New()
+	checksums := make([]objects.Checksum, 0, nchunks)
+	for i := 0; i < nchunks; i++ {
+		checksum := objects.Checksum{byte(i >> 8), byte(i)}
+		st.SetPackfileForChunk(packfileChecksum, checksum, uint32(len(packfile)), 1024)
+		packfile = append(packfile, bytes.Repeat([]byte{byte(i)}, 1024)...)
+		checksums = append(checksums, checksum)
+	}
+	latencyBackendInstance.packfiles[packfileChecksum] = packfile
+
+	return &Repository{store: store, state: st}, checksums
+}
+
+func TestGetChunks(t *testing.T) {
+	repo, checksums := newLatencyRepository(t, 32)
+
+	chunks, err := repo.GetChunks(checksums)
+	if err != nil {
+		t.Fatalf("GetChunks: %v", err)
+	}
+	if len(chunks) != len(checksums) {
+		t.Fatalf("expected %d chunks, got %d", len(checksums), len(chunks))
+	}
+	for i, checksum := range checksums {
+		if !bytes.Equal(chunks[checksum], bytes.Repeat([]byte{byte(i)}, 1024)) {
+			t.Errorf("chunk %d: unexpected content", i)
+		}
+	}
+}
+
+func TestGetChunksPartialFailure(t *testing.T) {
+	repo, checksums := newLatencyRepository(t, 4)
+	missing := objects.Checksum{0xde, 0xad}
+
+	chunks, err := repo.GetChunks(append(checksums, missing))
+	if err == nil {
+		t.Fatal("expected an error for the missing chunk")
+	}
+
+	var errs ChunkErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ChunkErrors, got %T", err)
+	}
+	if len(errs) != 1 || errs[missing] == nil {
+		t.Fatalf("expected a single error for %x, got %v", missing, errs)
+	}
+	if len(chunks) != len(checksums) {
+		t.Fatalf("expected %d fetched chunks, got %d", len(checksums), len(chunks))
+	}
+}
+
+func BenchmarkGetChunkSequential(b *testing.B) {
+	repo, checksums := newLatencyRepository(b, 64)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, checksum := range checksums {
+			if _, err := repo.getChunkBytes(nil, checksum); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkGetChunksParallel(b *testing.B) {
+	repo, checksums := newLatencyRepository(b, 64)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := repo.GetChunks(checksums); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGetChunkVerifyOnRead(t *testing.T) {
+	repo, _ := newLatencyRepository(t, 0)
+	repo.configuration.Hashing.Algorithm = "SHA256"
+	repo.configuration.VerifyOnRead = true
+
+	data := []byte("chunk content")
+	checksum := objects.Checksum(sha256.Sum256(data))
+	packfileChecksum := objects.Checksum{0xfe}
+	latencyBackendInstance.packfiles[packfileChecksum] = data
+	repo.state.SetPackfileForChunk(packfileChecksum, checksum, 0, uint32(len(data)))
+
+	rd, _, err := repo.GetChunk(checksum)
+	if err != nil {
+		t.Fatalf("GetChunk: %v", err)
+	}
+	if got, _ := io.ReadAll(rd); !bytes.Equal(got, data) {
+		t.Fatalf("unexpected chunk content %q", got)
+	}
+
+	latencyBackendInstance.packfiles[packfileChecksum] = []byte("chunk c0ntent")
+	if _, _, err := repo.GetChunk(checksum); !errors.Is(err, storage.ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestEncodeBoundToRepository(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x42}, 32)
+
+	repo := &Repository{secret: secret}
+	repo.configuration.RepositoryID = uuid.New()
+	repo.configuration.Encryption = encryption.DefaultConfiguration()
+
+	encoded, err := repo.Encode([]byte("bound to its repository"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Decode(encoded); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	other := &Repository{secret: secret, configuration: repo.configuration}
+	other.configuration.RepositoryID = uuid.New()
+	if _, err := other.Decode(encoded); err == nil {
+		t.Fatal("expected data from another repository to be rejected")
+	}
+}
+
+func TestEncodeUncompressed(t *testing.T) {
+	repo := &Repository{secret: bytes.Repeat([]byte{0x42}, 32)}
+	repo.configuration.RepositoryID = uuid.New()
+	repo.configuration.Encryption = encryption.DefaultConfiguration()
+	repo.configuration.Compression = compression.DefaultConfiguration()
+
+	data := bytes.Repeat([]byte("compressible "), 1000)
+	for _, encode := range []func([]byte) ([]byte, error){repo.Encode, repo.EncodeUncompressed} {
+		encoded, err := encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := repo.Decode(encoded)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("expected the data to round-trip")
+		}
+	}
+
+	// without encryption, the marker is visible and the data stored as is
+	repo = &Repository{}
+	repo.configuration.Compression = compression.DefaultConfiguration()
+	encoded, err := repo.EncodeUncompressed(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, append(append([]byte{}, uncompressedMarker...), data...)) {
+		t.Fatalf("expected the data to be stored uncompressed behind the marker")
+	}
+	encoded, err = repo.Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(encoded, uncompressedMarker) || len(encoded) >= len(data) {
+		t.Fatalf("expected the data to be compressed")
+	}
+}
+
+func TestEncodeChunkConvergent(t *testing.T) {
+	data := bytes.Repeat([]byte("identical chunk "), 200)
+	checksum := objects.Checksum(sha256.Sum256(data))
+
+	for _, convergent := range []bool{false, true} {
+		repo := &Repository{secret: bytes.Repeat([]byte{0x42}, 32)}
+		repo.configuration.RepositoryID = uuid.New()
+		repo.configuration.Encryption = encryption.DefaultConfiguration()
+		repo.configuration.Encryption.Convergent = convergent
+		repo.configuration.Compression = compression.DefaultConfiguration()
+
+		first, err := repo.EncodeChunk(checksum, data, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := repo.EncodeChunk(checksum, data, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(first, second) != convergent {
+			t.Errorf("convergent=%v: expected identical blobs only in convergent mode", convergent)
+		}
+
+		decoded, err := repo.Decode(first)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("convergent=%v: expected the chunk to round-trip", convergent)
+		}
+	}
+}
+
+func TestAppendOnlyRepository(t *testing.T) {
+	ctx := context.NewContext()
+	ctx.SetCacheDir(t.TempDir())
+	configuration := storage.NewConfiguration()
+	configuration.Encryption = nil
+	configuration.Mode = storage.ModeAppendOnly
+	store, err := storage.Create(ctx, "memory://appendonly-"+uuid.NewString(), *configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := New(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("packfile content")
+	packfileChecksum := objects.Checksum(sha256.Sum256(data))
+	if err := repo.PutPackfile(packfileChecksum, bytes.NewReader(data), uint64(len(data))); err != nil {
+		t.Fatalf("PutPackfile: %v", err)
+	}
+
+	if err := repo.DeleteSnapshot(objects.Checksum{0x01}); !errors.Is(err, storage.ErrAppendOnly) {
+		t.Fatalf("expected ErrAppendOnly, got %v", err)
+	}
+	if err := repo.DeletePackfiles([]objects.Checksum{packfileChecksum}); !errors.Is(err, storage.ErrAppendOnly) {
+		t.Fatalf("expected ErrAppendOnly, got %v", err)
+	}
+	if err := repo.ReplaceStates(); !errors.Is(err, storage.ErrAppendOnly) {
+		t.Fatalf("expected ErrAppendOnly, got %v", err)
+	}
+
+	states, err := repo.GetStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Fatalf("expected no state to be written, got %d", len(states))
+	}
+	packfiles, err := repo.GetPackfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packfiles) != 1 {
+		t.Fatalf("expected the packfile to be kept, got %d packfiles", len(packfiles))
+	}
+}
+
+func TestPackfileCache(t *testing.T) {
+	repo, checksums := newLatencyRepository(t, 32)
+	packfileReads := latencyBackendInstance.packfileReads.Load()
+	blobReads := latencyBackendInstance.blobReads.Load()
+
+	cache := repo.NewPackfileCache(1)
+	for i := 0; i < 2; i++ {
+		chunks, err := cache.GetChunks(checksums)
+		if err != nil {
+			t.Fatalf("GetChunks: %v", err)
+		}
+		for i, checksum := range checksums {
+			if !bytes.Equal(chunks[checksum], bytes.Repeat([]byte{byte(i)}, 1024)) {
+				t.Errorf("chunk %d: unexpected content", i)
+			}
+		}
+	}
+
+	if reads := latencyBackendInstance.packfileReads.Load() - packfileReads; reads != 1 {
+		t.Fatalf("expected the packfile to be read once, got %d", reads)
+	}
+	if reads := latencyBackendInstance.blobReads.Load() - blobReads; reads != 1 {
+		t.Fatalf("expected a single ranged read, got %d", reads)
+	}
+}
+
+// BenchmarkGetChunksPackfileCache reads the chunks one at a time, as
+// when restoring small files, to compare with BenchmarkGetChunkSequential.
+func BenchmarkGetChunksPackfileCache(b *testing.B) {
+	repo, checksums := newLatencyRepository(b, 64)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		cache := repo.NewPackfileCache(1)
+		for _, checksum := range checksums {
+			if _, err := cache.GetChunks([]objects.Checksum{checksum}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestFilesystemCache(t *testing.T) {
+	repo1, repo2 := &Repository{}, &Repository{}
+
+	repo1.PutFilesystem(objects.Checksum{1}, "fs1")
+	if _, ok := repo2.GetFilesystem(objects.Checksum{1}); ok {
+		t.Fatal("a filesystem was shared with another repository")
+	}
+	repo2.PutFilesystem(objects.Checksum{1}, "fs2")
+	if fs, ok := repo1.GetFilesystem(objects.Checksum{1}); !ok || fs != "fs1" {
+		t.Fatal("expected the filesystem of the first repository")
+	}
+	if fs, ok := repo2.GetFilesystem(objects.Checksum{1}); !ok || fs != "fs2" {
+		t.Fatal("expected the filesystem of the second repository")
+	}
+
+	for i := 0; i <= filesystemCacheSize; i++ {
+		repo1.PutFilesystem(objects.Checksum{2, byte(i)}, i)
+	}
+	if _, ok := repo1.GetFilesystem(objects.Checksum{1}); ok {
+		t.Fatal("expected the least recently used filesystem to be evicted")
+	}
+	if repo1.filesystems.lru.Len() != filesystemCacheSize {
+		t.Fatalf("expected %d filesystems, got %d", filesystemCacheSize, repo1.filesystems.lru.Len())
+	}
+}
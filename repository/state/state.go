@@ -708,6 +708,76 @@ func (st *State) DeleteSnapshot(snapshotChecksum objects.Checksum) error {
 	return nil
 }
 
+// ForgetSnapshot forgets the location of the header and signature of a
+// snapshot without deleting it, so that they can be stored again.
+func (st *State) ForgetSnapshot(snapshotChecksum objects.Checksum) {
+	snapshotID := st.getOrCreateIdForChecksum(snapshotChecksum)
+
+	st.muSnapshots.Lock()
+	delete(st.Snapshots, snapshotID)
+	st.muSnapshots.Unlock()
+
+	st.muSignatures.Lock()
+	delete(st.Signatures, snapshotID)
+	st.muSignatures.Unlock()
+
+	atomic.StoreInt32(&st.dirty, 1)
+}
+
+// DeletePackfile forgets the location of all blobs stored in the packfile,
+// so that they are no longer known to exist.
+func (st *State) DeletePackfile(packfileChecksum objects.Checksum) {
+	packfileID := st.getOrCreateIdForChecksum(packfileChecksum)
+
+	deleteFrom := func(mu *sync.Mutex, locations map[uint64]Location) {
+		mu.Lock()
+		defer mu.Unlock()
+		for id, location := range locations {
+			if location.Packfile == packfileID {
+				delete(locations, id)
+				atomic.StoreInt32(&st.dirty, 1)
+			}
+		}
+	}
+
+	deleteFrom(&st.muChunks, st.Chunks)
+	deleteFrom(&st.muObjects, st.Objects)
+	deleteFrom(&st.muFiles, st.Files)
+	deleteFrom(&st.muDirectories, st.Directories)
+	deleteFrom(&st.muDatas, st.Datas)
+	deleteFrom(&st.muSnapshots, st.Snapshots)
+	deleteFrom(&st.muSignatures, st.Signatures)
+}
+
+// Subset returns a new state holding only the locations of the blobs
+// stored in the given packfiles.
+func (st *State) Subset(packfiles map[objects.Checksum]struct{}) *State {
+	nst := New()
+
+	copyFrom := func(mu *sync.Mutex, locations map[uint64]Location, set func(objects.Checksum, objects.Checksum, uint32, uint32)) {
+		mu.Lock()
+		defer mu.Unlock()
+		for id, location := range locations {
+			st.muChecksum.Lock()
+			packfileChecksum := st.IdToChecksum[location.Packfile]
+			blobChecksum := st.IdToChecksum[id]
+			st.muChecksum.Unlock()
+			if _, found := packfiles[packfileChecksum]; found {
+				set(packfileChecksum, blobChecksum, location.Offset, location.Length)
+			}
+		}
+	}
+
+	copyFrom(&st.muChunks, st.Chunks, nst.SetPackfileForChunk)
+	copyFrom(&st.muObjects, st.Objects, nst.SetPackfileForObject)
+	copyFrom(&st.muFiles, st.Files, nst.SetPackfileForFile)
+	copyFrom(&st.muDirectories, st.Directories, nst.SetPackfileForDirectory)
+	copyFrom(&st.muDatas, st.Datas, nst.SetPackfileForData)
+	copyFrom(&st.muSnapshots, st.Snapshots, nst.SetPackfileForSnapshot)
+	copyFrom(&st.muSignatures, st.Signatures, nst.SetPackfileForSignature)
+	return nst
+}
+
 func (st *State) ListSnapshots() <-chan objects.Checksum {
 	ch := make(chan objects.Checksum)
 	go func() {
@@ -731,6 +801,41 @@ func (st *State) ListSnapshots() <-chan objects.Checksum {
 	return ch
 }
 
+// ListPackfiles returns the packfiles holding the blobs known to the state.
+func (st *State) ListPackfiles() <-chan objects.Checksum {
+	ch := make(chan objects.Checksum)
+	go func() {
+		packfileIDs := make(map[uint64]struct{})
+		collect := func(mu *sync.Mutex, locations map[uint64]Location) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, location := range locations {
+				packfileIDs[location.Packfile] = struct{}{}
+			}
+		}
+		collect(&st.muChunks, st.Chunks)
+		collect(&st.muObjects, st.Objects)
+		collect(&st.muFiles, st.Files)
+		collect(&st.muDirectories, st.Directories)
+		collect(&st.muDatas, st.Datas)
+		collect(&st.muSnapshots, st.Snapshots)
+		collect(&st.muSignatures, st.Signatures)
+
+		packfilesList := make([]objects.Checksum, 0, len(packfileIDs))
+		st.muChecksum.Lock()
+		for id := range packfileIDs {
+			packfilesList = append(packfilesList, st.IdToChecksum[id])
+		}
+		st.muChecksum.Unlock()
+
+		for _, checksum := range packfilesList {
+			ch <- checksum
+		}
+		close(ch)
+	}()
+	return ch
+}
+
 func (st *State) ListChunks() <-chan objects.Checksum {
 	ch := make(chan objects.Checksum)
 	go func() {
@@ -2,6 +2,8 @@ package state
 
 import (
 	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
 )
 
 func TestNew(t *testing.T) {
@@ -258,3 +260,95 @@ func TestGetSubpartForObject(t *testing.T) {
 		t.Errorf("Expected GetSubpartForObject to return false for %v", nonExisting)
 	}
 }
+
+func TestDeletePackfile(t *testing.T) {
+	st := New()
+
+	packfile1 := [32]byte{1}
+	packfile2 := [32]byte{2}
+	chunk1 := [32]byte{10}
+	chunk2 := [32]byte{11}
+	object := [32]byte{12}
+
+	st.SetPackfileForChunk(packfile1, chunk1, 0, 10)
+	st.SetPackfileForObject(packfile1, object, 10, 10)
+	st.SetPackfileForChunk(packfile2, chunk2, 0, 10)
+	st.ResetDirty()
+
+	st.DeletePackfile(packfile1)
+
+	if st.ChunkExists(chunk1) || st.ObjectExists(object) {
+		t.Error("Expected the blobs of the deleted packfile to be forgotten")
+	}
+	if !st.ChunkExists(chunk2) {
+		t.Error("Expected the blobs of other packfiles to be kept")
+	}
+	if !st.Dirty() {
+		t.Error("Expected state to be dirty after DeletePackfile")
+	}
+
+	packfiles := make([][32]byte, 0)
+	for checksum := range st.ListPackfiles() {
+		packfiles = append(packfiles, checksum)
+	}
+	if len(packfiles) != 1 || packfiles[0] != packfile2 {
+		t.Errorf("Expected only %x to be listed, got %x", packfile2, packfiles)
+	}
+}
+
+func TestForgetSnapshot(t *testing.T) {
+	st := New()
+
+	packfile1 := [32]byte{1}
+	packfile2 := [32]byte{2}
+	snapshot := [32]byte{10}
+
+	st.SetPackfileForSnapshot(packfile1, snapshot, 0, 10)
+	st.SetPackfileForSignature(packfile1, snapshot, 10, 10)
+	st.ResetDirty()
+
+	st.ForgetSnapshot(snapshot)
+	if _, _, _, exists := st.GetSubpartForSnapshot(snapshot); exists {
+		t.Error("Expected the snapshot header to be forgotten")
+	}
+	if _, exists := st.GetPackfileForSignature(snapshot); exists {
+		t.Error("Expected the snapshot signature to be forgotten")
+	}
+	if _, deleted := st.DeletedSnapshots[st.getOrCreateIdForChecksum(snapshot)]; deleted {
+		t.Error("Expected the snapshot not to be marked as deleted")
+	}
+	if !st.Dirty() {
+		t.Error("Expected state to be dirty after ForgetSnapshot")
+	}
+
+	st.SetPackfileForSnapshot(packfile2, snapshot, 0, 10)
+	if packfile, _, _, _ := st.GetSubpartForSnapshot(snapshot); packfile != packfile2 {
+		t.Errorf("Expected the snapshot header to be in %x, got %x", packfile2, packfile)
+	}
+}
+
+func TestSubset(t *testing.T) {
+	st := New()
+
+	packfile1 := [32]byte{1}
+	packfile2 := [32]byte{2}
+	chunk1 := [32]byte{10}
+	chunk2 := [32]byte{11}
+	snapshot := [32]byte{12}
+
+	st.SetPackfileForChunk(packfile1, chunk1, 0, 10)
+	st.SetPackfileForSnapshot(packfile1, snapshot, 10, 20)
+	st.SetPackfileForChunk(packfile2, chunk2, 0, 10)
+
+	subset := st.Subset(map[objects.Checksum]struct{}{packfile1: {}})
+	if !subset.ChunkExists(chunk1) || subset.ChunkExists(chunk2) {
+		t.Error("Expected only the blobs of the kept packfile")
+	}
+	packfile, offset, length, exists := subset.GetSubpartForSnapshot(snapshot)
+	if !exists || packfile != packfile1 || offset != 10 || length != 20 {
+		t.Errorf("Unexpected snapshot location %x %d %d", packfile, offset, length)
+	}
+	if !st.ChunkExists(chunk2) {
+		t.Error("Expected the original state to be left untouched")
+	}
+}
@@ -2,6 +2,7 @@ package httpd
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,6 +15,21 @@ import (
 
 var lrepository *repository.Repository
 var lNoDelete bool
+var lToken string
+
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lToken != "" {
+			expected := []byte("Bearer " + lToken)
+			provided := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(expected, provided) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
 func openRepository(w http.ResponseWriter, r *http.Request) {
 	var reqOpen network.ReqOpen
@@ -254,14 +270,21 @@ func deletePackfile(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Server(repo *repository.Repository, addr string, noDelete bool) error {
+func Server(repo *repository.Repository, addr string, noDelete bool, token string) error {
+	return http.ListenAndServe(addr, Handler(repo, noDelete, token))
+}
 
+// Handler returns the handler serving repo, requests must carry token as a
+// bearer token unless it is empty.
+func Handler(repo *repository.Repository, noDelete bool, token string) http.Handler {
 	lNoDelete = noDelete
+	lToken = token
 
 	lrepository = repo
 	network.ProtocolRegister()
 
 	r := mux.NewRouter()
+	r.Use(authenticate)
 	r.HandleFunc("/", openRepository).Methods("GET")
 	r.HandleFunc("/", closeRepository).Methods("POST")
 
@@ -276,5 +299,5 @@ func Server(repo *repository.Repository, addr string, noDelete bool) error {
 	r.HandleFunc("/packfile/blob", GetPackfileBlob).Methods("GET")
 	r.HandleFunc("/packfile", deletePackfile).Methods("DELETE")
 
-	return http.ListenAndServe(addr, r)
+	return r
 }
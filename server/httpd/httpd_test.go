@@ -0,0 +1,96 @@
+package httpd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/network"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/google/uuid"
+
+	_ "github.com/PlakarKorp/plakar/storage/backends/http"
+	_ "github.com/PlakarKorp/plakar/storage/backends/memory"
+)
+
+func newTestServer(t *testing.T, token string) (*httptest.Server, *repository.Repository) {
+	ctx := context.NewContext()
+	ctx.SetCacheDir(filepath.Join(t.TempDir(), "cache"))
+	configuration := storage.NewConfiguration()
+	configuration.Encryption = nil
+	store, err := storage.Create(ctx, "memory://httpd-"+uuid.NewString(), *configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := repository.New(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(Handler(repo, true, token))
+	t.Cleanup(server.Close)
+	return server, repo
+}
+
+func TestAuthenticate(t *testing.T) {
+	server, repo := newTestServer(t, "secret")
+
+	for _, test := range []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"token without scheme", "secret", http.StatusUnauthorized},
+		{"correct token", "Bearer secret", http.StatusOK},
+	} {
+		body, err := json.Marshal(network.ReqOpen{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest("GET", server.URL+"/", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, res.StatusCode)
+		}
+	}
+
+	// the http backend passes the token given in the location
+	ctx := context.NewContext()
+	location := strings.Replace(server.URL, "http://", "http://secret@", 1)
+	store, err := storage.Open(ctx, location)
+	if err != nil {
+		t.Fatalf("open with the correct token: %v", err)
+	}
+	if store.Configuration().RepositoryID != repo.Configuration().RepositoryID {
+		t.Errorf("opened a different repository")
+	}
+	if _, err := storage.Open(ctx, strings.Replace(server.URL, "http://", "http://wrong@", 1)); err == nil {
+		t.Errorf("expected open with a wrong token to fail")
+	}
+}
+
+func TestNoToken(t *testing.T) {
+	server, _ := newTestServer(t, "")
+
+	if _, err := storage.Open(context.NewContext(), server.URL); err != nil {
+		t.Fatalf("expected a server without a token to accept any client: %v", err)
+	}
+}
@@ -83,7 +83,7 @@ func handleConnection(ctx *context.Context, repo *repository.Repository, rd io.R
 					dirPath = filepath.Join(homeDir, ".plakar")
 				}
 
-				logger.Trace("server", "%s: Create(%s, %s)", clientUuid, dirPath, request.Payload.(network.ReqCreate).Configuration)
+				logger.Trace("server", "%s: Create(%s, %v)", clientUuid, dirPath, request.Payload.(network.ReqCreate).Configuration)
 				st, err := storage.Create(ctx, dirPath, request.Payload.(network.ReqCreate).Configuration)
 				retErr := ""
 				if err != nil {
@@ -1,17 +1,20 @@
 package snapshot
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"math"
 	"mime"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/PlakarKorp/plakar/compression"
 	"github.com/PlakarKorp/plakar/events"
 	"github.com/PlakarKorp/plakar/logger"
 	"github.com/PlakarKorp/plakar/objects"
@@ -49,8 +52,24 @@ type BackupContext struct {
 	imp            *importer.Importer
 	sc             *scanCache
 	maxConcurrency chan bool
+
+	filesTotal atomic.Uint64
+	filesDone  atomic.Uint64
+	bytesTotal atomic.Uint64
+	bytesDone  atomic.Uint64
+
+	skippedMutex sync.Mutex
+	skipped      []string
 }
 
+// errorsSummaryPaths is the number of failed pathnames reported along
+// with the errors summary at the end of a backup.
+const errorsSummaryPaths = 10
+
+// progressInterval is how often a Progress event is emitted while files
+// are being backed up.
+var progressInterval = time.Second
+
 func newScanCache() (*scanCache, error) {
 	tempDir, err := os.MkdirTemp("", "leveldb-temp")
 	if err != nil {
@@ -382,6 +401,29 @@ func (cache *scanCache) EnumerateImmediateChildPathnames(directory string) (<-ch
 type PushOptions struct {
 	MaxConcurrency uint64
 	Excludes       []glob.Glob
+	Includes       []glob.Glob // if set, only the files matching one of them are backed up
+	Resume         bool
+	OneFileSystem  bool
+	Dereference    bool
+	ExcludeCaches  bool // skip the directories tagged with a CACHEDIR.TAG
+	ExcludeDevices bool
+	ExcludeSockets bool
+	ExcludeFifos   bool
+	MaxFileSize    uint64 // regular files larger than this are skipped, 0 for no limit
+}
+
+// skipExcludedType reports whether a file of the given mode is of a type
+// the options exclude from the backup.
+func (snapshot *Snapshot) skipExcludedType(options *PushOptions, mode os.FileMode) bool {
+	switch {
+	case mode&os.ModeDevice != 0:
+		return options.ExcludeDevices
+	case mode&os.ModeSocket != 0:
+		return options.ExcludeSockets
+	case mode&os.ModeNamedPipe != 0:
+		return options.ExcludeFifos
+	}
+	return false
 }
 
 func (snapshot *Snapshot) skipExcludedPathname(options *PushOptions, record importer.ScanResult) bool {
@@ -390,7 +432,25 @@ func (snapshot *Snapshot) skipExcludedPathname(options *PushOptions, record impo
 	case importer.ScanError:
 		pathname = record.Pathname
 	case importer.ScanRecord:
+		if snapshot.skipExcludedType(options, record.FileInfo.Mode()) {
+			return true
+		}
 		pathname = record.Pathname
+
+		// directories are kept so that the included paths below them
+		// are still reached
+		if len(options.Includes) != 0 && !record.FileInfo.Mode().IsDir() {
+			included := false
+			for _, include := range options.Includes {
+				if include.Match(pathname) {
+					included = true
+					break
+				}
+			}
+			if !included {
+				return true
+			}
+		}
 	}
 	doExclude := false
 	for _, exclude := range options.Excludes {
@@ -402,6 +462,29 @@ func (snapshot *Snapshot) skipExcludedPathname(options *PushOptions, record impo
 	return doExclude
 }
 
+// skipLargeFile reports whether record is a regular file larger than
+// the maximum file size of the options, in which case it is recorded
+// as skipped so the user knows it is missing from the snapshot.
+func (snap *Snapshot) skipLargeFile(backupCtx *BackupContext, options *PushOptions, record importer.ScanResult) bool {
+	if options.MaxFileSize == 0 {
+		return false
+	}
+	scanRecord, ok := record.(importer.ScanRecord)
+	if !ok || !scanRecord.FileInfo.Mode().IsRegular() {
+		return false
+	}
+	size := uint64(scanRecord.FileInfo.Size())
+	if size <= options.MaxFileSize {
+		return false
+	}
+
+	backupCtx.skippedMutex.Lock()
+	backupCtx.skipped = append(backupCtx.skipped, scanRecord.Pathname)
+	backupCtx.skippedMutex.Unlock()
+	snap.Event(events.FileSkippedEvent(snap.Header.SnapshotID, scanRecord.Pathname, size))
+	return true
+}
+
 func (snap *Snapshot) updateImporterStatistics(record importer.ScanResult) {
 	atomic.AddUint64(&snap.statistics.ImporterRecords, 1)
 
@@ -445,12 +528,17 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *PushOptions
 	go func() {
 		snap.statistics.ImporterStart = time.Now()
 		for _record := range scanner {
+			// keep draining the scanner once aborted so that the
+			// importer isn't left blocked on a send
 			if backupCtx.aborted.Load() {
-				break
+				continue
 			}
 			if snap.skipExcludedPathname(options, _record) {
 				continue
 			}
+			if snap.skipLargeFile(backupCtx, options, _record) {
+				continue
+			}
 
 			backupCtx.maxConcurrency <- true
 			wg.Add(1)
@@ -464,8 +552,9 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *PushOptions
 				switch record := record.(type) {
 				case importer.ScanError:
 					if record.Pathname == backupCtx.imp.Root() || len(record.Pathname) < len(backupCtx.imp.Root()) {
-						backupCtx.aborted.Store(true)
-						backupCtx.abortedReason = record.Err
+						if backupCtx.aborted.CompareAndSwap(false, true) {
+							backupCtx.abortedReason = record.Err
+						}
 						return
 					}
 					backupCtx.sc.RecordError(record.Pathname, record.Err)
@@ -479,6 +568,8 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *PushOptions
 							return
 						}
 					} else {
+						backupCtx.filesTotal.Add(1)
+						backupCtx.bytesTotal.Add(uint64(record.FileInfo.Size()))
 						filesChannel <- record
 					}
 					//extension := strings.ToLower(filepath.Ext(record.Pathname))
@@ -495,13 +586,137 @@ func (snap *Snapshot) importerJob(backupCtx *BackupContext, options *PushOptions
 			}(_record)
 		}
 		wg.Wait()
-		close(filesChannel)
+		// set before closing so readers done with the channel see it
 		snap.statistics.ImporterDuration = time.Since(snap.statistics.ImporterStart)
+		close(filesChannel)
 	}()
 
 	return filesChannel, nil
 }
 
+func (snap *Snapshot) progressEvent(backupCtx *BackupContext) {
+	snap.Event(events.ProgressEvent(snap.Header.SnapshotID,
+		backupCtx.filesDone.Load(), backupCtx.filesTotal.Load(),
+		backupCtx.bytesDone.Load(), backupCtx.bytesTotal.Load()))
+}
+
+// progressJob periodically reports the progress of the backup until done
+// is closed, it closes stopped once it no longer emits events.
+func (snap *Snapshot) progressJob(backupCtx *BackupContext, done <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			snap.progressEvent(backupCtx)
+		}
+	}
+}
+
+// openImporter returns the importer for scanDir and records its
+// description in the snapshot header.
+func (snap *Snapshot) openImporter(scanDir string, options *PushOptions) (*importer.Importer, error) {
+	imp, err := importer.NewImporter(scanDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := imp.SetOneFileSystem(options.OneFileSystem); err != nil {
+		imp.Close()
+		return nil, err
+	}
+	if err := imp.SetDereference(options.Dereference); err != nil {
+		imp.Close()
+		return nil, err
+	}
+	if err := imp.SetExcludeCaches(options.ExcludeCaches); err != nil {
+		imp.Close()
+		return nil, err
+	}
+
+	snap.Header.Importer.Origin = imp.Origin()
+	snap.Header.Importer.Type = imp.Type()
+
+	if !strings.Contains(scanDir, "://") {
+		scanDir, err = filepath.Abs(scanDir)
+		if err != nil {
+			logger.Warn("%s", err)
+			imp.Close()
+			return nil, err
+		}
+	} else {
+		scanDir = imp.Root()
+	}
+	snap.Header.Importer.Directory = filepath.ToSlash(scanDir)
+	return imp, nil
+}
+
+type DryRunSummary struct {
+	Files       uint64
+	Directories uint64
+	Size        uint64
+	Skipped     []string // files larger than the maximum file size
+}
+
+// DryRun scans scanDir as Backup would and emits the same events for the
+// files and directories it would back up, but it neither reads their
+// content nor writes anything to the repository.
+func (snap *Snapshot) DryRun(scanDir string, options *PushOptions) (*DryRunSummary, error) {
+	snap.Event(events.StartEvent())
+	defer snap.Event(events.DoneEvent())
+
+	sc, err := newScanCache()
+	if err != nil {
+		return nil, err
+	}
+	defer sc.Close()
+
+	imp, err := snap.openImporter(scanDir, options)
+	if err != nil {
+		return nil, err
+	}
+	defer imp.Close()
+
+	backupCtx := &BackupContext{
+		imp:            imp,
+		sc:             sc,
+		maxConcurrency: make(chan bool, options.MaxConcurrency),
+	}
+
+	filesChannel, err := snap.importerJob(backupCtx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &DryRunSummary{}
+	for record := range filesChannel {
+		summary.Files++
+		if record.FileInfo.Mode().IsRegular() {
+			summary.Size += uint64(record.FileInfo.Size())
+		}
+		snap.Event(events.FileOKEvent(snap.Header.SnapshotID, record.Pathname))
+	}
+
+	directories, err := sc.EnumerateKeysWithPrefixReverse("__pathname__", true)
+	if err != nil {
+		return nil, err
+	}
+	for record := range directories {
+		summary.Directories++
+		snap.Event(events.DirectoryOKEvent(snap.Header.SnapshotID, record.Pathname))
+	}
+	summary.Skipped = backupCtx.skipped
+	sort.Strings(summary.Skipped)
+
+	if backupCtx.aborted.Load() {
+		return nil, backupCtx.abortedReason
+	}
+	return summary, nil
+}
+
 func (snap *Snapshot) Backup(scanDir string, options *PushOptions) error {
 	snap.Event(events.StartEvent())
 	defer snap.Event(events.DoneEvent())
@@ -519,27 +734,20 @@ func (snap *Snapshot) Backup(scanDir string, options *PushOptions) error {
 	}
 	defer sc.Close()
 
-	imp, err := importer.NewImporter(scanDir)
+	imp, err := snap.openImporter(scanDir, options)
 	if err != nil {
 		return err
 	}
 	defer imp.Close()
 
-	snap.Header.Importer.Origin = imp.Origin()
-	snap.Header.Importer.Type = imp.Type()
-
 	//t0 := time.Now()
 
-	if !strings.Contains(scanDir, "://") {
-		scanDir, err = filepath.Abs(scanDir)
-		if err != nil {
-			logger.Warn("%s", err)
+	snap.checkpoint = snap.checkpointPath(imp.Origin(), snap.Header.Importer.Directory)
+	if options.Resume {
+		if err := snap.resumeCheckpoint(); err != nil {
 			return err
 		}
-	} else {
-		scanDir = imp.Root()
 	}
-	snap.Header.Importer.Directory = filepath.ToSlash(scanDir)
 
 	backupCtx := &BackupContext{
 		imp:            imp,
@@ -553,6 +761,10 @@ func (snap *Snapshot) Backup(scanDir string, options *PushOptions) error {
 		return err
 	}
 
+	progressDone := make(chan struct{})
+	progressStopped := make(chan struct{})
+	go snap.progressJob(backupCtx, progressDone, progressStopped)
+
 	/* scanner */
 	scannerWg := sync.WaitGroup{}
 	snap.statistics.ScannerStart = time.Now()
@@ -561,6 +773,8 @@ func (snap *Snapshot) Backup(scanDir string, options *PushOptions) error {
 		scannerWg.Add(1)
 		go func(record importer.ScanRecord) {
 			defer func() {
+				backupCtx.filesDone.Add(1)
+				backupCtx.bytesDone.Add(uint64(record.FileInfo.Size()))
 				<-backupCtx.maxConcurrency
 				scannerWg.Done()
 			}()
@@ -683,6 +897,19 @@ func (snap *Snapshot) Backup(scanDir string, options *PushOptions) error {
 		}(_record)
 	}
 	scannerWg.Wait()
+	close(progressDone)
+	<-progressStopped
+	snap.progressEvent(backupCtx)
+
+	importerContext := imp.Context()
+	keys := make([]string, 0, len(importerContext))
+	for key := range importerContext {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		snap.Header.SetContext(key, importerContext[key])
+	}
 
 	var rootSummary *vfs.Summary
 
@@ -913,9 +1140,11 @@ func (snap *Snapshot) Backup(scanDir string, options *PushOptions) error {
 		return err
 	}
 	metadataChecksum := snap.repository.Checksum(metadata)
-	err = snap.PutData(metadataChecksum, metadata)
-	if err != nil {
-		return err
+	if !snap.CheckData(metadataChecksum) {
+		err = snap.PutData(metadataChecksum, metadata)
+		if err != nil {
+			return err
+		}
 	}
 
 	statistics, err := snap.statistics.Serialize()
@@ -923,9 +1152,11 @@ func (snap *Snapshot) Backup(scanDir string, options *PushOptions) error {
 		return err
 	}
 	statisticsChecksum := snap.repository.Checksum(statistics)
-	err = snap.PutData(statisticsChecksum, statistics)
-	if err != nil {
-		return err
+	if !snap.CheckData(statisticsChecksum) {
+		err = snap.PutData(statisticsChecksum, statistics)
+		if err != nil {
+			return err
+		}
 	}
 
 	errorsLog := errorslog.NewErrorsLog()
@@ -936,15 +1167,20 @@ func (snap *Snapshot) Backup(scanDir string, options *PushOptions) error {
 	for entry := range errc {
 		errorsLog.Append(entry.Pathname, entry.Error)
 	}
+	if summary := errorsLog.Summary(errorsSummaryPaths); summary.Count != 0 {
+		snap.Event(events.ErrorsSummaryEvent(snap.Header.SnapshotID, summary.Count, summary.Classes, summary.Paths))
+	}
 
 	errorsLogData, err := errorsLog.Serialize()
 	if err != nil {
 		return err
 	}
 	errorsLogChecksum := snap.repository.Checksum(errorsLogData)
-	err = snap.PutData(errorsLogChecksum, errorsLogData)
-	if err != nil {
-		return err
+	if !snap.CheckData(errorsLogChecksum) {
+		err = snap.PutData(errorsLogChecksum, errorsLogData)
+		if err != nil {
+			return err
+		}
 	}
 
 	value, err := sc.GetChecksum("/")
@@ -988,7 +1224,75 @@ func (snap *Snapshot) Backup(scanDir string, options *PushOptions) error {
 			snap.Header.FilePercentExtension[key] = math.Round((float64(value)/float64(snap.Header.FilesCount)*100)*100) / 100
 		}
 	*/
-	return snap.Commit()
+	if err := snap.Commit(); err != nil {
+		return err
+	}
+	snap.discardCheckpoint()
+	return nil
+}
+
+// incompressibleTypes are the content types whose data is compressed by
+// its format already, compressing it again only wastes CPU.
+var incompressibleTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/vnd.rar":          true,
+	"application/x-7z-compressed":  true,
+	"application/x-bzip2":          true,
+	"application/x-gzip":           true,
+	"application/x-rar-compressed": true,
+	"application/x-xz":             true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"audio/aac":                    true,
+	"audio/flac":                   true,
+	"audio/mp4":                    true,
+	"audio/mpeg":                   true,
+	"audio/ogg":                    true,
+	"image/avif":                   true,
+	"image/gif":                    true,
+	"image/heic":                   true,
+	"image/jpeg":                   true,
+	"image/png":                    true,
+	"image/webp":                   true,
+}
+
+// compressionSampleSize is how much of the first chunk of a file is
+// compressed to estimate how well the file compresses, below
+// compressionMinSample the file is compressed without asking.
+const compressionSampleSize = 64 << 10
+const compressionMinSample = 1 << 10
+
+// compressionMinRatio is the ratio of the sample size to its compressed
+// size under which a file is stored uncompressed.
+const compressionMinRatio = 1.05
+
+// compressible guesses from its content type and its first chunk whether
+// the chunks of a file are worth compressing.
+func (snap *Snapshot) compressible(contentType string, firstChunk []byte) bool {
+	configuration := snap.repository.Configuration().Compression
+	if configuration == nil {
+		return true
+	}
+
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if incompressibleTypes[mediaType] || strings.HasPrefix(mediaType, "video/") {
+		return false
+	}
+
+	if len(firstChunk) < compressionMinSample {
+		return true
+	}
+	sample := firstChunk[:min(len(firstChunk), compressionSampleSize)]
+	rd, err := compression.DeflateStream(configuration.Algorithm, bytes.NewReader(sample))
+	if err != nil {
+		return true
+	}
+	compressedSize, err := io.Copy(io.Discard, rd)
+	if err != nil || compressedSize == 0 {
+		return true
+	}
+	return float64(len(sample))/float64(compressedSize) >= compressionMinRatio
 }
 
 func entropy(data []byte) float64 {
@@ -1029,6 +1333,7 @@ func (snap *Snapshot) chunkify(imp *importer.Importer, record importer.ScanRecor
 	objectHasher := snap.repository.Hasher()
 
 	var firstChunk = true
+	var compress = true
 	var cdcOffset uint64
 	var object_t32 [32]byte
 
@@ -1045,6 +1350,7 @@ func (snap *Snapshot) chunkify(imp *importer.Importer, record importer.ScanRecor
 			if object.ContentType == "" {
 				object.ContentType = mimetype.Detect(data).String()
 			}
+			compress = snap.compressible(object.ContentType, data)
 			firstChunk = false
 		}
 		objectHasher.Write(data)
@@ -1063,7 +1369,7 @@ func (snap *Snapshot) chunkify(imp *importer.Importer, record importer.ScanRecor
 		if !snap.CheckChunk(chunk.Checksum) {
 			atomic.AddUint64(&snap.statistics.ChunksCount, 1)
 			atomic.AddUint64(&snap.statistics.ChunksSize, uint64(len(data)))
-			return snap.PutChunk(chunk.Checksum, data)
+			return snap.putChunk(chunk.Checksum, data, compress)
 		}
 		return nil
 	}
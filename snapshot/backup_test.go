@@ -0,0 +1,454 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/events"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/errorslog"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/gobwas/glob"
+	"github.com/google/uuid"
+)
+
+// listRepository returns the files stored in an fs repository.
+func listRepository(t *testing.T, repoDir string) []string {
+	var files []string
+	err := filepath.Walk(repoDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestDryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"a.txt":        strings.Repeat("a", 100),
+		"subdir/b.txt": strings.Repeat("b", 200),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repoDir := filepath.Join(tmpDir, "repo")
+	repo := openRepository(t, newTestStore(t, repoDir, nil))
+	before := listRepository(t, repoDir)
+
+	fileOK := 0
+	listener := repo.Context().Events().Listen()
+	listenerDone := make(chan struct{})
+	go func() {
+		defer close(listenerDone)
+		for event := range listener {
+			if _, ok := event.(events.FileOK); ok {
+				fileOK++
+			}
+		}
+	}()
+
+	snap, err := New(repo, repo.Checksum([]byte(uuid.NewString())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := snap.DryRun(sourceDir, &PushOptions{MaxConcurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Context().Events().Close()
+	<-listenerDone
+
+	if summary.Files != 2 {
+		t.Errorf("expected 2 files, got %d", summary.Files)
+	}
+	// the source directory, its subdirectory and their parents
+	if summary.Directories < 2 {
+		t.Errorf("expected at least 2 directories, got %d", summary.Directories)
+	}
+	if summary.Size != 300 {
+		t.Errorf("expected a size of 300, got %d", summary.Size)
+	}
+	if fileOK != 2 {
+		t.Errorf("expected 2 FileOK events, got %d", fileOK)
+	}
+
+	after := listRepository(t, repoDir)
+	if strings.Join(before, "\n") != strings.Join(after, "\n") {
+		t.Fatalf("dry run wrote to the repository:\nbefore: %v\nafter: %v", before, after)
+	}
+
+	repo = openRepository(t, repo.Store())
+	if snapshots, err := repo.GetSnapshots(); err != nil {
+		t.Fatal(err)
+	} else if len(snapshots) != 0 {
+		t.Fatalf("expected no snapshot, got %d", len(snapshots))
+	}
+}
+
+func TestSkipExcludedType(t *testing.T) {
+	modes := map[string]os.FileMode{
+		"file":      0644,
+		"directory": os.ModeDir | 0755,
+		"symlink":   os.ModeSymlink | 0777,
+		"block":     os.ModeDevice | 0660,
+		"char":      os.ModeDevice | os.ModeCharDevice | 0620,
+		"socket":    os.ModeSocket | 0755,
+		"fifo":      os.ModeNamedPipe | 0644,
+	}
+	record := func(name string) importer.ScanRecord {
+		return importer.ScanRecord{
+			Pathname: "/" + name,
+			FileInfo: objects.FileInfo{Lname: name, Lmode: modes[name]},
+		}
+	}
+
+	for _, test := range []struct {
+		options  PushOptions
+		excluded []string
+	}{
+		{PushOptions{}, nil},
+		{PushOptions{ExcludeDevices: true}, []string{"block", "char"}},
+		{PushOptions{ExcludeSockets: true}, []string{"socket"}},
+		{PushOptions{ExcludeFifos: true}, []string{"fifo"}},
+		{PushOptions{ExcludeDevices: true, ExcludeSockets: true, ExcludeFifos: true}, []string{"block", "char", "socket", "fifo"}},
+	} {
+		snap := &Snapshot{}
+		for name := range modes {
+			expected := false
+			for _, excluded := range test.excluded {
+				if name == excluded {
+					expected = true
+				}
+			}
+			if skipped := snap.skipExcludedPathname(&test.options, record(name)); skipped != expected {
+				t.Errorf("%+v: %s: expected excluded to be %v, got %v", test.options, name, expected, skipped)
+			}
+		}
+	}
+
+	// errors are never filtered by type
+	snap := &Snapshot{}
+	options := &PushOptions{ExcludeDevices: true, ExcludeSockets: true, ExcludeFifos: true}
+	if snap.skipExcludedPathname(options, importer.ScanError{Pathname: "/fifo"}) {
+		t.Error("a scan error was excluded")
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const maxFileSize = 100
+	sizes := map[string]int{
+		"under.bin": maxFileSize - 1,
+		"limit.bin": maxFileSize,
+		"over.bin":  maxFileSize + 1,
+	}
+	for name, size := range sizes {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(strings.Repeat("x", size)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pathname := func(name string) string {
+		return filepath.ToSlash(filepath.Join(sourceDir, name))
+	}
+
+	repo := newTestRepository(t)
+
+	var skipped []events.FileSkipped
+	listener := repo.Context().Events().Listen()
+	listenerDone := make(chan struct{})
+	go func() {
+		defer close(listenerDone)
+		for event := range listener {
+			if event, ok := event.(events.FileSkipped); ok {
+				skipped = append(skipped, event)
+			}
+		}
+	}()
+
+	options := &PushOptions{MaxConcurrency: 1, MaxFileSize: maxFileSize}
+	snap, err := New(repo, repo.Checksum([]byte(uuid.NewString())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := snap.DryRun(sourceDir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Skipped) != 1 || summary.Skipped[0] != pathname("over.bin") {
+		t.Errorf("expected only over.bin to be skipped, got %v", summary.Skipped)
+	}
+	if summary.Files != 2 || summary.Size != 2*maxFileSize-1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	snap, err = New(repo, repo.Checksum([]byte(uuid.NewString())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Backup(sourceDir, options); err != nil {
+		t.Fatal(err)
+	}
+	repo.Context().Events().Close()
+	<-listenerDone
+
+	// once for the dry run, once for the backup
+	if len(skipped) != 2 {
+		t.Fatalf("expected 2 FileSkipped events, got %d", len(skipped))
+	}
+	for _, event := range skipped {
+		if event.Pathname != pathname("over.bin") || event.Size != maxFileSize+1 {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+
+	snap, err = Load(repo, snap.Header.SnapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range sizes {
+		rd, err := snap.NewReader(pathname(name))
+		if name == "over.bin" {
+			if err == nil {
+				t.Errorf("%s was backed up", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		data, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != size {
+			t.Errorf("%s: expected %d bytes, got %d", name, size, len(data))
+		}
+	}
+}
+
+func TestSkipExcludedPathnameIncludes(t *testing.T) {
+	compile := func(patterns ...string) []glob.Glob {
+		var globs []glob.Glob
+		for _, pattern := range patterns {
+			globs = append(globs, glob.MustCompile(pattern))
+		}
+		return globs
+	}
+	directory := importer.ScanRecord{
+		Pathname: "/home/user/src",
+		FileInfo: objects.FileInfo{Lname: "src", Lmode: os.ModeDir | 0755},
+	}
+	file := func(pathname string) importer.ScanRecord {
+		return importer.ScanRecord{
+			Pathname: pathname,
+			FileInfo: objects.FileInfo{Lname: filepath.Base(pathname), Lmode: 0644},
+		}
+	}
+
+	for _, test := range []struct {
+		includes []string
+		excludes []string
+		record   importer.ScanRecord
+		skipped  bool
+	}{
+		{nil, nil, file("/home/user/src/main.go"), false},
+		{[]string{"*.go"}, nil, file("/home/user/src/main.go"), false},
+		{[]string{"*.go"}, nil, file("/home/user/src/README"), true},
+		{[]string{"*.go", "*/README"}, nil, file("/home/user/src/README"), false},
+		{[]string{"*.go"}, nil, directory, false},
+		{[]string{"*.go"}, []string{"*_test.go"}, file("/home/user/src/main_test.go"), true},
+		{[]string{"*.go"}, []string{"*_test.go"}, file("/home/user/src/main.go"), false},
+		{[]string{"*.go"}, []string{"/home/user/src"}, directory, true},
+		{nil, []string{"*.go"}, file("/home/user/src/main.go"), true},
+	} {
+		options := &PushOptions{Includes: compile(test.includes...), Excludes: compile(test.excludes...)}
+		if skipped := (&Snapshot{}).skipExcludedPathname(options, test.record); skipped != test.skipped {
+			t.Errorf("includes %v, excludes %v: %s: expected skipped to be %v, got %v",
+				test.includes, test.excludes, test.record.Pathname, test.skipped, skipped)
+		}
+	}
+}
+
+// scanErrorImporter is an importer sending scan errors: for the root if
+// its location ends in "/abort", for /b otherwise. It closes done once
+// its scan is over.
+type scanErrorImporter struct {
+	location string
+	done     chan struct{}
+}
+
+var scanErrorImporters sync.Map
+
+func init() {
+	importer.Register("scanerror", func(location string) (importer.ImporterBackend, error) {
+		imp := &scanErrorImporter{location: location, done: make(chan struct{})}
+		scanErrorImporters.Store(location, imp)
+		return imp, nil
+	})
+}
+
+func (imp *scanErrorImporter) Origin() string { return "scanerror" }
+func (imp *scanErrorImporter) Type() string   { return "scanerror" }
+func (imp *scanErrorImporter) Root() string   { return "/" }
+func (imp *scanErrorImporter) Close() error   { return nil }
+
+func (imp *scanErrorImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("a")), nil
+}
+
+func (imp *scanErrorImporter) Scan() (<-chan importer.ScanResult, error) {
+	c := make(chan importer.ScanResult)
+	go func() {
+		defer close(imp.done)
+		defer close(c)
+
+		if strings.HasSuffix(imp.location, "/abort") {
+			c <- importer.ScanError{Pathname: "/", Err: errors.New("root is unreadable")}
+		} else {
+			c <- importer.ScanError{Pathname: "/b", Err: errors.New("permission denied")}
+		}
+		file := objects.NewFileInfo("a", 1, 0644, time.Now(), 0, 0, 0, 0, 1)
+		for i := 0; i < 100; i++ {
+			c <- importer.ScanRecord{Type: importer.RecordTypeFile, Pathname: "/a", FileInfo: file}
+		}
+		c <- importer.ScanRecord{
+			Type:     importer.RecordTypeDirectory,
+			Pathname: "/",
+			FileInfo: objects.NewFileInfo("/", 0, os.ModeDir|0755, time.Now(), 0, 0, 0, 0, 1),
+			Children: []objects.FileInfo{file},
+		}
+	}()
+	return c, nil
+}
+
+func TestBackupScanErrors(t *testing.T) {
+	repo := newTestRepository(t)
+
+	backup := func(location string) (*Snapshot, error) {
+		snap, err := New(repo, repo.Checksum([]byte(uuid.NewString())))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = snap.Backup(location, &PushOptions{MaxConcurrency: 1})
+
+		imp, _ := scanErrorImporters.Load(location)
+		select {
+		case <-imp.(*scanErrorImporter).done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: the scan was not drained", location)
+		}
+		return snap, err
+	}
+
+	location := "scanerror://" + uuid.NewString()
+	snap, err := backup(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := snap.GetData(snap.Header.Errors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorsLog, err := errorslog.FromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := errorsLog.GetErrors()
+	if len(entries) != 1 || entries[0].Pathname != "/b" || entries[0].Error != "permission denied" {
+		t.Fatalf("expected the scan error on /b to be logged, got %+v", entries)
+	}
+
+	location = "scanerror://" + uuid.NewString() + "/abort"
+	if _, err := backup(location); err == nil || err.Error() != "root is unreadable" {
+		t.Fatalf("expected the backup to fail with the root error, got %v", err)
+	}
+}
+
+func TestBackupSkipsIncompressible(t *testing.T) {
+	sourceDir := t.TempDir()
+
+	random := make([]byte, 32<<10)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	text := []byte(strings.Repeat("plakar backs up this text file\n", 1000))
+	files := map[string][]byte{
+		"text.txt":   text,
+		"random.bin": random,
+		// the extension is enough, even if the content compresses
+		"photo.jpg": []byte(strings.Repeat("not really a picture\n", 1000)),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap := backupSnapshot(t, sourceDir)
+	fs, err := snap.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		entry, err := fs.Stat(filepath.ToSlash(filepath.Join(sourceDir, name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks := entry.(*vfs.FileEntry).Object.Chunks
+		if len(chunks) != 1 {
+			t.Fatalf("%s: expected a single chunk, got %d", name, len(chunks))
+		}
+
+		stored, exists := snap.repository.GetChunkLength(chunks[0].Checksum)
+		if !exists {
+			t.Fatalf("%s: chunk not found", name)
+		}
+		raw, err := snap.repository.EncodeUncompressed(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uncompressed := stored == uint32(len(raw))
+		if expected := name != "text.txt"; uncompressed != expected {
+			t.Errorf("%s: expected uncompressed=%v, stored %d bytes for %d", name, expected, stored, len(content))
+		}
+
+		data, err := snap.repository.GetChunks([]objects.Checksum{chunks[0].Checksum})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data[chunks[0].Checksum], content) {
+			t.Errorf("%s: the chunk does not read back", name)
+		}
+	}
+}
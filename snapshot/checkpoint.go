@@ -0,0 +1,118 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository/state"
+)
+
+// checkpointInterval is the minimum delay between two checkpoints of a
+// backup in progress.
+var checkpointInterval = time.Minute
+
+// checkpointPath returns the location of the checkpoint for a backup of
+// directory from origin, so that an interrupted backup finds it back when
+// it is restarted.
+func (snap *Snapshot) checkpointPath(origin string, directory string) string {
+	key := snap.repository.Checksum([]byte(origin + ":" + directory))
+	return filepath.Join(snap.repository.Context().GetCacheDir(), "resume",
+		snap.repository.Configuration().RepositoryID.String(), fmt.Sprintf("%x", key))
+}
+
+// resumeCheckpoint loads the state recorded by an interrupted backup: the
+// packfiles it references were fully written, so their content is known to
+// the repository and will not be uploaded again, and the new snapshot will
+// commit a state that references them.
+func (snap *Snapshot) resumeCheckpoint() error {
+	data, err := os.ReadFile(snap.checkpoint)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Info("no interrupted backup to resume")
+			return nil
+		}
+		return err
+	}
+
+	st, err := state.NewFromBytes(data)
+	if err != nil {
+		return fmt.Errorf("invalid checkpoint %s: %w", snap.checkpoint, err)
+	}
+
+	// the packfiles of an interrupted backup are not referenced by any
+	// snapshot and may have been removed by fsck -repair since.
+	packfiles, err := snap.repository.GetPackfiles()
+	if err != nil {
+		return err
+	}
+	present := make(map[objects.Checksum]struct{}, len(packfiles))
+	for _, checksum := range packfiles {
+		present[checksum] = struct{}{}
+	}
+	missing := 0
+	for checksum := range st.ListPackfiles() {
+		if _, found := present[checksum]; !found {
+			missing++
+		}
+	}
+	if missing != 0 {
+		logger.Warn("%d packfiles of the interrupted backup are gone, not resuming", missing)
+		return nil
+	}
+
+	snap.muStateDelta.Lock()
+	snap.stateDelta.Merge(snap.Header.SnapshotID, st)
+	snap.muStateDelta.Unlock()
+	snap.repository.MergeState(st)
+	return nil
+}
+
+// saveCheckpoint persists the state delta of the backup if the last
+// checkpoint is old enough, it must be called with muStateDelta held.
+func (snap *Snapshot) saveCheckpoint() {
+	if snap.checkpoint == "" || time.Since(snap.lastCheckpoint) < checkpointInterval {
+		return
+	}
+
+	t0 := time.Now()
+	defer func() {
+		logger.Trace("snapshot", "%x: saveCheckpoint(): %s", snap.Header.GetIndexShortID(), time.Since(t0))
+	}()
+
+	data, err := snap.stateDelta.Serialize()
+	if err != nil {
+		logger.Warn("could not serialize checkpoint: %s", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(snap.checkpoint), 0700); err != nil {
+		logger.Warn("could not save checkpoint: %s", err)
+		return
+	}
+
+	tmp := snap.checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		logger.Warn("could not save checkpoint: %s", err)
+		return
+	}
+	if err := os.Rename(tmp, snap.checkpoint); err != nil {
+		os.Remove(tmp)
+		logger.Warn("could not save checkpoint: %s", err)
+		return
+	}
+	snap.lastCheckpoint = time.Now()
+}
+
+// discardCheckpoint removes the checkpoint once the backup is committed.
+func (snap *Snapshot) discardCheckpoint() {
+	if snap.checkpoint == "" {
+		return
+	}
+	if err := os.Remove(snap.checkpoint); err != nil && !os.IsNotExist(err) {
+		logger.Warn("could not remove checkpoint: %s", err)
+	}
+}
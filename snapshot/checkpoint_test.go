@@ -0,0 +1,104 @@
+package snapshot
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/google/uuid"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/importer/fs"
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestResumeInterruptedBackup(t *testing.T) {
+	savedInterval := checkpointInterval
+	checkpointInterval = 0
+	defer func() { checkpointInterval = savedInterval }()
+
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// small enough to fit in a single chunk
+	content := []byte(strings.Repeat("resume me\n", 100))
+	if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := storage.NewConfiguration()
+	configuration.Compression = nil
+	configuration.Encryption = nil
+	store := newTestStore(t, filepath.Join(tmpDir, "repo"), configuration)
+	repo := openRepository(t, store)
+
+	imp, err := importer.NewImporter(sourceDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := imp.Origin()
+	imp.Close()
+
+	// first run: the chunk of the file makes it to a packfile, then the
+	// backup is interrupted before it is committed.
+	interrupted, err := New(repo, repo.Checksum([]byte(uuid.NewString())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	interrupted.checkpoint = interrupted.checkpointPath(origin, filepath.ToSlash(sourceDir))
+	chunkChecksum := repo.Checksum(content)
+	if err := interrupted.PutChunk(chunkChecksum, content); err != nil {
+		t.Fatal(err)
+	}
+	close(interrupted.packerChan)
+	<-interrupted.packerChanDone
+
+	if _, err := os.Stat(interrupted.checkpoint); err != nil {
+		t.Fatalf("expected a checkpoint to be saved: %v", err)
+	}
+
+	// the process restarts, nothing was committed
+	repo = openRepository(t, store)
+	if repo.ChunkExists(chunkChecksum) {
+		t.Fatal("uncommitted chunk should not be known to the repository")
+	}
+
+	snapshotID := repo.Checksum([]byte(uuid.NewString()))
+	resumed, err := New(repo, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resumed.Backup(sourceDir, &PushOptions{MaxConcurrency: 1, Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.statistics.ChunksTransferCount != 0 {
+		t.Errorf("expected no chunk to be uploaded again, got %d", resumed.statistics.ChunksTransferCount)
+	}
+	if _, err := os.Stat(interrupted.checkpoint); !os.IsNotExist(err) {
+		t.Errorf("expected the checkpoint to be removed after commit, got %v", err)
+	}
+
+	// the committed state must reference the packfile written by the
+	// interrupted run.
+	repo = openRepository(t, store)
+	snap, err := Load(repo, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd, err := snap.NewReader(filepath.ToSlash(filepath.Join(sourceDir, "file.txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(content) {
+		t.Fatalf("unexpected content after resume: %q", data)
+	}
+}
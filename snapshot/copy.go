@@ -0,0 +1,188 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+type CopyReport struct {
+	Packfiles int    // packfiles written to the destination
+	States    int    // states written to the destination
+	Skipped   int    // packfiles and states the destination already held
+	Bytes     uint64 // bytes written to the destination
+}
+
+// Copy replicates the repository to the destination store, which must
+// share its configuration. Packfiles and states the destination already
+// holds are not copied again.
+//
+// If snapshotIDs is not empty, only the packfiles these snapshots
+// reference are copied, along with a new state locating their blobs.
+func Copy(repo *repository.Repository, dst *storage.Store, snapshotIDs []objects.Checksum) (*CopyReport, error) {
+	report := &CopyReport{}
+
+	present, err := storeObjects(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	var packfiles []objects.Checksum
+	if len(snapshotIDs) == 0 {
+		packfiles, err = repo.GetPackfiles()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		packfiles, err = referencedPackfiles(repo, snapshotIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// packfiles go first so that a state is never copied before the blobs
+	// it locates.
+	for _, checksum := range packfiles {
+		if _, exists := present[checksum]; exists {
+			report.Skipped++
+			continue
+		}
+		rd, size, err := repo.GetPackfile(checksum)
+		if err != nil {
+			return report, fmt.Errorf("packfile %x: %w", checksum, err)
+		}
+		if err := dst.PutPackfile(checksum, rd, size); err != nil {
+			return report, fmt.Errorf("packfile %x: %w", checksum, err)
+		}
+		report.Packfiles++
+		report.Bytes += size
+	}
+
+	if len(snapshotIDs) == 0 {
+		states, err := repo.GetStates()
+		if err != nil {
+			return report, err
+		}
+		for _, checksum := range states {
+			if _, exists := present[checksum]; exists {
+				report.Skipped++
+				continue
+			}
+			rd, size, err := repo.Store().GetState(checksum)
+			if err != nil {
+				return report, fmt.Errorf("state %x: %w", checksum, err)
+			}
+			if err := dst.PutState(checksum, rd, size); err != nil {
+				return report, fmt.Errorf("state %x: %w", checksum, err)
+			}
+			report.States++
+			report.Bytes += size
+		}
+		return report, nil
+	}
+
+	// the states of the repository locate blobs of all snapshots, write
+	// one limited to the copied packfiles and snapshots instead.
+	selected := make(map[objects.Checksum]struct{}, len(packfiles))
+	for _, checksum := range packfiles {
+		selected[checksum] = struct{}{}
+	}
+	st := repo.StateSubset(selected)
+
+	wanted := make(map[objects.Checksum]struct{}, len(snapshotIDs))
+	for _, snapshotID := range snapshotIDs {
+		wanted[snapshotID] = struct{}{}
+	}
+	for snapshotID := range st.ListSnapshots() {
+		if _, found := wanted[snapshotID]; !found {
+			st.ForgetSnapshot(snapshotID)
+		}
+	}
+
+	serialized, err := st.Serialize()
+	if err != nil {
+		return report, err
+	}
+	stateID := repo.Checksum(serialized)
+	if _, exists := present[stateID]; exists {
+		report.Skipped++
+		return report, nil
+	}
+	encoded, err := repo.Encode(serialized)
+	if err != nil {
+		return report, err
+	}
+	if err := dst.PutState(stateID, bytes.NewReader(encoded), uint64(len(encoded))); err != nil {
+		return report, fmt.Errorf("state %x: %w", stateID, err)
+	}
+	report.States++
+	report.Bytes += uint64(len(encoded))
+	return report, nil
+}
+
+// storeObjects returns the packfiles and states held by the store.
+func storeObjects(store *storage.Store) (map[objects.Checksum]struct{}, error) {
+	packfiles, err := store.GetPackfiles()
+	if err != nil {
+		return nil, err
+	}
+	states, err := store.GetStates()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[objects.Checksum]struct{}, len(packfiles)+len(states))
+	for _, checksum := range packfiles {
+		ret[checksum] = struct{}{}
+	}
+	for _, checksum := range states {
+		ret[checksum] = struct{}{}
+	}
+	return ret, nil
+}
+
+// referencedPackfiles returns the packfiles holding the blobs reachable
+// from the given snapshots.
+func referencedPackfiles(repo *repository.Repository, snapshotIDs []objects.Checksum) ([]objects.Checksum, error) {
+	live := make(map[objects.Checksum]struct{})
+	var missing error
+	mark := func(ref Reference) bool {
+		packfileChecksum, exists := repo.GetPackfileForBlob(ref.Type, ref.Checksum)
+		if !exists {
+			missing = fmt.Errorf("%s is missing from the state", ref)
+			return false
+		}
+		live[packfileChecksum] = struct{}{}
+		return true
+	}
+
+	for _, snapshotID := range snapshotIDs {
+		mark(Reference{Type: packfile.TYPE_SNAPSHOT, Checksum: snapshotID})
+		if missing != nil {
+			return nil, fmt.Errorf("snapshot %x: %w", snapshotID, missing)
+		}
+		snap, err := Load(repo, snapshotID)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %x: %w", snapshotID, err)
+		}
+		if err := snap.References(mark); err != nil {
+			return nil, fmt.Errorf("snapshot %x: %w", snapshotID, err)
+		}
+		if missing != nil {
+			return nil, fmt.Errorf("snapshot %x: %w", snapshotID, missing)
+		}
+	}
+
+	ret := make([]objects.Checksum, 0, len(live))
+	for checksum := range live {
+		ret = append(ret, checksum)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return bytes.Compare(ret[i][:], ret[j][:]) < 0
+	})
+	return ret, nil
+}
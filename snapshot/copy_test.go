@@ -0,0 +1,106 @@
+package snapshot
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/google/uuid"
+
+	_ "github.com/PlakarKorp/plakar/storage/backends/memory"
+)
+
+func TestCopy(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newStore := func(name string, configuration *storage.Configuration) *storage.Store {
+		return newTestStore(t, "memory://"+name+"-"+uuid.NewString(), configuration)
+	}
+	src := newStore("src", nil)
+	configuration := src.Configuration()
+
+	contents := map[string][]byte{
+		"first":  []byte("content of the first snapshot"),
+		"second": []byte("content of the second snapshot"),
+	}
+	snapshotIDs := make(map[string]objects.Checksum)
+	for _, name := range []string{"first", "second"} {
+		sourceDir := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(sourceDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), contents[name], 0644); err != nil {
+			t.Fatal(err)
+		}
+		snapshotIDs[name] = backupTo(t, openRepository(t, src), sourceDir, nil).Header.SnapshotID
+	}
+
+	srcRepo := openRepository(t, src)
+
+	// verify opens the copy and checks that it holds exactly the given
+	// snapshots, intact.
+	verify := func(dst *storage.Store, names ...string) {
+		t.Helper()
+		dstRepo := openRepository(t, dst)
+		listed, err := dstRepo.GetSnapshots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listed) != len(names) {
+			t.Fatalf("expected %d snapshots, got %d", len(names), len(listed))
+		}
+		for _, name := range names {
+			snap, err := Load(dstRepo, snapshotIDs[name])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := snap.Check("/", &CheckOptions{MaxConcurrency: 1}); err != nil || !ok {
+				t.Fatalf("snapshot %s failed its check: %v", name, err)
+			}
+			rd, err := snap.NewReader(filepath.ToSlash(filepath.Join(tmpDir, name, "file.txt")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(rd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, contents[name]) {
+				t.Fatalf("unexpected content %q", data)
+			}
+		}
+	}
+
+	dst := newStore("dst", &configuration)
+	report, err := Copy(srcRepo, dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Packfiles == 0 || report.States == 0 || report.Skipped != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	verify(dst, "first", "second")
+
+	// everything is present already
+	again, err := Copy(srcRepo, dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Packfiles != 0 || again.States != 0 || again.Skipped != report.Packfiles+report.States {
+		t.Fatalf("unexpected report %+v", again)
+	}
+
+	partial := newStore("partial", &configuration)
+	report, err = Copy(srcRepo, partial, []objects.Checksum{snapshotIDs["second"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.States != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	verify(partial, "second")
+}
@@ -1,14 +1,26 @@
 package errorslog
 
-import "github.com/vmihailenco/msgpack/v5"
+import (
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
 
 type ErrorLogEntry struct {
-	Pathname string `msgpack:"pathname", json:"pathname"`
-	Error    string `msgpack:"error", json:"error"`
+	Pathname string `msgpack:"pathname" json:"pathname"`
+	Error    string `msgpack:"error" json:"error"`
 }
 
 type ErrorsLog struct {
-	Errors []ErrorLogEntry `msgpack:"errors", json:"errors"`
+	Errors []ErrorLogEntry `msgpack:"errors" json:"errors"`
+}
+
+// Summary aggregates the entries of an errors log so that a large number
+// of similar errors can be reported at once.
+type Summary struct {
+	Count   uint64
+	Classes map[string]uint64
+	Paths   []string
 }
 
 func NewErrorsLog() *ErrorsLog {
@@ -23,6 +35,30 @@ func (e *ErrorsLog) GetErrors() []ErrorLogEntry {
 	return e.Errors
 }
 
+// Summary counts the errors by class and keeps the first maxPaths
+// pathnames in the order they were logged.
+func (e *ErrorsLog) Summary(maxPaths int) Summary {
+	summary := Summary{Classes: make(map[string]uint64)}
+	for _, entry := range e.Errors {
+		summary.Count++
+		summary.Classes[ErrorClass(entry.Error)]++
+		if len(summary.Paths) < maxPaths {
+			summary.Paths = append(summary.Paths, entry.Pathname)
+		}
+	}
+	return summary
+}
+
+// ErrorClass strips the context from an error message, so that errors
+// such as "open /etc/shadow: permission denied" are grouped by their
+// cause rather than by the path they relate to.
+func ErrorClass(errmsg string) string {
+	if idx := strings.LastIndex(errmsg, ": "); idx != -1 {
+		errmsg = errmsg[idx+2:]
+	}
+	return errmsg
+}
+
 func (e *ErrorsLog) Serialize() ([]byte, error) {
 	return msgpack.Marshal(e)
 }
@@ -0,0 +1,41 @@
+package errorslog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	log := NewErrorsLog()
+	log.Append("/etc/shadow", "open /etc/shadow: permission denied")
+	log.Append("/etc/ssl/private", "open /etc/ssl/private: permission denied")
+	log.Append("/var/run/app.sock", "lstat /var/run/app.sock: no such file or directory")
+	log.Append("/root", "open /root: permission denied")
+	log.Append("/weird", "something went wrong")
+
+	summary := log.Summary(2)
+	if summary.Count != 5 {
+		t.Errorf("expected 5 errors, got %d", summary.Count)
+	}
+
+	expectedClasses := map[string]uint64{
+		"permission denied":         3,
+		"no such file or directory": 1,
+		"something went wrong":      1,
+	}
+	if !reflect.DeepEqual(summary.Classes, expectedClasses) {
+		t.Errorf("expected classes %v, got %v", expectedClasses, summary.Classes)
+	}
+
+	expectedPaths := []string{"/etc/shadow", "/etc/ssl/private"}
+	if !reflect.DeepEqual(summary.Paths, expectedPaths) {
+		t.Errorf("expected paths %v, got %v", expectedPaths, summary.Paths)
+	}
+}
+
+func TestSummaryEmpty(t *testing.T) {
+	summary := NewErrorsLog().Summary(10)
+	if summary.Count != 0 || len(summary.Classes) != 0 || len(summary.Paths) != 0 {
+		t.Errorf("expected an empty summary, got %+v", summary)
+	}
+}
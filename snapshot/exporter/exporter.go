@@ -17,7 +17,9 @@ import (
 type ExporterBackend interface {
 	Root() string
 	CreateDirectory(pathname string) error
-	StoreFile(pathname string, fp io.Reader) error
+	// StoreFile writes the content of a file, holes lists the ranges
+	// of a sparse file that were unallocated when it was backed up.
+	StoreFile(pathname string, fp io.Reader, holes []objects.Extent) error
 	SetPermissions(pathname string, fileinfo *objects.FileInfo) error
 	Close() error
 }
@@ -105,14 +107,14 @@ func (exporter *Exporter) CreateDirectory(pathname string) error {
 	return exporter.backend.CreateDirectory(pathname)
 }
 
-func (exporter *Exporter) StoreFile(pathname string, fp io.Reader) error {
+func (exporter *Exporter) StoreFile(pathname string, fp io.Reader, holes []objects.Extent) error {
 	t0 := time.Now()
 	defer func() {
 		profiler.RecordEvent("vfs.exporter.StoreFile", time.Since(t0))
 		logger.Trace("vfs", "exporter.StoreFile(%s): %s", pathname, time.Since(t0))
 	}()
 
-	return exporter.backend.StoreFile(pathname, fp)
+	return exporter.backend.StoreFile(pathname, fp, holes)
 }
 
 func (exporter *Exporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
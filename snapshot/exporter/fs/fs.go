@@ -17,9 +17,13 @@
 package fs
 
 import (
+	"bytes"
 	"io"
 	"os"
+	"os/user"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/PlakarKorp/plakar/logger"
 	"github.com/PlakarKorp/plakar/objects"
@@ -61,13 +65,13 @@ func (p *FSExporter) CreateDirectory(pathname string) error {
 	return os.MkdirAll(pathname, 0700)
 }
 
-func (p *FSExporter) StoreFile(pathname string, fp io.Reader) error {
+func (p *FSExporter) StoreFile(pathname string, fp io.Reader, holes []objects.Extent) error {
 	f, err := os.Create(pathname)
 	if err != nil {
 		return err
 	}
 
-	if _, err := io.Copy(f, fp); err != nil {
+	if err := storeSparse(f, fp, holes); err != nil {
 		logger.Warn("copy failure: %s: %s", pathname, err)
 		f.Close()
 		return err
@@ -81,16 +85,102 @@ func (p *FSExporter) StoreFile(pathname string, fp io.Reader) error {
 	return nil
 }
 
-func (p *FSExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
-	if err := os.Chmod(pathname, fileinfo.Mode()); err != nil {
+// storeSparse copies fp to f, seeking over the holes rather than writing
+// zeros so that the filesystem doesn't allocate them. A hole is only
+// skipped where the content is still made of zeros, the file may have
+// been written to between the scan and the backup of its content.
+func storeSparse(f *os.File, fp io.Reader, holes []objects.Extent) error {
+	if len(holes) == 0 {
+		_, err := io.Copy(f, fp)
+		return err
+	}
+
+	buf := make([]byte, 64*1024)
+	offset := int64(0)
+	for _, hole := range holes {
+		if hole.Offset < offset {
+			continue
+		}
+		n, err := io.CopyN(f, fp, hole.Offset-offset)
+		offset += n
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		for remaining := hole.Length; remaining > 0; {
+			n, readErr := io.ReadFull(fp, buf[:min(remaining, int64(len(buf)))])
+			if n > 0 {
+				var err error
+				if bytes.Count(buf[:n], []byte{0}) == n {
+					_, err = f.Seek(int64(n), io.SeekCurrent)
+				} else {
+					_, err = f.Write(buf[:n])
+				}
+				if err != nil {
+					return err
+				}
+			}
+			offset += int64(n)
+			remaining -= int64(n)
+			if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+				break
+			} else if readErr != nil {
+				return readErr
+			}
+		}
+	}
+
+	n, err := io.Copy(f, fp)
+	if err != nil {
 		return err
 	}
+	offset += n
+
+	// seeking past the end doesn't extend the file, a trailing hole
+	// needs it to be truncated to its size
+	return f.Truncate(offset)
+}
+
+func (p *FSExporter) SetPermissions(pathname string, fileinfo *objects.FileInfo) error {
+	// chown clears the setuid and setgid bits, it has to come first
 	if os.Getuid() == 0 {
-		if err := os.Chown(pathname, int(fileinfo.Uid()), int(fileinfo.Gid())); err != nil {
+		uid, gid := lookupOwner(fileinfo)
+		if err := os.Chown(pathname, uid, gid); err != nil {
 			return err
 		}
 	}
-	return nil
+	if err := os.Chmod(pathname, fileinfo.Mode()); err != nil {
+		return err
+	}
+	// last, as writing to a directory updates its mtime
+	return os.Chtimes(pathname, time.Time{}, fileinfo.ModTime())
+}
+
+// lookupOwner returns the local ids of the user and group owning a file.
+// Numeric ids differ from one machine to another, so the names recorded
+// at backup time are preferred, falling back to the recorded ids when
+// the names are unknown here.
+func lookupOwner(fileinfo *objects.FileInfo) (int, int) {
+	uid := int(fileinfo.Uid())
+	if fileinfo.Username() != "" {
+		if u, err := user.Lookup(fileinfo.Username()); err == nil {
+			if id, err := strconv.Atoi(u.Uid); err == nil {
+				uid = id
+			}
+		}
+	}
+
+	gid := int(fileinfo.Gid())
+	if fileinfo.Groupname() != "" {
+		if g, err := user.LookupGroup(fileinfo.Groupname()); err == nil {
+			if id, err := strconv.Atoi(g.Gid); err == nil {
+				gid = id
+			}
+		}
+	}
+	return uid, gid
 }
 
 func (p *FSExporter) Close() error {
@@ -0,0 +1,43 @@
+package fs
+
+import (
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+func TestLookupOwner(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Skip(err)
+	}
+	uid, err := strconv.Atoi(current.Uid)
+	if err != nil {
+		t.Skip("numeric ids are not supported")
+	}
+	gid, _ := strconv.Atoi(current.Gid)
+
+	// names known locally take precedence over the recorded ids
+	fileinfo := objects.FileInfo{Luid: 4242, Lgid: 4343, Lusername: current.Username, Lgroupname: group.Name}
+	if u, g := lookupOwner(&fileinfo); u != uid || g != gid {
+		t.Errorf("expected %d:%d, got %d:%d", uid, gid, u, g)
+	}
+
+	// unknown names fall back to the recorded ids
+	fileinfo = objects.FileInfo{Luid: 4242, Lgid: 4343, Lusername: "plakar-no-such-user", Lgroupname: "plakar-no-such-group"}
+	if u, g := lookupOwner(&fileinfo); u != 4242 || g != 4343 {
+		t.Errorf("expected 4242:4343, got %d:%d", u, g)
+	}
+
+	// as do entries recorded without names
+	fileinfo = objects.FileInfo{Luid: 4242, Lgid: 4343}
+	if u, g := lookupOwner(&fileinfo); u != 4242 || g != 4343 {
+		t.Errorf("expected 4242:4343, got %d:%d", u, g)
+	}
+}
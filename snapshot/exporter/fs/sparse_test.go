@@ -0,0 +1,80 @@
+//go:build linux || darwin || freebsd
+
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+func allocated(t *testing.T, pathname string) int64 {
+	info, err := os.Stat(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
+func TestStoreSparse(t *testing.T) {
+	const size = 8 << 20
+	content := make([]byte, size)
+	copy(content, "head")
+	copy(content[4<<20:], "middle")
+	holes := []objects.Extent{
+		{Offset: 1 << 20, Length: 2 << 20},
+		{Offset: 5 << 20, Length: 3 << 20},
+	}
+
+	pathname := filepath.Join(t.TempDir(), "sparse")
+	f, err := os.Create(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeSparse(f, bytes.NewReader(content), holes); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	restored, err := os.ReadFile(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, content) {
+		t.Fatal("restored content differs")
+	}
+	if allocated(t, pathname) >= size {
+		t.Skip("filesystem doesn't support sparse files")
+	}
+	if a := allocated(t, pathname); a > 3<<20+64*1024 {
+		t.Errorf("expected the holes to be left unallocated, %d bytes allocated", a)
+	}
+}
+
+func TestStoreSparseDataInHole(t *testing.T) {
+	// the file was written to after its holes were recorded
+	content := bytes.Repeat([]byte{0}, 1<<20)
+	copy(content[512<<10:], "late write")
+
+	pathname := filepath.Join(t.TempDir(), "sparse")
+	f, err := os.Create(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeSparse(f, bytes.NewReader(content), []objects.Extent{{Offset: 0, Length: 1 << 20}}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	restored, err := os.ReadFile(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, content) {
+		t.Fatal("data written in a hole was lost")
+	}
+}
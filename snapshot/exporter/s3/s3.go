@@ -84,7 +84,7 @@ func (p *S3Exporter) CreateDirectory(pathname string) error {
 	return nil
 }
 
-func (p *S3Exporter) StoreFile(pathname string, fp io.Reader) error {
+func (p *S3Exporter) StoreFile(pathname string, fp io.Reader, holes []objects.Extent) error {
 	_, err := p.minioClient.PutObject(context.Background(),
 		strings.TrimPrefix(p.rootDir, "/"),
 		strings.TrimPrefix(pathname, p.rootDir+"/"),
@@ -1,6 +1,12 @@
 package snapshot
 
 import (
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
 )
 
@@ -14,3 +20,209 @@ func (s *Snapshot) Filesystem() (*vfs.Filesystem, error) {
 		return fs, nil
 	}
 }
+
+// AsFS returns the snapshot as an io/fs filesystem, so that it can be
+// handed to fs.WalkDir, http.FS or template.ParseFS. Names are pathnames
+// in the snapshot without their leading slash, and opening a symlink
+// opens its target.
+func (s *Snapshot) AsFS() fs.FS {
+	return &snapshotFS{snapshot: s}
+}
+
+type snapshotFS struct {
+	snapshot *Snapshot
+}
+
+// lookup returns the entry named name, following symlinks, along with
+// its pathname in the snapshot.
+func (sfs *snapshotFS) lookup(op string, name string) (vfs.FSEntry, string, error) {
+	if !fs.ValidPath(name) {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	pathname := "/" + name
+	if name == "." {
+		pathname = "/"
+	}
+
+	fsc, err := sfs.snapshot.Filesystem()
+	if err != nil {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	pathname, err = fsc.ResolvePath(pathname)
+	if err != nil {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	entry, err := fsc.Stat(pathname)
+	if err != nil {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entry, pathname, nil
+}
+
+func (sfs *snapshotFS) Open(name string) (fs.File, error) {
+	entry, pathname, err := sfs.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch entry := entry.(type) {
+	case *vfs.DirEntry:
+		return &snapshotDir{fs: sfs, name: name, pathname: pathname, entry: entry}, nil
+	case *vfs.FileEntry:
+		return &snapshotFile{fs: sfs, name: name, pathname: pathname, entry: entry}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+}
+
+func (sfs *snapshotFS) Stat(name string) (fs.FileInfo, error) {
+	entry, _, err := sfs.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entryInfo(name, entry), nil
+}
+
+func (sfs *snapshotFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, pathname, err := sfs.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, isDir := entry.(*vfs.DirEntry); !isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return sfs.readDir(name, pathname)
+}
+
+func (sfs *snapshotFS) readDir(name string, pathname string) ([]fs.DirEntry, error) {
+	fsc, err := sfs.snapshot.Filesystem()
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	children, err := fsc.ChildrenInfo(pathname)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	ret := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		ret = append(ret, fs.FileInfoToDirEntry(child))
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name() < ret[j].Name()
+	})
+	return ret, nil
+}
+
+func (sfs *snapshotFS) ReadFile(name string) ([]byte, error) {
+	file, err := sfs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// entryInfo returns the FileInfo of entry, named as it was opened: the
+// root of the snapshot is "." and a symlink keeps its own name.
+func entryInfo(name string, entry vfs.FSEntry) fs.FileInfo {
+	var fileinfo objects.FileInfo
+	switch entry := entry.(type) {
+	case *vfs.DirEntry:
+		fileinfo = *entry.Stat()
+	case *vfs.FileEntry:
+		fileinfo = *entry.Stat()
+	}
+	fileinfo.Lname = path.Base(name)
+	return fileinfo
+}
+
+type snapshotFile struct {
+	fs       *snapshotFS
+	name     string
+	pathname string
+	entry    *vfs.FileEntry
+	reader   *Reader
+}
+
+func (file *snapshotFile) Stat() (fs.FileInfo, error) {
+	return entryInfo(file.name, file.entry), nil
+}
+
+func (file *snapshotFile) open(op string) error {
+	if file.reader != nil {
+		return nil
+	}
+	if !file.entry.Stat().Mode().IsRegular() {
+		return &fs.PathError{Op: op, Path: file.name, Err: fs.ErrInvalid}
+	}
+	reader, err := file.fs.snapshot.NewReader(file.pathname)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: file.name, Err: err}
+	}
+	file.reader = reader
+	return nil
+}
+
+func (file *snapshotFile) Read(buf []byte) (int, error) {
+	if err := file.open("read"); err != nil {
+		return 0, err
+	}
+	return file.reader.Read(buf)
+}
+
+func (file *snapshotFile) Seek(offset int64, whence int) (int64, error) {
+	if err := file.open("seek"); err != nil {
+		return 0, err
+	}
+	return file.reader.Seek(offset, whence)
+}
+
+func (file *snapshotFile) Close() error {
+	if file.reader != nil {
+		return file.reader.Close()
+	}
+	return nil
+}
+
+type snapshotDir struct {
+	fs       *snapshotFS
+	name     string
+	pathname string
+	entry    *vfs.DirEntry
+	children []fs.DirEntry
+	offset   int
+}
+
+func (dir *snapshotDir) Stat() (fs.FileInfo, error) {
+	return entryInfo(dir.name, dir.entry), nil
+}
+
+func (dir *snapshotDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: dir.name, Err: fs.ErrInvalid}
+}
+
+func (dir *snapshotDir) Close() error {
+	return nil
+}
+
+func (dir *snapshotDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if dir.children == nil {
+		children, err := dir.fs.readDir(dir.name, dir.pathname)
+		if err != nil {
+			return nil, err
+		}
+		dir.children = children
+	}
+
+	remaining := dir.children[dir.offset:]
+	if n <= 0 {
+		dir.offset = len(dir.children)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(remaining))
+	dir.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,363 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/PlakarKorp/plakar/encryption/keypair"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/google/uuid"
+)
+
+func TestLookupOwner(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("owned"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := backupTo(t, newTestRepository(t), sourceDir, nil).Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pathname := range []string{sourceDir, filepath.Join(sourceDir, "file.txt")} {
+		username, groupname, err := fs.LookupOwner(filepath.ToSlash(pathname))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username != current.Username || groupname != group.Name {
+			t.Errorf("%s: expected %s:%s, got %s:%s", pathname, current.Username, group.Name, username, groupname)
+		}
+	}
+
+	if _, _, err := fs.LookupOwner("/no/such/file"); err == nil {
+		t.Error("expected an error for a missing pathname")
+	}
+}
+
+func TestWalkSorted(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	for _, name := range []string{"b/z", "b/a", "a", "c/d/e", "c/d/b", "c/a", "B"} {
+		pathname := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pathname, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := backupTo(t, newTestRepository(t), sourceDir, &PushOptions{MaxConcurrency: 4}).Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.ToSlash(sourceDir)
+	walk := func(skip string) []string {
+		t.Helper()
+		ret := make([]string, 0)
+		err := fs.WalkSorted(root, func(pathname string, fileinfo *objects.FileInfo) error {
+			ret = append(ret, strings.TrimPrefix(pathname, root))
+			if skip != "" && pathname == root+skip {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+
+	expected := []string{"", "/B", "/a", "/b", "/b/a", "/b/z", "/c", "/c/a", "/c/d", "/c/d/b", "/c/d/e"}
+	for i := 0; i < 5; i++ {
+		if walked := walk(""); !slices.Equal(walked, expected) {
+			t.Fatalf("expected %v, got %v", expected, walked)
+		}
+	}
+
+	// skipping a directory prunes it, skipping a file the rest of its
+	// directory
+	skipped := []string{"", "/B", "/a", "/b", "/c", "/c/a", "/c/d", "/c/d/b", "/c/d/e"}
+	if walked := walk("/b"); !slices.Equal(walked, skipped) {
+		t.Fatalf("expected %v, got %v", skipped, walked)
+	}
+	skipped = []string{"", "/B", "/a", "/b", "/b/a", "/c", "/c/a", "/c/d", "/c/d/b", "/c/d/e"}
+	if walked := walk("/b/a"); !slices.Equal(walked, skipped) {
+		t.Fatalf("expected %v, got %v", skipped, walked)
+	}
+}
+
+// backupFilesystem backs sourceDir up to a new repository and returns
+// the filesystem of the snapshot.
+func backupFilesystem(tb testing.TB, sourceDir string) *vfs.Filesystem {
+	fs, err := backupSnapshot(tb, sourceDir).Filesystem()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return fs
+}
+
+func backupSnapshot(tb testing.TB, sourceDir string) *Snapshot {
+	return backupSignedSnapshot(tb, sourceDir, nil)
+}
+
+// backupSignedSnapshot is backupSnapshot with the snapshot signed by kp,
+// if not nil.
+func backupSignedSnapshot(tb testing.TB, sourceDir string, kp *keypair.KeyPair) *Snapshot {
+	repo := newTestRepository(tb)
+	if kp != nil {
+		repo.Context().SetIdentity(uuid.New())
+		repo.Context().SetKeypair(kp)
+	}
+	return backupTo(tb, repo, sourceDir, &PushOptions{MaxConcurrency: 4})
+}
+
+func createFiles(tb testing.TB, dir string, n int) {
+	for i := 0; i < n; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file-%05d", i)), []byte(fmt.Sprint(i)), 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestChildrenInfo(t *testing.T) {
+	sourceDir := t.TempDir()
+	createFiles(t, sourceDir, 10)
+	if err := os.Mkdir(filepath.Join(sourceDir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fs := backupFilesystem(t, sourceDir)
+
+	root := filepath.ToSlash(sourceDir)
+	names, err := fs.Children(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos, err := fs.ChildrenInfo(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := 0
+	for name := range names {
+		if i >= len(infos) || infos[i].Name() != name {
+			t.Fatalf("child %d: expected %s", i, name)
+		}
+		entry, err := fs.Stat(root + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fileinfo *objects.FileInfo
+		switch entry := entry.(type) {
+		case *vfs.FileEntry:
+			fileinfo = entry.Stat()
+		case *vfs.DirEntry:
+			fileinfo = entry.Stat()
+		}
+		if fileinfo.Mode() != infos[i].Mode() || fileinfo.Size() != infos[i].Size() {
+			t.Fatalf("%s: expected %s %d, got %s %d", name, fileinfo.Mode(), fileinfo.Size(), infos[i].Mode(), infos[i].Size())
+		}
+		i++
+	}
+	if i != 11 || len(infos) != 11 {
+		t.Fatalf("expected 11 children, got %d and %d", i, len(infos))
+	}
+
+	if _, err := fs.ChildrenInfo(root + "/file-00000"); err == nil {
+		t.Fatal("expected an error for a file")
+	}
+}
+
+func BenchmarkChildren(b *testing.B) {
+	sourceDir := b.TempDir()
+	createFiles(b, sourceDir, 10000)
+	fs := backupFilesystem(b, sourceDir)
+	root := filepath.ToSlash(sourceDir)
+
+	b.Run("Stat", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			children, err := fs.Children(root)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for child := range children {
+				if _, err := fs.Stat(root + "/" + child); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("ChildrenInfo", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := fs.ChildrenInfo(root); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestResolvePath(t *testing.T) {
+	sourceDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(sourceDir, "real", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "real", "sub", "file"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"link":     "real",
+		"chained":  "link/sub",
+		"absolute": filepath.Join(sourceDir, "real"),
+		"parent":   "real/sub/../sub",
+		"loop1":    "loop2",
+		"loop2":    "loop1",
+		"dangling": "missing",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(sourceDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := backupFilesystem(t, sourceDir)
+
+	root := filepath.ToSlash(sourceDir)
+	for pathname, expected := range map[string]string{
+		"/real/sub/file":      "/real/sub/file",
+		"/link/sub/file":      "/real/sub/file",
+		"/chained/file":       "/real/sub/file",
+		"/chained":            "/real/sub",
+		"/absolute/sub/file":  "/real/sub/file",
+		"/parent/file":        "/real/sub/file",
+		"/link/../link/./sub": "/real/sub",
+	} {
+		resolved, err := fs.ResolvePath(root + pathname)
+		if err != nil {
+			t.Fatalf("%s: %v", pathname, err)
+		}
+		if resolved != root+expected {
+			t.Fatalf("%s: expected %s, got %s", pathname, root+expected, resolved)
+		}
+	}
+
+	entry, err := fs.StatResolved(root + "/chained/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileEntry, isFile := entry.(*vfs.FileEntry); !isFile || fileEntry.Stat().Size() != int64(len("content")) {
+		t.Fatalf("unexpected entry %#v", entry)
+	}
+
+	if _, err := fs.ResolvePath(root + "/loop1/file"); err == nil || !strings.Contains(err.Error(), "too many levels") {
+		t.Fatalf("expected the loop to be detected, got %v", err)
+	}
+	if _, err := fs.ResolvePath(root + "/dangling"); err == nil {
+		t.Fatal("expected an error for a dangling symlink")
+	}
+}
+
+func TestAsFS(t *testing.T) {
+	sourceDir := t.TempDir()
+	files := map[string]string{
+		"a.txt":         "first file",
+		"dir/b.txt":     "second file",
+		"dir/sub/c.txt": "third file",
+		"empty":         "",
+	}
+	for name, content := range files {
+		pathname := filepath.Join(sourceDir, name)
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pathname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapfs, err := iofs.Sub(backupSnapshot(t, sourceDir).AsFS(), strings.TrimPrefix(filepath.ToSlash(sourceDir), "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]string, 0, len(files))
+	for name := range files {
+		expected = append(expected, name)
+	}
+	if err := fstest.TestFS(snapfs, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	walked := make([]string, 0)
+	err = iofs.WalkDir(snapfs, ".", func(pathname string, entry iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, pathname)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	walkedExpected := []string{".", "a.txt", "dir", "dir/b.txt", "dir/sub", "dir/sub/c.txt", "empty"}
+	if !slices.Equal(walked, walkedExpected) {
+		t.Fatalf("expected %v, got %v", walkedExpected, walked)
+	}
+
+	for name, content := range files {
+		data, err := iofs.ReadFile(snapfs, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Fatalf("%s: expected %q, got %q", name, content, data)
+		}
+	}
+
+	if _, err := iofs.ReadFile(snapfs, "missing"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Fatalf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestFilesystemCached(t *testing.T) {
+	sourceDir := t.TempDir()
+	createFiles(t, sourceDir, 3)
+	snap := backupSnapshot(t, sourceDir)
+
+	fs1, err := snap.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(snap.Repository(), snap.Header.SnapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs2, err := loaded.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs1 != fs2 {
+		t.Fatal("expected the filesystem to be loaded once")
+	}
+}
@@ -0,0 +1,61 @@
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+)
+
+// Footprint is the storage taken by the chunks that a snapshot references
+// and another one doesn't, i.e. the data it added on top of it.
+type Footprint struct {
+	Chunks     uint64 `json:"chunks"`
+	StoredSize uint64 `json:"stored_size"` // compressed and encrypted
+}
+
+// chunks returns the set of the chunks referenced by the snapshot.
+func (snap *Snapshot) chunks() (map[objects.Checksum]struct{}, error) {
+	chunks := make(map[objects.Checksum]struct{})
+	err := snap.References(func(ref Reference) bool {
+		if ref.Type == packfile.TYPE_CHUNK {
+			chunks[ref.Checksum] = struct{}{}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// Footprint returns the chunks that snap references and base doesn't,
+// along with the size they take in the repository.  Chunks shared with
+// other snapshots than base are counted.  With a nil base all the chunks
+// of snap are.
+func (snap *Snapshot) Footprint(base *Snapshot) (*Footprint, error) {
+	chunks, err := snap.chunks()
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		baseChunks, err := base.chunks()
+		if err != nil {
+			return nil, err
+		}
+		for checksum := range baseChunks {
+			delete(chunks, checksum)
+		}
+	}
+
+	footprint := &Footprint{}
+	for checksum := range chunks {
+		length, exists := snap.repository.GetChunkLength(checksum)
+		if !exists {
+			return nil, fmt.Errorf("chunk %x: not found", checksum)
+		}
+		footprint.Chunks++
+		footprint.StoredSize += uint64(length)
+	}
+	return footprint, nil
+}
@@ -0,0 +1,71 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/google/uuid"
+)
+
+func TestFootprint(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := openRepository(t, newTestStore(t, "memory://footprint-"+uuid.NewString(), nil))
+
+	if err := os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte(strings.Repeat("a", 1000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first := backupTo(t, repo, sourceDir, nil)
+	if err := os.WriteFile(filepath.Join(sourceDir, "b.txt"), []byte(strings.Repeat("b", 2000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := backupTo(t, repo, sourceDir, nil)
+
+	fs, err := second.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := fs.Stat(filepath.ToSlash(filepath.Join(sourceDir, "b.txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := entry.(*vfs.FileEntry).Object.Chunks
+	if len(chunks) != 1 {
+		t.Fatalf("expected b.txt to be a single chunk, got %d", len(chunks))
+	}
+	length, exists := repo.GetChunkLength(chunks[0].Checksum)
+	if !exists || length == 0 {
+		t.Fatalf("expected the chunk of b.txt to be stored")
+	}
+
+	footprint, err := second.Footprint(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if footprint.Chunks != 1 || footprint.StoredSize != uint64(length) {
+		t.Fatalf("expected the chunk of b.txt only (1 chunk, %d bytes), got %+v", length, footprint)
+	}
+
+	footprint, err = first.Footprint(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if footprint.Chunks != 0 || footprint.StoredSize != 0 {
+		t.Fatalf("expected the first snapshot to add nothing, got %+v", footprint)
+	}
+
+	footprint, err = second.Footprint(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if footprint.Chunks != 2 || footprint.StoredSize <= uint64(length) {
+		t.Fatalf("expected both chunks to be counted, got %+v", footprint)
+	}
+}
@@ -0,0 +1,161 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/google/uuid"
+)
+
+// Reference is a blob of the repository reachable from a snapshot.
+type Reference struct {
+	Type     uint8
+	Checksum objects.Checksum
+}
+
+func (ref Reference) String() string {
+	return fmt.Sprintf("%s %x", packfile.Blob{Type: ref.Type}.TypeName(), ref.Checksum)
+}
+
+// References calls fn for every blob reachable from the snapshot header,
+// from its root directory down to the chunks of its files. The header
+// itself is not reported. fn returns false when the blob is not available,
+// in which case what it references is not walked.
+func (snap *Snapshot) References(fn func(Reference) bool) error {
+	if snap.Header.Identity.Identifier != uuid.Nil {
+		fn(Reference{Type: packfile.TYPE_SIGNATURE, Checksum: snap.Header.SnapshotID})
+	}
+
+	for _, checksum := range []objects.Checksum{snap.Header.Metadata, snap.Header.Statistics, snap.Header.Errors} {
+		if checksum != (objects.Checksum{}) {
+			fn(Reference{Type: packfile.TYPE_DATA, Checksum: checksum})
+		}
+	}
+
+	return snap.directoryReferences(snap.Header.Root, fn)
+}
+
+func (snap *Snapshot) directoryReferences(checksum objects.Checksum, fn func(Reference) bool) error {
+	if !fn(Reference{Type: packfile.TYPE_DIRECTORY, Checksum: checksum}) {
+		return nil
+	}
+
+	rd, _, err := snap.repository.GetDirectory(checksum)
+	if err != nil {
+		return err
+	}
+	blob, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	dirEntry, err := vfs.DirEntryFromBytes(blob)
+	if err != nil {
+		return fmt.Errorf("directory %x: %w", checksum, err)
+	}
+
+	for _, child := range dirEntry.Children {
+		if child.Stat().IsDir() {
+			err = snap.directoryReferences(child.Checksum(), fn)
+		} else {
+			err = snap.fileReferences(child.Checksum(), fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (snap *Snapshot) fileReferences(checksum objects.Checksum, fn func(Reference) bool) error {
+	if !fn(Reference{Type: packfile.TYPE_FILE, Checksum: checksum}) {
+		return nil
+	}
+
+	rd, _, err := snap.repository.GetFile(checksum)
+	if err != nil {
+		return err
+	}
+	blob, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	fileEntry, err := vfs.FileEntryFromBytes(blob)
+	if err != nil {
+		return fmt.Errorf("file %x: %w", checksum, err)
+	}
+	if fileEntry.Object == nil {
+		return nil
+	}
+
+	// the chunks are listed in the file entry, they don't depend on the
+	// object blob being available.
+	fn(Reference{Type: packfile.TYPE_OBJECT, Checksum: fileEntry.Object.Checksum})
+	for _, chunk := range fileEntry.Object.Chunks {
+		fn(Reference{Type: packfile.TYPE_CHUNK, Checksum: chunk.Checksum})
+	}
+	return nil
+}
+
+// DanglingReference is a reference of a snapshot to a blob that the state
+// doesn't know about, or that is located in a missing packfile.
+type DanglingReference struct {
+	SnapshotID objects.Checksum
+	Reference
+	Packfile objects.Checksum // zero if the blob is unknown to the state
+}
+
+type FsckReport struct {
+	Snapshots int
+	Dangling  []DanglingReference
+	Orphans   []objects.Checksum // packfiles known to the state that no snapshot references
+}
+
+// Fsck walks all snapshots of the repository and reports the blobs they
+// reference that are missing, as well as the packfiles they don't use.
+// Like UnreferencedPackfiles, it leaves out the packfiles unknown to the
+// state, which may belong to a backup in progress.
+func Fsck(repo *repository.Repository) (*FsckReport, error) {
+	packfiles, err := repo.GetPackfiles()
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[objects.Checksum]struct{}, len(packfiles))
+	for _, checksum := range packfiles {
+		present[checksum] = struct{}{}
+	}
+
+	snapshotIDs, err := repo.GetSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(snapshotIDs, func(i, j int) bool {
+		return bytes.Compare(snapshotIDs[i][:], snapshotIDs[j][:]) < 0
+	})
+
+	report := &FsckReport{Snapshots: len(snapshotIDs)}
+	live, err := walkReferences(repo, snapshotIDs, func(snapshotID objects.Checksum, ref Reference, packfileChecksum objects.Checksum, exists bool) bool {
+		if exists {
+			if _, found := present[packfileChecksum]; found {
+				return true
+			}
+		}
+		report.Dangling = append(report.Dangling, DanglingReference{
+			SnapshotID: snapshotID,
+			Reference:  ref,
+			Packfile:   packfileChecksum,
+		})
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Orphans = unreferencedPackfiles(repo, packfiles, live)
+	return report, nil
+}
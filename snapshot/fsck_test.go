@@ -0,0 +1,115 @@
+package snapshot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+)
+
+func TestFsck(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("referenced content")
+	if err := os.WriteFile(filepath.Join(sourceDir, "sub", "file.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newTestRepository(t)
+	snapshotID := backupTo(t, repo, sourceDir, nil).Header.SnapshotID
+
+	repo = openRepository(t, repo.Store())
+	report, err := Fsck(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Snapshots != 1 || len(report.Dangling) != 0 || len(report.Orphans) != 0 {
+		t.Fatalf("expected a clean repository, got %+v", report)
+	}
+
+	// a packfile of a backup in progress is not known to the state yet
+	inProgress := objects.Checksum{0x0f}
+	if err := repo.PutPackfile(inProgress, bytes.NewReader([]byte("in progress")), 11); err != nil {
+		t.Fatal(err)
+	}
+	report, err = Fsck(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Dangling) != 0 || len(report.Orphans) != 0 {
+		t.Fatalf("expected %x not to be reported, got %+v", inProgress, report)
+	}
+
+	// the packfiles of a removed snapshot are no longer referenced
+	prunedDir := filepath.Join(tmpDir, "pruned")
+	if err := os.MkdirAll(prunedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	pruned := []byte("content of the pruned snapshot")
+	if err := os.WriteFile(filepath.Join(prunedDir, "file.txt"), pruned, 0644); err != nil {
+		t.Fatal(err)
+	}
+	prunedID := backupTo(t, openRepository(t, repo.Store()), prunedDir, nil).Header.SnapshotID
+	repo = openRepository(t, repo.Store())
+	orphan, exists := repo.GetPackfileForBlob(packfile.TYPE_CHUNK, repo.Checksum(pruned))
+	if !exists {
+		t.Fatal("chunk of the pruned file is unknown to the state")
+	}
+	if err := repo.DeleteSnapshot(prunedID); err != nil {
+		t.Fatal(err)
+	}
+	report, err = Fsck(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, checksum := range report.Orphans {
+		if checksum == inProgress {
+			t.Fatalf("packfile %x should not be reported as orphan", inProgress)
+		}
+		found = found || checksum == orphan
+	}
+	if len(report.Dangling) != 0 || !found {
+		t.Fatalf("expected %x to be reported as orphan, got %+v", orphan, report)
+	}
+
+	if err := repo.DeletePackfiles(report.Orphans); err != nil {
+		t.Fatal(err)
+	}
+	repo = openRepository(t, repo.Store())
+	report, err = Fsck(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Snapshots != 1 || len(report.Dangling) != 0 || len(report.Orphans) != 0 {
+		t.Fatalf("expected a clean repository after repair, got %+v", report)
+	}
+
+	// the packfile holding the chunk of the file goes missing behind the
+	// repository's back
+	chunkPackfile, exists := repo.GetPackfileForBlob(packfile.TYPE_CHUNK, repo.Checksum(content))
+	if !exists {
+		t.Fatal("chunk of the file is unknown to the state")
+	}
+	if err := repo.Store().DeletePackfile(chunkPackfile); err != nil {
+		t.Fatal(err)
+	}
+	report, err = Fsck(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Dangling) == 0 {
+		t.Fatal("expected dangling references")
+	}
+	for _, dangling := range report.Dangling {
+		if dangling.SnapshotID != snapshotID || dangling.Packfile != chunkPackfile {
+			t.Errorf("unexpected dangling reference %s in packfile %x", dangling.Reference, dangling.Packfile)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+// walkReferences calls fn for the header of the given snapshots and for
+// every blob reachable from them, along with the packfile the state
+// locates the blob in, if any. As with References, fn returns false when
+// the blob is not available, in which case what it references is not
+// walked, and that includes the whole snapshot for its header. It returns
+// the packfiles located for the references.
+func walkReferences(repo *repository.Repository, snapshotIDs []objects.Checksum, fn func(snapshotID objects.Checksum, ref Reference, packfileChecksum objects.Checksum, exists bool) bool) (map[objects.Checksum]struct{}, error) {
+	live := make(map[objects.Checksum]struct{})
+	for _, snapshotID := range snapshotIDs {
+		check := func(ref Reference) bool {
+			packfileChecksum, exists := repo.GetPackfileForBlob(ref.Type, ref.Checksum)
+			if exists {
+				live[packfileChecksum] = struct{}{}
+			}
+			return fn(snapshotID, ref, packfileChecksum, exists)
+		}
+
+		if !check(Reference{Type: packfile.TYPE_SNAPSHOT, Checksum: snapshotID}) {
+			continue
+		}
+		snap, err := Load(repo, snapshotID)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %x: %w", snapshotID, err)
+		}
+		if err := snap.References(check); err != nil {
+			return nil, fmt.Errorf("snapshot %x: %w", snapshotID, err)
+		}
+	}
+	return live, nil
+}
+
+// unreferencedPackfiles returns, sorted, the packfiles among the given
+// ones that are known to the state but not in live.
+func unreferencedPackfiles(repo *repository.Repository, packfiles []objects.Checksum, live map[objects.Checksum]struct{}) []objects.Checksum {
+	known := make(map[objects.Checksum]struct{})
+	for checksum := range repo.ListPackfiles() {
+		known[checksum] = struct{}{}
+	}
+
+	unreferenced := make([]objects.Checksum, 0)
+	for _, checksum := range packfiles {
+		if _, found := known[checksum]; !found {
+			continue
+		}
+		if _, found := live[checksum]; !found {
+			unreferenced = append(unreferenced, checksum)
+		}
+	}
+	sort.Slice(unreferenced, func(i, j int) bool {
+		return bytes.Compare(unreferenced[i][:], unreferenced[j][:]) < 0
+	})
+	return unreferenced
+}
+
+// UnreferencedPackfiles returns the packfiles of the store that are known
+// to the state but that no snapshot references anymore. Packfiles unknown
+// to the state are left out as they may belong to a backup in progress,
+// and the walk fails on any blob that can't be read rather than risk
+// missing what it references.
+func UnreferencedPackfiles(repo *repository.Repository) ([]objects.Checksum, error) {
+	snapshotIDs, err := repo.GetSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := walkReferences(repo, snapshotIDs, func(objects.Checksum, Reference, objects.Checksum, bool) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	packfiles, err := repo.GetPackfiles()
+	if err != nil {
+		return nil, err
+	}
+	return unreferencedPackfiles(repo, packfiles, live), nil
+}
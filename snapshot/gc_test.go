@@ -0,0 +1,141 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/repository"
+)
+
+func TestUnreferencedPackfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	store := newTestStore(t, filepath.Join(tmpDir, "repo"), nil)
+
+	backup := func(name string, content []byte) objects.Checksum {
+		sourceDir := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(sourceDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return backupTo(t, openRepository(t, store), sourceDir, nil).Header.SnapshotID
+	}
+
+	pruned := []byte("content of the pruned snapshot")
+	kept := []byte("content of the kept snapshot")
+	// blobs common to both snapshots, such as their empty errors log, are
+	// stored with the first one: it must be the kept one for the packfiles
+	// of the pruned snapshot to be unreferenced once it is removed.
+	keptID := backup("kept", kept)
+	prunedID := backup("pruned", pruned)
+
+	repo := openRepository(t, store)
+	prunedPackfile, _ := repo.GetPackfileForBlob(packfile.TYPE_CHUNK, repo.Checksum(pruned))
+	keptPackfile, _ := repo.GetPackfileForBlob(packfile.TYPE_CHUNK, repo.Checksum(kept))
+	if prunedPackfile == keptPackfile {
+		t.Fatal("expected the snapshots not to share packfiles")
+	}
+
+	// a packfile of a backup in progress is not known to the state yet
+	inProgress := objects.Checksum{0x0f}
+	if err := repo.PutPackfile(inProgress, bytes.NewReader([]byte("in progress")), 11); err != nil {
+		t.Fatal(err)
+	}
+
+	unreferenced, err := UnreferencedPackfiles(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unreferenced) != 0 {
+		t.Fatalf("expected no unreferenced packfiles, got %x", unreferenced)
+	}
+
+	if err := repo.DeleteSnapshot(prunedID); err != nil {
+		t.Fatal(err)
+	}
+	unreferenced, err = UnreferencedPackfiles(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, checksum := range unreferenced {
+		if checksum == keptPackfile || checksum == inProgress {
+			t.Fatalf("packfile %x should not be collected", checksum)
+		}
+	}
+	found := false
+	for _, checksum := range unreferenced {
+		found = found || checksum == prunedPackfile
+	}
+	if !found {
+		t.Fatalf("expected %x to be collected, got %x", prunedPackfile, unreferenced)
+	}
+
+	// a backup committed meanwhile makes the collection fail
+	concurrentID := backup("concurrent", []byte("concurrent content"))
+	if err := repo.DeletePackfiles(unreferenced); !errors.Is(err, repository.ErrConcurrentUpdate) {
+		t.Fatalf("expected ErrConcurrentUpdate, got %v", err)
+	}
+
+	repo = openRepository(t, store)
+	unreferenced, err = UnreferencedPackfiles(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeletePackfiles(unreferenced); err != nil {
+		t.Fatal(err)
+	}
+
+	packfiles, err := repo.GetPackfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := make(map[objects.Checksum]struct{})
+	for _, checksum := range packfiles {
+		remaining[checksum] = struct{}{}
+	}
+	if _, exists := remaining[prunedPackfile]; exists {
+		t.Errorf("expected %x to be deleted", prunedPackfile)
+	}
+	for _, checksum := range []objects.Checksum{keptPackfile, inProgress} {
+		if _, exists := remaining[checksum]; !exists {
+			t.Errorf("expected %x to be kept", checksum)
+		}
+	}
+
+	repo = openRepository(t, store)
+	if repo.ChunkExists(repo.Checksum(pruned)) {
+		t.Error("chunk of the deleted packfile is still known to the state")
+	}
+	for _, snapshotID := range []objects.Checksum{keptID, concurrentID} {
+		snap, err := Load(repo, snapshotID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := snap.Check("/", &CheckOptions{MaxConcurrency: 1}); err != nil || !ok {
+			t.Fatalf("snapshot %x failed its check: %v", snapshotID, err)
+		}
+	}
+	snap, err := Load(repo, keptID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd, err := snap.NewReader(filepath.ToSlash(filepath.Join(tmpDir, "kept", "file.txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, kept) {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
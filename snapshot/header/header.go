@@ -1,8 +1,10 @@
 package header
 
 import (
+	"bytes"
 	"errors"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -107,6 +109,38 @@ func (h *Header) Serialize() ([]byte, error) {
 	}
 }
 
+// CanonicalBytes returns the serialization of the header that snapshot
+// signatures cover.  Unlike Serialize, it doesn't depend on the order in
+// which tags and context entries were added.
+func (h *Header) CanonicalBytes() ([]byte, error) {
+	canonical := *h
+
+	canonical.Tags = nil
+	if len(h.Tags) != 0 {
+		canonical.Tags = slices.Clone(h.Tags)
+		sort.Strings(canonical.Tags)
+	}
+
+	canonical.Context = nil
+	if len(h.Context) != 0 {
+		canonical.Context = slices.Clone(h.Context)
+		sort.SliceStable(canonical.Context, func(i, j int) bool {
+			if canonical.Context[i].Key != canonical.Context[j].Key {
+				return canonical.Context[i].Key < canonical.Context[j].Key
+			}
+			return canonical.Context[i].Value < canonical.Context[j].Value
+		})
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(&canonical); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func (h *Header) SetContext(key, value string) {
 	h.Context = append(h.Context, KeyValue{Key: key, Value: value})
 }
@@ -120,6 +154,84 @@ func (h *Header) GetContext(key string) string {
 	return ""
 }
 
+// FilterByContext returns the headers whose context has the given key set
+// to value, or set to any value if value is empty.
+func FilterByContext(headers []Header, key, value string) []Header {
+	ret := make([]Header, 0)
+	for _, h := range headers {
+		for _, kv := range h.Context {
+			if kv.Key == key && (value == "" || kv.Value == value) {
+				ret = append(ret, h)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// FilterByAge returns the headers of snapshots created more than olderThan
+// ago and less than newerThan ago. A zero duration doesn't bound the age.
+func FilterByAge(headers []Header, olderThan, newerThan time.Duration) []Header {
+	return filterByAge(headers, time.Now(), olderThan, newerThan)
+}
+
+func filterByAge(headers []Header, now time.Time, olderThan, newerThan time.Duration) []Header {
+	ret := make([]Header, 0)
+	for _, h := range headers {
+		age := now.Sub(h.CreationTime)
+		if olderThan != 0 && age <= olderThan {
+			continue
+		}
+		if newerThan != 0 && age >= newerThan {
+			continue
+		}
+		ret = append(ret, h)
+	}
+	return ret
+}
+
+// AddTags adds the tags the header doesn't have yet and keeps them sorted,
+// it returns true if the tags changed.
+func (h *Header) AddTags(tags ...string) bool {
+	changed := false
+	for _, tag := range tags {
+		if !h.HasTag(tag) {
+			h.Tags = append(h.Tags, tag)
+			changed = true
+		}
+	}
+	sort.Strings(h.Tags)
+	return changed
+}
+
+// RemoveTags removes the given tags from the header, it returns true if the
+// tags changed.
+func (h *Header) RemoveTags(tags ...string) bool {
+	removed := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		removed[tag] = struct{}{}
+	}
+
+	kept := make([]string, 0, len(h.Tags))
+	for _, tag := range h.Tags {
+		if _, found := removed[tag]; !found {
+			kept = append(kept, tag)
+		}
+	}
+	changed := len(kept) != len(h.Tags)
+	h.Tags = kept
+	return changed
+}
+
+func (h *Header) HasTag(tag string) bool {
+	for _, t := range h.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Header) GetIndexID() [32]byte {
 	return h.SnapshotID
 }
@@ -1,6 +1,7 @@
 package header
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
 	"time"
@@ -86,3 +87,173 @@ func TestSortHeaders(t *testing.T) {
 		t.Errorf("Test 10 failed: expected %v, got %v", expected10, headers)
 	}
 }
+
+func TestAddTags(t *testing.T) {
+	h := NewHeader([32]byte{0x1})
+
+	if !h.AddTags("weekly", "daily") {
+		t.Fatal("expected the tags to change")
+	}
+	if !reflect.DeepEqual(h.Tags, []string{"daily", "weekly"}) {
+		t.Fatalf("unexpected tags %v", h.Tags)
+	}
+
+	if h.AddTags("daily", "weekly", "daily") {
+		t.Error("tagging twice should not change the tags")
+	}
+	if !reflect.DeepEqual(h.Tags, []string{"daily", "weekly"}) {
+		t.Fatalf("unexpected tags %v", h.Tags)
+	}
+
+	if !h.AddTags("monthly", "monthly") {
+		t.Fatal("expected the tags to change")
+	}
+	if !reflect.DeepEqual(h.Tags, []string{"daily", "monthly", "weekly"}) {
+		t.Fatalf("unexpected tags %v", h.Tags)
+	}
+}
+
+func TestRemoveTags(t *testing.T) {
+	h := NewHeader([32]byte{0x1})
+	h.AddTags("daily", "weekly")
+
+	if h.RemoveTags("monthly") {
+		t.Error("removing a missing tag should not change the tags")
+	}
+	if !reflect.DeepEqual(h.Tags, []string{"daily", "weekly"}) {
+		t.Fatalf("unexpected tags %v", h.Tags)
+	}
+
+	if !h.RemoveTags("weekly", "monthly") {
+		t.Fatal("expected the tags to change")
+	}
+	if !reflect.DeepEqual(h.Tags, []string{"daily"}) {
+		t.Fatalf("unexpected tags %v", h.Tags)
+	}
+}
+
+func TestFilterByContext(t *testing.T) {
+	headers := []Header{
+		{SnapshotID: [32]byte{0x1}, Context: []KeyValue{{Key: "git_commit", Value: "abc123"}}},
+		{SnapshotID: [32]byte{0x2}, Context: []KeyValue{{Key: "host", Value: "db1"}, {Key: "git_commit", Value: "def456"}}},
+		{SnapshotID: [32]byte{0x3}, Context: []KeyValue{{Key: "host", Value: "abc123"}}},
+		{SnapshotID: [32]byte{0x4}},
+	}
+
+	ids := func(headers []Header) []byte {
+		ret := make([]byte, 0)
+		for _, h := range headers {
+			ret = append(ret, h.SnapshotID[0])
+		}
+		return ret
+	}
+
+	if got := ids(FilterByContext(headers, "git_commit", "abc123")); !reflect.DeepEqual(got, []byte{0x1}) {
+		t.Errorf("key=value: unexpected headers %v", got)
+	}
+	if got := ids(FilterByContext(headers, "git_commit", "")); !reflect.DeepEqual(got, []byte{0x1, 0x2}) {
+		t.Errorf("key with any value: unexpected headers %v", got)
+	}
+	if got := ids(FilterByContext(headers, "git_commit", "fff")); len(got) != 0 {
+		t.Errorf("unknown value: unexpected headers %v", got)
+	}
+	if got := ids(FilterByContext(headers, "missing", "")); len(got) != 0 {
+		t.Errorf("unknown key: unexpected headers %v", got)
+	}
+}
+
+func TestFilterByAge(t *testing.T) {
+	now := time.Date(2024, 11, 12, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	headers := []Header{
+		{SnapshotID: [32]byte{0x1}, CreationTime: now.Add(-60 * day)},
+		{SnapshotID: [32]byte{0x2}, CreationTime: now.Add(-30*day - time.Second)},
+		{SnapshotID: [32]byte{0x3}, CreationTime: now.Add(-30 * day)},
+		{SnapshotID: [32]byte{0x4}, CreationTime: now.Add(-7 * day)},
+		{SnapshotID: [32]byte{0x5}, CreationTime: now.Add(-time.Hour)},
+	}
+
+	ids := func(headers []Header) []byte {
+		ret := make([]byte, 0)
+		for _, h := range headers {
+			ret = append(ret, h.SnapshotID[0])
+		}
+		return ret
+	}
+
+	tests := []struct {
+		olderThan time.Duration
+		newerThan time.Duration
+		expected  []byte
+	}{
+		{0, 0, []byte{0x1, 0x2, 0x3, 0x4, 0x5}},
+		{30 * day, 0, []byte{0x1, 0x2}},
+		{0, 30 * day, []byte{0x4, 0x5}},
+		{0, 30*day + time.Second, []byte{0x3, 0x4, 0x5}},
+		{7 * day, 60 * day, []byte{0x2, 0x3}},
+		{time.Hour, 7 * day, []byte{}},
+	}
+	for _, test := range tests {
+		got := ids(filterByAge(headers, now, test.olderThan, test.newerThan))
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("older than %s, newer than %s: expected %v, got %v",
+				test.olderThan, test.newerThan, test.expected, got)
+		}
+	}
+}
+
+func TestCanonicalBytes(t *testing.T) {
+	h1 := NewHeader([32]byte{0x1})
+	h1.Tags = []string{"b", "a"}
+	h1.SetContext("Hostname", "localhost")
+	h1.SetContext("OperatingSystem", "openbsd")
+	h1.SetContext("Architecture", "amd64")
+
+	h2 := *h1
+	h2.Tags = []string{"a", "b"}
+	h2.Context = nil
+	h2.SetContext("Architecture", "amd64")
+	h2.SetContext("OperatingSystem", "openbsd")
+	h2.SetContext("Hostname", "localhost")
+
+	b1, err := h1.CanonicalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := h2.CanonicalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1, b2) {
+		t.Fatal("expected headers differing only in ordering to have the same canonical bytes")
+	}
+	if h1.Tags[0] != "b" || h1.Context[0].Key != "Hostname" {
+		t.Fatal("expected CanonicalBytes to leave the header untouched")
+	}
+
+	// a header read back from its serialization has the same canonical bytes
+	serialized, err := h1.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3, err := NewFromBytes(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b3, err := h3.CanonicalBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1, b3) {
+		t.Fatal("expected canonical bytes to survive serialization")
+	}
+
+	h2.SetContext("Hostname", "otherhost")
+	if b2, err = h2.CanonicalBytes(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(b1, b2) {
+		t.Fatal("expected different headers to have different canonical bytes")
+	}
+}
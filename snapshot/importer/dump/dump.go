@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/PlakarKorp/plakar/snapshot/importer/stdin"
+)
+
+// DumpImporter backs up the output of a database dump as a single regular
+// file, without it being written to disk first. A PostgreSQL connection
+// string is dumped with pg_dump:
+//
+//	plakar backup postgres://backup@db.example.com/shop
+//
+// while any other dump command can be given explicitly:
+//
+//	plakar backup 'dump://shop?mysqldump --single-transaction shop'
+//
+// where everything after the question mark is run by the shell. The dump
+// is stored as /<database>.sql unless the dump location has a path. The
+// name of the database and the time the dump started are recorded in the
+// context of the snapshot.
+type DumpImporter struct {
+	*stdin.StdinImporter
+
+	scheme   string
+	origin   string
+	database string
+	pathname string
+	name     string
+	args     []string
+	env      []string
+
+	cmd     *exec.Cmd
+	started time.Time
+}
+
+func init() {
+	importer.Register("dump", NewDumpImporter)
+	importer.Register("postgres", NewDumpImporter)
+	importer.Register("postgresql", NewDumpImporter)
+}
+
+func NewDumpImporter(location string) (importer.ImporterBackend, error) {
+	scheme, rest, _ := strings.Cut(location, "://")
+
+	p := &DumpImporter{scheme: scheme}
+	switch scheme {
+	case "dump":
+		// the command is taken verbatim, it would not survive the
+		// decoding of a query string
+		target, command, _ := strings.Cut(rest, "?")
+		if command == "" {
+			return nil, fmt.Errorf("%s: missing dump command", location)
+		}
+		database, pathname, _ := strings.Cut(target, "/")
+		p.database = database
+		p.origin = "dump"
+		p.name = "/bin/sh"
+		p.args = []string{"-c", command}
+		if pathname != "" {
+			p.pathname = path.Clean("/" + pathname)
+		}
+
+	case "postgres", "postgresql":
+		parsed, err := url.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		p.database = strings.TrimPrefix(parsed.Path, "/")
+		p.origin = parsed.Hostname()
+		if p.origin == "" {
+			p.origin = "localhost"
+		}
+		// the credentials are passed in the environment rather than on
+		// the command line, where any user could read them.
+		if parsed.User != nil {
+			if username := parsed.User.Username(); username != "" {
+				p.env = append(p.env, "PGUSER="+username)
+			}
+			if password, ok := parsed.User.Password(); ok {
+				p.env = append(p.env, "PGPASSWORD="+password)
+			}
+			parsed.User = nil
+		}
+		p.name = "pg_dump"
+		p.args = []string{"--dbname=" + parsed.String()}
+
+	default:
+		return nil, fmt.Errorf("unsupported dump location %s", location)
+	}
+
+	if p.database == "" {
+		return nil, fmt.Errorf("%s: missing database name", location)
+	}
+	if p.pathname == "" {
+		p.pathname = "/" + p.database + ".sql"
+	}
+	return p, nil
+}
+
+func (p *DumpImporter) Scan() (<-chan importer.ScanResult, error) {
+	p.cmd = exec.Command(p.name, p.args...)
+	if len(p.env) != 0 {
+		p.cmd.Env = append(os.Environ(), p.env...)
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	p.cmd.Stderr = stderr
+
+	p.started = time.Now()
+	if err := p.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p.StdinImporter = stdin.NewStreamImporter(p.pathname, p.started, &commandReader{
+		rd:     stdout,
+		cmd:    p.cmd,
+		stderr: stderr,
+	})
+	return p.StdinImporter.Scan()
+}
+
+func (p *DumpImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	if p.StdinImporter == nil {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+	return p.StdinImporter.NewReader(pathname)
+}
+
+func (p *DumpImporter) Context() map[string]string {
+	return map[string]string{
+		"DatabaseName":  p.database,
+		"DumpTimestamp": p.started.UTC().Format(time.RFC3339),
+	}
+}
+
+func (p *DumpImporter) Close() error {
+	if p.cmd != nil && p.cmd.ProcessState == nil {
+		// the scan was interrupted before the dump was over
+		p.cmd.Process.Kill()
+		p.cmd.Wait()
+	}
+	if p.StdinImporter != nil {
+		return p.StdinImporter.Close()
+	}
+	return nil
+}
+
+func (p *DumpImporter) Root() string {
+	return "/"
+}
+
+func (p *DumpImporter) Origin() string {
+	return p.origin
+}
+
+func (p *DumpImporter) Type() string {
+	return p.scheme
+}
+
+// commandReader reads the output of the dump command and turns a failure
+// of the command into an error once its output is exhausted, so that a
+// truncated dump isn't mistaken for a complete one.
+type commandReader struct {
+	rd     io.Reader
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (r *commandReader) Read(buf []byte) (int, error) {
+	n, err := r.rd.Read(buf)
+	if err == io.EOF {
+		if werr := r.cmd.Wait(); werr != nil {
+			message := strings.TrimSpace(r.stderr.String())
+			if message == "" {
+				return n, fmt.Errorf("%s: %w", r.cmd.Path, werr)
+			}
+			return n, fmt.Errorf("%s: %w: %s", r.cmd.Path, werr, message)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package fs
+
+import (
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"golang.org/x/sys/unix"
+)
+
+// setBirthTime fills the birth time missing from struct stat on Linux,
+// when the kernel and the filesystem report it.
+func setBirthTime(pathname string, fileinfo *objects.FileInfo) {
+	if !fileinfo.BirthTime().IsZero() {
+		return
+	}
+
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, pathname, unix.AT_SYMLINK_NOFOLLOW, unix.STATX_BTIME, &stx); err != nil {
+		return
+	}
+	if stx.Mask&unix.STATX_BTIME == 0 {
+		return
+	}
+	fileinfo.LbirthTime = time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec))
+}
@@ -0,0 +1,33 @@
+//go:build linux
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+func TestSetBirthTime(t *testing.T) {
+	before := time.Now().Add(-time.Second)
+	pathname := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(pathname, []byte("born"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(pathname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileinfo := objects.FileInfoFromStat(info)
+	setBirthTime(pathname, &fileinfo)
+	if fileinfo.BirthTime().IsZero() {
+		t.Skip("birth time not supported by the kernel or the filesystem")
+	}
+	if fileinfo.BirthTime().Before(before) || fileinfo.BirthTime().After(time.Now()) {
+		t.Fatalf("unexpected birth time %v", fileinfo.BirthTime())
+	}
+}
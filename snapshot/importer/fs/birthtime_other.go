@@ -0,0 +1,12 @@
+//go:build !linux
+
+package fs
+
+import (
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+// setBirthTime is a no-op, objects.FileInfoFromStat already provides the
+// birth time on the platforms that have one in struct stat.
+func setBirthTime(pathname string, fileinfo *objects.FileInfo) {
+}
@@ -28,6 +28,7 @@ import (
 type FSImporter struct {
 	importer.ImporterBackend
 	rootDir string
+	options walkOptions
 }
 
 func init() {
@@ -63,8 +64,20 @@ func (p *FSImporter) Type() string {
 	return "fs"
 }
 
+func (p *FSImporter) SetOneFileSystem(enabled bool) {
+	p.options.oneFileSystem = enabled
+}
+
+func (p *FSImporter) SetDereference(enabled bool) {
+	p.options.dereference = enabled
+}
+
+func (p *FSImporter) SetExcludeCaches(enabled bool) {
+	p.options.excludeCaches = enabled
+}
+
 func (p *FSImporter) Scan() (<-chan importer.ScanResult, error) {
-	return walkDir_walker(p.rootDir, 256)
+	return walkDir_walker(p.rootDir, 256, p.options)
 }
 
 func (p *FSImporter) NewReader(pathname string) (io.ReadCloser, error) {
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd
+
+package fs
+
+import (
+	"io/fs"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+// holes is unsupported without SEEK_HOLE, sparse files are backed up and
+// restored densely.
+func holes(pathname string, info fs.FileInfo) []objects.Extent {
+	return nil
+}
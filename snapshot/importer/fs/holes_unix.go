@@ -0,0 +1,57 @@
+//go:build linux || darwin || freebsd
+
+package fs
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"golang.org/x/sys/unix"
+)
+
+// holes returns the holes of a sparse file. Files with as many blocks
+// allocated as their size calls for aren't sparse and aren't looked at.
+func holes(pathname string, info fs.FileInfo) []objects.Extent {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() || int64(stat.Blocks)*512 >= info.Size() {
+		return nil
+	}
+
+	fp, err := os.Open(pathname)
+	if err != nil {
+		return nil
+	}
+	defer fp.Close()
+	fd := int(fp.Fd())
+
+	// failing to find the holes only costs space on restore, the file is
+	// still backed up
+	extents := make([]objects.Extent, 0)
+	size := info.Size()
+	for offset := int64(0); offset < size; {
+		hole, err := unix.Seek(fd, offset, unix.SEEK_HOLE)
+		if err != nil {
+			return nil
+		}
+		if hole >= size {
+			break
+		}
+
+		data, err := unix.Seek(fd, hole, unix.SEEK_DATA)
+		if err == unix.ENXIO {
+			// hole running to the end of the file
+			data = size
+		} else if err != nil {
+			return nil
+		}
+		extents = append(extents, objects.Extent{Offset: hole, Length: data - hole})
+		offset = data
+	}
+
+	if len(extents) == 0 {
+		return nil
+	}
+	return extents
+}
@@ -18,6 +18,7 @@ package fs
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"os/user"
@@ -25,16 +26,60 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/PlakarKorp/plakar/logger"
 	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/snapshot/importer"
 )
 
+type walkOptions struct {
+	// oneFileSystem skips the directories on another device than the root
+	oneFileSystem bool
+
+	// dereference records the targets of symlinks in place of the links,
+	// dangling links are recorded as links.
+	dereference bool
+
+	// excludeCaches skips the directories tagged with a CACHEDIR.TAG
+	excludeCaches bool
+}
+
+// cacheDirSignature starts the CACHEDIR.TAG file marking a directory as a
+// cache, see https://bford.info/cachedir/
+const cacheDirSignature = "Signature: 8a477f597d28d172789f06886806bc55"
+
+// isCacheDir reports whether the directory at path holds a CACHEDIR.TAG
+// file starting with the expected signature.
+func isCacheDir(path string) bool {
+	fp, err := os.Open(filepath.Join(path, "CACHEDIR.TAG"))
+	if err != nil {
+		return false
+	}
+	defer fp.Close()
+
+	buf := make([]byte, len(cacheDirSignature))
+	if _, err := io.ReadFull(fp, buf); err != nil {
+		return false
+	}
+	return string(buf) == cacheDirSignature
+}
+
+// stat returns the information about path, following a symlink if the
+// options ask for it and its target exists.
+func (options walkOptions) stat(path string) (fs.FileInfo, error) {
+	if options.dereference {
+		if info, err := os.Stat(path); err == nil {
+			return info, nil
+		}
+	}
+	return os.Lstat(path)
+}
+
 // Worker pool to handle file scanning in parallel
-func walkDir_worker(rootDir string, jobs <-chan string, results chan<- importer.ScanResult, wg *sync.WaitGroup) {
+func walkDir_worker(rootDir string, options walkOptions, jobs <-chan string, results chan<- importer.ScanResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for path := range jobs {
-		info, err := os.Lstat(path) // Use Lstat to handle symlinks properly
+		info, err := options.stat(path) // Lstat unless dereferencing, to handle symlinks properly
 		if err != nil {
 			results <- importer.ScanError{Pathname: path, Err: err}
 			continue
@@ -60,13 +105,15 @@ func walkDir_worker(rootDir string, jobs <-chan string, results chan<- importer.
 		}
 
 		// Get extended attributes (if applicable)
-		extendedAttributes, err := getExtendedAttributes(path)
+		extendedAttributes, err := getExtendedAttributes(path, recordType == importer.RecordTypeSymlink)
 		if err != nil {
 			results <- importer.ScanError{Pathname: path, Err: err}
 			continue
 		}
 
 		fileinfo := objects.FileInfoFromStat(info)
+		setBirthTime(path, &fileinfo)
+		fileinfo.Lholes = holes(path, info)
 
 		var username string
 		var groupname string
@@ -95,7 +142,12 @@ func walkDir_worker(rootDir string, jobs <-chan string, results chan<- importer.
 				prefix = prefix + "/"
 			}
 			for _, child := range entries {
-				info, err := child.Info()
+				var info fs.FileInfo
+				if options.dereference {
+					info, err = options.stat(filepath.Join(path, child.Name()))
+				} else {
+					info, err = child.Info()
+				}
 				if err != nil {
 					results <- importer.ScanError{Pathname: path, Err: err}
 					continue
@@ -118,6 +170,7 @@ func walkDir_worker(rootDir string, jobs <-chan string, results chan<- importer.
 					}
 				}
 				childinfo := objects.FileInfoFromStat(info)
+				setBirthTime(fullpath, &childinfo)
 
 				var username string
 				var groupname string
@@ -137,18 +190,17 @@ func walkDir_worker(rootDir string, jobs <-chan string, results chan<- importer.
 				children = append(children, childinfo)
 			}
 			results <- importer.ScanRecord{Type: recordType, Pathname: filepath.ToSlash(path), FileInfo: fileinfo, ExtendedAttributes: extendedAttributes, Children: children}
-		} else {
-			results <- importer.ScanRecord{Type: recordType, Pathname: filepath.ToSlash(path), FileInfo: fileinfo, ExtendedAttributes: extendedAttributes}
-		}
-
-		// Handle symlinks separately
-		if fileinfo.Mode()&os.ModeSymlink != 0 {
+		} else if fileinfo.Mode()&os.ModeSymlink != 0 {
+			// a single record carrying the target: the backup keeps one
+			// entry per pathname and could otherwise keep one without it
 			originFile, err := os.Readlink(path)
 			if err != nil {
 				results <- importer.ScanError{Pathname: path, Err: err}
 				continue
 			}
 			results <- importer.ScanRecord{Type: recordType, Pathname: filepath.ToSlash(path), Target: originFile, FileInfo: fileinfo, ExtendedAttributes: extendedAttributes}
+		} else {
+			results <- importer.ScanRecord{Type: recordType, Pathname: filepath.ToSlash(path), FileInfo: fileinfo, ExtendedAttributes: extendedAttributes}
 		}
 	}
 }
@@ -176,7 +228,90 @@ func walkDir_addPrefixDirectories(rootDir string, jobs chan<- string, results ch
 	}
 }
 
-func walkDir_walker(rootDir string, numWorkers int) (<-chan importer.ScanResult, error) {
+// deviceOf returns the id of the device holding path, or its target if
+// it is a symlink. It is a variable so that tests can simulate mount
+// points.
+var deviceOf = func(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return objects.FileInfoFromStat(info).Dev(), nil
+}
+
+// fileID identifies a directory for the detection of symlink cycles
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// walkDir_dereference walks path like filepath.WalkDir does but follows
+// symlinks. A directory reached again below itself through a symlink is
+// reported as an error instead of being walked forever.
+func walkDir_dereference(path string, options walkOptions, rootDev uint64, ancestors map[fileID]struct{}, jobs chan<- string, results chan<- importer.ScanResult) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if _, err := os.Lstat(path); err == nil {
+			// a dangling symlink, recorded as a link
+			jobs <- path
+			return
+		}
+		results <- importer.ScanError{Pathname: path, Err: err}
+		return
+	}
+	if !info.IsDir() {
+		jobs <- path
+		return
+	}
+
+	fileinfo := objects.FileInfoFromStat(info)
+	id := fileID{dev: fileinfo.Dev(), ino: fileinfo.Ino()}
+	if _, found := ancestors[id]; found {
+		results <- importer.ScanError{Pathname: path, Err: fmt.Errorf("symlink cycle: directory contains itself")}
+		return
+	}
+
+	if options.oneFileSystem && len(ancestors) != 0 {
+		dev, err := deviceOf(path)
+		if err != nil {
+			results <- importer.ScanError{Pathname: path, Err: err}
+			return
+		}
+		if dev != rootDev {
+			logger.Warn("%s: skipping mount point", path)
+			return
+		}
+	}
+
+	if options.excludeCaches && len(ancestors) != 0 && isCacheDir(path) {
+		logger.Info("%s: skipping cache directory", path)
+		return
+	}
+
+	jobs <- path
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		// reported by the worker listing the children
+		return
+	}
+	ancestors[id] = struct{}{}
+	for _, entry := range entries {
+		walkDir_dereference(filepath.Join(path, entry.Name()), options, rootDev, ancestors, jobs, results)
+	}
+	delete(ancestors, id)
+}
+
+func walkDir_walker(rootDir string, numWorkers int, options walkOptions) (<-chan importer.ScanResult, error) {
+	var rootDev uint64
+	if options.oneFileSystem {
+		dev, err := deviceOf(rootDir)
+		if err != nil {
+			return nil, err
+		}
+		rootDev = dev
+	}
+
 	results := make(chan importer.ScanResult, 1000) // Larger buffer for results
 	jobs := make(chan string, 1000)                 // Buffered channel to feed paths to workers
 	var wg sync.WaitGroup
@@ -184,7 +319,7 @@ func walkDir_walker(rootDir string, numWorkers int) (<-chan importer.ScanResult,
 	// Launch worker pool
 	for w := 1; w <= numWorkers; w++ {
 		wg.Add(1)
-		go walkDir_worker(rootDir, jobs, results, &wg)
+		go walkDir_worker(rootDir, options, jobs, results, &wg)
 	}
 
 	// Start walking the directory and sending file paths to workers
@@ -194,12 +329,34 @@ func walkDir_walker(rootDir string, numWorkers int) (<-chan importer.ScanResult,
 		// Add prefix directories first
 		walkDir_addPrefixDirectories(rootDir, jobs, results)
 
+		if options.dereference {
+			walkDir_dereference(rootDir, options, rootDev, make(map[fileID]struct{}), jobs, results)
+			return
+		}
+
 		err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				results <- importer.ScanError{Pathname: path, Err: err}
 				return nil
 			}
 
+			if options.oneFileSystem && d.IsDir() && path != rootDir {
+				dev, err := deviceOf(path)
+				if err != nil {
+					results <- importer.ScanError{Pathname: path, Err: err}
+					return filepath.SkipDir
+				}
+				if dev != rootDev {
+					logger.Warn("%s: skipping mount point", path)
+					return filepath.SkipDir
+				}
+			}
+
+			if options.excludeCaches && d.IsDir() && path != rootDir && isCacheDir(path) {
+				logger.Info("%s: skipping cache directory", path)
+				return filepath.SkipDir
+			}
+
 			// If d is a directory, send its path directly to the job queue
 			jobs <- path
 			return nil
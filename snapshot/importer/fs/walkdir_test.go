@@ -0,0 +1,246 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+func TestWalkDirOneFileSystem(t *testing.T) {
+	rootDir := t.TempDir()
+	for _, name := range []string{"a.txt", "dir/b.txt", "mnt/c.txt", "mnt/sub/d.txt"} {
+		pathname := filepath.Join(rootDir, name)
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pathname, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// mnt is on another device, as if a filesystem were mounted there
+	mountPoint := filepath.Join(rootDir, "mnt")
+	savedDeviceOf := deviceOf
+	defer func() { deviceOf = savedDeviceOf }()
+	deviceOf = func(path string) (uint64, error) {
+		if path == mountPoint || strings.HasPrefix(path, mountPoint+string(os.PathSeparator)) {
+			return 2, nil
+		}
+		return 1, nil
+	}
+
+	scan := func(oneFileSystem bool) map[string]struct{} {
+		results, err := walkDir_walker(rootDir, 4, walkOptions{oneFileSystem: oneFileSystem})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pathnames := make(map[string]struct{})
+		for result := range results {
+			switch result := result.(type) {
+			case importer.ScanRecord:
+				pathnames[result.Pathname] = struct{}{}
+			case importer.ScanError:
+				t.Errorf("%s: %s", result.Pathname, result.Err)
+			}
+		}
+		return pathnames
+	}
+
+	slash := func(name string) string {
+		return filepath.ToSlash(filepath.Join(rootDir, name))
+	}
+
+	pathnames := scan(true)
+	for _, name := range []string{"a.txt", "dir", "dir/b.txt"} {
+		if _, found := pathnames[slash(name)]; !found {
+			t.Errorf("%s was not scanned", name)
+		}
+	}
+	for _, name := range []string{"mnt", "mnt/c.txt", "mnt/sub", "mnt/sub/d.txt"} {
+		if _, found := pathnames[slash(name)]; found {
+			t.Errorf("%s is past the mount point but was scanned", name)
+		}
+	}
+
+	pathnames = scan(false)
+	for _, name := range []string{"a.txt", "dir/b.txt", "mnt", "mnt/sub/d.txt"} {
+		if _, found := pathnames[slash(name)]; !found {
+			t.Errorf("%s was not scanned", name)
+		}
+	}
+}
+
+func TestWalkDirDereference(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootDir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"file.txt": "content", "dir/inner.txt": "inner"} {
+		if err := os.WriteFile(filepath.Join(rootDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range map[string]string{
+		"link-file": "file.txt",
+		"link-dir":  "dir",
+		"dangling":  "missing",
+		"dir/loop":  "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(rootDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(dereference bool) (map[string]importer.ScanRecord, map[string]error) {
+		results, err := walkDir_walker(rootDir, 4, walkOptions{dereference: dereference})
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := make(map[string]importer.ScanRecord)
+		errors := make(map[string]error)
+		for result := range results {
+			switch result := result.(type) {
+			case importer.ScanRecord:
+				if _, found := records[result.Pathname]; found {
+					t.Errorf("%s was scanned twice", result.Pathname)
+				}
+				records[result.Pathname] = result
+			case importer.ScanError:
+				errors[filepath.ToSlash(result.Pathname)] = result.Err
+			}
+		}
+		return records, errors
+	}
+	slash := func(name string) string {
+		return filepath.ToSlash(filepath.Join(rootDir, name))
+	}
+	expectType := func(records map[string]importer.ScanRecord, name string, recordType importer.RecordType) {
+		t.Helper()
+		record, found := records[slash(name)]
+		if !found {
+			t.Errorf("%s was not scanned", name)
+		} else if record.Type != recordType {
+			t.Errorf("%s: expected type %d, got %d", name, recordType, record.Type)
+		}
+	}
+
+	// links are preserved by default
+	records, errors := scan(false)
+	if len(errors) != 0 {
+		t.Fatalf("unexpected errors %v", errors)
+	}
+	for _, name := range []string{"link-file", "link-dir", "dangling", "dir/loop"} {
+		expectType(records, name, importer.RecordTypeSymlink)
+	}
+	if record := records[slash("dangling")]; record.Target != "missing" {
+		t.Errorf("dangling: unexpected target %q", record.Target)
+	}
+	if _, found := records[slash("link-dir/inner.txt")]; found {
+		t.Error("link-dir was followed")
+	}
+
+	records, errors = scan(true)
+	expectType(records, "link-file", importer.RecordTypeFile)
+	if size := records[slash("link-file")].FileInfo.Size(); size != int64(len("content")) {
+		t.Errorf("link-file: expected the size of its target, got %d", size)
+	}
+	expectType(records, "link-dir", importer.RecordTypeDirectory)
+	expectType(records, "link-dir/inner.txt", importer.RecordTypeFile)
+	expectType(records, "dangling", importer.RecordTypeSymlink)
+	if record := records[slash("dangling")]; record.Target != "missing" {
+		t.Errorf("dangling: unexpected target %q", record.Target)
+	}
+
+	// dir/loop points back to the root, which contains it
+	for _, name := range []string{"dir/loop", "link-dir/loop"} {
+		if _, found := errors[slash(name)]; !found {
+			t.Errorf("%s: expected the cycle to be reported", name)
+		}
+		if _, found := records[slash(name+"/file.txt")]; found {
+			t.Errorf("%s was followed", name)
+		}
+	}
+	if len(errors) != 2 {
+		t.Errorf("unexpected errors %v", errors)
+	}
+}
+
+func TestWalkDirExcludeCaches(t *testing.T) {
+	rootDir := t.TempDir()
+	files := map[string]string{
+		"a.txt":              "a",
+		"cache/CACHEDIR.TAG": cacheDirSignature + "\n# a comment\n",
+		"cache/sub/b.txt":    "b",
+		"plain/c.txt":        "c",
+		"bogus/CACHEDIR.TAG": "not a signature",
+		"bogus/d.txt":        "d",
+	}
+	for name, content := range files {
+		pathname := filepath.Join(rootDir, name)
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pathname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(options walkOptions) map[string]struct{} {
+		results, err := walkDir_walker(rootDir, 4, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pathnames := make(map[string]struct{})
+		for result := range results {
+			switch result := result.(type) {
+			case importer.ScanRecord:
+				pathnames[result.Pathname] = struct{}{}
+			case importer.ScanError:
+				t.Errorf("%s: %s", result.Pathname, result.Err)
+			}
+		}
+		return pathnames
+	}
+	slash := func(name string) string {
+		return filepath.ToSlash(filepath.Join(rootDir, name))
+	}
+
+	for _, dereference := range []bool{false, true} {
+		pathnames := scan(walkOptions{excludeCaches: true, dereference: dereference})
+		for _, name := range []string{"a.txt", "plain", "plain/c.txt", "bogus", "bogus/CACHEDIR.TAG", "bogus/d.txt"} {
+			if _, found := pathnames[slash(name)]; !found {
+				t.Errorf("dereference=%v: %s was not scanned", dereference, name)
+			}
+		}
+		for _, name := range []string{"cache", "cache/CACHEDIR.TAG", "cache/sub", "cache/sub/b.txt"} {
+			if _, found := pathnames[slash(name)]; found {
+				t.Errorf("dereference=%v: %s is in a cache directory but was scanned", dereference, name)
+			}
+		}
+	}
+
+	pathnames := scan(walkOptions{})
+	for _, name := range []string{"cache/CACHEDIR.TAG", "cache/sub/b.txt"} {
+		if _, found := pathnames[slash(name)]; !found {
+			t.Errorf("%s was not scanned", name)
+		}
+	}
+
+	// a tagged directory is still backed up when asked for explicitly
+	results, err := walkDir_walker(filepath.Join(rootDir, "cache"), 4, walkOptions{excludeCaches: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for result := range results {
+		if record, ok := result.(importer.ScanRecord); ok && record.Pathname == slash("cache/sub/b.txt") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("the content of the tagged root was not scanned")
+	}
+}
@@ -22,18 +22,26 @@ import (
 	"github.com/pkg/xattr"
 )
 
-func getExtendedAttributes(path string) (map[string][]byte, error) {
+// getExtendedAttributes returns the extended attributes of path.  Those
+// of a symlink are read from the link itself, not from its target which
+// may not even exist.
+func getExtendedAttributes(path string, symlink bool) (map[string][]byte, error) {
 	attrs := make(map[string][]byte)
 
+	list, get := xattr.List, xattr.Get
+	if symlink {
+		list, get = xattr.LList, xattr.LGet
+	}
+
 	// Get the list of attribute names
-	attributes, err := xattr.List(path)
+	attributes, err := list(path)
 	if err != nil {
 		return nil, err
 	}
 
 	// Iterate over each attribute and retrieve its value
 	for _, attr := range attributes {
-		value, err := xattr.Get(path, attr)
+		value, err := get(path, attr)
 		if err != nil {
 			// Log the error and continue instead of failing
 			if os.IsPermission(err) {
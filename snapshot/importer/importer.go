@@ -77,15 +77,60 @@ type ScanError struct {
 
 func (r ScanError) scanResult() {}
 
+// ImporterBackend is implemented by the sources a snapshot can be taken
+// from. Backends make themselves available with Register and are selected
+// by NewImporter from the scheme of the location to back up.
 type ImporterBackend interface {
+	// Origin identifies the source, e.g. the hostname for local paths,
+	// it is recorded in the snapshot header and scopes the backup cache.
 	Origin() string
+
+	// Type is the name the backend is registered under.
 	Type() string
+
+	// Root is the pathname of the top-level directory in the snapshot.
 	Root() string
+
+	// Scan walks the source and returns a channel on which a ScanRecord
+	// is sent for every entry, or a ScanError for entries that couldn't
+	// be read. Directory records carry the list of their children and
+	// may be sent after their content. The channel is closed once the
+	// walk is over.
 	Scan() (<-chan ScanResult, error)
+
+	// NewReader returns the content of a regular file sent by Scan.
 	NewReader(pathname string) (io.ReadCloser, error)
+
+	// Close releases the resources held by the backend.
 	Close() error
 }
 
+// OneFileSystem is implemented by backends that can restrict the scan to
+// the filesystem holding the root, without descending into the other
+// filesystems mounted below it.
+type OneFileSystem interface {
+	SetOneFileSystem(enabled bool)
+}
+
+// Dereference is implemented by backends that can record the targets of
+// symlinks instead of the links themselves.
+type Dereference interface {
+	SetDereference(enabled bool)
+}
+
+// ExcludeCaches is implemented by backends that can skip the directories
+// tagged as caches with a CACHEDIR.TAG file.
+type ExcludeCaches interface {
+	SetExcludeCaches(enabled bool)
+}
+
+// ContextProvider is implemented by backends that know details about the
+// source worth recording in the context of the snapshot, such as the name
+// of a database. Context is called once the scan is over.
+type ContextProvider interface {
+	Context() map[string]string
+}
+
 type Importer struct {
 	backend ImporterBackend
 }
@@ -93,6 +138,8 @@ type Importer struct {
 var muBackends sync.Mutex
 var backends map[string]func(config string) (ImporterBackend, error) = make(map[string]func(config string) (ImporterBackend, error))
 
+// Register makes an importer backend available under name, which is also
+// the URL scheme selecting it.
 func Register(name string, backend func(string) (ImporterBackend, error)) {
 	muBackends.Lock()
 	defer muBackends.Unlock()
@@ -117,38 +164,82 @@ func Backends() []string {
 	return ret
 }
 
+// NewImporter returns an importer for location. The backend is selected by
+// the scheme of location, "s3://bucket/prefix" is handled by the backend
+// registered as "s3", while locations without a scheme are local paths
+// handled by "fs".
 func NewImporter(location string) (*Importer, error) {
+	backendName := "fs"
+	if !strings.HasPrefix(location, "/") {
+		if scheme, _, found := strings.Cut(location, "://"); found {
+			backendName = scheme
+		}
+	}
+
 	muBackends.Lock()
-	defer muBackends.Unlock()
+	backend, exists := backends[backendName]
+	muBackends.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("unsupported importer protocol '%s'", backendName)
+	}
 
-	var backendName string
-	if !strings.HasPrefix(location, "/") {
-		if strings.HasPrefix(location, "s3://") {
-			backendName = "s3"
-		} else if strings.HasPrefix(location, "fs://") {
-			backendName = "fs"
-		} else if strings.HasPrefix(location, "ftp://") {
-			backendName = "ftp"
-		} else {
-			if strings.Contains(location, "://") {
-				return nil, fmt.Errorf("unsupported importer protocol")
-			} else {
-				backendName = "fs"
-			}
+	backendInstance, err := backend(location)
+	if err != nil {
+		return nil, err
+	}
+	return &Importer{backend: backendInstance}, nil
+}
+
+// SetOneFileSystem keeps the scan on the filesystem holding the root, it
+// fails if the backend doesn't support it.
+func (importer *Importer) SetOneFileSystem(enabled bool) error {
+	backend, ok := importer.backend.(OneFileSystem)
+	if !ok {
+		if !enabled {
+			return nil
 		}
-	} else {
-		backendName = "fs"
+		return fmt.Errorf("%s importer does not support staying on one filesystem", importer.backend.Type())
 	}
+	backend.SetOneFileSystem(enabled)
+	return nil
+}
 
-	if backend, exists := backends[backendName]; !exists {
-		return nil, fmt.Errorf("backend '%s' does not exist", backendName)
-	} else {
-		backendInstance, err := backend(location)
-		if err != nil {
-			return nil, err
+// SetDereference makes the scan record the targets of symlinks instead of
+// the links, it fails if the backend doesn't support it.
+func (importer *Importer) SetDereference(enabled bool) error {
+	backend, ok := importer.backend.(Dereference)
+	if !ok {
+		if !enabled {
+			return nil
 		}
-		return &Importer{backend: backendInstance}, nil
+		return fmt.Errorf("%s importer does not support dereferencing symlinks", importer.backend.Type())
+	}
+	backend.SetDereference(enabled)
+	return nil
+}
+
+// SetExcludeCaches skips the directories tagged as caches during the
+// scan, it fails if the backend doesn't support it.
+func (importer *Importer) SetExcludeCaches(enabled bool) error {
+	backend, ok := importer.backend.(ExcludeCaches)
+	if !ok {
+		if !enabled {
+			return nil
+		}
+		return fmt.Errorf("%s importer does not support excluding caches", importer.backend.Type())
+	}
+	backend.SetExcludeCaches(enabled)
+	return nil
+}
+
+// Context returns the details the backend records in the context of the
+// snapshot, or nil if it has none.
+func (importer *Importer) Context() map[string]string {
+	backend, ok := importer.backend.(ContextProvider)
+	if !ok {
+		return nil
 	}
+	return backend.Context()
 }
 
 func (importer *Importer) Origin() string {
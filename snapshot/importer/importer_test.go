@@ -0,0 +1,56 @@
+package importer
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeImporter records the name it was registered under and the location
+// it was created for.
+type fakeImporter struct {
+	name     string
+	location string
+}
+
+func (p *fakeImporter) Origin() string { return p.location }
+func (p *fakeImporter) Type() string   { return p.name }
+func (p *fakeImporter) Root() string   { return "/" }
+func (p *fakeImporter) Scan() (<-chan ScanResult, error) {
+	results := make(chan ScanResult)
+	close(results)
+	return results, nil
+}
+func (p *fakeImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(p.location)), nil
+}
+func (p *fakeImporter) Close() error { return nil }
+
+func init() {
+	for _, name := range []string{"fake", "fs"} {
+		Register(name, func(location string) (ImporterBackend, error) {
+			return &fakeImporter{name: name, location: location}, nil
+		})
+	}
+}
+
+func TestNewImporterScheme(t *testing.T) {
+	for location, expected := range map[string]string{
+		"fake://host/path": "fake",
+		"/var/backups":     "fs",
+		"relative/path":    "fs",
+		"/tmp/fake://path": "fs",
+	} {
+		imp, err := NewImporter(location)
+		if err != nil {
+			t.Fatalf("%s: %v", location, err)
+		}
+		if imp.Type() != expected || imp.Origin() != location {
+			t.Errorf("%s: resolved to %s for %s, expected %s", location, imp.Type(), imp.Origin(), expected)
+		}
+	}
+
+	if _, err := NewImporter("unknown://host/path"); err == nil {
+		t.Fatal("expected an error for an unknown scheme")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -86,73 +87,87 @@ func NewS3Importer(location string) (importer.ImporterBackend, error) {
 	}, nil
 }
 
-func (p *S3Importer) scanRecursive(prefix string, result chan importer.ScanResult) {
-	children := make([]objects.FileInfo, 0)
-	for object := range p.minioClient.ListObjects(context.Background(), p.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: false}) {
-		objectPath := "/" + object.Key
-		if !strings.HasPrefix(objectPath, p.scanDir) && !strings.HasPrefix(p.scanDir, objectPath) {
-			continue
+type directory struct {
+	fileinfo objects.FileInfo
+	children map[string]objects.FileInfo
+}
+
+// directory returns the directory at pathname, creating it and its
+// parents if needed: S3 has no directories, only keys with slashes.
+func (p *S3Importer) directory(directories map[string]*directory, pathname string, mtime time.Time) *directory {
+	if dir, exists := directories[pathname]; exists {
+		return dir
+	}
+	dir := &directory{
+		fileinfo: objects.NewFileInfo(path.Base(pathname), 0, 0755|os.ModeDir, mtime, 0, atomic.AddUint64(&p.ino, 1), 0, 0, 1),
+		children: make(map[string]objects.FileInfo),
+	}
+	directories[pathname] = dir
+	if pathname != "/" {
+		parent := p.directory(directories, path.Dir(pathname), mtime)
+		parent.children[dir.fileinfo.Name()] = dir.fileinfo
+	}
+	return dir
+}
+
+func (p *S3Importer) scan(result chan importer.ScanResult) {
+	prefix := strings.TrimPrefix(p.scanDir, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	directories := make(map[string]*directory)
+	p.directory(directories, p.scanDir, time.Now())
+
+	// the listing is paginated by minio-go, which keeps requesting pages
+	// as the channel is drained
+	for object := range p.minioClient.ListObjects(context.Background(), p.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			// a partial listing would silently drop objects
+			result <- importer.ScanError{Pathname: p.scanDir, Err: object.Err}
+			return
 		}
 
+		pathname := path.Clean("/" + object.Key)
 		if strings.HasSuffix(object.Key, "/") {
-			p.scanRecursive(object.Key, result)
-			children = append(children, objects.NewFileInfo(
-				filepath.Base(strings.TrimRight(object.Key, "/")),
-				object.Size,
-				0700|os.ModeDir,
-				object.LastModified,
-				0,
-				atomic.AddUint64(&p.ino, 1),
-				0,
-				0,
-				0,
-			))
-		} else {
-			fi := objects.NewFileInfo(
-				filepath.Base("/"+prefix+object.Key),
-				object.Size,
-				0700,
-				object.LastModified,
-				1,
-				atomic.AddUint64(&p.ino, 1),
-				0,
-				0,
-				0,
-			)
-			children = append(children, fi)
-			result <- importer.ScanRecord{Type: importer.RecordTypeFile, Pathname: "/" + object.Key, FileInfo: fi}
+			// directory marker created by some clients
+			p.directory(directories, pathname, object.LastModified)
+			continue
 		}
-	}
 
-	sort.Slice(children, func(i, j int) bool {
-		return children[i].Name() < children[j].Name()
-	})
-
-	var currentName string
-	if prefix == "" {
-		currentName = "/"
-	} else {
-		currentName = filepath.Base(prefix)
+		fi := objects.NewFileInfo(
+			path.Base(pathname),
+			object.Size,
+			0644,
+			object.LastModified,
+			0,
+			atomic.AddUint64(&p.ino, 1),
+			0,
+			0,
+			1,
+		)
+		parent := p.directory(directories, path.Dir(pathname), object.LastModified)
+		parent.children[fi.Name()] = fi
+		result <- importer.ScanRecord{Type: importer.RecordTypeFile, Pathname: pathname, FileInfo: fi}
 	}
 
-	result <- importer.ScanRecord{Type: importer.RecordTypeDirectory, Pathname: "/" + prefix, FileInfo: objects.NewFileInfo(
-		currentName,
-		0,
-		0700|os.ModeDir,
-		time.Now(),
-		0,
-		atomic.AddUint64(&p.ino, 1),
-		0,
-		0,
-		0,
-	), Children: children}
+	for pathname, dir := range directories {
+		children := make([]objects.FileInfo, 0, len(dir.children))
+		for _, child := range dir.children {
+			children = append(children, child)
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Name() < children[j].Name()
+		})
+		result <- importer.ScanRecord{Type: importer.RecordTypeDirectory, Pathname: pathname, FileInfo: dir.fileinfo, Children: children}
+	}
 }
 
 func (p *S3Importer) Scan() (<-chan importer.ScanResult, error) {
-	c := make(chan importer.ScanResult)
+	c := make(chan importer.ScanResult, 1000)
 	go func() {
 		defer close(c)
-		p.scanRecursive("", c)
+		p.scan(c)
 	}()
 	return c, nil
 }
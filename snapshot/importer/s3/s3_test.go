@@ -0,0 +1,215 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// fakeS3 implements enough of the S3 API for minio-go to list and fetch
+// objects from a single bucket, with pages of pageSize keys.
+type fakeS3 struct {
+	bucket   string
+	objects  map[string]string
+	pageSize int
+}
+
+type listContent struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	Prefix                string
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+	Contents              []listContent
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case query.Has("location"):
+		fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+
+	case key == "":
+		prefix := query.Get("prefix")
+		keys := make([]string, 0)
+		for key := range s.objects {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		start := 0
+		if token := query.Get("continuation-token"); token != "" {
+			start, _ = strconv.Atoi(token)
+		}
+		end := min(start+s.pageSize, len(keys))
+
+		result := listBucketResult{Name: s.bucket, Prefix: prefix, MaxKeys: s.pageSize}
+		for _, key := range keys[start:end] {
+			result.Contents = append(result.Contents, listContent{
+				Key:          key,
+				LastModified: "2024-11-12T10:00:00.000Z",
+				ETag:         `"etag"`,
+				Size:         int64(len(s.objects[key])),
+			})
+		}
+		result.KeyCount = len(result.Contents)
+		if end < len(keys) {
+			result.IsTruncated = true
+			result.NextContinuationToken = strconv.Itoa(end)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(result)
+
+	default:
+		content, exists := s.objects[key]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `<Error><Code>NoSuchKey</Code><Key>%s</Key></Error>`, key)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("Last-Modified", time.Date(2024, 11, 12, 10, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		if r.Method != http.MethodHead {
+			io.WriteString(w, content)
+		}
+	}
+}
+
+func TestS3Importer(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{
+		bucket: "bucket",
+		objects: map[string]string{
+			"photos/2024/a.jpg":  "a",
+			"photos/2024/b.jpg":  "bb",
+			"photos/2024/c.jpg":  "ccc",
+			"photos/index.html":  "index",
+			"photos/empty/":      "",
+			"photosynthesis.txt": "not under the prefix",
+			"other/file":         "elsewhere",
+		},
+		pageSize: 2,
+	})
+	defer server.Close()
+
+	location := "s3://access:secret@" + strings.TrimPrefix(server.URL, "http://") + "/bucket/photos"
+	imp, err := NewS3Importer(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imp.Close()
+
+	if imp.Root() != "/photos" {
+		t.Fatalf("unexpected root %s", imp.Root())
+	}
+
+	results, err := imp.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := make(map[string]importer.ScanRecord)
+	for result := range results {
+		switch result := result.(type) {
+		case importer.ScanRecord:
+			records[result.Pathname] = result
+		case importer.ScanError:
+			t.Fatalf("%s: %v", result.Pathname, result.Err)
+		}
+	}
+
+	expected := map[string]importer.RecordType{
+		"/":                  importer.RecordTypeDirectory,
+		"/photos":            importer.RecordTypeDirectory,
+		"/photos/2024":       importer.RecordTypeDirectory,
+		"/photos/2024/a.jpg": importer.RecordTypeFile,
+		"/photos/2024/b.jpg": importer.RecordTypeFile,
+		"/photos/2024/c.jpg": importer.RecordTypeFile,
+		"/photos/empty":      importer.RecordTypeDirectory,
+		"/photos/index.html": importer.RecordTypeFile,
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %d: %v", len(expected), len(records), records)
+	}
+	for pathname, recordType := range expected {
+		record, exists := records[pathname]
+		if !exists {
+			t.Fatalf("missing record for %s", pathname)
+		}
+		if record.Type != recordType {
+			t.Errorf("%s: expected type %d, got %d", pathname, recordType, record.Type)
+		}
+	}
+
+	children := records["/photos"].Children
+	if len(children) != 3 || children[0].Name() != "2024" || children[1].Name() != "empty" || children[2].Name() != "index.html" {
+		t.Errorf("unexpected children for /photos: %v", children)
+	}
+	b := records["/photos/2024/b.jpg"].FileInfo
+	if b.Size() != 2 || !b.ModTime().Equal(time.Date(2024, 11, 12, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected file info for b.jpg: %v", b)
+	}
+
+	rd, err := imp.NewReader("/photos/2024/c.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ccc" {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
+
+func TestS3ImporterListError(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{bucket: "bucket", pageSize: 2})
+	defer server.Close()
+
+	imp, err := NewS3Importer("s3://access:secret@" + strings.TrimPrefix(server.URL, "http://") + "/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imp.Close()
+
+	results, err := imp.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanErr error
+	for result := range results {
+		if result, ok := result.(importer.ScanError); ok {
+			scanErr = result.Err
+		}
+	}
+	if scanErr == nil {
+		t.Fatal("expected the listing error to be reported")
+	}
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package sftp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPImporter backs up a remote directory over SFTP:
+//
+//	plakar backup sftp://user@host:port/path
+//
+// Like ssh, it authenticates with the keys held by ssh-agent and the
+// unencrypted default keys in ~/.ssh, or with a password given in the
+// location, and only connects to hosts listed in ~/.ssh/known_hosts.
+type SFTPImporter struct {
+	importer.ImporterBackend
+
+	location *url.URL
+	rootDir  string
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+
+	ino uint64
+}
+
+func init() {
+	importer.Register("sftp", NewSFTPImporter)
+}
+
+func NewSFTPImporter(location string) (importer.ImporterBackend, error) {
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Path == "" {
+		return nil, fmt.Errorf("missing remote directory")
+	}
+
+	return &SFTPImporter{
+		location: parsed,
+		rootDir:  path.Clean(parsed.Path),
+	}, nil
+}
+
+func authMethods(location *url.URL, sshDir string) []ssh.AuthMethod {
+	methods := make([]ssh.AuthMethod, 0)
+
+	if password, exists := location.User.Password(); exists {
+		methods = append(methods, ssh.Password(password))
+	}
+
+	signers := make([]ssh.Signer, 0)
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			defer conn.Close()
+			if agentSigners, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		data, err := os.ReadFile(filepath.Join(sshDir, name))
+		if err != nil {
+			continue
+		}
+		// keys protected by a passphrase are expected to be in the agent
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) != 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods
+}
+
+// connect opens the SFTP session on first use rather than in the
+// constructor, importers are also created to validate a location.
+func (p *SFTPImporter) connect() (*sftp.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	sshDir := filepath.Join(homeDir, ".ssh")
+
+	hostKeyCallback, err := knownhosts.New(filepath.Join(sshDir, "known_hosts"))
+	if err != nil {
+		return nil, err
+	}
+
+	username := p.location.User.Username()
+	if username == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		username = u.Username
+	}
+
+	port := p.location.Port()
+	if port == "" {
+		port = "22"
+	}
+
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(p.location.Hostname(), port), &ssh.ClientConfig{
+		User:            username,
+		Auth:            authMethods(p.location, sshDir),
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	p.conn = conn
+	p.client = client
+	return client, nil
+}
+
+func (p *SFTPImporter) fileinfo(info os.FileInfo) objects.FileInfo {
+	var uid, gid uint64
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		uid = uint64(stat.UID)
+		gid = uint64(stat.GID)
+	}
+	return objects.NewFileInfo(info.Name(), info.Size(), info.Mode(), info.ModTime(), 0, atomic.AddUint64(&p.ino, 1), uid, gid, 1)
+}
+
+func recordType(mode os.FileMode) importer.RecordType {
+	switch {
+	case mode.IsDir():
+		return importer.RecordTypeDirectory
+	case mode&os.ModeSymlink != 0:
+		return importer.RecordTypeSymlink
+	case mode&os.ModeDevice != 0:
+		return importer.RecordTypeDevice
+	case mode&os.ModeNamedPipe != 0:
+		return importer.RecordTypePipe
+	case mode&os.ModeSocket != 0:
+		return importer.RecordTypeSocket
+	default:
+		return importer.RecordTypeFile
+	}
+}
+
+func (p *SFTPImporter) walk(client *sftp.Client, pathname string, fileinfo objects.FileInfo, results chan<- importer.ScanResult) {
+	record := importer.ScanRecord{
+		Type:     recordType(fileinfo.Mode()),
+		Pathname: pathname,
+		FileInfo: fileinfo,
+	}
+
+	switch record.Type {
+	case importer.RecordTypeSymlink:
+		target, err := client.ReadLink(pathname)
+		if err != nil {
+			results <- importer.ScanError{Pathname: pathname, Err: err}
+			return
+		}
+		record.Target = target
+		results <- record
+
+	case importer.RecordTypeDirectory:
+		entries, err := client.ReadDir(pathname)
+		if err != nil {
+			results <- importer.ScanError{Pathname: pathname, Err: err}
+			return
+		}
+		record.Children = make([]objects.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			record.Children = append(record.Children, p.fileinfo(entry))
+		}
+		results <- record
+
+		for _, child := range record.Children {
+			p.walk(client, path.Join(pathname, child.Name()), child, results)
+		}
+
+	default:
+		results <- record
+	}
+}
+
+func (p *SFTPImporter) Scan() (<-chan importer.ScanResult, error) {
+	client, err := p.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := client.Lstat(p.rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(chan importer.ScanResult, 1000)
+	go func() {
+		defer close(results)
+
+		fileinfo := p.fileinfo(info)
+
+		// directories leading to the root
+		child := fileinfo
+		for dir := p.rootDir; dir != "/"; {
+			dir = path.Dir(dir)
+			info, err := client.Lstat(dir)
+			if err != nil {
+				results <- importer.ScanError{Pathname: dir, Err: err}
+				break
+			}
+			dirinfo := p.fileinfo(info)
+			results <- importer.ScanRecord{
+				Type:     importer.RecordTypeDirectory,
+				Pathname: dir,
+				FileInfo: dirinfo,
+				Children: []objects.FileInfo{child},
+			}
+			child = dirinfo
+		}
+
+		p.walk(client, p.rootDir, fileinfo, results)
+	}()
+	return results, nil
+}
+
+func (p *SFTPImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	client, err := p.connect()
+	if err != nil {
+		return nil, err
+	}
+	return client.Open(pathname)
+}
+
+func (p *SFTPImporter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client == nil {
+		return nil
+	}
+	p.client.Close()
+	return p.conn.Close()
+}
+
+func (p *SFTPImporter) Root() string {
+	return p.rootDir
+}
+
+func (p *SFTPImporter) Origin() string {
+	return p.location.Host
+}
+
+func (p *SFTPImporter) Type() string {
+	return "sftp"
+}
@@ -0,0 +1,230 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/gobwas/glob"
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+// startServer runs an SFTP server on the loopback serving the local
+// filesystem, and sets up a home directory whose ssh keys and known_hosts
+// let the importer connect to it. It returns the address of the server.
+func startServer(t *testing.T) string {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientPublicKey, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := ssh.NewPublicKey(clientPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn, config)
+		}
+	}()
+
+	homeDir := t.TempDir()
+	sshDir := filepath.Join(homeDir, ".ssh")
+	if err := os.Mkdir(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sshDir, "id_ed25519"), pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostSigner.PublicKey())
+	if err := os.WriteFile(filepath.Join(sshDir, "known_hosts"), []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", homeDir)
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	return addr
+}
+
+func serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+			}
+		}()
+
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+		server.Serve()
+		server.Close()
+	}
+}
+
+func TestSFTPBackup(t *testing.T) {
+	addr := startServer(t)
+
+	sourceDir := filepath.Join(t.TempDir(), "source")
+	if err := os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte("remote content\n"), 1000)
+	if err := os.WriteFile(filepath.Join(sourceDir, "sub", "file.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "skipped.log"), []byte("excluded"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/file.txt", filepath.Join(sourceDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	sourceDir = filepath.ToSlash(sourceDir)
+
+	tmpDir := t.TempDir()
+	ctx := context.NewContext()
+	ctx.SetCacheDir(filepath.Join(tmpDir, "cache"))
+
+	configuration := storage.NewConfiguration()
+	configuration.Encryption = nil
+	store, err := storage.Create(ctx, filepath.Join(tmpDir, "repo"), *configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := repository.New(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshotID := repo.Checksum([]byte(uuid.NewString()))
+	snap, err := snapshot.New(repo, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snap.Backup("sftp://"+addr+sourceDir, &snapshot.PushOptions{
+		MaxConcurrency: 1,
+		Excludes:       []glob.Glob{glob.MustCompile("*.log")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err = snapshot.Load(repo, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Header.Importer.Type != "sftp" || snap.Header.Importer.Directory != sourceDir {
+		t.Fatalf("unexpected importer %s for %s", snap.Header.Importer.Type, snap.Header.Importer.Directory)
+	}
+
+	rd, err := snap.NewReader(sourceDir + "/sub/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("unexpected content, got %d bytes, expected %d", len(data), len(content))
+	}
+
+	fs, err := snap.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := fs.Stat(sourceDir + "/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link, ok := entry.(*vfs.FileEntry); !ok || link.SymlinkTarget != "sub/file.txt" {
+		t.Fatalf("unexpected entry for the symlink: %#v", entry)
+	}
+	if _, err := fs.Stat(sourceDir + "/skipped.log"); err == nil {
+		t.Fatal("excluded file was backed up")
+	}
+}
+
+func TestSFTPUnknownHost(t *testing.T) {
+	addr := startServer(t)
+	if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	imp, err := NewSFTPImporter("sftp://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imp.Close()
+	if _, err := imp.Scan(); err == nil {
+		t.Fatal("expected the connection to an unknown host to fail")
+	}
+}
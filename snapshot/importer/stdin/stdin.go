@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package stdin
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// DefaultPathname is the pathname under which the stream is stored when
+// the location doesn't specify one.
+const DefaultPathname = "/stdin"
+
+// StdinImporter backs up its standard input as a single regular file, so
+// that the output of a command can be snapshotted:
+//
+//	pg_dump db | plakar backup stdin:///dumps/db.sql?mtime=2024-11-12T10:00:00Z
+//
+// The pathname defaults to DefaultPathname and the mtime, in RFC 3339
+// format, to the time of the backup.
+type StdinImporter struct {
+	importer.ImporterBackend
+
+	pathname string
+	mtime    time.Time
+	input    io.Reader
+	spool    *os.File
+	size     int64
+}
+
+func init() {
+	importer.Register("stdin", NewStdinImporter)
+}
+
+func NewStdinImporter(location string) (importer.ImporterBackend, error) {
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	pathname := DefaultPathname
+	if parsed.Path != "" && parsed.Path != "/" {
+		pathname = path.Clean(parsed.Path)
+	}
+
+	mtime := time.Now()
+	if value := parsed.Query().Get("mtime"); value != "" {
+		mtime, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mtime: %w", err)
+		}
+	}
+
+	return NewStreamImporter(pathname, mtime, os.Stdin), nil
+}
+
+// NewStreamImporter returns an importer that backs up everything read from
+// input as a single regular file at pathname, for the importers built on
+// top of a stream other than the standard input.
+func NewStreamImporter(pathname string, mtime time.Time, input io.Reader) *StdinImporter {
+	return &StdinImporter{
+		pathname: pathname,
+		mtime:    mtime,
+		input:    input,
+	}
+}
+
+func (p *StdinImporter) Scan() (<-chan importer.ScanResult, error) {
+	// the size of a file must be known before it is chunked, so the
+	// stream is spooled before being announced
+	spool, err := os.CreateTemp("", "plakar-stdin-")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(spool.Name())
+	p.spool = spool
+
+	results := make(chan importer.ScanResult, 1)
+	go func() {
+		defer close(results)
+
+		size, err := io.Copy(p.spool, p.input)
+		if err != nil {
+			results <- importer.ScanError{Pathname: p.pathname, Err: err}
+			return
+		}
+		p.size = size
+
+		fileinfo := objects.NewFileInfo(path.Base(p.pathname), size, 0644, p.mtime, 0, 1, 0, 0, 1)
+		results <- importer.ScanRecord{
+			Type:     importer.RecordTypeFile,
+			Pathname: p.pathname,
+			FileInfo: fileinfo,
+		}
+
+		// directories leading to the file, up to the root
+		child := fileinfo
+		for dir := path.Dir(p.pathname); ; dir = path.Dir(dir) {
+			dirinfo := objects.NewFileInfo(path.Base(dir), 0, 0755|os.ModeDir, p.mtime, 0, 1, 0, 0, 1)
+			results <- importer.ScanRecord{
+				Type:     importer.RecordTypeDirectory,
+				Pathname: dir,
+				FileInfo: dirinfo,
+				Children: []objects.FileInfo{child},
+			}
+			if dir == "/" {
+				break
+			}
+			child = dirinfo
+		}
+	}()
+	return results, nil
+}
+
+func (p *StdinImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	if pathname != p.pathname || p.spool == nil {
+		return nil, fmt.Errorf("%s: no such file", pathname)
+	}
+	return io.NopCloser(io.NewSectionReader(p.spool, 0, p.size)), nil
+}
+
+func (p *StdinImporter) Close() error {
+	if p.spool != nil {
+		return p.spool.Close()
+	}
+	return nil
+}
+
+func (p *StdinImporter) Root() string {
+	return "/"
+}
+
+func (p *StdinImporter) Origin() string {
+	return "stdin"
+}
+
+func (p *StdinImporter) Type() string {
+	return "stdin"
+}
@@ -0,0 +1,112 @@
+package stdin
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/snapshot"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/google/uuid"
+
+	_ "github.com/PlakarKorp/plakar/storage/backends/fs"
+)
+
+func TestStdinBackup(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// large enough to span several chunks
+	content := make([]byte, 3<<20)
+	for i := range content {
+		content[i] = byte(i * 7 % 251)
+	}
+
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+	savedStdin := os.Stdin
+	os.Stdin = rd
+	defer func() { os.Stdin = savedStdin }()
+	go func() {
+		wr.Write(content)
+		wr.Close()
+	}()
+
+	ctx := context.NewContext()
+	ctx.SetCacheDir(filepath.Join(tmpDir, "cache"))
+
+	configuration := storage.NewConfiguration()
+	configuration.Encryption = nil
+	store, err := storage.Create(ctx, filepath.Join(tmpDir, "repo"), *configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := repository.New(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshotID := repo.Checksum([]byte(uuid.NewString()))
+	snap, err := snapshot.New(repo, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location := "stdin:///dumps/db.sql?mtime=2024-11-12T10:00:00Z"
+	if err := snap.Backup(location, &snapshot.PushOptions{MaxConcurrency: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err = snapshot.Load(repo, snapshotID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := snap.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := fs.Stat("/dumps/db.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileEntry, ok := entry.(*vfs.FileEntry)
+	if !ok {
+		t.Fatalf("expected a file entry, got %T", entry)
+	}
+	if mtime := time.Date(2024, 11, 12, 10, 0, 0, 0, time.UTC); !fileEntry.Stat().ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %v, got %v", mtime, fileEntry.Stat().ModTime())
+	}
+
+	fp, err := snap.NewReader("/dumps/db.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("stored content differs from the stream: got %d bytes, expected %d", len(data), len(content))
+	}
+}
+
+func TestStdinLocation(t *testing.T) {
+	imp, err := NewStdinImporter("stdin://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pathname := imp.(*StdinImporter).pathname; pathname != DefaultPathname {
+		t.Errorf("expected default pathname %s, got %s", DefaultPathname, pathname)
+	}
+
+	if _, err := NewStdinImporter("stdin:///dump?mtime=yesterday"); err == nil {
+		t.Error("expected an invalid mtime to be rejected")
+	}
+}
@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package tar
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// TarImporter backs up the content of a tar archive, read from a file or
+// from stdin with "tar://-", without unpacking it. Archives compressed
+// with gzip are detected and decompressed on the fly.
+//
+// The archive is read once during Scan and the content of its regular
+// files spooled to a temporary file, as a stream can't be rewound when
+// the backup reads them back.
+type TarImporter struct {
+	importer.ImporterBackend
+
+	location string
+	spool    *os.File
+	sections map[string]section
+}
+
+type section struct {
+	offset int64
+	size   int64
+}
+
+type entry struct {
+	recordType importer.RecordType
+	fileinfo   objects.FileInfo
+	target     string
+	children   map[string]objects.FileInfo
+}
+
+func init() {
+	importer.Register("tar", NewTarImporter)
+}
+
+func NewTarImporter(location string) (importer.ImporterBackend, error) {
+	location = strings.TrimPrefix(location, "tar://")
+	if location == "" {
+		return nil, fmt.Errorf("missing tar archive")
+	}
+
+	return &TarImporter{
+		location: location,
+		sections: make(map[string]section),
+	}, nil
+}
+
+func (p *TarImporter) open() (io.ReadCloser, error) {
+	if p.location == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(p.location)
+}
+
+func (p *TarImporter) Scan() (<-chan importer.ScanResult, error) {
+	rd, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+
+	spool, err := os.CreateTemp("", "plakar-tar-")
+	if err != nil {
+		rd.Close()
+		return nil, err
+	}
+	os.Remove(spool.Name())
+	p.spool = spool
+
+	results := make(chan importer.ScanResult, 1000)
+	go func() {
+		defer close(results)
+		defer rd.Close()
+
+		entries, err := p.readArchive(rd)
+		if err != nil {
+			results <- importer.ScanError{Pathname: "/", Err: err}
+			return
+		}
+
+		pathnames := make([]string, 0, len(entries))
+		for pathname := range entries {
+			pathnames = append(pathnames, pathname)
+		}
+		sort.Strings(pathnames)
+
+		for _, pathname := range pathnames {
+			e := entries[pathname]
+			record := importer.ScanRecord{
+				Type:     e.recordType,
+				Pathname: pathname,
+				Target:   e.target,
+				FileInfo: e.fileinfo,
+			}
+			if e.recordType == importer.RecordTypeDirectory {
+				record.Children = make([]objects.FileInfo, 0, len(e.children))
+				for _, child := range e.children {
+					record.Children = append(record.Children, child)
+				}
+				sort.Slice(record.Children, func(i, j int) bool {
+					return record.Children[i].Name() < record.Children[j].Name()
+				})
+			}
+			results <- record
+		}
+	}()
+	return results, nil
+}
+
+// readArchive spools the archive and returns its entries by pathname,
+// along with the directories leading to them.
+func (p *TarImporter) readArchive(rd io.Reader) (map[string]*entry, error) {
+	buffered := bufio.NewReader(rd)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		rd = gz
+	} else {
+		rd = buffered
+	}
+
+	var ino uint64
+	entries := make(map[string]*entry)
+
+	// directory ensures pathname and its parents exist as directories,
+	// archives don't always hold entries for them.
+	var directory func(pathname string, hdr *tar.Header) *entry
+	directory = func(pathname string, hdr *tar.Header) *entry {
+		if e, exists := entries[pathname]; exists {
+			return e
+		}
+		ino++
+		e := &entry{
+			recordType: importer.RecordTypeDirectory,
+			fileinfo:   objects.NewFileInfo(path.Base(pathname), 0, 0755|os.ModeDir, hdr.ModTime, 0, ino, 0, 0, 1),
+			children:   make(map[string]objects.FileInfo),
+		}
+		entries[pathname] = e
+		if pathname != "/" {
+			directory(path.Dir(pathname), hdr).children[e.fileinfo.Name()] = e.fileinfo
+		}
+		return e
+	}
+
+	tr := tar.NewReader(rd)
+	offset := int64(0)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		pathname := path.Clean("/" + hdr.Name)
+		if pathname == "/" {
+			continue
+		}
+
+		ino++
+		fileinfo := objects.NewFileInfo(path.Base(pathname), 0, hdr.FileInfo().Mode(), hdr.ModTime, 0, ino, uint64(hdr.Uid), uint64(hdr.Gid), 1)
+		fileinfo.Lusername = hdr.Uname
+		fileinfo.Lgroupname = hdr.Gname
+
+		e := &entry{fileinfo: fileinfo}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.recordType = importer.RecordTypeDirectory
+			e.children = make(map[string]objects.FileInfo)
+			if existing, exists := entries[pathname]; exists && existing.children != nil {
+				e.children = existing.children
+			}
+		case tar.TypeSymlink:
+			e.recordType = importer.RecordTypeSymlink
+			e.target = hdr.Linkname
+		case tar.TypeLink:
+			target, exists := p.sections[path.Clean("/"+hdr.Linkname)]
+			if !exists {
+				return nil, fmt.Errorf("%s: hard link to unknown file %s", pathname, hdr.Linkname)
+			}
+			e.recordType = importer.RecordTypeFile
+			e.fileinfo.Lmode = hdr.FileInfo().Mode().Perm()
+			e.fileinfo.Lsize = target.size
+			p.sections[pathname] = target
+		case tar.TypeChar, tar.TypeBlock:
+			e.recordType = importer.RecordTypeDevice
+		case tar.TypeFifo:
+			e.recordType = importer.RecordTypePipe
+		case tar.TypeReg, tar.TypeRegA:
+			n, err := io.Copy(p.spool, tr)
+			if err != nil {
+				return nil, err
+			}
+			e.recordType = importer.RecordTypeFile
+			e.fileinfo.Lsize = n
+			p.sections[pathname] = section{offset: offset, size: n}
+			offset += n
+		default:
+			// extended headers are consumed by the reader, anything
+			// else has no counterpart in a snapshot
+			continue
+		}
+
+		entries[pathname] = e
+		directory(path.Dir(pathname), hdr).children[fileinfo.Name()] = e.fileinfo
+	}
+
+	// an empty archive still has a root
+	if _, exists := entries["/"]; !exists {
+		directory("/", &tar.Header{})
+	}
+	return entries, nil
+}
+
+func (p *TarImporter) NewReader(pathname string) (io.ReadCloser, error) {
+	s, exists := p.sections[pathname]
+	if !exists {
+		return nil, fmt.Errorf("%s: no such file in archive", pathname)
+	}
+	return io.NopCloser(io.NewSectionReader(p.spool, s.offset, s.size)), nil
+}
+
+func (p *TarImporter) Close() error {
+	if p.spool != nil {
+		return p.spool.Close()
+	}
+	return nil
+}
+
+func (p *TarImporter) Root() string {
+	return "/"
+}
+
+func (p *TarImporter) Origin() string {
+	if p.location == "-" {
+		return "stdin"
+	}
+	return p.location
+}
+
+func (p *TarImporter) Type() string {
+	return "tar"
+}
@@ -0,0 +1,175 @@
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+// writeArchive writes a small tar archive to a temporary file, without
+// entries for its intermediate directories.
+func writeArchive(t *testing.T, compressed bool) string {
+	var buf bytes.Buffer
+	var wr io.Writer = &buf
+	var gz *gzip.Writer
+	if compressed {
+		gz = gzip.NewWriter(&buf)
+		wr = gz
+	}
+
+	tw := tar.NewWriter(wr)
+	mtime := time.Unix(1700000000, 0)
+	entries := []struct {
+		hdr     tar.Header
+		content string
+	}{
+		{tar.Header{Typeflag: tar.TypeDir, Name: "etc/", Mode: 0755, ModTime: mtime}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "etc/motd", Mode: 0644, ModTime: mtime, Uname: "root", Gname: "wheel"}, "welcome\n"},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "home/user/notes.txt", Mode: 0600, ModTime: mtime}, "some notes\n"},
+		{tar.Header{Typeflag: tar.TypeLink, Name: "home/user/motd", Linkname: "etc/motd", Mode: 0644, ModTime: mtime}, ""},
+		{tar.Header{Typeflag: tar.TypeSymlink, Name: "home/user/link", Linkname: "notes.txt", Mode: 0777, ModTime: mtime}, ""},
+	}
+	for _, entry := range entries {
+		entry.hdr.Size = int64(len(entry.content))
+		if err := tw.WriteHeader(&entry.hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archive := filepath.Join(t.TempDir(), "archive.tar")
+	if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestTarImporter(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		archive := writeArchive(t, compressed)
+
+		imp, err := NewTarImporter("tar://" + archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer imp.Close()
+
+		if imp.Root() != "/" || imp.Origin() != archive || imp.Type() != "tar" {
+			t.Fatalf("unexpected root %q, origin %q or type %q", imp.Root(), imp.Origin(), imp.Type())
+		}
+
+		results, err := imp.Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := make(map[string]importer.ScanRecord)
+		for result := range results {
+			switch result := result.(type) {
+			case importer.ScanRecord:
+				records[result.Pathname] = result
+			case importer.ScanError:
+				t.Fatalf("%s: %v", result.Pathname, result.Err)
+			}
+		}
+
+		expected := map[string]importer.RecordType{
+			"/":                    importer.RecordTypeDirectory,
+			"/etc":                 importer.RecordTypeDirectory,
+			"/etc/motd":            importer.RecordTypeFile,
+			"/home":                importer.RecordTypeDirectory,
+			"/home/user":           importer.RecordTypeDirectory,
+			"/home/user/notes.txt": importer.RecordTypeFile,
+			"/home/user/motd":      importer.RecordTypeFile,
+			"/home/user/link":      importer.RecordTypeSymlink,
+		}
+		if len(records) != len(expected) {
+			t.Fatalf("expected %d records, got %d", len(expected), len(records))
+		}
+		for pathname, recordType := range expected {
+			record, exists := records[pathname]
+			if !exists {
+				t.Fatalf("missing record for %s", pathname)
+			}
+			if record.Type != recordType {
+				t.Errorf("%s: expected type %d, got %d", pathname, recordType, record.Type)
+			}
+		}
+
+		if children := records["/home/user"].Children; len(children) != 3 || children[0].Name() != "link" {
+			t.Errorf("unexpected children for /home/user: %v", children)
+		}
+		if target := records["/home/user/link"].Target; target != "notes.txt" {
+			t.Errorf("unexpected symlink target %q", target)
+		}
+		if motd := records["/etc/motd"].FileInfo; motd.Lusername != "root" || motd.Size() != 8 || motd.Mode().Perm() != 0644 {
+			t.Errorf("unexpected file info for /etc/motd: %v", motd)
+		}
+
+		for pathname, content := range map[string]string{
+			"/etc/motd":            "welcome\n",
+			"/home/user/motd":      "welcome\n",
+			"/home/user/notes.txt": "some notes\n",
+		} {
+			rd, err := imp.NewReader(pathname)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(rd)
+			rd.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != content {
+				t.Errorf("%s: expected %q, got %q", pathname, content, data)
+			}
+		}
+	}
+}
+
+func TestTarImporterTruncated(t *testing.T) {
+	data, err := os.ReadFile(writeArchive(t, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "truncated.tar")
+	if err := os.WriteFile(archive, data[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imp, err := NewTarImporter("tar://" + archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imp.Close()
+
+	results, err := imp.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scanErr error
+	for result := range results {
+		if result, ok := result.(importer.ScanError); ok {
+			scanErr = result.Err
+		}
+	}
+	if scanErr == nil {
+		t.Fatal("expected an error for a truncated archive")
+	}
+}
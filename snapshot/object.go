@@ -0,0 +1,59 @@
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+// RestoreObject writes the content of the object with the given checksum,
+// reassembled from its chunks, regardless of the snapshots and pathnames
+// referencing it. The content is hashed as it is written, an error
+// wrapping storage.ErrChecksumMismatch is returned if it doesn't hash to
+// the checksum of the object, in which case what was written is corrupt.
+func RestoreObject(repo *repository.Repository, checksum objects.Checksum, w io.Writer) (int64, error) {
+	rd, _, err := repo.GetObject(checksum)
+	if err != nil {
+		return 0, fmt.Errorf("object %x: %w", checksum, err)
+	}
+	serialized, err := io.ReadAll(rd)
+	if err != nil {
+		return 0, fmt.Errorf("object %x: %w", checksum, err)
+	}
+	object, err := objects.NewObjectFromBytes(serialized)
+	if err != nil {
+		return 0, fmt.Errorf("object %x: %w", checksum, err)
+	}
+
+	hasher := repo.Hasher()
+	w = io.MultiWriter(w, hasher)
+
+	written := int64(0)
+	for start, end := 0, 0; start < len(object.Chunks); start = end {
+		end = start + prefetchCount(object.Chunks[start:])
+		checksums := make([]objects.Checksum, 0, end-start)
+		for _, chunk := range object.Chunks[start:end] {
+			checksums = append(checksums, chunk.Checksum)
+		}
+		chunks, err := repo.GetChunks(checksums)
+		if err != nil {
+			return written, err
+		}
+		for _, chunk := range object.Chunks[start:end] {
+			n, err := w.Write(chunks[chunk.Checksum])
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+
+	if !bytes.Equal(hasher.Sum(nil), checksum[:]) {
+		return written, fmt.Errorf("object %x: %w", checksum, storage.ErrChecksumMismatch)
+	}
+	return written, nil
+}
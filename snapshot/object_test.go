@@ -0,0 +1,75 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/google/uuid"
+)
+
+func TestRestoreObject(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// large enough to be split in several chunks
+	content := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	if err := os.WriteFile(filepath.Join(sourceDir, "random.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newTestRepository(t)
+	backupTo(t, repo, sourceDir, nil)
+
+	repo = openRepository(t, repo.Store())
+	var buf bytes.Buffer
+	written, err := RestoreObject(repo, repo.Checksum(content), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(len(content)) || !bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("restored %d bytes that differ from the original content", written)
+	}
+
+	if _, err := RestoreObject(repo, objects.Checksum{0x01}, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected an unknown object to be reported")
+	}
+
+	// an object whose chunks don't hash to its checksum
+	chunk := []byte("not the content of the object")
+	chunkChecksum := repo.Checksum(chunk)
+	bogus := repo.Checksum([]byte("some other content"))
+	object := objects.NewObject()
+	object.Checksum = bogus
+	object.Chunks = []objects.Chunk{{Checksum: chunkChecksum, Length: uint32(len(chunk))}}
+	serialized, err := object.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := New(repo, repo.Checksum([]byte(uuid.NewString())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.PutChunk(chunkChecksum, chunk); err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.PutObject(bogus, serialized); err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo = openRepository(t, repo.Store())
+	if _, err := RestoreObject(repo, bogus, &bytes.Buffer{}); !errors.Is(err, storage.ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
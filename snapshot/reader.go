@@ -2,15 +2,22 @@ package snapshot
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"os"
 	"path"
 
 	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
 	"github.com/PlakarKorp/plakar/snapshot/importer"
 	"github.com/PlakarKorp/plakar/snapshot/vfs"
 )
 
+// readerPrefetchSize bounds the size of the chunks a Reader fetches at
+// once, in parallel, when it reaches a chunk that it does not hold yet. At
+// least one chunk is fetched whatever its size.
+const readerPrefetchSize = 4 << 20
+
 type Reader struct {
 	snapshot *Snapshot
 	object   *objects.Object
@@ -19,6 +26,10 @@ type Reader struct {
 	chunksLengths []uint32
 	offset        int64
 	size          int64
+
+	// chunks fetched by the last prefetch and not consumed yet, indexed
+	// by checksum
+	prefetched map[objects.Checksum][]byte
 }
 
 func (reader *Reader) GetContentType() string {
@@ -26,7 +37,7 @@ func (reader *Reader) GetContentType() string {
 }
 
 func (reader *Reader) Read(buf []byte) (int, error) {
-	if reader.offset == reader.size {
+	if reader.offset >= reader.size {
 		return 0, io.EOF
 	}
 
@@ -34,13 +45,13 @@ func (reader *Reader) Read(buf []byte) (int, error) {
 	chunkStart := int64(0)
 	for chunkOffset, chunkLength := range reader.chunksLengths {
 		// reader offset is past this chunk, skip
-		if reader.offset > chunkStart+int64(chunkLength) {
+		if reader.offset >= chunkStart+int64(chunkLength) {
 			chunkStart += int64(chunkLength)
 			continue
 		}
 
 		// we have data to read from this chunk, fetch content
-		data, err := reader.snapshot.GetChunk(reader.object.Chunks[chunkOffset].Checksum)
+		data, err := reader.getChunk(chunkOffset)
 		if err != nil {
 			return -1, err
 		}
@@ -67,6 +78,9 @@ func (reader *Reader) Read(buf []byte) (int, error) {
 
 		// update offset and remaining buffer capacity, possibly exiting loop
 		reader.offset += int64(nbytes)
+		if reader.offset >= endOffset {
+			delete(reader.prefetched, reader.object.Chunks[chunkOffset].Checksum)
+		}
 		readSize -= uint(nbytes)
 		if reader.offset == reader.size || readSize == 0 {
 			break
@@ -76,25 +90,65 @@ func (reader *Reader) Read(buf []byte) (int, error) {
 	return reader.obuf.Read(buf)
 }
 
+// getChunk returns the content of the chunk at index idx, fetching it along
+// with the following ones when it was not part of the last prefetch.
+func (reader *Reader) getChunk(idx int) ([]byte, error) {
+	checksum := reader.object.Chunks[idx].Checksum
+	if data, exists := reader.prefetched[checksum]; exists {
+		return data, nil
+	}
+
+	end := idx + prefetchCount(reader.object.Chunks[idx:])
+	checksums := make([]objects.Checksum, 0, end-idx)
+	for _, chunk := range reader.object.Chunks[idx:end] {
+		checksums = append(checksums, chunk.Checksum)
+	}
+
+	prefetched, err := reader.snapshot.GetChunks(checksums)
+	if err != nil {
+		// only fail on the chunk being read, the others will be
+		// retried if and when the reader reaches them.
+		if errs, ok := err.(repository.ChunkErrors); !ok {
+			return nil, err
+		} else if err, failed := errs[checksum]; failed {
+			return nil, err
+		}
+	}
+	reader.prefetched = prefetched
+	return prefetched[checksum], nil
+}
+
+// prefetchCount returns how many of the leading chunks fit in
+// readerPrefetchSize, at least one if chunks isn't empty.
+func prefetchCount(chunks []objects.Chunk) int {
+	size := uint64(0)
+	for i, chunk := range chunks {
+		size += uint64(chunk.Length)
+		if i != 0 && size > readerPrefetchSize {
+			return i
+		}
+	}
+	return len(chunks)
+}
+
+// Seek sets the offset of the next Read, which fetches chunks from that
+// offset on: the ones before it are never read.
 func (reader *Reader) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
 	case io.SeekStart:
-		if offset >= reader.size {
-			return 0, io.EOF
-		}
-		reader.offset = offset
 	case io.SeekCurrent:
-		if reader.offset+offset >= reader.size {
-			return 0, io.EOF
-		}
-		reader.offset += offset
+		offset += reader.offset
 	case io.SeekEnd:
-		if offset > reader.size {
-			return 0, io.EOF
-		}
-		reader.offset = reader.size - offset
+		offset += reader.size
+	default:
+		return 0, errors.New("Reader.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("Reader.Seek: negative position")
 	}
-	return reader.offset, nil
+	reader.offset = offset
+	reader.obuf.Reset()
+	return offset, nil
 }
 
 func (reader *Reader) Close() error {
@@ -0,0 +1,61 @@
+package snapshot
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReaderPrefetchBound(t *testing.T) {
+	sourceDir := t.TempDir()
+	content := make([]byte, 12<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	if err := os.WriteFile(filepath.Join(sourceDir, "large"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	snap := backupSnapshot(t, sourceDir)
+
+	rd, err := NewReader(snap, filepath.Join(sourceDir, "large"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	maxChunk := uint32(0)
+	for _, chunk := range rd.object.Chunks {
+		maxChunk = max(maxChunk, chunk.Length)
+	}
+	if len(rd.object.Chunks) < 4 {
+		t.Fatalf("expected the file to span several chunks, got %d", len(rd.object.Chunks))
+	}
+
+	var data bytes.Buffer
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := rd.Read(buf)
+		data.Write(buf[:max(n, 0)])
+
+		held := 0
+		for _, chunk := range rd.prefetched {
+			held += len(chunk)
+		}
+		if held > readerPrefetchSize+int(maxChunk) {
+			t.Fatalf("reader holds %d bytes of chunks, expected at most %d", held, readerPrefetchSize+int(maxChunk))
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(data.Bytes(), content) {
+		t.Fatalf("read %d bytes differing from the %d bytes backed up", data.Len(), len(content))
+	}
+	if len(rd.prefetched) != 0 {
+		t.Errorf("expected the consumed chunks to be released, %d still held", len(rd.prefetched))
+	}
+}
@@ -18,6 +18,10 @@ type RestoreOptions struct {
 	Rebase         bool
 }
 
+// restorePackfiles is the number of packfiles kept in memory during a
+// restore, see repository.PackfileCache.
+var restorePackfiles = 4
+
 type restoreContext struct {
 	hardlinks      map[string]string
 	hardlinksMutex sync.Mutex
@@ -103,7 +107,7 @@ func snapshotRestorePath(snap *Snapshot, fs *vfs.Filesystem, exp *exporter.Expor
 			}
 			defer rd.Close()
 
-			if err := exp.StoreFile(dest, rd); err != nil {
+			if err := exp.StoreFile(dest, rd, fileEntry.Stat().Holes()); err != nil {
 				snap.Event(events.FileErrorEvent(snap.Header.SnapshotID, pathname, err.Error()))
 			} else if err := exp.SetPermissions(dest, fileEntry.Stat()); err != nil {
 				snap.Event(events.FileErrorEvent(snap.Header.SnapshotID, pathname, err.Error()))
@@ -127,6 +131,11 @@ func (snap *Snapshot) Restore(exp *exporter.Exporter, base string, pathname stri
 		return err
 	}
 
+	if restorePackfiles > 0 {
+		snap.packfiles = snap.repository.NewPackfileCache(restorePackfiles)
+		defer func() { snap.packfiles = nil }()
+	}
+
 	restoreContext := &restoreContext{
 		hardlinks:      make(map[string]string),
 		hardlinksMutex: sync.Mutex{},
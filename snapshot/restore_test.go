@@ -0,0 +1,104 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+)
+
+func TestRestorePreservesMetadata(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	subDir := filepath.Join(sourceDir, "sub")
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(subDir, "file.txt")
+	if err := os.WriteFile(file, []byte("old content"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	mtimes := map[string]time.Time{
+		"sub":          time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		"sub/file.txt": time.Date(2019, 6, 7, 8, 9, 10, 0, time.UTC),
+	}
+	for name, mtime := range mtimes {
+		if err := os.Chtimes(filepath.Join(sourceDir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap := backupTo(t, newTestRepository(t), sourceDir, nil)
+
+	targetDir := filepath.Join(tmpDir, "target")
+	exp, err := exporter.NewExporter(targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Close()
+	if err := snap.Restore(exp, targetDir, filepath.ToSlash(sourceDir), &RestoreOptions{MaxConcurrency: 1, Rebase: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, mtime := range mtimes {
+		info, err := os.Stat(filepath.Join(targetDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: expected mtime %v, got %v", name, mtime, info.ModTime())
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(targetDir, "sub/file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640, got %04o", info.Mode().Perm())
+	}
+}
+
+// BenchmarkRestore restores a directory of small files, with and without
+// keeping packfiles in memory.
+func BenchmarkRestore(b *testing.B) {
+	sourceDir := b.TempDir()
+	createFiles(b, sourceDir, 200)
+	snap := backupSnapshot(b, sourceDir)
+
+	for _, packfiles := range []int{0, restorePackfiles} {
+		b.Run(fmt.Sprintf("packfiles=%d", packfiles), func(b *testing.B) {
+			defer func(saved int) { restorePackfiles = saved }(restorePackfiles)
+			restorePackfiles = packfiles
+
+			for n := 0; n < b.N; n++ {
+				targetDir := b.TempDir()
+				exp, err := exporter.NewExporter(targetDir)
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = snap.Restore(exp, targetDir, filepath.ToSlash(sourceDir), &RestoreOptions{MaxConcurrency: 8, Rebase: true})
+				exp.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.StopTimer()
+				data, err := os.ReadFile(filepath.Join(targetDir, "file-00199"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if string(data) != "199" {
+					b.Fatalf("unexpected content %q", data)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -24,11 +24,19 @@ import (
 )
 
 type Snapshot struct {
-	repository *repository.Repository
-	stateDelta *state.State
+	repository   *repository.Repository
+	stateDelta   *state.State
+	muStateDelta sync.Mutex
+
+	// path to the checkpoint of the backup in progress, if any
+	checkpoint     string
+	lastCheckpoint time.Time
 
 	filesystem *vfs.Filesystem
 
+	// set while restoring, chunks are read through it
+	packfiles *repository.PackfileCache
+
 	SkipDirs []string
 
 	Header *header.Header
@@ -396,6 +404,9 @@ func GetSnapshot(repo *repository.Repository, snapshotID [32]byte) (*header.Head
 	if err != nil {
 		return nil, false, err
 	}
+	if closer, ok := rd.(io.Closer); ok {
+		defer closer.Close()
+	}
 
 	buffer, err := io.ReadAll(rd)
 	if err != nil {
@@ -471,13 +482,19 @@ func (snap *Snapshot) PutSignature(checksum [32]byte, data []byte) error {
 }
 
 func (snap *Snapshot) PutChunk(checksum [32]byte, data []byte) error {
+	return snap.putChunk(checksum, data, true)
+}
+
+// putChunk stores a chunk, compressed or not as the repository records it
+// within the blob.
+func (snap *Snapshot) putChunk(checksum [32]byte, data []byte, compress bool) error {
 	t0 := time.Now()
 	defer func() {
 		profiler.RecordEvent("snapshot.PutChunk", time.Since(t0))
 	}()
 	logger.Trace("snapshot", "%x: PutChunk(%064x)", snap.Header.GetIndexShortID(), checksum)
 
-	encoded, err := snap.repository.Encode(data)
+	encoded, err := snap.repository.EncodeChunk(checksum, data, compress)
 	if err != nil {
 		return err
 	}
@@ -626,6 +643,9 @@ func (snap *Snapshot) PutPackfile(pack *packfile.PackFile, objects [][32]byte, c
 	atomic.AddUint64(&snap.statistics.PackfilesTransferCount, 1)
 	atomic.AddUint64(&snap.statistics.PackfilesTransferSize, uint64(len(serializedPackfile)))
 
+	snap.muStateDelta.Lock()
+	defer snap.muStateDelta.Unlock()
+
 	for _, chunkChecksum := range chunks {
 		for idx, blob := range pack.Index {
 			if blob.Checksum == chunkChecksum && blob.Type == packfile.TYPE_CHUNK {
@@ -737,6 +757,7 @@ func (snap *Snapshot) PutPackfile(pack *packfile.PackFile, objects [][32]byte, c
 			}
 		}
 	}
+	snap.saveCheckpoint()
 	return nil
 }
 
@@ -760,6 +781,19 @@ func (snapshot *Snapshot) GetChunk(checksum [32]byte) ([]byte, error) {
 	return buffer, nil
 }
 
+func (snapshot *Snapshot) GetChunks(checksums []objects.Checksum) (map[objects.Checksum][]byte, error) {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("snapshot.GetChunks", time.Since(t0))
+	}()
+	logger.Trace("snapshot", "%x: GetChunks(%d chunks)", snapshot.Header.GetIndexShortID(), len(checksums))
+
+	if snapshot.packfiles != nil {
+		return snapshot.packfiles.GetChunks(checksums)
+	}
+	return snapshot.repository.GetChunks(checksums)
+}
+
 func (snapshot *Snapshot) GetFile(checksum [32]byte) ([]byte, error) {
 	t0 := time.Now()
 	defer func() {
@@ -820,6 +854,16 @@ func (snapshot *Snapshot) CheckDirectory(checksum [32]byte) bool {
 	return snapshot.Repository().DirectoryExists(checksum)
 }
 
+func (snapshot *Snapshot) CheckData(checksum [32]byte) bool {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("snapshot.CheckData", time.Since(t0))
+	}()
+	logger.Trace("snapshot", "%x: CheckData(%064x)", snapshot.Header.GetIndexShortID(), checksum)
+
+	return snapshot.Repository().DataExists(checksum)
+}
+
 func (snapshot *Snapshot) CheckChunk(checksum [32]byte) bool {
 	t0 := time.Now()
 	defer func() {
@@ -876,8 +920,12 @@ func (snapshot *Snapshot) Commit() error {
 	}
 
 	if kp := snapshot.repository.Context().GetKeypair(); kp != nil {
-		serializedHdrChecksum := snapshot.repository.Checksum(serializedHdr)
-		signature := kp.Sign(serializedHdrChecksum[:])
+		canonicalHdr, err := snapshot.Header.CanonicalBytes()
+		if err != nil {
+			return err
+		}
+		canonicalHdrChecksum := snapshot.repository.Checksum(canonicalHdr)
+		signature := kp.Sign(canonicalHdrChecksum[:])
 		if err := snapshot.PutSignature(snapshot.Header.SnapshotID, signature); err != nil {
 			return err
 		}
@@ -0,0 +1,73 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+	"github.com/google/uuid"
+)
+
+// newTestStore creates a repository at location, with its cache in a
+// temporary directory. A nil configuration is the default one, without
+// encryption.
+func newTestStore(tb testing.TB, location string, configuration *storage.Configuration) *storage.Store {
+	tb.Helper()
+	if configuration == nil {
+		configuration = storage.NewConfiguration()
+		configuration.Encryption = nil
+	}
+	ctx := context.NewContext()
+	ctx.SetCacheDir(filepath.Join(tb.TempDir(), "cache"))
+	store, err := storage.Create(ctx, location, *configuration)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return store
+}
+
+// openRepository opens store, loading its current state.
+func openRepository(tb testing.TB, store *storage.Store) *repository.Repository {
+	tb.Helper()
+	repo, err := repository.New(store, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return repo
+}
+
+// newTestRepository creates an unencrypted repository in a temporary
+// directory.
+func newTestRepository(tb testing.TB) *repository.Repository {
+	tb.Helper()
+	return openRepository(tb, newTestStore(tb, filepath.Join(tb.TempDir(), "repo"), nil))
+}
+
+// backupTo backs sourceDir up to repo and loads the snapshot, signed if
+// the context of the repository has a keypair. A nil options backs up
+// with a single worker.
+func backupTo(tb testing.TB, repo *repository.Repository, sourceDir string, options *PushOptions) *Snapshot {
+	tb.Helper()
+	if options == nil {
+		options = &PushOptions{MaxConcurrency: 1}
+	}
+	snapshotID := repo.Checksum([]byte(uuid.NewString()))
+	snap, err := New(repo, snapshotID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if kp := repo.Context().GetKeypair(); kp != nil {
+		snap.Header.Identity.Identifier = repo.Context().GetIdentity()
+		snap.Header.Identity.PublicKey = kp.PublicKey
+	}
+	if err := snap.Backup(sourceDir, options); err != nil {
+		tb.Fatal(err)
+	}
+	snap, err = Load(repo, snapshotID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return snap
+}
@@ -0,0 +1,91 @@
+//go:build linux || darwin || freebsd
+
+package snapshot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/snapshot/exporter"
+	"github.com/PlakarKorp/plakar/snapshot/vfs"
+
+	_ "github.com/PlakarKorp/plakar/snapshot/exporter/fs"
+)
+
+func TestSparseFileRoundTrip(t *testing.T) {
+	const size = 64 << 20
+
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// data at both ends of the file and a 60MB hole in between
+	source := filepath.Join(sourceDir, "disk.img")
+	fp, err := os.Create(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := bytes.Repeat([]byte("head"), 1024)
+	tail := bytes.Repeat([]byte("tail"), 1024)
+	if _, err := fp.Write(head); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fp.WriteAt(tail, size-int64(len(tail))); err != nil {
+		t.Fatal(err)
+	}
+	fp.Close()
+
+	allocated := func(pathname string) int64 {
+		info, err := os.Stat(pathname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Sys().(*syscall.Stat_t).Blocks * 512
+	}
+	if allocated(source) >= size {
+		t.Skip("filesystem doesn't support sparse files")
+	}
+
+	snap := backupTo(t, newTestRepository(t), sourceDir, nil)
+	fs, err := snap.Filesystem()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := fs.Stat(filepath.ToSlash(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holes := entry.(*vfs.FileEntry).Stat().Holes(); len(holes) == 0 {
+		t.Fatal("expected the holes of the file to be recorded")
+	}
+
+	targetDir := filepath.Join(tmpDir, "target")
+	exp, err := exporter.NewExporter(targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Close()
+	if err := snap.Restore(exp, targetDir, filepath.ToSlash(sourceDir), &RestoreOptions{MaxConcurrency: 1, Rebase: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := filepath.Join(targetDir, "disk.img")
+	data, err := os.ReadFile(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := make([]byte, size)
+	copy(expected, head)
+	copy(expected[size-len(tail):], tail)
+	if !bytes.Equal(data, expected) {
+		t.Fatal("restored content differs")
+	}
+	if a := allocated(restored); a >= size/2 {
+		t.Fatalf("expected the restored file to be sparse, %d bytes allocated", a)
+	}
+}
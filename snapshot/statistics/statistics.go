@@ -1,6 +1,8 @@
 package statistics
 
 import (
+	"reflect"
+	"sync/atomic"
 	"time"
 
 	"github.com/vmihailenco/msgpack/v5"
@@ -74,6 +76,26 @@ func FromBytes(data []byte) (*Statistics, error) {
 	return s, nil
 }
 
+// Load returns a copy of the statistics. The counters are updated with
+// atomic.AddUint64 while a backup runs, so they are read atomically too
+// and the copy can be inspected or serialized safely.
+func (s *Statistics) Load() *Statistics {
+	ret := &Statistics{}
+	src := reflect.ValueOf(s).Elem()
+	dst := reflect.ValueOf(ret).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Field(i)
+		if counter, ok := field.Addr().Interface().(*uint64); ok {
+			dst.Field(i).SetUint(atomic.LoadUint64(counter))
+		} else {
+			dst.Field(i).Set(field)
+		}
+	}
+	return ret
+}
+
+// Serialize may be called while a backup still updates the counters,
+// the durations however are only set once their stage completed.
 func (s *Statistics) Serialize() ([]byte, error) {
-	return msgpack.Marshal(s)
+	return msgpack.Marshal(s.Load())
 }
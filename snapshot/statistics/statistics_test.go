@@ -0,0 +1,48 @@
+package statistics
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSerialize(t *testing.T) {
+	s := New()
+	s.ImporterStart = time.Now()
+
+	// run with -race: serializing while the counters are updated must not
+	// be reported
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				atomic.AddUint64(&s.ImporterFiles, 1)
+				atomic.AddUint64(&s.ImporterSize, 10)
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := s.Serialize(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	data, err := s.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := FromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ImporterFiles != 4000 || loaded.ImporterSize != 40000 {
+		t.Fatalf("unexpected counters %d and %d", loaded.ImporterFiles, loaded.ImporterSize)
+	}
+	if !loaded.ImporterStart.Equal(s.ImporterStart) {
+		t.Fatalf("expected start %v, got %v", s.ImporterStart, loaded.ImporterStart)
+	}
+}
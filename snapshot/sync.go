@@ -0,0 +1,77 @@
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/repository"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+type SyncReport struct {
+	CopyReport
+	Pruned int // packfiles and states deleted from the destination
+}
+
+// Sync brings a copy of the repository up to date by pushing the
+// packfiles and states it lacks. With prune, the packfiles and states that
+// the repository no longer holds, such as those removed by a garbage
+// collection, are deleted from the destination too.
+func Sync(repo *repository.Repository, dst *storage.Store, prune bool) (*SyncReport, error) {
+	copied, err := Copy(repo, dst, nil)
+	if err != nil {
+		return nil, err
+	}
+	report := &SyncReport{CopyReport: *copied}
+	if !prune {
+		return report, nil
+	}
+
+	// packfiles are listed before states: a collection running meanwhile
+	// deletes the states before the packfiles they locate, so a state kept
+	// here never locates a pruned packfile.
+	srcPackfiles, err := repo.GetPackfiles()
+	if err != nil {
+		return report, err
+	}
+	srcStates, err := repo.GetStates()
+	if err != nil {
+		return report, err
+	}
+	keep := make(map[objects.Checksum]struct{}, len(srcPackfiles)+len(srcStates))
+	for _, checksum := range srcPackfiles {
+		keep[checksum] = struct{}{}
+	}
+	for _, checksum := range srcStates {
+		keep[checksum] = struct{}{}
+	}
+
+	dstStates, err := dst.GetStates()
+	if err != nil {
+		return report, err
+	}
+	for _, checksum := range dstStates {
+		if _, found := keep[checksum]; found {
+			continue
+		}
+		if err := dst.DeleteState(checksum); err != nil {
+			return report, fmt.Errorf("state %x: %w", checksum, err)
+		}
+		report.Pruned++
+	}
+
+	dstPackfiles, err := dst.GetPackfiles()
+	if err != nil {
+		return report, err
+	}
+	for _, checksum := range dstPackfiles {
+		if _, found := keep[checksum]; found {
+			continue
+		}
+		if err := dst.DeletePackfile(checksum); err != nil {
+			return report, fmt.Errorf("packfile %x: %w", checksum, err)
+		}
+		report.Pruned++
+	}
+	return report, nil
+}
@@ -0,0 +1,124 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/google/uuid"
+
+	_ "github.com/PlakarKorp/plakar/storage/backends/memory"
+)
+
+func TestSync(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	src := newTestStore(t, "memory://src-"+uuid.NewString(), nil)
+	configuration := src.Configuration()
+	dst := newTestStore(t, "memory://dst-"+uuid.NewString(), &configuration)
+
+	backup := func(name string) objects.Checksum {
+		sourceDir := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(sourceDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("content of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return backupTo(t, openRepository(t, src), sourceDir, nil).Header.SnapshotID
+	}
+
+	// sync pushes the source to the destination and checks that both then
+	// hold the same packfiles, states and snapshots.
+	sync := func(prune bool) *SyncReport {
+		t.Helper()
+		srcRepo := openRepository(t, src)
+		report, err := Sync(srcRepo, dst, prune)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srcObjects, err := storeObjects(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstObjects, err := storeObjects(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for checksum := range srcObjects {
+			if _, found := dstObjects[checksum]; !found {
+				t.Fatalf("%x is missing from the destination", checksum)
+			}
+		}
+		if prune && len(dstObjects) != len(srcObjects) {
+			t.Fatalf("expected %d objects in the destination, got %d", len(srcObjects), len(dstObjects))
+		}
+
+		dstRepo := openRepository(t, dst)
+		srcSnapshots, err := srcRepo.GetSnapshots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dstSnapshots, err := dstRepo.GetSnapshots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dstSnapshots) != len(srcSnapshots) {
+			t.Fatalf("expected %d snapshots, got %d", len(srcSnapshots), len(dstSnapshots))
+		}
+		for _, snapshotID := range dstSnapshots {
+			snap, err := Load(dstRepo, snapshotID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := snap.Check("/", &CheckOptions{MaxConcurrency: 1}); err != nil || !ok {
+				t.Fatalf("snapshot %x failed its check: %v", snapshotID, err)
+			}
+		}
+		return report
+	}
+
+	backup("first")
+	full := sync(false)
+	if full.Packfiles == 0 || full.States == 0 || full.Bytes == 0 || full.Skipped != 0 {
+		t.Fatalf("unexpected report %+v", full)
+	}
+
+	// only the objects of the new snapshot are pushed
+	backup("second")
+	incremental := sync(false)
+	if incremental.Packfiles == 0 || incremental.States != 1 {
+		t.Fatalf("unexpected report %+v", incremental)
+	}
+	if incremental.Skipped != full.Packfiles+full.States {
+		t.Fatalf("expected %d objects to be skipped, got %+v", full.Packfiles+full.States, incremental)
+	}
+
+	noop := sync(false)
+	if noop.Packfiles != 0 || noop.States != 0 || noop.Bytes != 0 {
+		t.Fatalf("unexpected report %+v", noop)
+	}
+
+	// deletions on the source are only mirrored with prune
+	if err := openRepository(t, src).ReplaceStates(); err != nil {
+		t.Fatal(err)
+	}
+	kept := sync(false)
+	if kept.Pruned != 0 {
+		t.Fatalf("unexpected report %+v", kept)
+	}
+	states, err := dst.GetStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != full.States+incremental.States+kept.States {
+		t.Fatalf("expected the previous states to be kept, got %d", len(states))
+	}
+
+	pruned := sync(true)
+	if pruned.Pruned != full.States+incremental.States {
+		t.Fatalf("unexpected report %+v", pruned)
+	}
+}
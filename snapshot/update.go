@@ -0,0 +1,78 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/packfile"
+	"github.com/PlakarKorp/plakar/profiler"
+	"github.com/PlakarKorp/plakar/repository/state"
+	"github.com/PlakarKorp/plakar/snapshot/statistics"
+	"github.com/google/uuid"
+)
+
+var ErrNotSigner = errors.New("snapshot is signed by another identity")
+
+// UpdateHeader stores the header of a loaded snapshot after it was
+// modified, replacing the previous one. A signed snapshot is signed again,
+// which requires the keypair of its identity.
+func (snap *Snapshot) UpdateHeader() error {
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("snapshot.UpdateHeader", time.Since(t0))
+	}()
+	logger.Trace("snapshot", "%x: UpdateHeader()", snap.Header.GetIndexShortID())
+
+	repo := snap.repository
+
+	// the previous header is deleted along with the states locating it
+	if err := repo.Store().CheckDelete(); err != nil {
+		return err
+	}
+
+	serializedHdr, err := snap.Header.Serialize()
+	if err != nil {
+		return err
+	}
+	encodedHdr, err := repo.Encode(serializedHdr)
+	if err != nil {
+		return err
+	}
+
+	pack := packfile.New()
+	pack.AddBlob(packfile.TYPE_SNAPSHOT, snap.Header.SnapshotID, encodedHdr)
+	signatures := [][32]byte{}
+
+	if snap.Header.Identity.Identifier != uuid.Nil {
+		kp := repo.Context().GetKeypair()
+		if kp == nil || !bytes.Equal(kp.PublicKey, snap.Header.Identity.PublicKey) {
+			return ErrNotSigner
+		}
+		canonicalHdr, err := snap.Header.CanonicalBytes()
+		if err != nil {
+			return err
+		}
+		canonicalHdrChecksum := repo.Checksum(canonicalHdr)
+		encodedSignature, err := repo.Encode(kp.Sign(canonicalHdrChecksum[:]))
+		if err != nil {
+			return err
+		}
+		pack.AddBlob(packfile.TYPE_SIGNATURE, snap.Header.SnapshotID, encodedSignature)
+		signatures = append(signatures, snap.Header.SnapshotID)
+	}
+
+	// the location of the previous header would be kept otherwise
+	repo.ForgetSnapshot(snap.Header.SnapshotID)
+
+	snap.stateDelta = state.New()
+	snap.statistics = statistics.New()
+	if err := snap.PutPackfile(pack, nil, nil, nil, nil, nil, signatures, [][32]byte{snap.Header.SnapshotID}); err != nil {
+		return err
+	}
+
+	// the previous states still point to the previous header, merging them
+	// with one pointing to the new header could pick either.
+	return repo.ReplaceStates()
+}
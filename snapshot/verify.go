@@ -2,25 +2,57 @@ package snapshot
 
 import (
 	"crypto/ed25519"
+	"errors"
 
 	"github.com/google/uuid"
 )
 
-func (snap *Snapshot) Verify() (bool, error) {
+var (
+	ErrNotSigned        = errors.New("snapshot is not signed")
+	ErrInvalidSignature = errors.New("snapshot signature is invalid")
+)
+
+// VerifyHeader checks the signature of the snapshot header against
+// publicKey.  Unlike Verify it does not trust the key recorded in the
+// header, so a header whose identity was swapped along with its
+// signature is caught.  It returns ErrNotSigned if the snapshot carries
+// no signature and ErrInvalidSignature if the signature doesn't match.
+func (snap *Snapshot) VerifyHeader(publicKey ed25519.PublicKey) error {
 	if snap.Header.Identity.Identifier == uuid.Nil {
-		return false, nil
+		return ErrNotSigned
+	}
+	if !snap.repository.SignatureExists(snap.Header.SnapshotID) {
+		return ErrNotSigned
 	}
 
 	signature, err := snap.GetSignature(snap.Header.SnapshotID)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	serializedHdr, err := snap.Header.Serialize()
-	if err != nil {
-		return false, err
+	if len(publicKey) != ed25519.PublicKeySize {
+		return ErrInvalidSignature
 	}
-	serializedHdrChecksum := snap.repository.Checksum(serializedHdr)
 
-	return ed25519.Verify(snap.Header.Identity.PublicKey, serializedHdrChecksum[:], signature), nil
+	// snapshots used to be signed over the plain serialization of their
+	// header, keep accepting those.
+	for _, serialize := range []func() ([]byte, error){snap.Header.CanonicalBytes, snap.Header.Serialize} {
+		serializedHdr, err := serialize()
+		if err != nil {
+			return err
+		}
+		serializedHdrChecksum := snap.repository.Checksum(serializedHdr)
+		if ed25519.Verify(publicKey, serializedHdrChecksum[:], signature) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func (snap *Snapshot) Verify() (bool, error) {
+	err := snap.VerifyHeader(snap.Header.Identity.PublicKey)
+	if errors.Is(err, ErrNotSigned) || errors.Is(err, ErrInvalidSignature) {
+		return false, nil
+	}
+	return err == nil, err
 }
@@ -0,0 +1,53 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/encryption/keypair"
+)
+
+func TestVerifyHeader(t *testing.T) {
+	sourceDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sourceDir, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	kp, err := keypair.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := keypair.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap := backupSignedSnapshot(t, sourceDir, kp)
+	if err := snap.VerifyHeader(kp.PublicKey); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	if ok, err := snap.Verify(); err != nil || !ok {
+		t.Fatalf("expected Verify to succeed, got %v, %v", ok, err)
+	}
+	if err := snap.VerifyHeader(other.PublicKey); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature with another key, got %v", err)
+	}
+
+	snap.Header.Tags = append(snap.Header.Tags, "tampered")
+	if err := snap.VerifyHeader(kp.PublicKey); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature on a tampered header, got %v", err)
+	}
+	if ok, err := snap.Verify(); err != nil || ok {
+		t.Fatalf("expected Verify to fail on a tampered header, got %v, %v", ok, err)
+	}
+
+	unsigned := backupSnapshot(t, sourceDir)
+	if err := unsigned.VerifyHeader(kp.PublicKey); !errors.Is(err, ErrNotSigned) {
+		t.Fatalf("expected ErrNotSigned, got %v", err)
+	}
+	if ok, err := unsigned.Verify(); err != nil || ok {
+		t.Fatalf("expected Verify to fail on an unsigned snapshot, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,212 @@
+package vfs
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/PlakarKorp/plakar/objects"
+)
+
+type DiffKind int8
+
+const (
+	DiffAdded DiffKind = iota
+	DiffRemoved
+	DiffChanged
+)
+
+func (kind DiffKind) String() string {
+	switch kind {
+	case DiffAdded:
+		return "+"
+	case DiffRemoved:
+		return "-"
+	case DiffChanged:
+		return "~"
+	default:
+		return "?"
+	}
+}
+
+type Difference struct {
+	Kind     DiffKind
+	Pathname string
+
+	// Fields lists what differs for a changed path
+	Fields []string
+}
+
+// Diff returns the paths under pathname that were added, removed or
+// changed in other.  Subtrees sharing the same checksum in both
+// filesystems are identical and are not walked.
+func (fsc *Filesystem) Diff(other *Filesystem, pathname string) ([]Difference, error) {
+	pathname = path.Clean("/" + pathname)
+
+	entry1, err1 := fsc.Stat(pathname)
+	entry2, err2 := other.Stat(pathname)
+	if err1 != nil && err2 != nil {
+		return nil, fmt.Errorf("%s: not found in both filesystems", pathname)
+	}
+
+	differences := make([]Difference, 0)
+	if err1 != nil {
+		return other.walkDifferences(DiffAdded, pathname, entry2, differences)
+	}
+	if err2 != nil {
+		return fsc.walkDifferences(DiffRemoved, pathname, entry1, differences)
+	}
+	return fsc.diffEntries(other, pathname, entry1, entry2, differences)
+}
+
+func (fsc *Filesystem) diffEntries(other *Filesystem, pathname string, entry1, entry2 FSEntry, differences []Difference) ([]Difference, error) {
+	dirEntry1, isDir1 := entry1.(*DirEntry)
+	dirEntry2, isDir2 := entry2.(*DirEntry)
+
+	// a path that changed type is reported as replaced
+	if isDir1 != isDir2 {
+		differences, err := fsc.walkDifferences(DiffRemoved, pathname, entry1, differences)
+		if err != nil {
+			return nil, err
+		}
+		return other.walkDifferences(DiffAdded, pathname, entry2, differences)
+	}
+
+	var fields []string
+	if isDir1 {
+		fields = diffFileInfo(dirEntry1.FileInfo, dirEntry2.FileInfo)
+	} else {
+		fileEntry1 := entry1.(*FileEntry)
+		fileEntry2 := entry2.(*FileEntry)
+		fields = diffFileInfo(fileEntry1.FileInfo, fileEntry2.FileInfo)
+		if objectChecksum(fileEntry1.Object) != objectChecksum(fileEntry2.Object) {
+			fields = append(fields, "content")
+		}
+		if fileEntry1.SymlinkTarget != fileEntry2.SymlinkTarget {
+			fields = append(fields, "target")
+		}
+	}
+	if len(fields) != 0 {
+		differences = append(differences, Difference{Kind: DiffChanged, Pathname: pathname, Fields: fields})
+	}
+
+	if !isDir1 {
+		return differences, nil
+	}
+
+	children1 := make(map[string]ChildEntry)
+	for _, child := range dirEntry1.Children {
+		children1[child.Stat().Name()] = child
+	}
+	children2 := make(map[string]ChildEntry)
+	for _, child := range dirEntry2.Children {
+		children2[child.Stat().Name()] = child
+	}
+
+	names := make([]string, 0, len(children1)+len(children2))
+	for name := range children1 {
+		names = append(names, name)
+	}
+	for name := range children2 {
+		if _, exists := children1[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		childPathname := path.Join(pathname, name)
+		child1, exists1 := children1[name]
+		child2, exists2 := children2[name]
+
+		var err error
+		switch {
+		case exists1 && exists2:
+			if child1.Checksum() == child2.Checksum() {
+				continue
+			}
+			var childEntry1, childEntry2 FSEntry
+			if childEntry1, err = fsc.entry(child1.Checksum()); err != nil {
+				return nil, err
+			}
+			if childEntry2, err = other.entry(child2.Checksum()); err != nil {
+				return nil, err
+			}
+			differences, err = fsc.diffEntries(other, childPathname, childEntry1, childEntry2, differences)
+		case exists1:
+			differences, err = fsc.walkChildDifferences(DiffRemoved, childPathname, child1, differences)
+		default:
+			differences, err = other.walkChildDifferences(DiffAdded, childPathname, child2, differences)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return differences, nil
+}
+
+func (fsc *Filesystem) walkChildDifferences(kind DiffKind, pathname string, child ChildEntry, differences []Difference) ([]Difference, error) {
+	entry, err := fsc.entry(child.Checksum())
+	if err != nil {
+		return nil, err
+	}
+	return fsc.walkDifferences(kind, pathname, entry, differences)
+}
+
+// walkDifferences reports pathname and everything below it as added or
+// removed.
+func (fsc *Filesystem) walkDifferences(kind DiffKind, pathname string, entry FSEntry, differences []Difference) ([]Difference, error) {
+	differences = append(differences, Difference{Kind: kind, Pathname: pathname})
+
+	dirEntry, isDir := entry.(*DirEntry)
+	if !isDir {
+		return differences, nil
+	}
+
+	children := make([]ChildEntry, len(dirEntry.Children))
+	copy(children, dirEntry.Children)
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Stat().Name() < children[j].Stat().Name()
+	})
+
+	var err error
+	for _, child := range children {
+		differences, err = fsc.walkChildDifferences(kind, path.Join(pathname, child.Stat().Name()), child, differences)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return differences, nil
+}
+
+// entry loads the file or directory entry with the given checksum.
+func (fsc *Filesystem) entry(checksum [32]byte) (FSEntry, error) {
+	return fsc.statRecursive(checksum, nil)
+}
+
+func diffFileInfo(info1, info2 objects.FileInfo) []string {
+	fields := make([]string, 0)
+	if info1.Size() != info2.Size() {
+		fields = append(fields, "size")
+	}
+	if info1.Mode() != info2.Mode() {
+		fields = append(fields, "mode")
+	}
+	if !info1.ModTime().Equal(info2.ModTime()) {
+		fields = append(fields, "mtime")
+	}
+	if info1.Uid() != info2.Uid() {
+		fields = append(fields, "uid")
+	}
+	if info1.Gid() != info2.Gid() {
+		fields = append(fields, "gid")
+	}
+	return fields
+}
+
+func objectChecksum(object *objects.Object) objects.Checksum {
+	if object == nil {
+		return objects.Checksum{}
+	}
+	return object.Checksum
+}
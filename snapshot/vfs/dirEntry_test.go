@@ -0,0 +1,92 @@
+package vfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/compression"
+	"github.com/PlakarKorp/plakar/objects"
+	"github.com/PlakarKorp/plakar/snapshot/importer"
+)
+
+func TestDirEntrySummaryRoundTrip(t *testing.T) {
+	dirEntry := NewDirectoryEntry("/", &importer.ScanRecord{
+		Type:     importer.RecordTypeDirectory,
+		FileInfo: objects.NewFileInfo("dir", 0, os.ModeDir|0755, time.Now(), 0, 0, 0, 0, 1),
+	})
+	dirEntry.AddFileChild([32]byte{1}, objects.NewFileInfo("file", 42, 0644, time.Now(), 0, 0, 0, 0, 1))
+	dirEntry.AddDirectoryChild([32]byte{2}, objects.NewFileInfo("subdir", 0, os.ModeDir|0755, time.Now(), 0, 0, 0, 0, 1),
+		&Summary{Directory: Directory{Files: 3, Size: 300}})
+	dirEntry.Summary.Directory.Files = 1
+	dirEntry.Summary.Directory.Directories = 1
+	dirEntry.Summary.Directory.Size = 42
+	dirEntry.Summary.Below.Files = 3
+	dirEntry.Summary.Below.Size = 300
+
+	serialized, err := dirEntry.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := DirEntryFromBytes(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Summary.Directory != dirEntry.Summary.Directory {
+		t.Fatalf("expected %+v, got %+v", dirEntry.Summary.Directory, loaded.Summary.Directory)
+	}
+	if loaded.Summary.Below != dirEntry.Summary.Below {
+		t.Fatalf("expected %+v, got %+v", dirEntry.Summary.Below, loaded.Summary.Below)
+	}
+	if len(loaded.Children) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(loaded.Children))
+	}
+	if loaded.Children[0].Lsummary != nil {
+		t.Fatalf("unexpected summary for a file child")
+	}
+	if summary := loaded.Children[1].Lsummary; summary == nil || summary.Directory.Files != 3 || summary.Directory.Size != 300 {
+		t.Fatalf("unexpected child summary %+v", summary)
+	}
+}
+
+// BenchmarkDirEntryCompression reports how much the repository
+// compression, applied to every blob by Repository.Encode, shrinks the
+// serialization of a large directory.
+func BenchmarkDirEntryCompression(b *testing.B) {
+	dirEntry := NewDirectoryEntry("/", &importer.ScanRecord{
+		Type:     importer.RecordTypeDirectory,
+		FileInfo: objects.NewFileInfo("dir", 0, os.ModeDir|0755, time.Now(), 0, 0, 0, 0, 1),
+	})
+	for i := 0; i < 100000; i++ {
+		checksum := sha256.Sum256([]byte(fmt.Sprint(i)))
+		dirEntry.AddFileChild(checksum, objects.NewFileInfo(fmt.Sprintf("file-%06d.txt", i), int64(i), 0644, time.Now(), 0, 1000, 1000, 1, 1))
+	}
+	serialized, err := dirEntry.Serialize()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, algorithm := range []string{"LZ4", "GZIP"} {
+		b.Run(algorithm, func(b *testing.B) {
+			var compressed []byte
+			for i := 0; i < b.N; i++ {
+				rd, err := compression.DeflateStream(algorithm, bytes.NewReader(serialized))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if compressed, err = io.ReadAll(rd); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.SetBytes(int64(len(serialized)))
+			b.ReportMetric(float64(len(serialized)), "raw-bytes")
+			b.ReportMetric(float64(len(compressed)), "compressed-bytes")
+			b.ReportMetric(float64(len(serialized))/float64(len(compressed)), "ratio")
+		})
+	}
+}
@@ -3,14 +3,23 @@ package vfs
 import (
 	"fmt"
 	"io"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/PlakarKorp/plakar/objects"
 	"github.com/PlakarKorp/plakar/repository"
 )
 
 const VERSION = 001
 
+// maxSymlinks bounds the number of symlinks followed while resolving a
+// pathname, as the kernel does, so that loops are reported.
+const maxSymlinks = 40
+
 type ExtendedAttribute struct {
 	Name  string `msgpack:"name"`
 	Value []byte `msgpack:"value"`
@@ -32,7 +41,14 @@ type Filesystem struct {
 	rootEntry *DirEntry
 }
 
+// NewFilesystem returns the filesystem whose root directory is root.
+// The filesystems most recently opened are cached by the repository, so
+// it can be called again for the same snapshot at little cost.
 func NewFilesystem(repo *repository.Repository, root [32]byte) (*Filesystem, error) {
+	if fsc, ok := repo.GetFilesystem(root); ok {
+		return fsc.(*Filesystem), nil
+	}
+
 	rd, _, err := repo.GetDirectory(root)
 	if err != nil {
 		return nil, err
@@ -48,11 +64,13 @@ func NewFilesystem(repo *repository.Repository, root [32]byte) (*Filesystem, err
 		return nil, err
 	}
 
-	return &Filesystem{
+	fsc := &Filesystem{
 		repo:      repo,
 		root:      root,
 		rootEntry: dirEntry,
-	}, nil
+	}
+	repo.PutFilesystem(root, fsc)
+	return fsc, nil
 }
 
 func (fsc *Filesystem) directoriesRecursive(checksum [32]byte, out chan string) {
@@ -280,6 +298,156 @@ func (fsc *Filesystem) Stat(path string) (FSEntry, error) {
 	return fsc.statRecursive(fsc.root, components[1:]) // Skip the initial empty component due to leading '/'
 }
 
+// ResolvePath returns pathname with every symlink it traverses, the last
+// component included, replaced by its target as recorded in the snapshot.
+func (fsc *Filesystem) ResolvePath(pathname string) (string, error) {
+	components := strings.Split(pathname, "/")
+	resolved := "/"
+	links := 0
+	for len(components) != 0 {
+		component := components[0]
+		components = components[1:]
+
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		candidate := path.Join(resolved, component)
+		fsEntry, err := fsc.Stat(candidate)
+		if err != nil {
+			return "", err
+		}
+		fileEntry, isFile := fsEntry.(*FileEntry)
+		if !isFile || fileEntry.Stat().Mode()&os.ModeSymlink == 0 {
+			resolved = candidate
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", pathname)
+		}
+		if strings.HasPrefix(fileEntry.SymlinkTarget, "/") {
+			resolved = "/"
+		}
+		components = append(strings.Split(fileEntry.SymlinkTarget, "/"), components...)
+	}
+	return resolved, nil
+}
+
+// StatResolved is like Stat but follows the symlinks along pathname.
+func (fsc *Filesystem) StatResolved(pathname string) (FSEntry, error) {
+	resolved, err := fsc.ResolvePath(pathname)
+	if err != nil {
+		return nil, err
+	}
+	return fsc.Stat(resolved)
+}
+
+// Glob returns the sorted pathnames matching pattern, in the syntax of
+// path.Match: wildcards don't match the separators, so the pattern needs
+// as many components as the pathnames it is looking for.
+func (fsc *Filesystem) Glob(pattern string) ([]string, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	// a plain pathname is a single lookup, no need to walk the tree
+	if !strings.ContainsAny(pattern, "*?[\\") {
+		pattern = path.Clean(pattern)
+		if _, err := fsc.Stat(pattern); err != nil {
+			return []string{}, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	ret := make([]string, 0)
+	for pathname := range fsc.Pathnames() {
+		if matched, _ := path.Match(pattern, pathname); matched {
+			ret = append(ret, pathname)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// WalkSorted calls fn for root and, if it is a directory, for everything
+// below it. Children are visited by name whatever the order the importer
+// recorded them in, so two walks of a snapshot always agree. As with
+// filepath.Walk, fn may return filepath.SkipDir to not descend into a
+// directory, or to skip the rest of the directory holding a file.
+func (fsc *Filesystem) WalkSorted(root string, fn func(pathname string, fileinfo *objects.FileInfo) error) error {
+	if !strings.HasPrefix(root, "/") {
+		root = "/" + root
+	}
+	root = path.Clean(root)
+
+	fsEntry, err := fsc.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	switch entry := fsEntry.(type) {
+	case *FileEntry:
+		err = fn(root, entry.Stat())
+	case *DirEntry:
+		err = fsc.walkSorted(root, entry, fn)
+	default:
+		return fmt.Errorf("%s: unexpected entry type %T", root, fsEntry)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (fsc *Filesystem) walkSorted(pathname string, dirEntry *DirEntry, fn func(pathname string, fileinfo *objects.FileInfo) error) error {
+	if err := fn(pathname, dirEntry.Stat()); err != nil {
+		return err
+	}
+
+	children := make([]ChildEntry, len(dirEntry.Children))
+	copy(children, dirEntry.Children)
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Stat().Name() < children[j].Stat().Name()
+	})
+
+	for _, child := range children {
+		childpath := path.Join(pathname, child.Stat().Name())
+		if !fsc.repo.DirectoryExists(child.Checksum()) {
+			fileinfo := child.Stat()
+			if err := fn(childpath, &fileinfo); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rd, _, err := fsc.repo.GetDirectory(child.Checksum())
+		if err != nil {
+			return err
+		}
+		blob, err := io.ReadAll(rd)
+		if err != nil {
+			return err
+		}
+		childEntry, err := DirEntryFromBytes(blob)
+		if err != nil {
+			return err
+		}
+		if err := fsc.walkSorted(childpath, childEntry, fn); err != nil && err != filepath.SkipDir {
+			return err
+		}
+	}
+	return nil
+}
+
 func (fsc *Filesystem) Children(path string) (<-chan string, error) {
 	fsEntry, err := fsc.Stat(path)
 	if err != nil {
@@ -299,6 +467,55 @@ func (fsc *Filesystem) Children(path string) (<-chan string, error) {
 	return ch, nil
 }
 
+// ChildrenInfo returns the FileInfo of the children of the directory at
+// path as recorded in the directory itself, which spares a Stat of every
+// child when their names alone are not enough.
+func (fsc *Filesystem) ChildrenInfo(path string) ([]objects.FileInfo, error) {
+	fsEntry, err := fsc.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	dirEntry, isDir := fsEntry.(*DirEntry)
+	if !isDir {
+		return nil, fmt.Errorf("path is not a directory")
+	}
+
+	ret := make([]objects.FileInfo, 0, len(dirEntry.Children))
+	for _, child := range dirEntry.Children {
+		ret = append(ret, child.Stat())
+	}
+	return ret, nil
+}
+
+// LookupOwner returns the names of the user and group owning pathname as
+// resolved at backup time, or their numeric ids when they weren't.
+func (fsc *Filesystem) LookupOwner(pathname string) (string, string, error) {
+	fsEntry, err := fsc.Stat(pathname)
+	if err != nil {
+		return "", "", err
+	}
+
+	var fileinfo *objects.FileInfo
+	switch entry := fsEntry.(type) {
+	case *FileEntry:
+		fileinfo = entry.Stat()
+	case *DirEntry:
+		fileinfo = entry.Stat()
+	default:
+		return "", "", fmt.Errorf("%s: unexpected entry type %T", pathname, fsEntry)
+	}
+
+	username := fileinfo.Username()
+	if username == "" {
+		username = strconv.FormatUint(fileinfo.Uid(), 10)
+	}
+	groupname := fileinfo.Groupname()
+	if groupname == "" {
+		groupname = strconv.FormatUint(fileinfo.Gid(), 10)
+	}
+	return username, groupname, nil
+}
+
 func (fsc *Filesystem) fileChecksumsRecursive(checksum [32]byte, out chan [32]byte) {
 	currentEntry := fsc.rootEntry
 	if fsc.root != checksum {
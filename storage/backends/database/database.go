@@ -26,6 +26,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/storage"
 
 	"github.com/mattn/go-sqlite3"
@@ -49,7 +50,7 @@ func init() {
 	storage.Register("database", NewRepository)
 }
 
-func NewRepository() storage.Backend {
+func NewRepository(ctx *context.Context) storage.Backend {
 	return &Repository{}
 }
 
@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/PlakarKorp/plakar/compression"
+	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/logger"
 	"github.com/PlakarKorp/plakar/storage"
 	"github.com/vmihailenco/msgpack/v5"
@@ -43,7 +44,7 @@ func init() {
 	storage.Register("fs", NewRepository)
 }
 
-func NewRepository() storage.Backend {
+func NewRepository(ctx *context.Context) storage.Backend {
 	return &Repository{}
 }
 
@@ -73,6 +74,12 @@ func (repository *Repository) Create(location string, config storage.Configurati
 		os.MkdirAll(filepath.Join(repository.root, "packfiles", fmt.Sprintf("%02x", i)), 0700)
 	}
 
+	return repository.PutConfiguration(config)
+}
+
+// PutConfiguration writes the configuration to a temporary file first so
+// that CONFIG is replaced atomically.
+func (repository *Repository) PutConfiguration(config storage.Configuration) error {
 	configPath := filepath.Join(repository.root, "CONFIG")
 	tmpfile := filepath.Join(repository.PathTmp(), "CONFIG")
 
@@ -97,9 +104,11 @@ func (repository *Repository) Create(location string, config storage.Configurati
 		return err
 	}
 
+	if err := os.Rename(tmpfile, configPath); err != nil {
+		return err
+	}
 	repository.config = config
-
-	return os.Rename(tmpfile, configPath)
+	return nil
 }
 
 func (repository *Repository) Open(location string) error {
@@ -195,6 +204,19 @@ func (repository *Repository) GetPackfile(checksum [32]byte) (io.Reader, uint64,
 	return fp, uint64(info.Size()), nil
 }
 
+func (repository *Repository) StatPackfile(checksum [32]byte) (storage.ObjectStat, error) {
+	pathname := repository.PathPackfile(checksum)
+	if !strings.HasPrefix(pathname, repository.PathPackfiles()) {
+		return storage.ObjectStat{}, fmt.Errorf("invalid path generated from checksum")
+	}
+
+	info, err := os.Stat(pathname)
+	if err != nil {
+		return storage.ObjectStat{}, err
+	}
+	return storage.ObjectStat{Size: uint64(info.Size()), ModTime: info.ModTime()}, nil
+}
+
 func (repository *Repository) GetPackfileBlob(checksum [32]byte, offset uint32, length uint32) (io.Reader, uint32, error) {
 	pathname := repository.PathPackfile(checksum)
 	if !strings.HasPrefix(pathname, repository.PathPackfiles()) {
@@ -244,6 +266,21 @@ func (repository *Repository) DeletePackfile(checksum [32]byte) error {
 	return nil
 }
 
+func (repository *Repository) CheckPackfile(checksum [32]byte) (bool, error) {
+	pathname := repository.PathPackfile(checksum)
+	if !strings.HasPrefix(pathname, repository.PathPackfiles()) {
+		return false, fmt.Errorf("invalid path generated from checksum")
+	}
+
+	if _, err := os.Stat(pathname); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func (repository *Repository) PutPackfile(checksum [32]byte, rd io.Reader, size uint64) error {
 	tmpfile := filepath.Join(repository.PathTmp(), hex.EncodeToString(checksum[:]))
 	if !strings.HasPrefix(tmpfile, repository.PathTmp()) {
@@ -368,3 +405,65 @@ func (repository *Repository) DeleteState(checksum [32]byte) error {
 	}
 	return nil
 }
+
+/* Lock */
+
+// writeLockTmp writes the lock to a temporary file, so that it only ever
+// appears complete under its final name.
+func (repository *Repository) writeLockTmp(rd io.Reader, size uint64) (string, error) {
+	f, err := os.CreateTemp(repository.PathTmp(), "LOCK.*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if n, err := io.Copy(f, rd); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	} else if uint64(n) != size {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("short write")
+	}
+	return f.Name(), nil
+}
+
+func (repository *Repository) CreateLock(rd io.Reader, size uint64) (bool, error) {
+	tmpfile, err := repository.writeLockTmp(rd, size)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmpfile)
+
+	// unlike rename, link fails if the lock exists
+	if err := os.Link(tmpfile, repository.PathLock()); err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (repository *Repository) PutLock(rd io.Reader, size uint64) error {
+	tmpfile, err := repository.writeLockTmp(rd, size)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpfile, repository.PathLock()); err != nil {
+		os.Remove(tmpfile)
+		return err
+	}
+	return nil
+}
+
+func (repository *Repository) GetLock() (io.Reader, uint64, error) {
+	data, err := os.ReadFile(repository.PathLock())
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), uint64(len(data)), nil
+}
+
+func (repository *Repository) DeleteLock() error {
+	return os.Remove(repository.PathLock())
+}
@@ -48,3 +48,7 @@ func (repository *Repository) PathState(checksum [32]byte) string {
 func (repository *Repository) PathPackfile(checksum [32]byte) string {
 	return filepath.Join(repository.PathPackfileBucket(checksum), fmt.Sprintf("%064x", checksum))
 }
+
+func (repository *Repository) PathLock() string {
+	return filepath.Join(repository.root, "LOCK")
+}
@@ -22,7 +22,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/network"
 	"github.com/PlakarKorp/plakar/storage"
 )
@@ -30,6 +33,7 @@ import (
 type Repository struct {
 	config     storage.Configuration
 	Repository string
+	token      string
 }
 
 func init() {
@@ -37,7 +41,7 @@ func init() {
 	storage.Register("http", NewRepository)
 }
 
-func NewRepository() storage.Backend {
+func NewRepository(ctx *context.Context) storage.Backend {
 	return &Repository{}
 }
 
@@ -51,8 +55,44 @@ func (r *Repository) sendRequest(method string, url string, requestType string,
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
 	client := &http.Client{}
-	return client.Do(req)
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		if len(msg) == 0 {
+			return nil, fmt.Errorf("%s %s: %s", method, requestType, res.Status)
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", method, requestType, res.Status, strings.TrimSpace(string(msg)))
+	}
+	return res, nil
+}
+
+// parseLocation splits the bearer token, passed as the userinfo part of
+// the location (https://token@host/), from the url requests are sent to.
+func parseLocation(location string) (string, string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", "", err
+	}
+
+	token := ""
+	if u.User != nil {
+		if password, isSet := u.User.Password(); isSet {
+			token = password
+		} else {
+			token = u.User.Username()
+		}
+		u.User = nil
+	}
+	return strings.TrimSuffix(u.String(), "/"), token, nil
 }
 
 func (repository *Repository) Create(location string, config storage.Configuration) error {
@@ -60,13 +100,20 @@ func (repository *Repository) Create(location string, config storage.Configurati
 }
 
 func (repository *Repository) Open(location string) error {
-	repository.Repository = location
-	r, err := repository.sendRequest("GET", location, "/", network.ReqOpen{
+	endpoint, token, err := parseLocation(location)
+	if err != nil {
+		return err
+	}
+	repository.Repository = endpoint
+	repository.token = token
+
+	r, err := repository.sendRequest("GET", repository.Repository, "/", network.ReqOpen{
 		Repository: "",
 	})
 	if err != nil {
 		return err
 	}
+	defer r.Body.Close()
 
 	var resOpen network.ResOpen
 	if err := json.NewDecoder(r.Body).Decode(&resOpen); err != nil {
@@ -87,6 +134,7 @@ func (repository *Repository) Close() error {
 	if err != nil {
 		return err
 	}
+	defer r.Body.Close()
 
 	var resClose network.ResClose
 	if err := json.NewDecoder(r.Body).Decode(&resClose); err != nil {
@@ -109,6 +157,7 @@ func (repository *Repository) GetStates() ([][32]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer r.Body.Close()
 
 	var resGetStates network.ResGetStates
 	if err := json.NewDecoder(r.Body).Decode(&resGetStates); err != nil {
@@ -138,6 +187,7 @@ func (repository *Repository) PutState(checksum [32]byte, rd io.Reader, size uin
 	if err != nil {
 		return err
 	}
+	defer r.Body.Close()
 
 	var resPutState network.ResPutState
 	if err := json.NewDecoder(r.Body).Decode(&resPutState); err != nil {
@@ -156,6 +206,7 @@ func (repository *Repository) GetState(checksum [32]byte) (io.Reader, uint64, er
 	if err != nil {
 		return nil, 0, err
 	}
+	defer r.Body.Close()
 
 	var resGetState network.ResGetState
 	if err := json.NewDecoder(r.Body).Decode(&resGetState); err != nil {
@@ -174,6 +225,7 @@ func (repository *Repository) DeleteState(checksum [32]byte) error {
 	if err != nil {
 		return err
 	}
+	defer r.Body.Close()
 
 	var resDeleteState network.ResDeleteState
 	if err := json.NewDecoder(r.Body).Decode(&resDeleteState); err != nil {
@@ -191,6 +243,7 @@ func (repository *Repository) GetPackfiles() ([][32]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer r.Body.Close()
 
 	var resGetPackfiles network.ResGetPackfiles
 	if err := json.NewDecoder(r.Body).Decode(&resGetPackfiles); err != nil {
@@ -219,6 +272,7 @@ func (repository *Repository) PutPackfile(checksum [32]byte, rd io.Reader, size
 	if err != nil {
 		return err
 	}
+	defer r.Body.Close()
 
 	var resPutPackfile network.ResPutPackfile
 	if err := json.NewDecoder(r.Body).Decode(&resPutPackfile); err != nil {
@@ -237,6 +291,7 @@ func (repository *Repository) GetPackfile(checksum [32]byte) (io.Reader, uint64,
 	if err != nil {
 		return nil, 0, err
 	}
+	defer r.Body.Close()
 
 	var resGetPackfile network.ResGetPackfile
 	if err := json.NewDecoder(r.Body).Decode(&resGetPackfile); err != nil {
@@ -257,6 +312,7 @@ func (repository *Repository) GetPackfileBlob(checksum [32]byte, offset uint32,
 	if err != nil {
 		return nil, 0, err
 	}
+	defer r.Body.Close()
 
 	var resGetPackfileBlob network.ResGetPackfileBlob
 	if err := json.NewDecoder(r.Body).Decode(&resGetPackfileBlob); err != nil {
@@ -275,6 +331,7 @@ func (repository *Repository) DeletePackfile(checksum [32]byte) error {
 	if err != nil {
 		return err
 	}
+	defer r.Body.Close()
 
 	var resDeletePackfile network.ResDeletePackfile
 	if err := json.NewDecoder(r.Body).Decode(&resDeletePackfile); err != nil {
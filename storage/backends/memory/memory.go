@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+// repositories outlive the backends opening them so that a repository can
+// be created and opened again within the same process, as with the other
+// backends.
+var muRepositories sync.Mutex
+var repositories = make(map[string]*store)
+
+type store struct {
+	mu        sync.Mutex
+	config    storage.Configuration
+	states    map[[32]byte][]byte
+	packfiles map[[32]byte][]byte
+	stored    map[[32]byte]time.Time
+	lock      []byte
+}
+
+type Repository struct {
+	location string
+	repo     *store
+}
+
+func init() {
+	storage.Register("memory", NewRepository)
+}
+
+func NewRepository(ctx *context.Context) storage.Backend {
+	return &Repository{}
+}
+
+func (repository *Repository) Create(location string, config storage.Configuration) error {
+	location = strings.TrimPrefix(location, "memory://")
+
+	muRepositories.Lock()
+	defer muRepositories.Unlock()
+
+	if _, exists := repositories[location]; exists {
+		return fmt.Errorf("%s: %w", location, fs.ErrExist)
+	}
+	repositories[location] = &store{
+		config:    config,
+		states:    make(map[[32]byte][]byte),
+		packfiles: make(map[[32]byte][]byte),
+		stored:    make(map[[32]byte]time.Time),
+	}
+	repository.location = location
+	repository.repo = repositories[location]
+	return nil
+}
+
+func (repository *Repository) Open(location string) error {
+	location = strings.TrimPrefix(location, "memory://")
+
+	muRepositories.Lock()
+	defer muRepositories.Unlock()
+
+	repo, exists := repositories[location]
+	if !exists {
+		return fmt.Errorf("%s: %w", location, fs.ErrNotExist)
+	}
+	repository.location = location
+	repository.repo = repo
+	return nil
+}
+
+func (repository *Repository) Configuration() storage.Configuration {
+	return repository.repo.config
+}
+
+func (repository *Repository) PutConfiguration(config storage.Configuration) error {
+	repository.repo.config = config
+	return nil
+}
+
+func (repository *Repository) Close() error {
+	return nil
+}
+
+func list(mu *sync.Mutex, blobs map[[32]byte][]byte) [][32]byte {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ret := make([][32]byte, 0, len(blobs))
+	for checksum := range blobs {
+		ret = append(ret, checksum)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return bytes.Compare(ret[i][:], ret[j][:]) < 0
+	})
+	return ret
+}
+
+func put(mu *sync.Mutex, blobs map[[32]byte][]byte, checksum [32]byte, rd io.Reader) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	blobs[checksum] = data
+	return nil
+}
+
+func get(mu *sync.Mutex, blobs map[[32]byte][]byte, checksum [32]byte) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	data, exists := blobs[checksum]
+	if !exists {
+		return nil, fmt.Errorf("%x: %w", checksum, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+/* States */
+func (repository *Repository) GetStates() ([][32]byte, error) {
+	return list(&repository.repo.mu, repository.repo.states), nil
+}
+
+func (repository *Repository) PutState(checksum [32]byte, rd io.Reader, size uint64) error {
+	return put(&repository.repo.mu, repository.repo.states, checksum, rd)
+}
+
+func (repository *Repository) GetState(checksum [32]byte) (io.Reader, uint64, error) {
+	data, err := get(&repository.repo.mu, repository.repo.states, checksum)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), uint64(len(data)), nil
+}
+
+func (repository *Repository) DeleteState(checksum [32]byte) error {
+	repository.repo.mu.Lock()
+	defer repository.repo.mu.Unlock()
+	delete(repository.repo.states, checksum)
+	return nil
+}
+
+/* Packfiles */
+func (repository *Repository) GetPackfiles() ([][32]byte, error) {
+	return list(&repository.repo.mu, repository.repo.packfiles), nil
+}
+
+func (repository *Repository) PutPackfile(checksum [32]byte, rd io.Reader, size uint64) error {
+	if err := put(&repository.repo.mu, repository.repo.packfiles, checksum, rd); err != nil {
+		return err
+	}
+	repository.repo.mu.Lock()
+	defer repository.repo.mu.Unlock()
+	repository.repo.stored[checksum] = time.Now()
+	return nil
+}
+
+func (repository *Repository) GetPackfile(checksum [32]byte) (io.Reader, uint64, error) {
+	data, err := get(&repository.repo.mu, repository.repo.packfiles, checksum)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), uint64(len(data)), nil
+}
+
+func (repository *Repository) GetPackfileBlob(checksum [32]byte, offset uint32, length uint32) (io.Reader, uint32, error) {
+	data, err := get(&repository.repo.mu, repository.repo.packfiles, checksum)
+	if err != nil {
+		return nil, 0, err
+	}
+	if uint64(offset)+uint64(length) > uint64(len(data)) {
+		return nil, 0, fmt.Errorf("invalid length")
+	}
+	return bytes.NewReader(data[offset : offset+length]), length, nil
+}
+
+func (repository *Repository) DeletePackfile(checksum [32]byte) error {
+	repository.repo.mu.Lock()
+	defer repository.repo.mu.Unlock()
+	delete(repository.repo.packfiles, checksum)
+	delete(repository.repo.stored, checksum)
+	return nil
+}
+
+func (repository *Repository) StatPackfile(checksum [32]byte) (storage.ObjectStat, error) {
+	repository.repo.mu.Lock()
+	defer repository.repo.mu.Unlock()
+	data, exists := repository.repo.packfiles[checksum]
+	if !exists {
+		return storage.ObjectStat{}, fmt.Errorf("%x: %w", checksum, fs.ErrNotExist)
+	}
+	return storage.ObjectStat{Size: uint64(len(data)), ModTime: repository.repo.stored[checksum]}, nil
+}
+
+func (repository *Repository) CheckPackfile(checksum [32]byte) (bool, error) {
+	repository.repo.mu.Lock()
+	defer repository.repo.mu.Unlock()
+	_, exists := repository.repo.packfiles[checksum]
+	return exists, nil
+}
+
+/* Lock */
+func (repository *Repository) CreateLock(rd io.Reader, size uint64) (bool, error) {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return false, err
+	}
+	repository.repo.mu.Lock()
+	defer repository.repo.mu.Unlock()
+	if repository.repo.lock != nil {
+		return false, nil
+	}
+	repository.repo.lock = data
+	return true, nil
+}
+
+func (repository *Repository) PutLock(rd io.Reader, size uint64) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	repository.repo.mu.Lock()
+	defer repository.repo.mu.Unlock()
+	repository.repo.lock = data
+	return nil
+}
+
+func (repository *Repository) GetLock() (io.Reader, uint64, error) {
+	repository.repo.mu.Lock()
+	defer repository.repo.mu.Unlock()
+	if repository.repo.lock == nil {
+		return nil, 0, fs.ErrNotExist
+	}
+	return bytes.NewReader(repository.repo.lock), uint64(len(repository.repo.lock)), nil
+}
+
+func (repository *Repository) DeleteLock() error {
+	repository.repo.mu.Lock()
+	defer repository.repo.mu.Unlock()
+	repository.repo.lock = nil
+	return nil
+}
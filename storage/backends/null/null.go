@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"io"
 
+	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/storage"
 )
 
@@ -32,7 +33,7 @@ func init() {
 	storage.Register("null", NewRepository)
 }
 
-func NewRepository() storage.Backend {
+func NewRepository(ctx *context.Context) storage.Backend {
 	return &Repository{}
 }
 
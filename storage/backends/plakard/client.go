@@ -28,6 +28,7 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/PlakarKorp/plakar/context"
 	"github.com/PlakarKorp/plakar/network"
 	"github.com/PlakarKorp/plakar/storage"
 	"github.com/google/uuid"
@@ -54,7 +55,7 @@ func init() {
 	storage.Register("plakard", NewRepository)
 }
 
-func NewRepository() storage.Backend {
+func NewRepository(ctx *context.Context) storage.Backend {
 	return &Repository{}
 }
 
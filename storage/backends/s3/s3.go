@@ -18,15 +18,21 @@ package s3
 
 import (
 	"bytes"
-	"context"
+	goctx "context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net/url"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/PlakarKorp/plakar/compression"
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/logger"
 	"github.com/PlakarKorp/plakar/network"
 	"github.com/PlakarKorp/plakar/storage"
 	"github.com/vmihailenco/msgpack/v5"
@@ -36,19 +42,29 @@ import (
 )
 
 type Repository struct {
+	ctx         *context.Context
 	config      storage.Configuration
 	Repository  string
 	minioClient *minio.Client
 	bucketName  string
+	limiter     *storage.RateLimiter
+	timeout     time.Duration
+	cache       *storage.BlobCache
 }
 
+// ErrTimeout is returned, wrapping the underlying context error, when an
+// operation does not complete within the ?timeout= of the repository URL.
+var ErrTimeout = errors.New("s3: operation timed out")
+
 func init() {
 	network.ProtocolRegister()
 	storage.Register("s3", NewRepository)
 }
 
-func NewRepository() storage.Backend {
-	return &Repository{}
+func NewRepository(ctx *context.Context) storage.Backend {
+	return &Repository{
+		ctx: ctx,
+	}
 }
 
 func (repository *Repository) connect(location *url.URL) error {
@@ -66,10 +82,95 @@ func (repository *Repository) connect(location *url.URL) error {
 		log.Fatalln(err)
 	}
 
+	if bwlimit := location.Query().Get("bwlimit"); bwlimit != "" {
+		limiter, err := storage.ParseRateLimit(bwlimit)
+		if err != nil {
+			return err
+		}
+		repository.limiter = limiter
+	}
+
+	if size := location.Query().Get("cache"); size != "" {
+		cache, err := storage.ParseBlobCache(size)
+		if err != nil {
+			return err
+		}
+		repository.cache = cache
+	}
+
+	if timeout := location.Query().Get("timeout"); timeout != "" {
+		duration, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q: %w", timeout, err)
+		}
+		repository.timeout = duration
+	}
+
 	repository.minioClient = minioClient
 	return nil
 }
 
+// operationContext returns the context for a single operation, bounded by
+// the configured timeout if any.
+func (repository *Repository) operationContext() (goctx.Context, goctx.CancelFunc) {
+	if repository.timeout == 0 {
+		return goctx.WithCancel(repository.ctx)
+	}
+	return goctx.WithTimeout(repository.ctx, repository.timeout)
+}
+
+func (repository *Repository) wrapError(ctx goctx.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), goctx.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// objectReader releases the operation context once the object has been
+// fully read or failed, as minio fetches the object lazily. Readers that
+// are dropped before the end of the object must be closed.
+type objectReader struct {
+	rd     io.Reader
+	object *minio.Object
+	ctx    goctx.Context
+	cancel goctx.CancelFunc
+	repo   *Repository
+
+	operation string
+	t0        time.Time
+	nbytes    uint64
+	done      bool
+}
+
+func (reader *objectReader) Read(p []byte) (int, error) {
+	n, err := reader.rd.Read(p)
+	reader.nbytes += uint64(n)
+	if err != nil {
+		reader.cancel()
+		if err != io.EOF {
+			err = reader.repo.wrapError(reader.ctx, err)
+		}
+		if !reader.done {
+			reader.done = true
+			if err == io.EOF {
+				reader.repo.record(reader.operation, reader.t0, reader.nbytes, nil)
+			} else {
+				reader.repo.record(reader.operation, reader.t0, reader.nbytes, err)
+			}
+		}
+	}
+	return n, err
+}
+
+func (reader *objectReader) Close() error {
+	reader.cancel()
+	if !reader.done {
+		reader.done = true
+		reader.repo.record(reader.operation, reader.t0, reader.nbytes, nil)
+	}
+	return reader.object.Close()
+}
+
 func (repository *Repository) Create(location string, config storage.Configuration) error {
 	parsed, err := url.Parse(location)
 	if err != nil {
@@ -80,11 +181,14 @@ func (repository *Repository) Create(location string, config storage.Configurati
 	if err != nil {
 		return err
 	}
-	repository.bucketName = parsed.RequestURI()[1:]
+	repository.bucketName = strings.TrimPrefix(parsed.Path, "/")
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
 
-	err = repository.minioClient.MakeBucket(context.Background(), repository.bucketName, minio.MakeBucketOptions{})
+	err = repository.minioClient.MakeBucket(ctx, repository.bucketName, minio.MakeBucketOptions{})
 	if err != nil {
-		return err
+		return repository.wrapError(ctx, err)
 	}
 
 	jconfig, err := msgpack.Marshal(config)
@@ -102,9 +206,9 @@ func (repository *Repository) Create(location string, config storage.Configurati
 		return err
 	}
 
-	_, err = repository.minioClient.PutObject(context.Background(), repository.bucketName, "CONFIG", bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+	_, err = repository.minioClient.PutObject(ctx, repository.bucketName, "CONFIG", bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
 	if err != nil {
-		return err
+		return repository.wrapError(ctx, err)
 	}
 
 	repository.config = config
@@ -122,33 +226,40 @@ func (repository *Repository) Open(location string) error {
 		return err
 	}
 
-	repository.bucketName = parsed.RequestURI()[1:]
+	repository.bucketName = strings.TrimPrefix(parsed.Path, "/")
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
 
-	exists, err := repository.minioClient.BucketExists(context.Background(), repository.bucketName)
+	exists, err := repository.minioClient.BucketExists(ctx, repository.bucketName)
 	if err != nil {
-		return err
+		return repository.wrapError(ctx, err)
 	}
 	if !exists {
-		return fmt.Errorf("bucket does not exist")
+		return fmt.Errorf("bucket %s: %w", repository.bucketName, fs.ErrNotExist)
 	}
 
-	object, err := repository.minioClient.GetObject(context.Background(), repository.bucketName, "CONFIG", minio.GetObjectOptions{})
+	object, err := repository.minioClient.GetObject(ctx, repository.bucketName, "CONFIG", minio.GetObjectOptions{})
 	if err != nil {
-		return err
+		return repository.wrapError(ctx, err)
 	}
+	defer object.Close()
+
 	stat, err := object.Stat()
 	if err != nil {
-		return err
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return fmt.Errorf("CONFIG: %w", fs.ErrNotExist)
+		}
+		return repository.wrapError(ctx, err)
 	}
 
 	compressed := make([]byte, stat.Size)
 	_, err = object.Read(compressed)
 	if err != nil {
 		if err != io.EOF {
-			return err
+			return repository.wrapError(ctx, err)
 		}
 	}
-	object.Close()
 
 	jconfig, err := compression.InflateStream("GZIP", bytes.NewReader(compressed))
 	if err != nil {
@@ -181,171 +292,235 @@ func (repository *Repository) Configuration() storage.Configuration {
 
 // snapshots
 func (repository *Repository) GetSnapshots() ([][32]byte, error) {
-	ret := make([][32]byte, 0)
-	for object := range repository.minioClient.ListObjects(context.Background(), repository.bucketName, minio.ListObjectsOptions{
-		Prefix:    "snapshots/",
-		Recursive: true,
-	}) {
-		if strings.HasPrefix(object.Key, "snapshots/") && len(object.Key) == 13 {
-			snapshotIDhex, err := hex.DecodeString(object.Key[13:])
-			if err != nil {
-				continue
-			}
-			if len(snapshotIDhex) != 64 {
-				continue
-			}
-			var snapshotID [32]byte
-			copy(snapshotID[:], snapshotIDhex)
-			ret = append(ret, snapshotID)
-		}
-	}
-	return ret, nil
+	return collectChecksums(repository.GetSnapshotsChan())
 }
 
-func (repository *Repository) PutSnapshot(snapshotID [32]byte, data []byte) error {
-	_, err := repository.minioClient.PutObject(context.Background(), repository.bucketName, fmt.Sprintf("snapshots/%x/%s", snapshotID[0], hex.EncodeToString(snapshotID[:])), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+// GetSnapshotsChan streams the snapshot checksums as the listing progresses, the
+// error channel yields the error that interrupted the listing, if any, once
+// the checksums channel is closed.
+func (repository *Repository) GetSnapshotsChan() (<-chan [32]byte, <-chan error) {
+	return repository.listChecksums("GetSnapshots", "snapshots/")
+}
+
+func (repository *Repository) PutSnapshot(snapshotID [32]byte, data []byte) (err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("PutSnapshot", t0, uint64(len(data)), err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	_, err = repository.minioClient.PutObject(ctx, repository.bucketName, objectKey("snapshots", snapshotID), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
 	if err != nil {
-		return err
+		return repository.wrapError(ctx, err)
 	}
 	return nil
 }
 
-func (repository *Repository) GetSnapshot(snapshotID [32]byte) ([]byte, error) {
-	object, err := repository.minioClient.GetObject(context.Background(), repository.bucketName, fmt.Sprintf("snapshots/%x/%s", snapshotID[0], hex.EncodeToString(snapshotID[:])), minio.GetObjectOptions{})
+func (repository *Repository) GetSnapshot(snapshotID [32]byte) (_ []byte, err error) {
+	t0 := time.Now()
+	nbytes := uint64(0)
+	defer func() {
+		repository.record("GetSnapshot", t0, nbytes, err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	key := objectKey("snapshots", snapshotID)
+	object, err := repository.minioClient.GetObject(ctx, repository.bucketName, key, minio.GetObjectOptions{})
 	if err != nil {
-		return nil, err
+		return nil, repository.wrapError(ctx, err)
 	}
 	stat, err := object.Stat()
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" && key != legacySnapshotKey(snapshotID) {
+		object.Close()
+		object, err = repository.minioClient.GetObject(ctx, repository.bucketName, legacySnapshotKey(snapshotID), minio.GetObjectOptions{})
+		if err != nil {
+			return nil, repository.wrapError(ctx, err)
+		}
+		stat, err = object.Stat()
+	}
 	if err != nil {
-		return nil, err
+		return nil, repository.wrapError(ctx, err)
 	}
 
 	dataBytes := make([]byte, stat.Size)
 	_, err = object.Read(dataBytes)
 	if err != nil {
 		if err != io.EOF {
-			return nil, err
+			return nil, repository.wrapError(ctx, err)
 		}
 	}
 	object.Close()
 
+	nbytes = uint64(len(dataBytes))
 	return dataBytes, nil
 }
 
-func (repository *Repository) DeleteSnapshot(snapshotID [32]byte) error {
-	err := repository.minioClient.RemoveObject(context.Background(), repository.bucketName, fmt.Sprintf("snapshots/%x/%s", snapshotID[0], hex.EncodeToString(snapshotID[:])), minio.RemoveObjectOptions{})
-	if err != nil {
-		return err
+func (repository *Repository) DeleteSnapshot(snapshotID [32]byte) (err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("DeleteSnapshot", t0, 0, err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	for _, key := range []string{objectKey("snapshots", snapshotID), legacySnapshotKey(snapshotID)} {
+		err = repository.minioClient.RemoveObject(ctx, repository.bucketName, key, minio.RemoveObjectOptions{})
+		if err != nil {
+			return repository.wrapError(ctx, err)
+		}
 	}
 	return nil
 }
 
 // states
 func (repository *Repository) GetStates() ([][32]byte, error) {
-	ret := make([][32]byte, 0)
-	for object := range repository.minioClient.ListObjects(context.Background(), repository.bucketName, minio.ListObjectsOptions{
-		Prefix:    "states/",
-		Recursive: true,
-	}) {
-		if strings.HasPrefix(object.Key, "states/") && len(object.Key) >= 10 {
-			t, err := hex.DecodeString(object.Key[10:])
-			if err != nil {
-				return nil, err
-			}
-			if len(t) != 32 {
-				continue
-			}
-			var t32 [32]byte
-			copy(t32[:], t)
-			ret = append(ret, t32)
-		}
-	}
-	return ret, nil
+	return collectChecksums(repository.GetStatesChan())
+}
+
+// GetStatesChan streams the state checksums as the listing progresses, the
+// error channel yields the error that interrupted the listing, if any, once
+// the checksums channel is closed.
+func (repository *Repository) GetStatesChan() (<-chan [32]byte, <-chan error) {
+	return repository.listChecksums("GetStates", "states/")
 }
 
-func (repository *Repository) PutState(checksum [32]byte, rd io.Reader, size uint64) error {
-	_, err := repository.minioClient.PutObject(context.Background(), repository.bucketName, fmt.Sprintf("states/%02x/%016x", checksum[0], checksum), rd, int64(size), minio.PutObjectOptions{})
+func (repository *Repository) PutState(checksum [32]byte, rd io.Reader, size uint64) (err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("PutState", t0, size, err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	_, err = repository.minioClient.PutObject(ctx, repository.bucketName, objectKey("states", checksum), storage.NewRateLimitedReader(rd, repository.limiter), int64(size), minio.PutObjectOptions{})
 	if err != nil {
-		return err
+		return repository.wrapError(ctx, err)
 	}
 	return nil
 }
 
 func (repository *Repository) GetState(checksum [32]byte) (io.Reader, uint64, error) {
-	object, err := repository.minioClient.GetObject(context.Background(), repository.bucketName, fmt.Sprintf("states/%02x/%016x", checksum[0], checksum), minio.GetObjectOptions{})
-	if err != nil {
-		return nil, 0, err
-	}
+	return repository.getObject("GetState", objectKey("states", checksum))
+}
 
-	stat, err := object.Stat()
-	if err != nil {
-		return nil, 0, err
-	}
+func (repository *Repository) DeleteState(checksum [32]byte) (err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("DeleteState", t0, 0, err)
+	}()
 
-	return object, uint64(stat.Size), nil
-}
+	ctx, cancel := repository.operationContext()
+	defer cancel()
 
-func (repository *Repository) DeleteState(checksum [32]byte) error {
-	err := repository.minioClient.RemoveObject(context.Background(), repository.bucketName, fmt.Sprintf("states/%02x/%016x", checksum[0], checksum), minio.RemoveObjectOptions{})
+	err = repository.minioClient.RemoveObject(ctx, repository.bucketName, objectKey("states", checksum), minio.RemoveObjectOptions{})
 	if err != nil {
-		return err
+		return repository.wrapError(ctx, err)
 	}
 	return nil
 }
 
 // packfiles
 func (repository *Repository) GetPackfiles() ([][32]byte, error) {
-	ret := make([][32]byte, 0)
-	for object := range repository.minioClient.ListObjects(context.Background(), repository.bucketName, minio.ListObjectsOptions{
-		Prefix:    "packfiles/",
-		Recursive: true,
-	}) {
-		if strings.HasPrefix(object.Key, "packfiles/") && len(object.Key) >= 13 {
-			t, err := hex.DecodeString(object.Key[13:])
-			if err != nil {
-				return nil, err
-			}
-			if len(t) != 32 {
-				continue
-			}
-			var t32 [32]byte
-			copy(t32[:], t)
-			ret = append(ret, t32)
-		}
-	}
-	return ret, nil
+	return collectChecksums(repository.GetPackfilesChan())
+}
+
+// GetPackfilesChan streams the packfile checksums as the listing progresses, the
+// error channel yields the error that interrupted the listing, if any, once
+// the checksums channel is closed.
+func (repository *Repository) GetPackfilesChan() (<-chan [32]byte, <-chan error) {
+	return repository.listChecksums("GetPackfiles", "packfiles/")
 }
 
-func (repository *Repository) PutPackfile(checksum [32]byte, rd io.Reader, size uint64) error {
-	_, err := repository.minioClient.PutObject(context.Background(), repository.bucketName, fmt.Sprintf("packfiles/%02x/%016x", checksum[0], checksum), rd, int64(size), minio.PutObjectOptions{})
+func (repository *Repository) CheckPackfile(checksum [32]byte) (_ bool, err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("CheckPackfile", t0, 0, err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	_, err = repository.minioClient.StatObject(ctx, repository.bucketName, objectKey("packfiles", checksum), minio.StatObjectOptions{})
 	if err != nil {
-		return err
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, repository.wrapError(ctx, err)
 	}
-	return nil
+	return true, nil
 }
 
-func (repository *Repository) GetPackfile(checksum [32]byte) (io.Reader, uint64, error) {
-	object, err := repository.minioClient.GetObject(context.Background(), repository.bucketName, fmt.Sprintf("packfiles/%02x/%016x", checksum[0], checksum), minio.GetObjectOptions{})
+func (repository *Repository) StatPackfile(checksum [32]byte) (_ storage.ObjectStat, err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("StatPackfile", t0, 0, err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	key := objectKey("packfiles", checksum)
+	info, err := repository.minioClient.StatObject(ctx, repository.bucketName, key, minio.StatObjectOptions{})
 	if err != nil {
-		return nil, 0, err
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return storage.ObjectStat{}, fmt.Errorf("%s: %w", key, fs.ErrNotExist)
+		}
+		return storage.ObjectStat{}, repository.wrapError(ctx, err)
 	}
-	stat, err := object.Stat()
+	return storage.ObjectStat{Size: uint64(info.Size), ModTime: info.LastModified}, nil
+}
+
+func (repository *Repository) PutPackfile(checksum [32]byte, rd io.Reader, size uint64) (err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("PutPackfile", t0, size, err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	_, err = repository.minioClient.PutObject(ctx, repository.bucketName, objectKey("packfiles", checksum), storage.NewRateLimitedReader(rd, repository.limiter), int64(size), minio.PutObjectOptions{})
 	if err != nil {
-		return nil, 0, err
+		return repository.wrapError(ctx, err)
 	}
-	return object, uint64(stat.Size), nil
+	return nil
+}
+
+func (repository *Repository) GetPackfile(checksum [32]byte) (io.Reader, uint64, error) {
+	return repository.getObject("GetPackfile", objectKey("packfiles", checksum))
 }
 
-func (repository *Repository) GetPackfileBlob(checksum [32]byte, offset uint32, length uint32) (io.Reader, uint32, error) {
+func (repository *Repository) GetPackfileBlob(checksum [32]byte, offset uint32, length uint32) (_ io.Reader, _ uint32, err error) {
+	if data, ok := repository.cache.Get(checksum, offset, length); ok {
+		return bytes.NewReader(data), length, nil
+	}
+
+	t0 := time.Now()
+	defer func() {
+		repository.record("GetPackfileBlob", t0, uint64(length), err)
+	}()
+
 	opts := minio.GetObjectOptions{}
 	opts.SetRange(int64(offset), int64(offset+length))
-	object, err := repository.minioClient.GetObject(context.Background(), repository.bucketName, fmt.Sprintf("packfiles/%02x/%016x", checksum[0], checksum), opts)
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	object, err := repository.minioClient.GetObject(ctx, repository.bucketName, objectKey("packfiles", checksum), opts)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, repository.wrapError(ctx, err)
 	}
+	defer object.Close()
+
 	stat, err := object.Stat()
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, repository.wrapError(ctx, err)
 	}
 
 	if stat.Size < int64(offset+length) {
@@ -353,33 +528,235 @@ func (repository *Repository) GetPackfileBlob(checksum [32]byte, offset uint32,
 	}
 
 	if _, err := object.Seek(int64(offset), io.SeekStart); err != nil {
-		return nil, 0, err
+		return nil, 0, repository.wrapError(ctx, err)
 	}
 
 	buffer := make([]byte, length)
-	if nbytes, err := object.Read(buffer); err != nil {
-		return nil, 0, err
+	if nbytes, err := io.ReadFull(storage.NewRateLimitedReader(object, repository.limiter), buffer); err != nil {
+		return nil, 0, repository.wrapError(ctx, err)
 	} else if nbytes != int(length) {
 		return nil, 0, fmt.Errorf("short read")
 	}
+	repository.cache.Put(checksum, offset, length, buffer)
 
-	return bytes.NewBuffer(buffer), uint32(length), nil
+	return bytes.NewReader(buffer), uint32(length), nil
 }
 
-func (repository *Repository) DeletePackfile(checksum [32]byte) error {
-	err := repository.minioClient.RemoveObject(context.Background(), repository.bucketName, fmt.Sprintf("packfiles/%02x/%016x", checksum[0], checksum), minio.RemoveObjectOptions{})
+func (repository *Repository) DeletePackfile(checksum [32]byte) (err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("DeletePackfile", t0, 0, err)
+	}()
+	repository.cache.Invalidate(checksum)
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	err = repository.minioClient.RemoveObject(ctx, repository.bucketName, objectKey("packfiles", checksum), minio.RemoveObjectOptions{})
 	if err != nil {
-		return err
+		return repository.wrapError(ctx, err)
+	}
+	return nil
+}
+
+// lock
+func (repository *Repository) CreateLock(rd io.Reader, size uint64) (_ bool, err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("CreateLock", t0, size, err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	// minio-go can't send the If-None-Match: * header that makes a PUT
+	// conditional, so the lock is checked for and written in two steps.
+	// Two processes can both find no lock and both write theirs, and
+	// each may read its own back before the other write lands: the lock
+	// is best-effort on S3.
+	_, err = repository.minioClient.StatObject(ctx, repository.bucketName, "LOCK", minio.StatObjectOptions{})
+	if err == nil {
+		return false, nil
+	} else if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return false, repository.wrapError(ctx, err)
+	}
+
+	_, err = repository.minioClient.PutObject(ctx, repository.bucketName, "LOCK", rd, int64(size), minio.PutObjectOptions{})
+	if err != nil {
+		return false, repository.wrapError(ctx, err)
+	}
+	return true, nil
+}
+
+func (repository *Repository) PutLock(rd io.Reader, size uint64) (err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("PutLock", t0, size, err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	_, err = repository.minioClient.PutObject(ctx, repository.bucketName, "LOCK", rd, int64(size), minio.PutObjectOptions{})
+	if err != nil {
+		return repository.wrapError(ctx, err)
 	}
 	return nil
 }
 
+func (repository *Repository) GetLock() (io.Reader, uint64, error) {
+	rd, size, err := repository.getObject("GetLock", "LOCK")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, 0, fs.ErrNotExist
+		}
+		return nil, 0, err
+	}
+	return rd, size, nil
+}
+
+func (repository *Repository) DeleteLock() (err error) {
+	t0 := time.Now()
+	defer func() {
+		repository.record("DeleteLock", t0, 0, err)
+	}()
+
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	err = repository.minioClient.RemoveObject(ctx, repository.bucketName, "LOCK", minio.RemoveObjectOptions{})
+	if err != nil {
+		return repository.wrapError(ctx, err)
+	}
+	return nil
+}
+
+// listChecksums lists the objects under prefix, streaming their checksums
+// to the returned channel which must be drained by the caller.
+func (repository *Repository) listChecksums(operation string, prefix string) (<-chan [32]byte, <-chan error) {
+	checksums := make(chan [32]byte, 1024)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(checksums)
+
+		t0 := time.Now()
+		ctx, cancel := repository.operationContext()
+		defer cancel()
+
+		for object := range repository.minioClient.ListObjects(ctx, repository.bucketName, minio.ListObjectsOptions{
+			Prefix:    prefix,
+			Recursive: true,
+		}) {
+			if object.Err != nil {
+				err := repository.wrapError(ctx, object.Err)
+				repository.record(operation, t0, 0, err)
+				errc <- err
+				return
+			}
+			if checksum, ok := parseObjectKey(object.Key); ok {
+				checksums <- checksum
+			}
+		}
+		repository.record(operation, t0, 0, nil)
+	}()
+
+	return checksums, errc
+}
+
+func collectChecksums(checksums <-chan [32]byte, errc <-chan error) ([][32]byte, error) {
+	ret := make([][32]byte, 0)
+	for checksum := range checksums {
+		ret = append(ret, checksum)
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// objectKey returns the key of the object of the given checksum, under
+// prefix and a directory named after its first byte.
+func objectKey(prefix string, checksum [32]byte) string {
+	return fmt.Sprintf("%s/%02x/%064x", prefix, checksum[0], checksum)
+}
+
+// legacySnapshotKey is where snapshots used to be written, the directory
+// was a single hex digit for first bytes below 0x10.
+func legacySnapshotKey(snapshotID [32]byte) string {
+	return fmt.Sprintf("snapshots/%x/%064x", snapshotID[0], snapshotID)
+}
+
+// parseObjectKey extracts the checksum from the last component of an object
+// key. Objects that were not written by plakar may lie around in the bucket,
+// they are reported and skipped rather than failing the whole listing.
+func parseObjectKey(key string) ([32]byte, bool) {
+	var checksum [32]byte
+
+	decoded, err := hex.DecodeString(path.Base(key))
+	if err != nil || len(decoded) != len(checksum) {
+		logger.Warn("s3: skipping unexpected object %q", key)
+		return checksum, false
+	}
+	copy(checksum[:], decoded)
+	return checksum, true
+}
+
+// getObject returns a reader streaming the object at key, the operation is
+// recorded once the object has been fully read, failed or closed.  A
+// missing key is reported as an error matching fs.ErrNotExist, as other
+// backends do.
+func (repository *Repository) getObject(operation string, key string) (io.ReadCloser, uint64, error) {
+	t0 := time.Now()
+	ctx, cancel := repository.operationContext()
+
+	object, err := repository.minioClient.GetObject(ctx, repository.bucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		cancel()
+		err = repository.wrapError(ctx, err)
+		repository.record(operation, t0, 0, err)
+		return nil, 0, err
+	}
+
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		cancel()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			err = fmt.Errorf("%s: %w", key, fs.ErrNotExist)
+		} else {
+			err = repository.wrapError(ctx, err)
+		}
+		repository.record(operation, t0, 0, err)
+		return nil, 0, err
+	}
+
+	rd := &objectReader{
+		rd:        storage.NewRateLimitedReader(object, repository.limiter),
+		object:    object,
+		ctx:       ctx,
+		cancel:    cancel,
+		repo:      repository,
+		operation: operation,
+		t0:        t0,
+	}
+	return rd, uint64(stat.Size), nil
+}
+
+func (repository *Repository) record(operation string, t0 time.Time, nbytes uint64, err error) {
+	storage.RecordOperation("s3."+operation, time.Since(t0), nbytes, err)
+}
+
 //////
 
 func (repository *Repository) Commit(snapshotID [32]byte, data []byte) error {
-	_, err := repository.minioClient.PutObject(context.Background(), repository.bucketName, fmt.Sprintf("snapshots/%x/%s", snapshotID[0], hex.EncodeToString(snapshotID[:])), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+	ctx, cancel := repository.operationContext()
+	defer cancel()
+
+	_, err := repository.minioClient.PutObject(ctx, repository.bucketName, objectKey("snapshots", snapshotID), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
 	if err != nil {
-		return err
+		return repository.wrapError(ctx, err)
 	}
 	return nil
 }
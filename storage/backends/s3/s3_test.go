@@ -0,0 +1,753 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	goctx "context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/context"
+	"github.com/PlakarKorp/plakar/storage"
+)
+
+// fakeS3 implements the handful of S3 requests issued by the backend,
+// keeping objects of a single bucket in memory.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	gets     int      // object reads
+	requests []string // method and key of every request
+}
+
+type fakeListResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []fakeListEntry
+
+	NextContinuationToken string `xml:",omitempty"`
+}
+
+type fakeListEntry struct {
+	Key          string
+	Size         int
+	LastModified string
+	ETag         string
+}
+
+func (fake *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// path-style requests: /bucket/key
+	_, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.requests = append(fake.requests, r.Method+" "+key)
+
+	switch {
+	case key == "" && r.URL.Query().Has("location"):
+		fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+
+	case key == "" && r.Method == http.MethodGet:
+		// ListObjectsV2, paginated by 1000 keys like the real thing
+		prefix := r.URL.Query().Get("prefix")
+		after := r.URL.Query().Get("continuation-token")
+
+		keys := make([]string, 0)
+		for key := range fake.objects {
+			if strings.HasPrefix(key, prefix) && key > after {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		result := fakeListResult{Name: "bucket", Prefix: prefix, MaxKeys: 1000}
+		if len(keys) > result.MaxKeys {
+			keys = keys[:result.MaxKeys]
+			result.IsTruncated = true
+			result.NextContinuationToken = keys[len(keys)-1]
+		}
+		for _, key := range keys {
+			result.Contents = append(result.Contents, fakeListEntry{
+				Key:          key,
+				Size:         len(fake.objects[key]),
+				LastModified: "2024-01-01T00:00:00.000Z",
+				ETag:         `"etag"`,
+			})
+		}
+		result.KeyCount = len(result.Contents)
+		xml.NewEncoder(w).Encode(result)
+
+	case key == "":
+		// bucket creation and existence checks
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPut:
+		data, err := fakeReadBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fake.objects[key] = data
+		w.Header().Set("ETag", `"etag"`)
+
+	case r.Method == http.MethodDelete:
+		delete(fake.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		fake.gets++
+		data, exists := fake.objects[key]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `<Error><Code>NoSuchKey</Code><Key>%s</Key></Error>`, key)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, key, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), bytes.NewReader(data))
+	}
+}
+
+// fakeReadBody decodes the aws-chunked encoding used by minio for
+// uploads over plain HTTP.
+func fakeReadBody(r *http.Request) ([]byte, error) {
+	if r.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return io.ReadAll(r.Body)
+	}
+
+	var data []byte
+	rd := bufio.NewReader(r.Body)
+	for {
+		header, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, chunk); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return data, nil
+		}
+		data = append(data, chunk[:n]...)
+	}
+}
+
+// newFakeRepository returns a repository backed by an in-memory fake S3.
+func newFakeRepository(t *testing.T) (*Repository, *fakeS3) {
+	t.Helper()
+
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	ts := httptest.NewServer(fake)
+	t.Cleanup(ts.Close)
+
+	location, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location.User = url.UserPassword("access", "secret")
+
+	repo := NewRepository(context.NewContext()).(*Repository)
+	if err := repo.connect(location); err != nil {
+		t.Fatal(err)
+	}
+	repo.bucketName = "bucket"
+	return repo, fake
+}
+
+// newStallingRepository returns a repository whose endpoint never answers
+// until the client gives up on the request.
+func newStallingRepository(t *testing.T, ctx *context.Context) *Repository {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	location, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	location.User = url.UserPassword("access", "secret")
+
+	repo := NewRepository(ctx).(*Repository)
+	if err := repo.connect(location); err != nil {
+		t.Fatal(err)
+	}
+	repo.bucketName = "bucket"
+	return repo
+}
+
+func TestCancelInFlightRequest(t *testing.T) {
+	ctx := context.NewContext()
+	repo := newStallingRepository(t, ctx)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ctx.Close()
+	}()
+
+	t0 := time.Now()
+	_, _, err := repo.GetPackfile([32]byte{0x01})
+	if err == nil {
+		t.Fatalf("expected an error after cancellation")
+	}
+	if elapsed := time.Since(t0); elapsed > 2*time.Second {
+		t.Fatalf("expected GetPackfile to return promptly, took %s", elapsed)
+	}
+	if !errors.Is(err, goctx.Canceled) {
+		t.Fatalf("expected a context error, got %v", err)
+	}
+}
+
+func TestOperationTimeout(t *testing.T) {
+	ctx := context.NewContext()
+	repo := newStallingRepository(t, ctx)
+	repo.timeout = 100 * time.Millisecond
+
+	t0 := time.Now()
+	err := repo.DeletePackfile([32]byte{0x01})
+	if err == nil {
+		t.Fatalf("expected an error from a stalled endpoint")
+	}
+	if elapsed := time.Since(t0); elapsed > 2*time.Second {
+		t.Fatalf("expected DeletePackfile to time out promptly, took %s", elapsed)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+
+	if _, err := repo.GetStates(); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout error from GetStates, got %v", err)
+	}
+}
+
+func TestTimeoutParameter(t *testing.T) {
+	repo := NewRepository(context.NewContext()).(*Repository)
+
+	location, _ := url.Parse("s3://access:secret@localhost:9000/bucket?timeout=30s")
+	if err := repo.connect(location); err != nil {
+		t.Fatal(err)
+	}
+	if repo.timeout != 30*time.Second {
+		t.Fatalf("expected a 30s timeout, got %s", repo.timeout)
+	}
+
+	location, _ = url.Parse("s3://access:secret@localhost:9000/bucket?timeout=soon")
+	if err := repo.connect(location); err == nil {
+		t.Fatalf("expected an error for an invalid timeout")
+	}
+}
+
+func TestCacheParameter(t *testing.T) {
+	repo := NewRepository(context.NewContext()).(*Repository)
+
+	location, _ := url.Parse("s3://access:secret@localhost:9000/bucket")
+	if err := repo.connect(location); err != nil {
+		t.Fatal(err)
+	}
+	if repo.cache != nil {
+		t.Fatal("expected no cache by default")
+	}
+
+	location, _ = url.Parse("s3://access:secret@localhost:9000/bucket?cache=64MB")
+	if err := repo.connect(location); err != nil {
+		t.Fatal(err)
+	}
+	if repo.cache == nil {
+		t.Fatal("expected a cache")
+	}
+
+	location, _ = url.Parse("s3://access:secret@localhost:9000/bucket?cache=lots")
+	if err := repo.connect(location); err == nil {
+		t.Fatalf("expected an error for an invalid cache size")
+	}
+}
+
+func TestBlobCache(t *testing.T) {
+	repo, fake := newFakeRepository(t)
+	repo.cache = storage.NewBlobCache(1024)
+
+	data := []byte("packfile content")
+	checksum := [32]byte{0x05}
+	if err := repo.PutPackfile(checksum, bytes.NewReader(data), uint64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func() string {
+		t.Helper()
+		rd, _, err := repo.GetPackfileBlob(checksum, 9, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(blob)
+	}
+	gets := func() int {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return fake.gets
+	}
+
+	before := gets()
+	if blob := read(); blob != "content" {
+		t.Fatalf("unexpected content %q", blob)
+	}
+	fetched := gets()
+	if fetched == before {
+		t.Fatal("the first read was not sent to S3")
+	}
+	if blob := read(); blob != "content" {
+		t.Fatalf("unexpected content %q", blob)
+	}
+	if gets() != fetched {
+		t.Fatal("the second read was not served from the cache")
+	}
+
+	if err := repo.DeletePackfile(checksum); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.GetPackfileBlob(checksum, 9, 7); err == nil {
+		t.Fatal("a blob of a deleted packfile was served from the cache")
+	}
+}
+
+func TestStats(t *testing.T) {
+	repo, _ := newFakeRepository(t)
+	before := storage.Stats()
+
+	data := []byte("packfile content")
+	checksum := [32]byte{0x02}
+	if err := repo.PutPackfile(checksum, bytes.NewReader(data), uint64(len(data))); err != nil {
+		t.Fatalf("PutPackfile: %v", err)
+	}
+
+	rd, _, err := repo.GetPackfile(checksum)
+	if err != nil {
+		t.Fatalf("GetPackfile: %v", err)
+	}
+	if got, err := io.ReadAll(rd); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("GetPackfile: unexpected content %q (%v)", got, err)
+	}
+
+	rd, _, err = repo.GetPackfileBlob(checksum, 9, 7)
+	if err != nil {
+		t.Fatalf("GetPackfileBlob: %v", err)
+	}
+	if got, _ := io.ReadAll(rd); string(got) != "content" {
+		t.Fatalf("GetPackfileBlob: unexpected content %q", got)
+	}
+
+	if packfiles, err := repo.GetPackfiles(); err != nil || len(packfiles) != 1 {
+		t.Fatalf("GetPackfiles: %v, %v", packfiles, err)
+	}
+	if err := repo.DeletePackfile(checksum); err != nil {
+		t.Fatalf("DeletePackfile: %v", err)
+	}
+	if _, _, err := repo.GetPackfile(checksum); err == nil {
+		t.Fatalf("GetPackfile: expected an error for a deleted packfile")
+	}
+
+	after := storage.Stats()
+	expect := []struct {
+		operation string
+		calls     uint64
+		errors    uint64
+		bytes     uint64
+	}{
+		{"s3.PutPackfile", 1, 0, uint64(len(data))},
+		{"s3.GetPackfile", 2, 1, uint64(len(data))},
+		{"s3.GetPackfileBlob", 1, 0, 7},
+		{"s3.GetPackfiles", 1, 0, 0},
+		{"s3.DeletePackfile", 1, 0, 0},
+	}
+	for _, e := range expect {
+		st := after[e.operation]
+		st.Calls -= before[e.operation].Calls
+		st.Errors -= before[e.operation].Errors
+		st.Bytes -= before[e.operation].Bytes
+		if st.Calls != e.calls || st.Errors != e.errors || st.Bytes != e.bytes {
+			t.Errorf("%s: expected calls=%d errors=%d bytes=%d, got calls=%d errors=%d bytes=%d",
+				e.operation, e.calls, e.errors, e.bytes, st.Calls, st.Errors, st.Bytes)
+		}
+		if st.Calls != 0 && after[e.operation].MaxDuration == 0 {
+			t.Errorf("%s: no duration recorded", e.operation)
+		}
+	}
+}
+
+func TestListingSkipsUnexpectedKeys(t *testing.T) {
+	repo, fake := newFakeRepository(t)
+
+	checksum := [32]byte{0x03, 0x04}
+	if err := repo.PutState(checksum, bytes.NewReader([]byte("state")), 5); err != nil {
+		t.Fatalf("PutState: %v", err)
+	}
+	if err := repo.PutPackfile(checksum, bytes.NewReader([]byte("packfile")), 8); err != nil {
+		t.Fatalf("PutPackfile: %v", err)
+	}
+	if err := repo.PutSnapshot(checksum, []byte("snapshot")); err != nil {
+		t.Fatalf("PutSnapshot: %v", err)
+	}
+
+	fake.mu.Lock()
+	for _, key := range []string{
+		"states/README",
+		"states/03/not-a-checksum",
+		"packfiles/03/0304",
+		"packfiles/.DS_Store",
+		"snapshots/x",
+	} {
+		fake.objects[key] = []byte("garbage")
+	}
+	fake.mu.Unlock()
+
+	states, err := repo.GetStates()
+	if err != nil {
+		t.Fatalf("GetStates: %v", err)
+	}
+	if len(states) != 1 || states[0] != checksum {
+		t.Errorf("GetStates: expected [%x], got %x", checksum, states)
+	}
+
+	packfiles, err := repo.GetPackfiles()
+	if err != nil {
+		t.Fatalf("GetPackfiles: %v", err)
+	}
+	if len(packfiles) != 1 || packfiles[0] != checksum {
+		t.Errorf("GetPackfiles: expected [%x], got %x", checksum, packfiles)
+	}
+
+	snapshots, err := repo.GetSnapshots()
+	if err != nil {
+		t.Fatalf("GetSnapshots: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0] != checksum {
+		t.Errorf("GetSnapshots: expected [%x], got %x", checksum, snapshots)
+	}
+}
+
+func TestListingStreamsPages(t *testing.T) {
+	repo, fake := newFakeRepository(t)
+
+	const npackfiles = 3500
+	fake.mu.Lock()
+	for i := 0; i < npackfiles; i++ {
+		checksum := [32]byte{byte(i >> 8), byte(i)}
+		fake.objects[fmt.Sprintf("packfiles/%02x/%016x", checksum[0], checksum)] = nil
+	}
+	fake.mu.Unlock()
+
+	checksums, errc := repo.GetPackfilesChan()
+	seen := make(map[[32]byte]struct{})
+	for checksum := range checksums {
+		seen[checksum] = struct{}{}
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("GetPackfilesChan: %v", err)
+	}
+	if len(seen) != npackfiles {
+		t.Fatalf("expected %d packfiles, got %d", npackfiles, len(seen))
+	}
+
+	packfiles, err := repo.GetPackfiles()
+	if err != nil {
+		t.Fatalf("GetPackfiles: %v", err)
+	}
+	if len(packfiles) != npackfiles {
+		t.Fatalf("expected %d packfiles, got %d", npackfiles, len(packfiles))
+	}
+}
+
+func TestListingError(t *testing.T) {
+	repo := newStallingRepository(t, context.NewContext())
+	repo.timeout = 100 * time.Millisecond
+
+	checksums, errc := repo.GetStatesChan()
+	for range checksums {
+		t.Fatal("unexpected checksum from a stalled endpoint")
+	}
+	if err := <-errc; !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestCheckPackfile(t *testing.T) {
+	repo, _ := newFakeRepository(t)
+	checksum := [32]byte{0x05}
+
+	if exists, err := repo.CheckPackfile(checksum); err != nil || exists {
+		t.Fatalf("CheckPackfile before put: exists=%v, err=%v", exists, err)
+	}
+	if err := repo.PutPackfile(checksum, bytes.NewReader([]byte("data")), 4); err != nil {
+		t.Fatalf("PutPackfile: %v", err)
+	}
+	if exists, err := repo.CheckPackfile(checksum); err != nil || !exists {
+		t.Fatalf("CheckPackfile after put: exists=%v, err=%v", exists, err)
+	}
+}
+
+func TestCheckPackfileSingleHead(t *testing.T) {
+	repo, fake := newFakeRepository(t)
+	present := [32]byte{0x05}
+	missing := [32]byte{0x06}
+	data := bytes.Repeat([]byte("large packfile "), 64<<10)
+	if err := repo.PutPackfile(present, bytes.NewReader(data), uint64(len(data))); err != nil {
+		t.Fatalf("PutPackfile: %v", err)
+	}
+
+	for _, checksum := range [][32]byte{present, missing} {
+		fake.mu.Lock()
+		fake.requests = nil
+		fake.mu.Unlock()
+
+		if _, err := repo.CheckPackfile(checksum); err != nil {
+			t.Fatalf("CheckPackfile: %v", err)
+		}
+
+		fake.mu.Lock()
+		requests := fake.requests
+		fake.mu.Unlock()
+		expected := fmt.Sprintf("HEAD packfiles/%02x/%016x", checksum[0], checksum)
+		if len(requests) != 1 || requests[0] != expected {
+			t.Errorf("expected a single %q, got %q", expected, requests)
+		}
+	}
+}
+
+func TestStatPackfile(t *testing.T) {
+	repo, fake := newFakeRepository(t)
+	checksum := [32]byte{0x05}
+	data := bytes.Repeat([]byte("packfile "), 4096)
+	if err := repo.PutPackfile(checksum, bytes.NewReader(data), uint64(len(data))); err != nil {
+		t.Fatalf("PutPackfile: %v", err)
+	}
+
+	fake.mu.Lock()
+	fake.requests = nil
+	fake.mu.Unlock()
+
+	stat, err := repo.StatPackfile(checksum)
+	if err != nil {
+		t.Fatalf("StatPackfile: %v", err)
+	}
+	if stat.Size != uint64(len(data)) {
+		t.Errorf("expected size %d, got %d", len(data), stat.Size)
+	}
+	if want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); !stat.ModTime.Equal(want) {
+		t.Errorf("expected mtime %v, got %v", want, stat.ModTime)
+	}
+
+	fake.mu.Lock()
+	requests := fake.requests
+	fake.mu.Unlock()
+	expected := fmt.Sprintf("HEAD packfiles/%02x/%016x", checksum[0], checksum)
+	if len(requests) != 1 || requests[0] != expected {
+		t.Errorf("expected a single %q, got %q", expected, requests)
+	}
+
+	if _, err := repo.StatPackfile([32]byte{0x06}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist for a missing packfile, got %v", err)
+	}
+}
+
+func TestCloseObjectReader(t *testing.T) {
+	repo, _ := newFakeRepository(t)
+	checksum := [32]byte{0x05}
+	data := bytes.Repeat([]byte("large packfile "), 64<<10)
+	if err := repo.PutPackfile(checksum, bytes.NewReader(data), uint64(len(data))); err != nil {
+		t.Fatalf("PutPackfile: %v", err)
+	}
+
+	rd, _, err := repo.GetPackfile(checksum)
+	if err != nil {
+		t.Fatalf("GetPackfile: %v", err)
+	}
+	prefix := make([]byte, 16)
+	if _, err := io.ReadFull(rd, prefix); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	closer, ok := rd.(io.Closer)
+	if !ok {
+		t.Fatalf("expected the packfile reader to implement io.Closer")
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := rd.(*objectReader).ctx.Err(); err == nil {
+		t.Errorf("expected Close to release the operation context")
+	}
+	if _, err := rd.Read(prefix); err == nil {
+		t.Errorf("expected a read after Close to fail")
+	}
+}
+
+func TestOpenMissingRepository(t *testing.T) {
+	ts := httptest.NewServer(&fakeS3{objects: make(map[string][]byte)})
+	t.Cleanup(ts.Close)
+
+	location := strings.Replace(ts.URL, "http://", "s3://access:secret@", 1) + "/bucket"
+	repo := NewRepository(context.NewContext())
+	if err := repo.Open(location); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist opening a bucket without CONFIG, got %v", err)
+	}
+}
+
+func TestSharedPrefixChecksums(t *testing.T) {
+	repo, fake := newFakeRepository(t)
+
+	// the checksums only differ in their last byte
+	var first, second [32]byte
+	for i := range first {
+		first[i] = 0x07
+		second[i] = 0x07
+	}
+	second[31] = 0x08
+
+	for _, checksum := range [][32]byte{first, second} {
+		data := []byte(fmt.Sprintf("content of %x", checksum))
+		if err := repo.PutPackfile(checksum, bytes.NewReader(data), uint64(len(data))); err != nil {
+			t.Fatalf("PutPackfile: %v", err)
+		}
+		if err := repo.PutState(checksum, bytes.NewReader(data), uint64(len(data))); err != nil {
+			t.Fatalf("PutState: %v", err)
+		}
+	}
+
+	for _, checksum := range [][32]byte{first, second} {
+		expected := fmt.Sprintf("content of %x", checksum)
+		for name, get := range map[string]func([32]byte) (io.Reader, uint64, error){
+			"GetPackfile": repo.GetPackfile,
+			"GetState":    repo.GetState,
+		} {
+			rd, _, err := get(checksum)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			data, err := io.ReadAll(rd)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if string(data) != expected {
+				t.Errorf("%s(%x): expected %q, got %q", name, checksum, expected, data)
+			}
+		}
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for key := range fake.objects {
+		if len(path.Base(key)) != 64 {
+			t.Errorf("expected the key %q to end with the full checksum", key)
+		}
+	}
+}
+
+func TestGetMissingObject(t *testing.T) {
+	repo, _ := newFakeRepository(t)
+	checksum := [32]byte{0x09}
+
+	if _, _, err := repo.GetPackfile(checksum); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist for a missing packfile, got %v", err)
+	}
+	if _, _, err := repo.GetState(checksum); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist for a missing state, got %v", err)
+	}
+
+	data := []byte("state")
+	if err := repo.PutState(checksum, bytes.NewReader(data), uint64(len(data))); err != nil {
+		t.Fatalf("PutState: %v", err)
+	}
+	rd, size, err := repo.GetState(checksum)
+	if err != nil {
+		t.Fatalf("GetState: %v", err)
+	}
+	if got, _ := io.ReadAll(rd); !bytes.Equal(got, data) || size != uint64(len(data)) {
+		t.Fatalf("expected %q, got %q (%d bytes)", data, got, size)
+	}
+}
+
+func TestLegacySnapshotKey(t *testing.T) {
+	repo, fake := newFakeRepository(t)
+	snapshotID := [32]byte{0x05, 0x01}
+
+	fake.mu.Lock()
+	fake.objects[fmt.Sprintf("snapshots/5/%064x", snapshotID)] = []byte("legacy snapshot")
+	fake.mu.Unlock()
+
+	data, err := repo.GetSnapshot(snapshotID)
+	if err != nil {
+		t.Fatalf("GetSnapshot: %v", err)
+	}
+	if string(data) != "legacy snapshot" {
+		t.Fatalf("expected the legacy snapshot, got %q", data)
+	}
+
+	if err := repo.DeleteSnapshot(snapshotID); err != nil {
+		t.Fatalf("DeleteSnapshot: %v", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.objects) != 0 {
+		t.Fatalf("expected the legacy snapshot to be deleted, got %v", fake.objects)
+	}
+}
+
+func TestLock(t *testing.T) {
+	repo, _ := newFakeRepository(t)
+
+	if _, _, err := repo.GetLock(); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist without a lock, got %v", err)
+	}
+	if created, err := repo.CreateLock(bytes.NewReader([]byte("first")), 5); err != nil || !created {
+		t.Fatalf("first CreateLock: created=%v, err=%v", created, err)
+	}
+	if created, err := repo.CreateLock(bytes.NewReader([]byte("second")), 6); err != nil || created {
+		t.Fatalf("second CreateLock: created=%v, err=%v", created, err)
+	}
+
+	rd, _, err := repo.GetLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(rd); string(data) != "first" {
+		t.Fatalf("expected the first lock to be kept, got %q", data)
+	}
+
+	if err := repo.DeleteLock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.GetLock(); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist after DeleteLock, got %v", err)
+	}
+}
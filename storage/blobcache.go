@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package storage
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/PlakarKorp/plakar/lru"
+	"github.com/dustin/go-humanize"
+)
+
+// BlobCache keeps the blobs most recently read from packfiles in memory,
+// up to a total size, for backends where every read is a round-trip over
+// the network.  A nil BlobCache caches nothing.
+type BlobCache struct {
+	mu  sync.Mutex
+	lru *lru.Cache[blobKey, []byte]
+}
+
+type blobKey struct {
+	packfile [32]byte
+	offset   uint32
+	length   uint32
+}
+
+func NewBlobCache(maxBytes uint64) *BlobCache {
+	return &BlobCache{
+		lru: lru.New[blobKey](maxBytes, func(data []byte) uint64 {
+			return uint64(len(data))
+		}, nil),
+	}
+}
+
+// ParseBlobCache parses a human-readable size such as "64MB" or "1GiB",
+// the maximum amount of memory used by the cache.
+func ParseBlobCache(value string) (*BlobCache, error) {
+	maxBytes, err := humanize.ParseBytes(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache size %q: %w", value, err)
+	}
+	if maxBytes == 0 {
+		return nil, fmt.Errorf("invalid cache size %q", value)
+	}
+	return NewBlobCache(maxBytes), nil
+}
+
+// Get returns the cached blob at offset in the packfile, the caller must
+// not modify it.
+func (cache *BlobCache) Get(packfile [32]byte, offset uint32, length uint32) ([]byte, bool) {
+	if cache == nil {
+		return nil, false
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.lru.Get(blobKey{packfile, offset, length})
+}
+
+// Put caches a blob read from a packfile, evicting the least recently
+// used ones as needed.  Blobs larger than the cache are not kept.
+func (cache *BlobCache) Put(packfile [32]byte, offset uint32, length uint32, data []byte) {
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.lru.Put(blobKey{packfile, offset, length}, data)
+}
+
+// Invalidate drops the cached blobs of a packfile, once it is deleted.
+func (cache *BlobCache) Invalidate(packfile [32]byte) {
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.lru.RemoveFunc(func(key blobKey, _ []byte) bool {
+		return key.packfile == packfile
+	})
+}
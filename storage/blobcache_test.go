@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBlobCache(t *testing.T) {
+	cache := NewBlobCache(10)
+	first, second := [32]byte{0x01}, [32]byte{0x02}
+
+	cache.Put(first, 0, 4, []byte("aaaa"))
+	cache.Put(first, 4, 4, []byte("bbbb"))
+	if data, ok := cache.Get(first, 0, 4); !ok || !bytes.Equal(data, []byte("aaaa")) {
+		t.Fatalf("expected a hit, got %q, %v", data, ok)
+	}
+	if _, ok := cache.Get(first, 0, 3); ok {
+		t.Fatal("a blob was returned for another length")
+	}
+
+	// evicts the least recently used blob, bbbb since aaaa was read
+	cache.Put(second, 0, 4, []byte("cccc"))
+	if _, ok := cache.Get(first, 4, 4); ok {
+		t.Fatal("the least recently used blob was kept")
+	}
+	if _, ok := cache.Get(first, 0, 4); !ok {
+		t.Fatal("a recently used blob was evicted")
+	}
+	if cache.lru.Size() != 8 {
+		t.Fatalf("expected 8 bytes cached, got %d", cache.lru.Size())
+	}
+
+	// larger than the whole cache
+	cache.Put(second, 4, 11, []byte("ddddddddddd"))
+	if _, ok := cache.Get(second, 4, 11); ok {
+		t.Fatal("a blob larger than the cache was kept")
+	}
+
+	cache.Invalidate(first)
+	if _, ok := cache.Get(first, 0, 4); ok {
+		t.Fatal("a blob of an invalidated packfile was kept")
+	}
+	if _, ok := cache.Get(second, 0, 4); !ok {
+		t.Fatal("a blob of another packfile was invalidated")
+	}
+	if cache.lru.Size() != 4 || cache.lru.Len() != 1 {
+		t.Fatalf("unexpected cache size %d with %d entries", cache.lru.Size(), cache.lru.Len())
+	}
+
+	var disabled *BlobCache
+	disabled.Put(first, 0, 4, []byte("aaaa"))
+	if _, ok := disabled.Get(first, 0, 4); ok {
+		t.Fatal("a nil cache returned a blob")
+	}
+	disabled.Invalidate(first)
+}
+
+func TestParseBlobCache(t *testing.T) {
+	cache, err := ParseBlobCache("64MiB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.lru.MaxSize() != 64*1024*1024 {
+		t.Fatalf("expected 64MiB, got %d", cache.lru.MaxSize())
+	}
+
+	for _, value := range []string{"", "0", "big"} {
+		if _, err := ParseBlobCache(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package storage
+
+import (
+	"io"
+	"time"
+)
+
+// PackfileChecker is implemented by backends that can tell whether they
+// hold a packfile without fetching it.
+type PackfileChecker interface {
+	CheckPackfile(checksum [32]byte) (bool, error)
+}
+
+// PutIfAbsent writes a packfile unless the backend already holds it, and
+// reports whether it was written. Packfiles are content-addressed so an
+// existing one never needs to be overwritten. Backends that do not
+// implement PackfileChecker always get the write.
+func PutIfAbsent(backend Backend, checksum [32]byte, rd io.Reader, size uint64) (bool, error) {
+	if checker, ok := backend.(PackfileChecker); ok {
+		exists, err := checker.CheckPackfile(checksum)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return false, nil
+		}
+	}
+	return true, backend.PutPackfile(checksum, rd, size)
+}
+
+// ObjectStat describes a packfile as stored by the backend.
+type ObjectStat struct {
+	Size    uint64
+	ModTime time.Time
+}
+
+// PackfileStatter is implemented by backends that can report the size and
+// store time of a packfile without fetching it.
+type PackfileStatter interface {
+	StatPackfile(checksum [32]byte) (ObjectStat, error)
+}
+
+// StatPackfile returns the metadata of a packfile. Backends that do not
+// implement PackfileStatter have the packfile opened to learn its size,
+// and report a zero ModTime.
+func StatPackfile(backend Backend, checksum [32]byte) (ObjectStat, error) {
+	if statter, ok := backend.(PackfileStatter); ok {
+		return statter.StatPackfile(checksum)
+	}
+	rd, size, err := backend.GetPackfile(checksum)
+	if err != nil {
+		return ObjectStat{}, err
+	}
+	if closer, ok := rd.(io.Closer); ok {
+		closer.Close()
+	}
+	return ObjectStat{Size: size}, nil
+}
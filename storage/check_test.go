@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// checkingBackend is a memoryBackend that can check for packfiles and
+// counts the writes it receives.
+type checkingBackend struct {
+	memoryBackend
+	puts int
+}
+
+func (backend *checkingBackend) CheckPackfile(checksum [32]byte) (bool, error) {
+	_, exists := backend.packfiles[checksum]
+	return exists, nil
+}
+
+func (backend *checkingBackend) PutPackfile(checksum [32]byte, rd io.Reader, size uint64) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	backend.packfiles[checksum] = data
+	backend.puts++
+	return nil
+}
+
+func TestPutIfAbsent(t *testing.T) {
+	backend := &checkingBackend{
+		memoryBackend: memoryBackend{packfiles: make(map[[32]byte][]byte)},
+	}
+	data := []byte("packfile")
+	checksum := [32]byte{0x01}
+
+	written, err := PutIfAbsent(backend, checksum, bytes.NewReader(data), uint64(len(data)))
+	if err != nil || !written {
+		t.Fatalf("first put: written=%v, err=%v", written, err)
+	}
+
+	written, err = PutIfAbsent(backend, checksum, bytes.NewReader(data), uint64(len(data)))
+	if err != nil || written {
+		t.Fatalf("second put: written=%v, err=%v", written, err)
+	}
+	if backend.puts != 1 {
+		t.Fatalf("expected a single write to reach the backend, got %d", backend.puts)
+	}
+
+	// the check must still work through the verifying wrapper
+	written, err = PutIfAbsent(NewVerifyingBackend(backend), checksum, bytes.NewReader(data), uint64(len(data)))
+	if err != nil || written || backend.puts != 1 {
+		t.Fatalf("put through VerifyingBackend: written=%v, err=%v, puts=%d", written, err, backend.puts)
+	}
+}
+
+// statBackend is a checkingBackend that can also report packfile metadata.
+type statBackend struct {
+	checkingBackend
+	stored time.Time
+}
+
+func (backend *statBackend) StatPackfile(checksum [32]byte) (ObjectStat, error) {
+	return ObjectStat{Size: uint64(len(backend.packfiles[checksum])), ModTime: backend.stored}, nil
+}
+
+func TestStatPackfile(t *testing.T) {
+	data := []byte("packfile")
+	checksum := [32]byte{0x01}
+
+	// backends without StatPackfile have the packfile opened instead
+	plain := &memoryBackend{packfiles: map[[32]byte][]byte{checksum: data}}
+	stat, err := StatPackfile(plain, checksum)
+	if err != nil || stat.Size != uint64(len(data)) || !stat.ModTime.IsZero() {
+		t.Fatalf("StatPackfile without support: stat=%+v, err=%v", stat, err)
+	}
+
+	backend := &statBackend{
+		checkingBackend: checkingBackend{
+			memoryBackend: memoryBackend{packfiles: map[[32]byte][]byte{checksum: data}},
+		},
+		stored: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for _, wrapped := range []Backend{backend, NewVerifyingBackend(backend)} {
+		stat, err := StatPackfile(wrapped, checksum)
+		if err != nil {
+			t.Fatalf("StatPackfile(%T): %v", wrapped, err)
+		}
+		if stat.Size != uint64(len(data)) || !stat.ModTime.Equal(backend.stored) {
+			t.Errorf("StatPackfile(%T): got %+v", wrapped, stat)
+		}
+	}
+}
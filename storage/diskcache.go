@@ -0,0 +1,340 @@
+/*
+ * Copyright (c) 2021 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/PlakarKorp/plakar/lru"
+)
+
+// DiskCache keeps packfiles fetched from a remote repository in a local
+// directory, evicting the least recently used ones beyond a total size.
+// Entries are named after the checksum of the packfile.
+type DiskCache struct {
+	mu  sync.Mutex
+	dir string
+	lru *lru.Cache[[32]byte, uint64] // sizes of the cached packfiles
+}
+
+// OpenDiskCache opens the cache in dir, creating it if needed.  Packfiles
+// cached by previous runs are kept, their modification time tells when
+// they were last used.
+func OpenDiskCache(dir string, maxBytes uint64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	cache := &DiskCache{dir: dir}
+	cache.lru = lru.New(maxBytes, func(size uint64) uint64 {
+		return size
+	}, func(checksum [32]byte, _ uint64) {
+		os.Remove(cache.path(checksum))
+	})
+
+	type cachedFile struct {
+		checksum [32]byte
+		size     uint64
+		modTime  time.Time
+	}
+	var files []cachedFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		decoded, err := hex.DecodeString(d.Name())
+		if err != nil || len(decoded) != 32 {
+			// leftovers of an interrupted write, or foreign files
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var checksum [32]byte
+		copy(checksum[:], decoded)
+		files = append(files, cachedFile{checksum, uint64(info.Size()), info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the most recently used last, evicting the oldest ones beyond the
+	// size of the cache
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, file := range files {
+		if !cache.lru.Put(file.checksum, file.size) {
+			os.Remove(cache.path(file.checksum))
+		}
+	}
+	return cache, nil
+}
+
+func (cache *DiskCache) path(checksum [32]byte) string {
+	return filepath.Join(cache.dir, fmt.Sprintf("%02x", checksum[0]), fmt.Sprintf("%064x", checksum))
+}
+
+// open returns the cached packfile, if any.
+func (cache *DiskCache) open(checksum [32]byte) (*os.File, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if _, ok := cache.lru.Get(checksum); !ok {
+		return nil, false
+	}
+	fp, err := os.Open(cache.path(checksum))
+	if err != nil {
+		cache.lru.Remove(checksum)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(fp.Name(), now, now)
+	return fp, true
+}
+
+// Get returns the content of a cached packfile.
+func (cache *DiskCache) Get(checksum [32]byte) ([]byte, bool) {
+	fp, ok := cache.open(checksum)
+	if !ok {
+		return nil, false
+	}
+	defer fp.Close()
+
+	data, err := io.ReadAll(fp)
+	if err != nil {
+		cache.Remove(checksum)
+		return nil, false
+	}
+	return data, true
+}
+
+// Put stores a packfile in the cache, evicting the least recently used
+// ones as needed.  Packfiles larger than the cache are not kept.
+func (cache *DiskCache) Put(checksum [32]byte, data []byte) error {
+	if uint64(len(data)) > cache.lru.MaxSize() {
+		return nil
+	}
+
+	path := cache.path(checksum)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp.*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		cache.lru.Remove(checksum)
+		return err
+	}
+	cache.lru.Put(checksum, uint64(len(data)))
+	return nil
+}
+
+// Remove drops a packfile from the cache.
+func (cache *DiskCache) Remove(checksum [32]byte) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.lru.Remove(checksum)
+}
+
+// DiskCacheBackend wraps the Backend of a remote repository and serves
+// the packfiles, and the blobs they contain, from a DiskCache when they
+// were fetched before.  A packfile that misses the cache is fetched
+// whole and stored, so that the other blobs it contains are read
+// locally.  Cached packfiles are verified against their checksum the
+// first time they are loaded.
+type DiskCacheBackend struct {
+	Backend
+	cache *DiskCache
+
+	mu       sync.Mutex
+	verified map[[32]byte]struct{}
+	fetching map[[32]byte]*sync.Mutex
+}
+
+func NewDiskCacheBackend(backend Backend, cache *DiskCache) Backend {
+	return &DiskCacheBackend{
+		Backend:  backend,
+		cache:    cache,
+		verified: make(map[[32]byte]struct{}),
+		fetching: make(map[[32]byte]*sync.Mutex),
+	}
+}
+
+func (backend *DiskCacheBackend) Unwrap() Backend {
+	return backend.Backend
+}
+
+// SetDiskCache has the packfiles read from the repository kept in cache.
+func (store *Store) SetDiskCache(cache *DiskCache) {
+	store.backend = NewDiskCacheBackend(store.backend, cache)
+}
+
+// fetchLock serializes the fetches of a packfile, so that blobs read
+// concurrently from a packfile missing the cache download it once.
+func (backend *DiskCacheBackend) fetchLock(checksum [32]byte) func() {
+	backend.mu.Lock()
+	mu, ok := backend.fetching[checksum]
+	if !ok {
+		mu = &sync.Mutex{}
+		backend.fetching[checksum] = mu
+	}
+	backend.mu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (backend *DiskCacheBackend) isVerified(checksum [32]byte) bool {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	_, ok := backend.verified[checksum]
+	return ok
+}
+
+func (backend *DiskCacheBackend) setVerified(checksum [32]byte, verified bool) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if verified {
+		backend.verified[checksum] = struct{}{}
+	} else {
+		delete(backend.verified, checksum)
+	}
+}
+
+// load returns a cached packfile, verifying it unless it was already.
+// A corrupted entry is dropped.
+func (backend *DiskCacheBackend) load(checksum [32]byte) ([]byte, bool) {
+	data, ok := backend.cache.Get(checksum)
+	if !ok {
+		return nil, false
+	}
+	if !backend.isVerified(checksum) {
+		if err := verifyPackfile(backend.Configuration(), checksum, data); err != nil {
+			logger.Warn("packfile cache: %s, dropping it", err)
+			backend.cache.Remove(checksum)
+			return nil, false
+		}
+		backend.setVerified(checksum, true)
+	}
+	return data, true
+}
+
+// fetch loads a packfile from the cache, or from the repository in which
+// case it is cached if it matches its checksum.
+func (backend *DiskCacheBackend) fetch(checksum [32]byte) ([]byte, error) {
+	unlock := backend.fetchLock(checksum)
+	defer unlock()
+
+	if data, ok := backend.load(checksum); ok {
+		return data, nil
+	}
+
+	rd, _, err := backend.Backend.GetPackfile(checksum)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyPackfile(backend.Configuration(), checksum, data); err != nil {
+		// not cached, the caller gets what the repository returned
+		return data, nil
+	}
+	if err := backend.cache.Put(checksum, data); err != nil {
+		logger.Warn("packfile cache: %s", err)
+	} else {
+		backend.setVerified(checksum, true)
+	}
+	return data, nil
+}
+
+func (backend *DiskCacheBackend) GetPackfile(checksum [32]byte) (io.Reader, uint64, error) {
+	data, err := backend.fetch(checksum)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), uint64(len(data)), nil
+}
+
+func (backend *DiskCacheBackend) GetPackfileBlob(checksum [32]byte, offset uint32, length uint32) (io.Reader, uint32, error) {
+	// a packfile verified earlier is read partially
+	if backend.isVerified(checksum) {
+		if fp, ok := backend.cache.open(checksum); ok {
+			defer fp.Close()
+			buffer := make([]byte, length)
+			if _, err := fp.ReadAt(buffer, int64(offset)); err == nil {
+				return bytes.NewReader(buffer), length, nil
+			}
+		}
+	}
+
+	data, err := backend.fetch(checksum)
+	if err != nil {
+		return nil, 0, err
+	}
+	if uint64(offset)+uint64(length) > uint64(len(data)) {
+		return nil, 0, fmt.Errorf("packfile %x: invalid range", checksum)
+	}
+	return bytes.NewReader(data[offset : offset+length]), length, nil
+}
+
+func (backend *DiskCacheBackend) DeletePackfile(checksum [32]byte) error {
+	backend.cache.Remove(checksum)
+	backend.setVerified(checksum, false)
+	return backend.Backend.DeletePackfile(checksum)
+}
+
+func (backend *DiskCacheBackend) CheckPackfile(checksum [32]byte) (bool, error) {
+	if checker, ok := backend.Backend.(PackfileChecker); ok {
+		return checker.CheckPackfile(checksum)
+	}
+	return false, nil
+}
+
+func (backend *DiskCacheBackend) StatPackfile(checksum [32]byte) (ObjectStat, error) {
+	return StatPackfile(backend.Backend, checksum)
+}
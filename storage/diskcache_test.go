@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"testing"
+)
+
+// countingBackend counts the packfiles fetched from a memoryBackend.
+type countingBackend struct {
+	*memoryBackend
+	fetches int
+}
+
+func (backend *countingBackend) GetPackfile(checksum [32]byte) (io.Reader, uint64, error) {
+	backend.fetches++
+	return backend.memoryBackend.GetPackfile(checksum)
+}
+
+func (backend *countingBackend) DeletePackfile(checksum [32]byte) error {
+	delete(backend.packfiles, checksum)
+	return nil
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	packfiles := make(map[[32]byte][]byte)
+	var checksums [][32]byte
+	for _, content := range []string{"first packfile", "second packfile", "third packfile"} {
+		data := []byte(content)
+		checksum := sha256.Sum256(data)
+		packfiles[checksum] = data
+		checksums = append(checksums, checksum)
+	}
+	remote := &countingBackend{memoryBackend: &memoryBackend{
+		configuration: *NewConfiguration(),
+		packfiles:     packfiles,
+	}}
+
+	// room for two packfiles
+	cache, err := OpenDiskCache(dir, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := NewDiskCacheBackend(remote, cache)
+
+	read := func(checksum [32]byte) []byte {
+		t.Helper()
+		rd, _, err := backend.GetPackfile(checksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, packfiles[checksum]) {
+			t.Fatalf("unexpected content %q", data)
+		}
+		return data
+	}
+	expectFetches := func(fetches int) {
+		t.Helper()
+		if remote.fetches != fetches {
+			t.Fatalf("expected %d fetches from the repository, got %d", fetches, remote.fetches)
+		}
+	}
+
+	// miss, then hit
+	read(checksums[0])
+	expectFetches(1)
+	read(checksums[0])
+	expectFetches(1)
+
+	// blobs are read from the cached packfile
+	rd, _, err := backend.GetPackfileBlob(checksums[0], 6, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob, _ := io.ReadAll(rd); string(blob) != "packfile" {
+		t.Fatalf("unexpected blob %q", blob)
+	}
+	expectFetches(1)
+
+	// a blob of a packfile missing the cache brings the whole packfile in
+	rd, _, err = backend.GetPackfileBlob(checksums[1], 0, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob, _ := io.ReadAll(rd); string(blob) != "second" {
+		t.Fatalf("unexpected blob %q", blob)
+	}
+	expectFetches(2)
+	read(checksums[1])
+	expectFetches(2)
+
+	// the third packfile evicts the least recently used, the first one
+	read(checksums[0])
+	read(checksums[2])
+	expectFetches(3)
+	if _, err := os.Stat(cache.path(checksums[1])); !os.IsNotExist(err) {
+		t.Fatalf("the evicted packfile is still on disk: %v", err)
+	}
+	read(checksums[0])
+	expectFetches(3)
+	read(checksums[1])
+	expectFetches(4)
+
+	// a corrupted entry is dropped and fetched again
+	if err := os.WriteFile(cache.path(checksums[1]), []byte("corrupted packfile"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenDiskCache(dir, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend = NewDiskCacheBackend(remote, reopened)
+	read(checksums[1])
+	expectFetches(5)
+	read(checksums[1])
+	expectFetches(5)
+
+	// the cache survives across runs
+	read(checksums[0])
+	expectFetches(5)
+
+	if err := backend.DeletePackfile(checksums[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(reopened.path(checksums[0])); !os.IsNotExist(err) {
+		t.Fatalf("a deleted packfile is still cached: %v", err)
+	}
+}
+
+func TestDiskCacheUnverified(t *testing.T) {
+	data := []byte("some packfile content")
+	checksum := sha256.Sum256([]byte("something else"))
+	remote := &countingBackend{memoryBackend: &memoryBackend{
+		configuration: *NewConfiguration(),
+		packfiles:     map[[32]byte][]byte{checksum: data},
+	}}
+	cache, err := OpenDiskCache(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := NewDiskCacheBackend(remote, cache)
+
+	// what doesn't match its checksum is returned as is but not cached
+	for i := 1; i <= 2; i++ {
+		rd, _, err := backend.GetPackfile(checksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := io.ReadAll(rd); !bytes.Equal(got, data) {
+			t.Fatalf("unexpected content %q", got)
+		}
+		if remote.fetches != i {
+			t.Fatalf("expected %d fetches, got %d", i, remote.fetches)
+		}
+	}
+	if cache.lru.Len() != 0 {
+		t.Fatal("a packfile not matching its checksum was cached")
+	}
+}
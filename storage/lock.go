@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/PlakarKorp/plakar/logger"
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ErrLocked is returned when the repository lock is held by someone else.
+var ErrLocked = errors.New("repository is locked")
+
+// DefaultLockTTL is how long a lock stays valid without being refreshed,
+// the holder refreshes it well before that.
+var DefaultLockTTL = 5 * time.Minute
+
+// Locker is implemented by backends that can hold the repository lock, a
+// single LOCK object next to the configuration.
+//
+// The lock only excludes other processes if CreateLock is atomic, as it is
+// on the fs backend. The s3 backend can only check for the lock and then
+// write it: two processes may both take the lock, so there it is a
+// best-effort guard against mistakes and not mutual exclusion.
+type Locker interface {
+	// CreateLock stores the lock unless one exists already, and reports
+	// whether it was stored.
+	CreateLock(rd io.Reader, size uint64) (bool, error)
+	// PutLock overwrites the lock.
+	PutLock(rd io.Reader, size uint64) error
+	// GetLock returns the lock, or an error matching fs.ErrNotExist if
+	// there is none.
+	GetLock() (io.Reader, uint64, error)
+	DeleteLock() error
+}
+
+// Lock identifies the holder of the repository lock.
+type Lock struct {
+	Identifier uuid.UUID
+	Hostname   string
+	Username   string
+	ProcessID  int
+	Timestamp  time.Time
+	TTL        time.Duration
+}
+
+func NewLockFromBytes(serialized []byte) (*Lock, error) {
+	var lock Lock
+	if err := msgpack.Unmarshal(serialized, &lock); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+func (lock *Lock) Serialize() ([]byte, error) {
+	return msgpack.Marshal(lock)
+}
+
+// Expired returns true if the holder didn't refresh the lock within its
+// TTL, it most likely died without releasing it.
+func (lock *Lock) Expired() bool {
+	return time.Since(lock.Timestamp) > lock.TTL
+}
+
+func (lock *Lock) String() string {
+	return fmt.Sprintf("%s@%s (pid %d) since %s", lock.Username, lock.Hostname,
+		lock.ProcessID, lock.Timestamp.UTC().Format(time.RFC3339))
+}
+
+// locker returns the backend as a Locker, looking through the wrappers,
+// or nil if it can't hold a lock.
+func (store *Store) locker() Locker {
+	locker, _ := unwrap(store.backend).(Locker)
+	return locker
+}
+
+// CanLock reports whether the backend can hold the repository lock, Lock
+// succeeds without locking anything when it can't.
+func (store *Store) CanLock() bool {
+	return store.locker() != nil
+}
+
+func getLock(locker Locker) (*Lock, error) {
+	rd, _, err := locker.GetLock()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	return NewLockFromBytes(data)
+}
+
+// Lock takes the repository lock and refreshes it in the background until
+// Unlock is called. It fails with ErrLocked if someone else holds it, a
+// lock that expired can be broken with force. Backends that can't hold a
+// lock are not locked, with a warning, see CanLock. Read-only repositories
+// and those newer than VERSION can't be locked at all.
+func (store *Store) Lock(force bool) error {
+	if err := checkWrite(store.Configuration().Mode); err != nil {
+		return err
+	}
+	if err := checkVersion(store.Configuration().Version); err != nil {
+		return err
+	}
+
+	locker := store.locker()
+	if locker == nil {
+		logger.Warn("backend does not support locking, the repository is not locked")
+		return nil
+	}
+
+	lock := &Lock{
+		Identifier: uuid.Must(uuid.NewRandom()),
+		Hostname:   store.context.GetHostname(),
+		Username:   store.context.GetUsername(),
+		ProcessID:  store.context.GetProcessID(),
+		Timestamp:  time.Now(),
+		TTL:        DefaultLockTTL,
+	}
+	serialized, err := lock.Serialize()
+	if err != nil {
+		return err
+	}
+
+	created, err := locker.CreateLock(bytes.NewReader(serialized), uint64(len(serialized)))
+	if err != nil {
+		return err
+	}
+	if !created {
+		holder, err := getLock(locker)
+		if errors.Is(err, fs.ErrNotExist) {
+			// released meanwhile, don't race for it
+			return fmt.Errorf("%w, try again", ErrLocked)
+		} else if err != nil {
+			return err
+		}
+		if !force || !holder.Expired() {
+			return fmt.Errorf("%w by %s", ErrLocked, holder)
+		}
+
+		logger.Warn("breaking expired lock held by %s", holder)
+		if err := locker.PutLock(bytes.NewReader(serialized), uint64(len(serialized))); err != nil {
+			return err
+		}
+	}
+
+	// another process may have broken the same expired lock at the same
+	// time, or created it if CreateLock isn't atomic. Only the writes that
+	// landed before this read are detected, a later one goes unnoticed.
+	if current, err := getLock(locker); err != nil {
+		return err
+	} else if current.Identifier != lock.Identifier {
+		return fmt.Errorf("%w by %s", ErrLocked, current)
+	}
+
+	store.lock = lock
+	store.lockDone = make(chan struct{})
+	store.lockRefreshed = make(chan struct{})
+	go store.refreshLock(locker, lock, store.lockDone, store.lockRefreshed)
+	return nil
+}
+
+func (store *Store) refreshLock(locker Locker, lock *Lock, done <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(lock.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		current, err := getLock(locker)
+		if err != nil {
+			logger.Warn("could not refresh repository lock: %s", err)
+			continue
+		}
+		if current.Identifier != lock.Identifier {
+			logger.Warn("repository lock was taken over by %s", current)
+			return
+		}
+
+		refreshed := *lock
+		refreshed.Timestamp = time.Now()
+		serialized, err := refreshed.Serialize()
+		if err != nil {
+			logger.Warn("could not refresh repository lock: %s", err)
+			continue
+		}
+		if err := locker.PutLock(bytes.NewReader(serialized), uint64(len(serialized))); err != nil {
+			logger.Warn("could not refresh repository lock: %s", err)
+		}
+	}
+}
+
+// Unlock releases the lock taken by Lock, unless someone else broke it
+// meanwhile.
+func (store *Store) Unlock() error {
+	if store.lock == nil {
+		return nil
+	}
+	lock := store.lock
+	store.lock = nil
+
+	close(store.lockDone)
+	<-store.lockRefreshed
+
+	locker := store.locker()
+	current, err := getLock(locker)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if current.Identifier != lock.Identifier {
+		return nil
+	}
+	return locker.DeleteLock()
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/PlakarKorp/plakar/context"
+)
+
+// lockingBackend is a memoryBackend that can hold the repository lock.
+type lockingBackend struct {
+	memoryBackend
+	lock []byte
+}
+
+func (backend *lockingBackend) CreateLock(rd io.Reader, size uint64) (bool, error) {
+	if backend.lock != nil {
+		return false, nil
+	}
+	return true, backend.PutLock(rd, size)
+}
+
+func (backend *lockingBackend) PutLock(rd io.Reader, size uint64) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	backend.lock = data
+	return nil
+}
+
+func (backend *lockingBackend) GetLock() (io.Reader, uint64, error) {
+	if backend.lock == nil {
+		return nil, 0, fs.ErrNotExist
+	}
+	return bytes.NewReader(backend.lock), uint64(len(backend.lock)), nil
+}
+
+func (backend *lockingBackend) DeleteLock() error {
+	backend.lock = nil
+	return nil
+}
+
+func TestLock(t *testing.T) {
+	backend := &lockingBackend{}
+	first := &Store{backend: backend, context: context.NewContext()}
+	second := &Store{backend: NewVerifyingBackend(backend), context: context.NewContext()}
+	if !first.CanLock() || !second.CanLock() {
+		t.Fatal("expected the backend to hold the lock")
+	}
+
+	if err := first.Lock(false); err != nil {
+		t.Fatalf("first Lock: %v", err)
+	}
+	if err := second.Lock(false); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked while held, got %v", err)
+	}
+	if err := second.Lock(true); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected a live lock not to be broken, got %v", err)
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if backend.lock != nil {
+		t.Fatal("expected the lock to be released")
+	}
+	if err := second.Lock(false); err != nil {
+		t.Fatalf("Lock after release: %v", err)
+	}
+	if err := second.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+}
+
+func TestLockExpired(t *testing.T) {
+	backend := &lockingBackend{}
+	stale := &Lock{Hostname: "elsewhere", Timestamp: time.Now().Add(-time.Hour), TTL: time.Minute}
+	serialized, err := stale.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.lock = serialized
+
+	store := &Store{backend: backend, context: context.NewContext()}
+	if err := store.Lock(false); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected an expired lock to need force, got %v", err)
+	}
+	if err := store.Lock(true); err != nil {
+		t.Fatalf("Lock with force: %v", err)
+	}
+
+	// the previous holder comes back and finds its lock taken over
+	previous := &Store{backend: backend, context: context.NewContext(), lock: stale,
+		lockDone: make(chan struct{}), lockRefreshed: make(chan struct{})}
+	close(previous.lockRefreshed)
+	if err := previous.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if backend.lock == nil {
+		t.Fatal("expected the lock of the new holder to be kept")
+	}
+	if err := store.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockUnsupported(t *testing.T) {
+	store := &Store{backend: &memoryBackend{}, context: context.NewContext()}
+	if store.CanLock() {
+		t.Fatal("expected the backend not to hold the lock")
+	}
+	if err := store.Lock(false); err != nil {
+		t.Fatalf("expected backends without locking to be left unlocked, got %v", err)
+	}
+	if err := store.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
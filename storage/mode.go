@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Modes of a repository, recorded in its configuration when it is created.
+// Repositories created before modes existed have an empty mode, which is
+// read-write.
+const (
+	ModeReadWrite  = "readwrite"
+	ModeAppendOnly = "appendonly"
+	ModeReadOnly   = "readonly"
+)
+
+var ErrReadOnly = errors.New("repository is read-only")
+var ErrAppendOnly = errors.New("repository is append-only")
+
+func ValidateMode(mode string) error {
+	switch mode {
+	case ModeReadWrite, ModeAppendOnly, ModeReadOnly:
+		return nil
+	default:
+		return fmt.Errorf("unknown repository mode: %s", mode)
+	}
+}
+
+func checkWrite(mode string) error {
+	if mode == ModeReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+func checkDelete(mode string) error {
+	switch mode {
+	case ModeReadOnly:
+		return ErrReadOnly
+	case ModeAppendOnly:
+		return ErrAppendOnly
+	}
+	return nil
+}
+
+// ModeBackend wraps a Backend and refuses the operations that the mode of
+// the repository forbids: nothing is written to a read-only repository and
+// nothing is deleted from an append-only one.
+type ModeBackend struct {
+	Backend
+	mode string
+}
+
+func NewModeBackend(backend Backend, mode string) Backend {
+	return &ModeBackend{Backend: backend, mode: mode}
+}
+
+func (backend *ModeBackend) Unwrap() Backend {
+	return backend.Backend
+}
+
+func (backend *ModeBackend) PutState(checksum [32]byte, rd io.Reader, size uint64) error {
+	if err := checkWrite(backend.mode); err != nil {
+		return err
+	}
+	return backend.Backend.PutState(checksum, rd, size)
+}
+
+func (backend *ModeBackend) DeleteState(checksum [32]byte) error {
+	if err := checkDelete(backend.mode); err != nil {
+		return err
+	}
+	return backend.Backend.DeleteState(checksum)
+}
+
+func (backend *ModeBackend) PutPackfile(checksum [32]byte, rd io.Reader, size uint64) error {
+	if err := checkWrite(backend.mode); err != nil {
+		return err
+	}
+	return backend.Backend.PutPackfile(checksum, rd, size)
+}
+
+func (backend *ModeBackend) DeletePackfile(checksum [32]byte) error {
+	if err := checkDelete(backend.mode); err != nil {
+		return err
+	}
+	return backend.Backend.DeletePackfile(checksum)
+}
+
+func (backend *ModeBackend) CheckPackfile(checksum [32]byte) (bool, error) {
+	if checker, ok := backend.Backend.(PackfileChecker); ok {
+		return checker.CheckPackfile(checksum)
+	}
+	return false, nil
+}
+
+func (backend *ModeBackend) StatPackfile(checksum [32]byte) (ObjectStat, error) {
+	return StatPackfile(backend.Backend, checksum)
+}
+
+// CheckDelete returns an error if the mode of the repository forbids
+// deletions. Some of them, such as the deletion of a snapshot, are
+// recorded by writing a state and must be refused before reaching the
+// backend.
+func (store *Store) CheckDelete() error {
+	return checkDelete(store.Configuration().Mode)
+}
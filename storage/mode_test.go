@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// mapBackend keeps states and packfiles in memory, the embedded Backend
+// is nil so any other method panics if called.
+type mapBackend struct {
+	Backend
+	states    map[[32]byte][]byte
+	packfiles map[[32]byte][]byte
+}
+
+func newMapBackend() *mapBackend {
+	return &mapBackend{
+		states:    make(map[[32]byte][]byte),
+		packfiles: make(map[[32]byte][]byte),
+	}
+}
+
+func (backend *mapBackend) PutState(checksum [32]byte, rd io.Reader, size uint64) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	backend.states[checksum] = data
+	return nil
+}
+
+func (backend *mapBackend) DeleteState(checksum [32]byte) error {
+	delete(backend.states, checksum)
+	return nil
+}
+
+func (backend *mapBackend) PutPackfile(checksum [32]byte, rd io.Reader, size uint64) error {
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	backend.packfiles[checksum] = data
+	return nil
+}
+
+func (backend *mapBackend) DeletePackfile(checksum [32]byte) error {
+	delete(backend.packfiles, checksum)
+	return nil
+}
+
+func TestModeBackend(t *testing.T) {
+	data := []byte("some content")
+	checksum := [32]byte{0x01}
+
+	put := func(backend Backend) (error, error) {
+		return backend.PutState(checksum, bytes.NewReader(data), uint64(len(data))),
+			backend.PutPackfile(checksum, bytes.NewReader(data), uint64(len(data)))
+	}
+	del := func(backend Backend) (error, error) {
+		return backend.DeleteState(checksum), backend.DeletePackfile(checksum)
+	}
+
+	inner := newMapBackend()
+	backend := NewModeBackend(inner, ModeAppendOnly)
+	if errState, errPackfile := put(backend); errState != nil || errPackfile != nil {
+		t.Fatalf("put in append-only mode: %v, %v", errState, errPackfile)
+	}
+	if len(inner.states) != 1 || len(inner.packfiles) != 1 {
+		t.Fatal("expected the puts to reach the backend")
+	}
+	errState, errPackfile := del(backend)
+	if !errors.Is(errState, ErrAppendOnly) || !errors.Is(errPackfile, ErrAppendOnly) {
+		t.Fatalf("expected ErrAppendOnly, got %v, %v", errState, errPackfile)
+	}
+	if len(inner.states) != 1 || len(inner.packfiles) != 1 {
+		t.Fatal("expected the deletes not to reach the backend")
+	}
+
+	backend = NewModeBackend(inner, ModeReadOnly)
+	errState, errPackfile = put(backend)
+	if !errors.Is(errState, ErrReadOnly) || !errors.Is(errPackfile, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v, %v", errState, errPackfile)
+	}
+	errState, errPackfile = del(backend)
+	if !errors.Is(errState, ErrReadOnly) || !errors.Is(errPackfile, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, got %v, %v", errState, errPackfile)
+	}
+	if len(inner.states) != 1 || len(inner.packfiles) != 1 {
+		t.Fatal("expected the deletes not to reach the backend")
+	}
+}
+
+func TestValidateMode(t *testing.T) {
+	for _, mode := range []string{ModeReadWrite, ModeAppendOnly, ModeReadOnly} {
+		if err := ValidateMode(mode); err != nil {
+			t.Errorf("%s: %v", mode, err)
+		}
+	}
+	if err := ValidateMode("writeonly"); err == nil {
+		t.Error("expected an unknown mode to be refused")
+	}
+}
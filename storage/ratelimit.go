@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// RateLimiter is a token bucket shared by all the readers and writers of
+// a backend, so that the configured rate applies to the backend as a whole
+// rather than to each transfer.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(bytesPerSecond uint64) *RateLimiter {
+	rate := float64(bytesPerSecond)
+
+	// allow a tenth of a second worth of data to go through unthrottled,
+	// small enough to keep the rate smooth, large enough to avoid tiny
+	// reads and writes on slow links.
+	burst := rate / 10
+	if burst < 1024 {
+		burst = 1024
+	}
+
+	return &RateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// ParseRateLimit parses a human-readable bandwidth such as "10MB" or
+// "512KiB", interpreted as bytes per second.
+func ParseRateLimit(value string) (*RateLimiter, error) {
+	bytesPerSecond, err := humanize.ParseBytes(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bandwidth limit %q: %w", value, err)
+	}
+	if bytesPerSecond == 0 {
+		return nil, fmt.Errorf("invalid bandwidth limit %q", value)
+	}
+	return NewRateLimiter(bytesPerSecond), nil
+}
+
+func (limiter *RateLimiter) chunkSize() int {
+	return int(limiter.burst)
+}
+
+// wait consumes n tokens, sleeping for as long as the bucket is in debt.
+func (limiter *RateLimiter) wait(n int) {
+	limiter.mu.Lock()
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.burst {
+		limiter.tokens = limiter.burst
+	}
+	limiter.last = now
+	limiter.tokens -= float64(n)
+	debt := limiter.tokens
+	limiter.mu.Unlock()
+
+	if debt < 0 {
+		time.Sleep(time.Duration(-debt / limiter.rate * float64(time.Second)))
+	}
+}
+
+type RateLimitedReader struct {
+	rd      io.Reader
+	limiter *RateLimiter
+}
+
+// NewRateLimitedReader returns a reader throttling reads from rd. The
+// returned reader implements io.Closer if rd does, so that the resources
+// behind rd can still be released.
+func NewRateLimitedReader(rd io.Reader, limiter *RateLimiter) io.Reader {
+	if limiter == nil {
+		return rd
+	}
+	reader := &RateLimitedReader{
+		rd:      rd,
+		limiter: limiter,
+	}
+	if closer, ok := rd.(io.Closer); ok {
+		return &rateLimitedReadCloser{RateLimitedReader: reader, closer: closer}
+	}
+	return reader
+}
+
+func (reader *RateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > reader.limiter.chunkSize() {
+		p = p[:reader.limiter.chunkSize()]
+	}
+	n, err := reader.rd.Read(p)
+	if n > 0 {
+		reader.limiter.wait(n)
+	}
+	return n, err
+}
+
+type rateLimitedReadCloser struct {
+	*RateLimitedReader
+	closer io.Closer
+}
+
+func (reader *rateLimitedReadCloser) Close() error {
+	return reader.closer.Close()
+}
+
+type RateLimitedWriter struct {
+	wr      io.Writer
+	limiter *RateLimiter
+}
+
+func NewRateLimitedWriter(wr io.Writer, limiter *RateLimiter) io.Writer {
+	if limiter == nil {
+		return wr
+	}
+	return &RateLimitedWriter{
+		wr:      wr,
+		limiter: limiter,
+	}
+}
+
+func (writer *RateLimitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > writer.limiter.chunkSize() {
+			chunk = chunk[:writer.limiter.chunkSize()]
+		}
+		writer.limiter.wait(len(chunk))
+
+		n, err := writer.wr.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
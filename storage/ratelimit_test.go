@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedReader(t *testing.T) {
+	payload := make([]byte, 512*1024)
+	limiter := NewRateLimiter(1024 * 1024)
+
+	t0 := time.Now()
+	n, err := io.Copy(io.Discard, NewRateLimitedReader(bytes.NewReader(payload), limiter))
+	elapsed := time.Since(t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(payload)) {
+		t.Fatalf("expected %d bytes, got %d", len(payload), n)
+	}
+
+	// 512KiB at 1MiB/s minus the initial burst of ~100KiB
+	if elapsed < 300*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Fatalf("expected transfer to take ~400ms, took %s", elapsed)
+	}
+}
+
+func TestRateLimitedWriter(t *testing.T) {
+	payload := make([]byte, 512*1024)
+	limiter := NewRateLimiter(1024 * 1024)
+
+	var buf bytes.Buffer
+	t0 := time.Now()
+	n, err := NewRateLimitedWriter(&buf, limiter).Write(payload)
+	elapsed := time.Since(t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(payload) || buf.Len() != len(payload) {
+		t.Fatalf("expected %d bytes, got %d", len(payload), n)
+	}
+	if elapsed < 300*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Fatalf("expected transfer to take ~400ms, took %s", elapsed)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	limiter, err := ParseRateLimit("10MB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limiter.rate != 10*1000*1000 {
+		t.Fatalf("expected 10MB/s, got %f", limiter.rate)
+	}
+
+	for _, value := range []string{"", "0", "fast"} {
+		if _, err := ParseRateLimit(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestRateLimitedNilLimiter(t *testing.T) {
+	rd := bytes.NewReader(nil)
+	if NewRateLimitedReader(rd, nil) != io.Reader(rd) {
+		t.Fatalf("expected reader to be returned unwrapped")
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (rd *closeRecorder) Close() error {
+	rd.closed = true
+	return nil
+}
+
+func TestRateLimitedReaderClose(t *testing.T) {
+	limiter := NewRateLimiter(1 << 20)
+
+	if _, ok := NewRateLimitedReader(bytes.NewReader(nil), limiter).(io.Closer); ok {
+		t.Errorf("expected a reader without Close to stay without Close")
+	}
+
+	rd := &closeRecorder{Reader: bytes.NewReader([]byte("data"))}
+	closer, ok := NewRateLimitedReader(rd, limiter).(io.ReadCloser)
+	if !ok {
+		t.Fatalf("expected the wrapped reader to keep its Close")
+	}
+	if data, err := io.ReadAll(closer); err != nil || string(data) != "data" {
+		t.Fatalf("read %q: %v", data, err)
+	}
+	if err := closer.Close(); err != nil || !rd.closed {
+		t.Errorf("expected Close to reach the wrapped reader: closed=%v, err=%v", rd.closed, err)
+	}
+}
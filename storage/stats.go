@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/PlakarKorp/plakar/profiler"
+)
+
+// OperationStats accumulates the calls made to a single backend operation.
+// Bytes only accounts for the payload of successful calls.
+type OperationStats struct {
+	Calls       uint64
+	Errors      uint64
+	Bytes       uint64
+	Duration    time.Duration
+	MinDuration time.Duration
+	MaxDuration time.Duration
+}
+
+var muStats sync.Mutex
+var stats map[string]*OperationStats = make(map[string]*OperationStats)
+
+// RecordOperation is called by backends once an operation completed, it
+// also records the operation as a profiler event.
+func RecordOperation(operation string, duration time.Duration, nbytes uint64, err error) {
+	profiler.RecordEvent(operation, duration)
+
+	muStats.Lock()
+	defer muStats.Unlock()
+
+	st, exists := stats[operation]
+	if !exists {
+		st = &OperationStats{MinDuration: duration, MaxDuration: duration}
+		stats[operation] = st
+	}
+
+	st.Calls++
+	st.Duration += duration
+	if duration < st.MinDuration {
+		st.MinDuration = duration
+	}
+	if duration > st.MaxDuration {
+		st.MaxDuration = duration
+	}
+	if err != nil {
+		st.Errors++
+	} else {
+		st.Bytes += nbytes
+	}
+}
+
+// Stats returns a copy of the statistics recorded so far, by operation.
+func Stats() map[string]OperationStats {
+	muStats.Lock()
+	defer muStats.Unlock()
+
+	ret := make(map[string]OperationStats, len(stats))
+	for operation, st := range stats {
+		ret[operation] = *st
+	}
+	return ret
+}
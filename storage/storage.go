@@ -55,6 +55,19 @@ type Configuration struct {
 	Hashing     hashing.Configuration
 	Compression *compression.Configuration
 	Encryption  *encryption.Configuration
+
+	// VerifyOnRead makes the store check the checksum of every packfile
+	// it fetches before handing it over.
+	VerifyOnRead bool
+
+	// CheckBeforeWrite makes the store skip the upload of packfiles that
+	// the backend already holds, at the cost of an extra request per
+	// packfile.
+	CheckBeforeWrite bool
+
+	// Mode restricts the operations allowed on the repository, see
+	// ModeBackend.
+	Mode string
 }
 
 func NewConfiguration() *Configuration {
@@ -69,6 +82,8 @@ func NewConfiguration() *Configuration {
 
 		Compression: compression.DefaultConfiguration(),
 		Encryption:  encryption.DefaultConfiguration(),
+
+		Mode: ModeReadWrite,
 	}
 }
 
@@ -91,8 +106,26 @@ type Backend interface {
 	Close() error
 }
 
+// wrapper is implemented by the backends wrapping another one, such as
+// ModeBackend, so that the optional interfaces of the wrapped backend,
+// which they don't all forward, can be found.
+type wrapper interface {
+	Unwrap() Backend
+}
+
+// unwrap returns the backend underneath all wrappers.
+func unwrap(backend Backend) Backend {
+	for {
+		w, ok := backend.(wrapper)
+		if !ok {
+			return backend
+		}
+		backend = w.Unwrap()
+	}
+}
+
 var muBackends sync.Mutex
-var backends map[string]func() Backend = make(map[string]func() Backend)
+var backends map[string]func(*context.Context) Backend = make(map[string]func(*context.Context) Backend)
 
 type Store struct {
 	backend  Backend
@@ -106,6 +139,10 @@ type Store struct {
 	readSharedLock  *locking.SharedLock
 
 	bufferedPackfiles chan struct{}
+
+	lock          *Lock
+	lockDone      chan struct{}
+	lockRefreshed chan struct{}
 }
 
 func NewStore(ctx *context.Context, name string, location string) (*Store, error) {
@@ -117,7 +154,7 @@ func NewStore(ctx *context.Context, name string, location string) (*Store, error
 	} else {
 		store := &Store{}
 		store.context = ctx
-		store.backend = backend()
+		store.backend = backend(ctx)
 		store.location = location
 		store.writeSharedLock = locking.NewSharedLock("store.write", runtime.NumCPU()*8+1)
 		store.readSharedLock = locking.NewSharedLock("store.read", runtime.NumCPU()*8+1)
@@ -126,7 +163,7 @@ func NewStore(ctx *context.Context, name string, location string) (*Store, error
 	}
 }
 
-func Register(name string, backend func() Backend) {
+func Register(name string, backend func(*context.Context) Backend) {
 	muBackends.Lock()
 	defer muBackends.Unlock()
 
@@ -163,6 +200,8 @@ func New(ctx *context.Context, location string) (*Store, error) {
 			backendName = "s3"
 		} else if strings.HasPrefix(location, "null://") {
 			backendName = "null"
+		} else if strings.HasPrefix(location, "memory://") {
+			backendName = "memory"
 		} else if strings.HasPrefix(location, "fs://") {
 			backendName = "fs"
 		} else if strings.Contains(location, "://") {
@@ -197,9 +236,19 @@ func Open(ctx *context.Context, location string) (*Store, error) {
 
 	if err = store.backend.Open(location); err != nil {
 		return nil, err
-	} else {
-		return store, nil
 	}
+	if store.backend.Configuration().VerifyOnRead {
+		store.backend = NewVerifyingBackend(store.backend)
+	}
+	if mode := store.backend.Configuration().Mode; mode != "" && mode != ModeReadWrite {
+		store.backend = NewModeBackend(store.backend, mode)
+	}
+	if err := checkVersion(store.backend.Configuration().Version); err != nil {
+		logger.Warn("%s: repository version %s is newer than %s, refusing writes",
+			location, store.backend.Configuration().Version, VERSION)
+		store.backend = NewVersionBackend(store.backend)
+	}
+	return store, nil
 }
 
 func Create(ctx *context.Context, location string, configuration Configuration) (*Store, error) {
@@ -217,9 +266,14 @@ func Create(ctx *context.Context, location string, configuration Configuration)
 
 	if err = store.backend.Create(location, configuration); err != nil {
 		return nil, err
-	} else {
-		return store, nil
 	}
+	if configuration.VerifyOnRead {
+		store.backend = NewVerifyingBackend(store.backend)
+	}
+	if mode := configuration.Mode; mode != "" && mode != ModeReadWrite {
+		store.backend = NewModeBackend(store.backend, mode)
+	}
+	return store, nil
 }
 
 func (store *Store) Context() *context.Context {
@@ -279,6 +333,21 @@ func (store *Store) GetPackfile(checksum objects.Checksum) (io.Reader, uint64, e
 	return rd, datalen, nil
 }
 
+// StatPackfile returns the size and store time of a packfile without
+// fetching it when the backend allows it.
+func (store *Store) StatPackfile(checksum objects.Checksum) (ObjectStat, error) {
+	store.readSharedLock.Lock()
+	defer store.readSharedLock.Unlock()
+
+	t0 := time.Now()
+	defer func() {
+		profiler.RecordEvent("store.StatPackfile", time.Since(t0))
+		logger.Trace("store", "StatPackfile(%016x): %s", checksum, time.Since(t0))
+	}()
+
+	return StatPackfile(store.backend, checksum)
+}
+
 func (store *Store) GetPackfileBlob(checksum objects.Checksum, offset uint32, length uint32) (io.Reader, uint32, error) {
 	store.readSharedLock.Lock()
 	defer store.readSharedLock.Unlock()
@@ -310,8 +379,21 @@ func (store *Store) PutPackfile(checksum objects.Checksum, rd io.Reader, size ui
 	store.bufferedPackfiles <- struct{}{}
 	defer func() { <-store.bufferedPackfiles }()
 
-	atomic.AddUint64(&store.wBytes, uint64(size))
-	return store.backend.PutPackfile(checksum, rd, size)
+	if !store.backend.Configuration().CheckBeforeWrite {
+		atomic.AddUint64(&store.wBytes, uint64(size))
+		return store.backend.PutPackfile(checksum, rd, size)
+	}
+
+	written, err := PutIfAbsent(store.backend, checksum, rd, size)
+	if err != nil {
+		return err
+	}
+	if written {
+		atomic.AddUint64(&store.wBytes, uint64(size))
+	} else {
+		logger.Trace("store", "PutPackfile(%016x): already present", checksum)
+	}
+	return nil
 }
 
 func (store *Store) DeletePackfile(checksum objects.Checksum) error {
@@ -397,5 +479,8 @@ func (store *Store) Close() error {
 		profiler.RecordEvent("store.Close", time.Since(t0))
 		logger.Trace("store", "Close(): %s", time.Since(t0))
 	}()
+	if err := store.Unlock(); err != nil {
+		logger.Warn("could not release repository lock: %s", err)
+	}
 	return store.backend.Close()
 }
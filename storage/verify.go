@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/PlakarKorp/plakar/hashing"
+)
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// VerifyingBackend wraps a Backend and checks that the packfiles it returns
+// hash to the checksum they were requested by. States and packfile blobs are
+// not verified here as their checksums are computed over the decoded data,
+// which only the repository can produce.
+type VerifyingBackend struct {
+	Backend
+}
+
+func NewVerifyingBackend(backend Backend) Backend {
+	return &VerifyingBackend{Backend: backend}
+}
+
+func (backend *VerifyingBackend) Unwrap() Backend {
+	return backend.Backend
+}
+
+func (backend *VerifyingBackend) GetPackfile(checksum [32]byte) (io.Reader, uint64, error) {
+	rd, _, err := backend.Backend.GetPackfile(checksum)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := backend.verify(checksum, data); err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), uint64(len(data)), nil
+}
+
+func (backend *VerifyingBackend) CheckPackfile(checksum [32]byte) (bool, error) {
+	if checker, ok := backend.Backend.(PackfileChecker); ok {
+		return checker.CheckPackfile(checksum)
+	}
+	return false, nil
+}
+
+func (backend *VerifyingBackend) StatPackfile(checksum [32]byte) (ObjectStat, error) {
+	return StatPackfile(backend.Backend, checksum)
+}
+
+func (backend *VerifyingBackend) verify(checksum [32]byte, data []byte) error {
+	return verifyPackfile(backend.Configuration(), checksum, data)
+}
+
+// verifyPackfile checks that data hashes to the checksum of the packfile.
+func verifyPackfile(configuration Configuration, checksum [32]byte, data []byte) error {
+	algorithm := configuration.Hashing.Algorithm
+	hasher := hashing.GetHasher(algorithm)
+	if hasher == nil {
+		return fmt.Errorf("unknown hashing algorithm: %s", algorithm)
+	}
+	hasher.Write(data)
+	if !bytes.Equal(hasher.Sum(nil), checksum[:]) {
+		return fmt.Errorf("packfile %x: %w", checksum, ErrChecksumMismatch)
+	}
+	return nil
+}
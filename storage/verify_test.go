@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+)
+
+// memoryBackend keeps packfiles in memory, the embedded Backend is nil
+// so any other method panics if called.
+type memoryBackend struct {
+	Backend
+	configuration Configuration
+	packfiles     map[[32]byte][]byte
+}
+
+func (backend *memoryBackend) Configuration() Configuration {
+	return backend.configuration
+}
+
+func (backend *memoryBackend) GetPackfile(checksum [32]byte) (io.Reader, uint64, error) {
+	data := backend.packfiles[checksum]
+	return bytes.NewReader(data), uint64(len(data)), nil
+}
+
+func TestVerifyingBackend(t *testing.T) {
+	data := []byte("some packfile content")
+	checksum := sha256.Sum256(data)
+
+	memory := &memoryBackend{
+		configuration: *NewConfiguration(),
+		packfiles:     map[[32]byte][]byte{checksum: data},
+	}
+	backend := NewVerifyingBackend(memory)
+
+	rd, size, err := backend.GetPackfile(checksum)
+	if err != nil {
+		t.Fatalf("GetPackfile: %v", err)
+	}
+	got, _ := io.ReadAll(rd)
+	if !bytes.Equal(got, data) || size != uint64(len(data)) {
+		t.Fatalf("unexpected packfile content %q (%d bytes)", got, size)
+	}
+
+	// flip a byte behind the wrapper's back
+	corrupted := append([]byte{}, data...)
+	corrupted[0] ^= 0xff
+	memory.packfiles[checksum] = corrupted
+
+	if _, _, err := backend.GetPackfile(checksum); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2024 Gilles Chehade <gilles@poolp.org>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrVersionTooNew is returned when writing to a repository created by a
+// newer version of plakar, whose format this one doesn't know.
+var ErrVersionTooNew = errors.New("repository version is newer than supported")
+
+// CompareVersions compares two MAJOR.MINOR.PATCH versions and returns -1,
+// 0 or 1 if a is older than, the same as or newer than b.
+func CompareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va {
+		if va[i] < vb[i] {
+			return -1, nil
+		} else if va[i] > vb[i] {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersion(version string) ([3]int, error) {
+	var ret [3]int
+
+	fields := strings.Split(version, ".")
+	if len(fields) != len(ret) {
+		return ret, fmt.Errorf("invalid version: %q", version)
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return ret, fmt.Errorf("invalid version: %q", version)
+		}
+		ret[i] = n
+	}
+	return ret, nil
+}
+
+// checkVersion returns ErrVersionTooNew if the repository is newer than
+// VERSION, a version that can't be parsed is the caller's business.
+func checkVersion(version string) error {
+	if cmp, err := CompareVersions(version, VERSION); err == nil && cmp > 0 {
+		return ErrVersionTooNew
+	}
+	return nil
+}
+
+// VersionBackend wraps the Backend of a repository newer than VERSION and
+// refuses all writes, this version of plakar could only corrupt it.
+type VersionBackend struct {
+	Backend
+}
+
+func NewVersionBackend(backend Backend) Backend {
+	return &VersionBackend{Backend: backend}
+}
+
+func (backend *VersionBackend) Unwrap() Backend {
+	return backend.Backend
+}
+
+func (backend *VersionBackend) PutState(checksum [32]byte, rd io.Reader, size uint64) error {
+	return ErrVersionTooNew
+}
+
+func (backend *VersionBackend) DeleteState(checksum [32]byte) error {
+	return ErrVersionTooNew
+}
+
+func (backend *VersionBackend) PutPackfile(checksum [32]byte, rd io.Reader, size uint64) error {
+	return ErrVersionTooNew
+}
+
+func (backend *VersionBackend) DeletePackfile(checksum [32]byte) error {
+	return ErrVersionTooNew
+}
+
+func (backend *VersionBackend) CheckPackfile(checksum [32]byte) (bool, error) {
+	if checker, ok := backend.Backend.(PackfileChecker); ok {
+		return checker.CheckPackfile(checksum)
+	}
+	return false, nil
+}
+
+func (backend *VersionBackend) StatPackfile(checksum [32]byte) (ObjectStat, error) {
+	return StatPackfile(backend.Backend, checksum)
+}
+
+// ConfigurationWriter is implemented by backends that can overwrite the
+// configuration of the repository, as migrations do.
+type ConfigurationWriter interface {
+	PutConfiguration(configuration Configuration) error
+}
+
+// Migration upgrades the on-disk structures of a repository from version
+// From to version To.  Migrate may be nil if only the version changes.
+type Migration struct {
+	From    string
+	To      string
+	Migrate func(store *Store) error
+}
+
+// migrations lead from every version plakar still reads to VERSION, the
+// repositories of the current version go through none: that's the
+// identity migration.  A change to the format bumps VERSION and registers
+// the migration from the previous one.
+var migrations []Migration
+
+func RegisterMigration(from, to string, migrate func(store *Store) error) {
+	migrations = append(migrations, Migration{From: from, To: to, Migrate: migrate})
+}
+
+// migrationPath returns the migrations to apply, in order, to bring a
+// repository from version to VERSION.
+func migrationPath(migrations []Migration, version string) ([]Migration, error) {
+	var path []Migration
+	for version != VERSION {
+		cmp, err := CompareVersions(version, VERSION)
+		if err != nil {
+			return nil, err
+		}
+		if cmp > 0 {
+			return nil, ErrVersionTooNew
+		}
+
+		found := false
+		for _, migration := range migrations {
+			if migration.From == version {
+				if cmp, err := CompareVersions(migration.To, version); err != nil {
+					return nil, err
+				} else if cmp <= 0 {
+					return nil, fmt.Errorf("migration from version %s does not upgrade", version)
+				}
+				path = append(path, migration)
+				version = migration.To
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no migration from version %s", version)
+		}
+	}
+	return path, nil
+}
+
+// Migrate upgrades the repository to VERSION and returns the migrations
+// applied, none if it is up to date.  The configuration is rewritten after
+// each one so that an interrupted upgrade resumes where it stopped.
+func (store *Store) Migrate() ([]Migration, error) {
+	return store.migrate(migrations)
+}
+
+func (store *Store) migrate(migrations []Migration) ([]Migration, error) {
+	configuration := store.Configuration()
+
+	path, err := migrationPath(migrations, configuration.Version)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	if err := checkWrite(configuration.Mode); err != nil {
+		return nil, err
+	}
+	writer := store.configurationWriter()
+	if writer == nil {
+		return nil, fmt.Errorf("backend can't update the repository configuration")
+	}
+
+	for i, migration := range path {
+		if migration.Migrate != nil {
+			if err := migration.Migrate(store); err != nil {
+				return path[:i], fmt.Errorf("migration from version %s to %s: %w", migration.From, migration.To, err)
+			}
+		}
+		configuration.Version = migration.To
+		if err := writer.PutConfiguration(configuration); err != nil {
+			return path[:i], err
+		}
+	}
+	return path, nil
+}
+
+// configurationWriter returns the backend as a ConfigurationWriter,
+// looking through the wrappers, or nil if it can't update its
+// configuration.
+func (store *Store) configurationWriter() ConfigurationWriter {
+	writer, _ := unwrap(store.backend).(ConfigurationWriter)
+	return writer
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/PlakarKorp/plakar/context"
+)
+
+// configurableBackend is a lockingBackend whose configuration can be
+// rewritten by migrations.
+type configurableBackend struct {
+	lockingBackend
+	writes int
+}
+
+func (backend *configurableBackend) PutConfiguration(configuration Configuration) error {
+	backend.configuration = configuration
+	backend.writes++
+	return nil
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"0.6.0", "0.6.0", 0},
+		{"0.5.9", "0.6.0", -1},
+		{"0.10.0", "0.9.0", 1},
+		{"1.0.0", "0.99.99", 1},
+	} {
+		cmp, err := CompareVersions(test.a, test.b)
+		if err != nil {
+			t.Fatalf("CompareVersions(%s, %s): %v", test.a, test.b, err)
+		}
+		if cmp != test.expected {
+			t.Errorf("CompareVersions(%s, %s): expected %d, got %d", test.a, test.b, test.expected, cmp)
+		}
+	}
+
+	for _, version := range []string{"", "0.6", "0.6.0.1", "0.x.0", "0.-1.0"} {
+		if _, err := CompareVersions(version, VERSION); err == nil {
+			t.Errorf("expected %q to be rejected", version)
+		}
+	}
+}
+
+func TestMigrateIdentity(t *testing.T) {
+	backend := &configurableBackend{}
+	backend.configuration = *NewConfiguration()
+	store := &Store{backend: backend, context: context.NewContext()}
+
+	applied, err := store.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 || backend.writes != 0 {
+		t.Fatalf("expected an up to date repository to be left untouched, got %d migrations and %d writes",
+			len(applied), backend.writes)
+	}
+	if store.Configuration().Version != VERSION {
+		t.Fatalf("expected version %s, got %s", VERSION, store.Configuration().Version)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	backend := &configurableBackend{}
+	backend.configuration = *NewConfiguration()
+	backend.configuration.Version = "0.4.0"
+	store := &Store{backend: NewVerifyingBackend(backend), context: context.NewContext()}
+
+	var seen []string
+	step := func(store *Store) error {
+		seen = append(seen, store.Configuration().Version)
+		return nil
+	}
+	migrations := []Migration{
+		{From: "0.5.0", To: VERSION, Migrate: step},
+		{From: "0.4.0", To: "0.5.0", Migrate: step},
+	}
+
+	applied, err := store.migrate(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied[0].From != "0.4.0" || applied[1].To != VERSION {
+		t.Fatalf("unexpected migrations applied: %+v", applied)
+	}
+	if len(seen) != 2 || seen[0] != "0.4.0" || seen[1] != "0.5.0" {
+		t.Fatalf("expected the migrations to see versions 0.4.0 then 0.5.0, got %v", seen)
+	}
+	if store.Configuration().Version != VERSION || backend.writes != 2 {
+		t.Fatalf("expected the configuration to be written after each step, got version %s after %d writes",
+			store.Configuration().Version, backend.writes)
+	}
+
+	backend.configuration.Version = "0.3.0"
+	if _, err := store.migrate(migrations); err == nil {
+		t.Fatal("expected a version without migration to be rejected")
+	}
+}
+
+func TestVersionTooNew(t *testing.T) {
+	backend := &configurableBackend{}
+	backend.configuration = *NewConfiguration()
+	backend.configuration.Version = "99.0.0"
+	store := &Store{backend: NewVersionBackend(backend), context: context.NewContext()}
+
+	data := []byte("some content")
+	if err := store.backend.PutState([32]byte{}, bytes.NewReader(data), uint64(len(data))); !errors.Is(err, ErrVersionTooNew) {
+		t.Errorf("expected PutState to fail with ErrVersionTooNew, got %v", err)
+	}
+	if err := store.backend.PutPackfile([32]byte{}, bytes.NewReader(data), uint64(len(data))); !errors.Is(err, ErrVersionTooNew) {
+		t.Errorf("expected PutPackfile to fail with ErrVersionTooNew, got %v", err)
+	}
+	if err := store.backend.DeletePackfile([32]byte{}); !errors.Is(err, ErrVersionTooNew) {
+		t.Errorf("expected DeletePackfile to fail with ErrVersionTooNew, got %v", err)
+	}
+	if err := store.Lock(false); !errors.Is(err, ErrVersionTooNew) {
+		t.Errorf("expected Lock to fail with ErrVersionTooNew, got %v", err)
+	}
+	if _, err := store.Migrate(); !errors.Is(err, ErrVersionTooNew) {
+		t.Errorf("expected Migrate to fail with ErrVersionTooNew, got %v", err)
+	}
+	if backend.lock != nil || backend.writes != 0 {
+		t.Errorf("expected nothing to be written to the repository")
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	backend := &configurableBackend{}
+	wrapped := NewDiskCacheBackend(NewModeBackend(NewVersionBackend(NewVerifyingBackend(backend)), ModeReadWrite), nil)
+	if unwrap(wrapped) != Backend(backend) {
+		t.Fatal("expected the innermost backend")
+	}
+
+	store := &Store{backend: wrapped, context: context.NewContext()}
+	if store.locker() == nil || store.configurationWriter() == nil {
+		t.Fatal("expected the optional interfaces to be found through the wrappers")
+	}
+}